@@ -0,0 +1,50 @@
+// certgen writes a throwaway CA plus server and client certificates for
+// trying the TLS and mTLS modes locally
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/tlsconfig/tlstest"
+)
+
+func main() {
+	out := flag.String("out", "certs", "output directory")
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "comma separated server DNS names and IPs")
+	clientID := flag.String("client-id", "spiffe://mop.local/ns/mop-examples/sa/client", "SPIFFE ID of the client certificate")
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("failed to create output directory: %v", err)
+	}
+
+	ca, err := tlstest.NewCA("mop-examples test CA")
+	if err != nil {
+		log.Fatalf("failed to create CA: %v", err)
+	}
+	server, err := ca.IssueServer(strings.Split(*hosts, ",")...)
+	if err != nil {
+		log.Fatalf("failed to issue server certificate: %v", err)
+	}
+	client, err := ca.IssueClient(*clientID)
+	if err != nil {
+		log.Fatalf("failed to issue client certificate: %v", err)
+	}
+
+	path := func(name string) string { return filepath.Join(*out, name) }
+	if err := ca.WriteCert(path("ca.crt")); err != nil {
+		log.Fatalf("failed to write CA: %v", err)
+	}
+	if err := server.WriteFiles(path("server.crt"), path("server.key")); err != nil {
+		log.Fatalf("failed to write server certificate: %v", err)
+	}
+	if err := client.WriteFiles(path("client.crt"), path("client.key")); err != nil {
+		log.Fatalf("failed to write client certificate: %v", err)
+	}
+
+	log.Printf("wrote ca.crt, server.crt/key and client.crt/key (%s) to %s", *clientID, *out)
+}
@@ -6,11 +6,18 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/scenario"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/telemetry"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/tlsconfig"
 	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
@@ -18,11 +25,53 @@ func main() {
 	address := flag.String("addr", "localhost:9090", "gRPC server address")
 	username := flag.String("username", "testuser", "username for login")
 	password := flag.String("password", "password", "password for login")
-	action := flag.String("action", "full-flow", "action to perform: login, logout, validate, refresh, stream, full-flow")
+	action := flag.String("action", "full-flow", "action to perform: login, logout, validate, refresh, stream, full-flow, health, scenario")
+	service := flag.String("service", "", "service name for the health action (empty for overall server health)")
+	mfaCode := flag.String("mfa-code", "", "TOTP code for the login action when the user has MFA enabled")
+	tlsMode := flag.String("tls-mode", os.Getenv("TLS_MODE"), "transport security: plaintext, tls or mtls")
+	caFile := flag.String("ca-file", os.Getenv("TLS_CA_FILE"), "CA certificate to verify the server (system roots if empty)")
+	certFile := flag.String("cert-file", os.Getenv("TLS_CERT_FILE"), "client certificate for mtls")
+	keyFile := flag.String("key-file", os.Getenv("TLS_KEY_FILE"), "client key for mtls")
+	serverName := flag.String("server-name", os.Getenv("TLS_SERVER_NAME"), "override the server name verified in the certificate")
+	format := flag.String("format", "tap", "scenario report format: tap or junit")
+	output := flag.String("output", "", "write the scenario report to this file instead of stdout")
+	otlpEndpoint := flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/gRPC collector for client traces and metrics (disabled if empty)")
+	otlpInsecure := flag.Bool("otlp-insecure", os.Getenv("OTEL_EXPORTER_OTLP_INSECURE") == "true", "connect to the OTLP collector without TLS")
+	vars := scenarioVars{}
+	flag.Var(vars, "var", "scenario variable as key=value, overriding the scenario's vars (repeatable)")
 	flag.Parse()
 
-	// Connect to gRPC server
-	conn, err := grpc.NewClient(*address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	mode, err := tlsconfig.ParseMode(*tlsMode)
+	if err != nil {
+		log.Fatalf("invalid tls mode: %v", err)
+	}
+	creds, _, err := tlsconfig.ClientCredentials(tlsconfig.Config{
+		Mode:       mode,
+		CertFile:   *certFile,
+		KeyFile:    *keyFile,
+		CAFile:     *caFile,
+		ServerName: *serverName,
+	})
+	if err != nil {
+		log.Fatalf("failed to load TLS configuration: %v", err)
+	}
+
+	shutdownTelemetry, err := telemetry.Setup(context.Background(), telemetry.Config{
+		ServiceName: "grpc-auth-client",
+		Endpoint:    *otlpEndpoint,
+		Insecure:    *otlpInsecure,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up telemetry: %v", err)
+	}
+	defer flushTelemetry(shutdownTelemetry)
+
+	// Connect to gRPC server. The stats handler traces each call, sends the
+	// trace context in metadata and records client RPC metrics.
+	conn, err := grpc.NewClient(*address,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
 	if err != nil {
 		log.Fatalf("failed to connect: %v", err)
 	}
@@ -32,7 +81,7 @@ func main() {
 
 	switch *action {
 	case "login":
-		testLogin(client, *username, *password)
+		testLogin(client, *username, *password, *mfaCode)
 	case "logout":
 		testLogout(client, *username, *password)
 	case "validate":
@@ -40,15 +89,30 @@ func main() {
 	case "refresh":
 		testRefresh(client, *username, *password)
 	case "stream":
-		testStream(client)
+		testStream(client, *username, *password)
 	case "full-flow":
 		testFullFlow(client, *username, *password)
+	case "health":
+		testHealth(healthpb.NewHealthClient(conn), *service)
+	case "scenario":
+		code := runScenarios(conn, flag.Args(), vars, *format, *output)
+		flushTelemetry(shutdownTelemetry)
+		os.Exit(code)
 	default:
 		log.Fatalf("unknown action: %s", *action)
 	}
 }
 
-func testLogin(client authv1.AuthServiceClient, username, password string) {
+// flushTelemetry exports buffered spans and metrics before the client exits
+func flushTelemetry(shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		log.Printf("failed to flush telemetry: %v", err)
+	}
+}
+
+func testLogin(client authv1.AuthServiceClient, username, password, mfaCode string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -62,14 +126,40 @@ func testLogin(client authv1.AuthServiceClient, username, password string) {
 		log.Fatalf("login failed: %v", err)
 	}
 
+	// Second step for users with MFA enabled
+	if resp.MfaRequired {
+		fmt.Printf("MFA required, challenge expires at %s\n", resp.MfaChallengeExpiresAt.AsTime())
+		if mfaCode == "" {
+			fmt.Printf("MFA Challenge: %s\n", resp.MfaChallenge)
+			return
+		}
+
+		resp, err = client.VerifyMFA(ctx, &authv1.VerifyMFARequest{
+			MfaChallenge: resp.MfaChallenge,
+			Code:         mfaCode,
+		})
+		if err != nil {
+			log.Fatalf("mfa verification failed: %v", err)
+		}
+	}
+
 	fmt.Printf("Login successful!\n")
 	fmt.Printf("Token: %s\n", resp.Token)
 	fmt.Printf("User ID: %s\n", resp.User.Id)
-	fmt.Printf("Email: %s\n", resp.User.Email)
+	fmt.Printf("Username: %s\n", resp.User.Username)
+	fmt.Printf("Email: %s\n", displayEmail(resp.User))
 	fmt.Printf("Roles: %v\n", resp.User.Roles)
 	fmt.Printf("Expires At: %s\n", resp.ExpiresAt.AsTime())
 }
 
+// displayEmail shows the verified email of a user, if any
+func displayEmail(user *authv1.User) string {
+	if user.Email == "" {
+		return "unverified"
+	}
+	return user.Email
+}
+
 func testLogout(client authv1.AuthServiceClient, username, password string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -121,7 +211,7 @@ func testValidate(client authv1.AuthServiceClient, username, password string) {
 
 	if validateResp.Valid {
 		fmt.Printf("Token is valid!\n")
-		fmt.Printf("User: %s (%s)\n", validateResp.User.Username, validateResp.User.Email)
+		fmt.Printf("User: %s (%s)\n", validateResp.User.Username, displayEmail(validateResp.User))
 	} else {
 		fmt.Printf("Token is invalid\n")
 	}
@@ -151,17 +241,28 @@ func testRefresh(client authv1.AuthServiceClient, username, password string) {
 	}
 
 	fmt.Printf("New token: %s\n", refreshResp.Token)
+	fmt.Printf("New refresh token: %s\n", refreshResp.RefreshToken)
 	fmt.Printf("Expires At: %s\n", refreshResp.ExpiresAt.AsTime())
 }
 
-func testStream(client authv1.AuthServiceClient) {
+func testStream(client authv1.AuthServiceClient, username, password string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 
-	fmt.Printf("Starting event stream...\n")
+	// StreamEvents requires the admin role
+	loginResp, err := client.Login(ctx, &authv1.LoginRequest{
+		Username: username,
+		Password: password,
+	})
+	if err != nil {
+		log.Fatalf("login failed: %v", err)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+loginResp.Token)
+
+	fmt.Printf("Starting event stream as %s...\n", username)
 
 	stream, err := client.StreamEvents(ctx, &authv1.EventsRequest{
-		EventTypes: []string{"user_activity", "login"},
+		EventTypes: []string{"login", "login_failed", "logout", "token_refreshed", "token_revoked"},
 	})
 	if err != nil {
 		log.Fatalf("stream failed: %v", err)
@@ -179,8 +280,9 @@ func testStream(client authv1.AuthServiceClient) {
 		}
 
 		eventCount++
-		fmt.Printf("Event %d: %s (user=%s, time=%s)\n",
+		fmt.Printf("Event %d: #%d %s (user=%s, time=%s)\n",
 			eventCount,
+			event.Sequence,
 			event.EventType,
 			event.UserId,
 			event.Timestamp.AsTime(),
@@ -188,6 +290,25 @@ func testStream(client authv1.AuthServiceClient) {
 	}
 }
 
+func testHealth(client healthpb.HealthClient, service string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fmt.Printf("Checking health of service=%q\n", service)
+
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{
+		Service: service,
+	})
+	if err != nil {
+		log.Fatalf("health check failed: %v", err)
+	}
+
+	fmt.Printf("Status: %s\n", resp.Status)
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		log.Fatalf("service not serving")
+	}
+}
+
 func testFullFlow(client authv1.AuthServiceClient, username, password string) {
 	ctx := context.Background()
 
@@ -270,3 +391,79 @@ func testFullFlow(client authv1.AuthServiceClient, username, password string) {
 
 	fmt.Println("=== All Tests Passed ===")
 }
+
+// scenarioVars collects repeated -var key=value flags
+type scenarioVars map[string]interface{}
+
+func (v scenarioVars) String() string {
+	return fmt.Sprint(map[string]interface{}(v))
+}
+
+func (v scenarioVars) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	v[key] = val
+	return nil
+}
+
+// runScenarios runs the scenario files and writes a TAP or JUnit report. It
+// returns the process exit code: 0 when every step passed, 1 when any
+// failed and 2 on usage errors.
+func runScenarios(conn *grpc.ClientConn, files []string, vars scenarioVars, format, output string) int {
+	write := scenario.WriteTAP
+	switch format {
+	case "tap":
+	case "junit":
+		write = scenario.WriteJUnit
+	default:
+		log.Printf("unknown report format: %s", format)
+		return 2
+	}
+	if len(files) == 0 {
+		log.Printf("usage: client -action scenario [-format tap|junit] [-var key=value] file.yaml...")
+		return 2
+	}
+
+	var scenarios []*scenario.Scenario
+	for _, file := range files {
+		s, err := scenario.LoadFile(file)
+		if err != nil {
+			log.Printf("invalid scenario: %v", err)
+			return 2
+		}
+		scenarios = append(scenarios, s)
+	}
+
+	runner := scenario.NewRunner(conn)
+	runner.Vars = vars
+
+	var results []*scenario.SuiteResult
+	failed := 0
+	for _, s := range scenarios {
+		result := runner.Run(context.Background(), s)
+		results = append(results, result)
+		failed += result.Failed()
+	}
+
+	out := os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Printf("failed to create report: %v", err)
+			return 2
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := write(out, results); err != nil {
+		log.Printf("failed to write report: %v", err)
+		return 2
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/gateway"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/tlsconfig"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	// Initialize logger
+	logger, err := zap.NewProduction()
+	if err != nil {
+		panic(fmt.Sprintf("failed to initialize logger: %v", err))
+	}
+	defer logger.Sync()
+
+	// Get configuration from environment or use defaults
+	port := getEnv("GATEWAY_PORT", "8080")
+	endpoint := getEnv("GRPC_ENDPOINT", "localhost:9090")
+
+	// Transport security towards the gRPC server; in mtls mode the
+	// gateway presents its own client certificate
+	tlsMode, err := tlsconfig.ParseMode(os.Getenv("TLS_MODE"))
+	if err != nil {
+		logger.Fatal("invalid TLS_MODE", zap.Error(err))
+	}
+	creds, certReloader, err := tlsconfig.ClientCredentials(tlsconfig.Config{
+		Mode:       tlsMode,
+		CertFile:   os.Getenv("TLS_CERT_FILE"),
+		KeyFile:    os.Getenv("TLS_KEY_FILE"),
+		CAFile:     os.Getenv("TLS_CA_FILE"),
+		ServerName: os.Getenv("TLS_SERVER_NAME"),
+	})
+	if err != nil {
+		logger.Fatal("failed to load TLS configuration", zap.Error(err))
+	}
+
+	// Connect to the gRPC server
+	conn, err := grpc.NewClient(endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		logger.Fatal("failed to create gRPC client", zap.String("endpoint", endpoint), zap.Error(err))
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if certReloader != nil {
+		go certReloader.Watch(ctx, getEnvAsDuration("TLS_RELOAD_INTERVAL", 30*time.Second), logger)
+	}
+
+	handler, err := gateway.New(ctx, conn, logger)
+	if err != nil {
+		logger.Fatal("failed to create gateway", zap.Error(err))
+	}
+
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	// Setup graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		logger.Info("HTTP gateway starting", zap.String("port", port), zap.String("grpc_endpoint", endpoint))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("failed to serve", zap.Error(err))
+		}
+	}()
+
+	// Wait for shutdown signal
+	<-sigChan
+	logger.Info("shutting down HTTP gateway")
+
+	// SSE streams never finish on their own, so cancel them before waiting
+	cancel()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("gateway stop timeout, forcing shutdown", zap.Error(err))
+		srv.Close()
+	}
+	logger.Info("gateway stopped")
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
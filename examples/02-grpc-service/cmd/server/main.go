@@ -2,17 +2,38 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
-	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"connectrpc.com/connect"
+	"connectrpc.com/otelconnect"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/audit"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/healthcheck"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/lockout"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/notify"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/oauth"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/rbac"
 	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/service"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/store"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/telemetry"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/tlsconfig"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/webrpc"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/grpcauth"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/admin"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -24,55 +45,342 @@ func main() {
 	}
 	defer logger.Sync()
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "9090"
+	// OpenTelemetry traces and RPC metrics; nothing is exported unless
+	// OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTelemetry, err := telemetry.Setup(context.Background(), telemetry.Config{
+		ServiceName: "grpc-auth-service",
+		Endpoint:    os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		Insecure:    getEnvAsBool("OTEL_EXPORTER_OTLP_INSECURE", false),
+	})
+	if err != nil {
+		logger.Fatal("failed to set up telemetry", zap.Error(err))
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTelemetry(ctx); err != nil {
+			logger.Warn("failed to flush telemetry", zap.Error(err))
+		}
+	}()
+
+	// Get configuration from environment or use defaults
+	port := getEnv("PORT", "9090")
+	adminPort := getEnv("ADMIN_PORT", "9191")
+	healthInterval := getEnvAsDuration("HEALTH_CHECK_INTERVAL", 10*time.Second)
+
+	policyFile := os.Getenv("RBAC_POLICY_FILE")
+	policyReloadInterval := getEnvAsDuration("RBAC_POLICY_RELOAD_INTERVAL", 5*time.Second)
+
+	// Load the RBAC policy; without a file the built-in default is used
+	policy := rbac.DefaultPolicy()
+	if policyFile != "" {
+		policy, err = rbac.LoadPolicyFile(policyFile)
+		if err != nil {
+			logger.Fatal("failed to load RBAC policy", zap.String("path", policyFile), zap.Error(err))
+		}
+	}
+	authorizer := rbac.NewAuthorizer(policy)
+
+	cfg := service.DefaultConfig()
+	cfg.Authorizer = authorizer
+
+	// Brute-force protection thresholds; relax them or list the load
+	// generator's network in LOCKOUT_TRUSTED_NETWORKS for load tests
+	cfg.Lockout.Enabled = getEnvAsBool("LOCKOUT_ENABLED", cfg.Lockout.Enabled)
+	cfg.Lockout.FreeFailures = getEnvAsInt("LOCKOUT_FREE_FAILURES", cfg.Lockout.FreeFailures)
+	cfg.Lockout.BaseDelay = getEnvAsDuration("LOCKOUT_BASE_DELAY", cfg.Lockout.BaseDelay)
+	cfg.Lockout.MaxDelay = getEnvAsDuration("LOCKOUT_MAX_DELAY", cfg.Lockout.MaxDelay)
+	cfg.Lockout.MaxUserFailures = getEnvAsInt("LOCKOUT_MAX_USER_FAILURES", cfg.Lockout.MaxUserFailures)
+	cfg.Lockout.MaxIPFailures = getEnvAsInt("LOCKOUT_MAX_IP_FAILURES", cfg.Lockout.MaxIPFailures)
+	cfg.Lockout.LockoutDuration = getEnvAsDuration("LOCKOUT_DURATION", cfg.Lockout.LockoutDuration)
+	if trusted := os.Getenv("LOCKOUT_TRUSTED_NETWORKS"); trusted != "" {
+		cfg.Lockout.TrustedNetworks, err = lockout.ParseNetworks(strings.Split(trusted, ","))
+		if err != nil {
+			logger.Fatal("invalid LOCKOUT_TRUSTED_NETWORKS", zap.Error(err))
+		}
+	}
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		cfg.TrustedProxies, err = lockout.ParseNetworks(strings.Split(proxies, ","))
+		if err != nil {
+			logger.Fatal("invalid TRUSTED_PROXIES", zap.Error(err))
+		}
+	}
+
+	// Token, session and user storage; use redis when running more than one replica
+	var revocations *store.RedisTokenStore
+	switch backend := getEnv("TOKEN_STORE", "memory"); backend {
+	case "memory":
+	case "redis":
+		client, err := store.NewRedisClient(context.Background(), store.RedisConfig{
+			Addr:     getEnv("REDIS_ADDR", "localhost:6379"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+			DB:       getEnvAsInt("REDIS_DB", 0),
+		})
+		if err != nil {
+			logger.Fatal("failed to connect to token store", zap.Error(err))
+		}
+		defer client.Close()
+
+		revocations = store.NewRedisTokenStore(client, getEnvAsDuration("TOKEN_CACHE_TTL", 5*time.Second))
+		cfg.Tokens = revocations
+		cfg.Sessions = store.NewRedisSessionStore(client)
+		cfg.Users = store.NewRedisUserStore(client)
+	default:
+		logger.Fatal("invalid TOKEN_STORE", zap.String("value", backend))
 	}
 
-	// Create listener
+	// Email verification codes are logged unless an SMTP relay is configured
+	cfg.Verification.CodeTTL = getEnvAsDuration("EMAIL_VERIFICATION_TTL", cfg.Verification.CodeTTL)
+	cfg.Verification.ResendInterval = getEnvAsDuration("EMAIL_VERIFICATION_RESEND_INTERVAL", cfg.Verification.ResendInterval)
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		cfg.Notifier, err = notify.NewSMTPNotifier(notify.SMTPConfig{
+			Addr:     smtpAddr,
+			From:     os.Getenv("SMTP_FROM"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		})
+		if err != nil {
+			logger.Fatal("invalid SMTP configuration", zap.Error(err))
+		}
+	}
+
+	// Security audit trail: recent records stay queryable with
+	// ListAuditEvents, and AUDIT_LOG_FILE keeps all of them as JSONL
+	var auditSinks []audit.Sink
+	if auditFile := os.Getenv("AUDIT_LOG_FILE"); auditFile != "" {
+		sink, err := audit.NewFileSink(auditFile,
+			int64(getEnvAsInt("AUDIT_LOG_MAX_SIZE_MB", 100))<<20,
+			getEnvAsInt("AUDIT_LOG_MAX_BACKUPS", 5),
+		)
+		if err != nil {
+			logger.Fatal("failed to open audit log", zap.String("path", auditFile), zap.Error(err))
+		}
+		defer sink.Close()
+		auditSinks = append(auditSinks, sink)
+	}
+	cfg.Audit = audit.NewLog(getEnvAsInt("AUDIT_BUFFER_SIZE", audit.DefaultBufferSize), logger, auditSinks...)
+
+	// Transport security for the main port. The admin port stays plaintext
+	// so kubelet gRPC probes keep working.
+	tlsMode, err := tlsconfig.ParseMode(os.Getenv("TLS_MODE"))
+	if err != nil {
+		logger.Fatal("invalid TLS_MODE", zap.Error(err))
+	}
+	certReloader, err := tlsconfig.ServerReloader(tlsconfig.Config{
+		Mode:     tlsMode,
+		CertFile: os.Getenv("TLS_CERT_FILE"),
+		KeyFile:  os.Getenv("TLS_KEY_FILE"),
+		CAFile:   os.Getenv("TLS_CA_FILE"),
+	})
+	if err != nil {
+		logger.Fatal("failed to load TLS configuration", zap.Error(err))
+	}
+	certReloadInterval := getEnvAsDuration("TLS_RELOAD_INTERVAL", 30*time.Second)
+
+	// Create listeners
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
 		logger.Fatal("failed to listen", zap.Error(err))
 	}
+	adminLis, err := net.Listen("tcp", fmt.Sprintf(":%s", adminPort))
+	if err != nil {
+		logger.Fatal("failed to listen on admin port", zap.Error(err))
+	}
+
+	authService := service.NewAuthServiceWithConfig(logger, cfg)
+
+	// Method policies come from the (auth.v1.access_policy) options in
+	// auth.proto; health and reflection stay open for probes and tooling
+	authConfig := grpcauth.Config{
+		Validator:     authService,
+		PeerValidator: authService,
+		Policies: grpcauth.PoliciesFromService(
+			authv1.File_proto_auth_v1_auth_proto.Services().ByName("AuthService"),
+		).Merge(grpcauth.Policies{
+			"/grpc.health.v1.Health/":                    grpcauth.Public(),
+			"/grpc.reflection.v1.ServerReflection/":      grpcauth.Public(),
+			"/grpc.reflection.v1alpha.ServerReflection/": grpcauth.Public(),
+		}),
+	}
 
-	// Create gRPC server
+	// The same chains run for native gRPC and for Connect and gRPC-Web calls
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		unaryLoggingInterceptor(logger),
+		grpcauth.UnaryServerInterceptor(authConfig),
+		telemetry.UnaryServerInterceptor(),
+	}
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		streamLoggingInterceptor(logger),
+		grpcauth.StreamServerInterceptor(authConfig),
+		telemetry.StreamServerInterceptor(),
+	}
+
+	// Create gRPC server. TLS terminates in the HTTP server in front of it.
+	// The stats handler starts a span per RPC, continuing the caller's trace
+	// from the traceparent metadata, and records RPC metrics.
 	grpcServer := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(
-			unaryLoggingInterceptor(logger),
-		),
-		grpc.ChainStreamInterceptor(
-			streamLoggingInterceptor(logger),
-		),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
 	)
 
 	// Register auth service
-	authService := service.NewAuthService(logger)
 	authv1.RegisterAuthServiceServer(grpcServer, authService)
 
+	// Register standard health checking, driven by the store dependency checks
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	monitor := healthcheck.NewMonitor(healthServer, logger, healthInterval)
+	authServiceName := authv1.AuthService_ServiceDesc.ServiceName
+	monitor.AddCheck(authServiceName, "token_store", authService.CheckTokenStore)
+	monitor.AddCheck(authServiceName, "session_store", authService.CheckSessionStore)
+	monitor.AddCheck(authServiceName, "user_store", authService.CheckUserStore)
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	monitor.CheckNow(backgroundCtx)
+	go monitor.Run(backgroundCtx)
+
+	// Hot reload the RBAC policy when the file changes
+	if policyFile != "" {
+		go authorizer.Watch(backgroundCtx, policyFile, policyReloadInterval, logger)
+	}
+
+	// Pick up rotated certificates and CAs without a restart
+	if certReloader != nil {
+		go certReloader.Watch(backgroundCtx, certReloadInterval, logger)
+	}
+
+	// Drop tokens revoked on other replicas from the local cache
+	if revocations != nil {
+		go revocations.WatchRevocations(backgroundCtx, logger)
+	}
+
 	// Enable reflection for tools like grpcurl
 	reflection.Register(grpcServer)
 
+	// Native gRPC, Connect and gRPC-Web share the main port, told apart by
+	// content type; plaintext mode accepts HTTP/2 without TLS (h2c)
+	var allowedOrigins []string
+	if origins := os.Getenv("CORS_ALLOWED_ORIGINS"); origins != "" {
+		allowedOrigins = strings.Split(origins, ",")
+	}
+	// Connect and gRPC-Web calls bypass the stats handler, so they are
+	// traced and measured by a Connect interceptor with the same metrics.
+	// Peer attributes are left off to keep metric cardinality bounded.
+	connectTelemetry, err := otelconnect.NewInterceptor(
+		otelconnect.WithTrustRemote(),
+		otelconnect.WithoutServerPeerAttributes(),
+	)
+	if err != nil {
+		logger.Fatal("failed to create Connect telemetry interceptor", zap.Error(err))
+	}
+	mainServer := &http.Server{
+		Handler: webrpc.NewHandler(grpcServer, authService, webrpc.Config{
+			UnaryInterceptors:  unaryInterceptors,
+			StreamInterceptors: streamInterceptors,
+			HandlerOptions:     []connect.HandlerOption{connect.WithInterceptors(connectTelemetry)},
+			AllowedOrigins:     allowedOrigins,
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if certReloader != nil {
+		mainServer.TLSConfig = certReloader.HTTPServerTLSConfig()
+	} else {
+		mainServer.Protocols = new(http.Protocols)
+		mainServer.Protocols.SetHTTP1(true)
+		mainServer.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	// OAuth2 introspection, revocation and client-credentials endpoints for
+	// services that do not speak auth.v1
+	var oauthServer *http.Server
+	if clientsFile := os.Getenv("OAUTH_CLIENTS_FILE"); clientsFile != "" {
+		clients, err := oauth.LoadClientsFile(clientsFile)
+		if err != nil {
+			logger.Fatal("failed to load OAuth2 clients", zap.String("path", clientsFile), zap.Error(err))
+		}
+		oauthServer = &http.Server{
+			Addr:              ":" + getEnv("OAUTH_PORT", "9092"),
+			Handler:           oauth.NewHandler(clients, authService, logger),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		if certReloader != nil {
+			oauthServer.TLSConfig = certReloader.HTTPServerTLSConfig()
+		}
+		logger.Info("OAuth2 clients loaded", zap.Int("clients", clients.Len()))
+	}
+
+	// Admin server exposes channelz and health on a separate port
+	adminServer := grpc.NewServer()
+	cleanupAdmin, err := admin.Register(adminServer)
+	if err != nil {
+		logger.Fatal("failed to register admin services", zap.Error(err))
+	}
+	defer cleanupAdmin()
+	healthpb.RegisterHealthServer(adminServer, healthServer)
+	reflection.Register(adminServer)
+
 	// Setup graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	// Start server in goroutine
+	// Start servers in goroutines
 	go func() {
-		logger.Info("gRPC server starting", zap.String("port", port))
-		if err := grpcServer.Serve(lis); err != nil {
+		logger.Info("gRPC server starting", zap.String("port", port), zap.String("tls_mode", string(tlsMode)))
+		var err error
+		if mainServer.TLSConfig != nil {
+			err = mainServer.ServeTLS(lis, "", "")
+		} else {
+			err = mainServer.Serve(lis)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Fatal("failed to serve", zap.Error(err))
 		}
 	}()
+	go func() {
+		logger.Info("admin server starting", zap.String("port", adminPort))
+		if err := adminServer.Serve(adminLis); err != nil {
+			logger.Fatal("failed to serve admin", zap.Error(err))
+		}
+	}()
+	if oauthServer != nil {
+		go func() {
+			logger.Info("OAuth2 server starting", zap.String("addr", oauthServer.Addr))
+			var err error
+			if oauthServer.TLSConfig != nil {
+				err = oauthServer.ListenAndServeTLS("", "")
+			} else {
+				err = oauthServer.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatal("failed to serve OAuth2", zap.Error(err))
+			}
+		}()
+	}
 
 	// Wait for shutdown signal
 	<-sigChan
 	logger.Info("shutting down gRPC server")
 
+	// Report NOT_SERVING first so load balancers and probes drain traffic
+	stopBackground()
+	healthServer.Shutdown()
+
 	// Graceful shutdown
 	stopped := make(chan struct{})
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
 	go func() {
-		grpcServer.GracefulStop()
+		// The HTTP server drains the main port; grpc-go cannot drain
+		// ServeHTTP transports itself, so it is stopped once they are done
+		mainServer.Shutdown(shutdownCtx)
+		grpcServer.Stop()
+		adminServer.GracefulStop()
+		if oauthServer != nil {
+			oauthServer.Shutdown(shutdownCtx)
+		}
 		close(stopped)
 	}()
 
@@ -80,10 +388,49 @@ func main() {
 	select {
 	case <-stopped:
 		logger.Info("server stopped gracefully")
-	case <-time.After(10 * time.Second):
+	case <-shutdownCtx.Done():
 		logger.Warn("server stop timeout, forcing shutdown")
+		mainServer.Close()
 		grpcServer.Stop()
+		adminServer.Stop()
+		if oauthServer != nil {
+			oauthServer.Close()
+		}
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvAsInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
 	}
+	return defaultValue
 }
 
 // unaryLoggingInterceptor logs unary RPC calls
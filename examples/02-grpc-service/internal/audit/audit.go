@@ -0,0 +1,175 @@
+// Package audit records security-relevant authentication events as
+// structured records. Every record is written to the configured sinks, such
+// as a rotating JSONL file for log shipping, and the most recent records are
+// kept in memory so administrators can query them over the API.
+package audit
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Actions recorded by AuthService
+const (
+	ActionLogin         = "login"
+	ActionLogout        = "logout"
+	ActionTokenRefresh  = "token_refresh"
+	ActionTokenRevoke   = "token_revoke"
+	ActionTokenValidate = "token_validate"
+	ActionEmailVerify   = "email_verify"
+)
+
+// Outcome classifies whether the action succeeded
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+// Reason codes explaining an outcome
+const (
+	ReasonMissingCredentials = "missing_credentials"
+	ReasonInvalidCredentials = "invalid_credentials"
+	ReasonInvalidMFACode     = "invalid_mfa_code"
+	ReasonInvalidChallenge   = "invalid_mfa_challenge"
+	ReasonLockedOut          = "locked_out"
+	ReasonInvalidToken       = "invalid_token"
+	ReasonNotRefreshToken    = "not_refresh_token"
+	ReasonSessionNotFound    = "session_not_found"
+	ReasonTokenNotOwned      = "token_not_owned"
+	ReasonPassword           = "password"
+	ReasonMFACode            = "mfa_code"
+	ReasonRecoveryCode       = "recovery_code"
+	ReasonInvalidUsername    = "invalid_username"
+	ReasonConfusableUsername = "confusable_username"
+	ReasonInvalidCode        = "invalid_verification_code"
+	ReasonEmailTaken         = "email_taken"
+)
+
+// DefaultBufferSize is the number of records kept in memory by default
+const DefaultBufferSize = 10000
+
+// Record is one audit event
+type Record struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Outcome Outcome   `json:"outcome"`
+	Reason  string    `json:"reason,omitempty"`
+	UserID  string    `json:"user_id,omitempty"`
+	// Username is the account the action targeted, which may not exist for
+	// failed logins
+	Username string `json:"username,omitempty"`
+	// ClientID is set for actions by OAuth2 clients
+	ClientID      string `json:"client_id,omitempty"`
+	ClientIP      string `json:"client_ip,omitempty"`
+	UserAgent     string `json:"user_agent,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// Sink persists records, e.g. to a file
+type Sink interface {
+	Write(Record) error
+}
+
+// Filter selects records in Query. Zero fields match everything.
+type Filter struct {
+	// Since is inclusive and Until exclusive
+	Since time.Time
+	Until time.Time
+	// UserID and Username must both match when set
+	UserID   string
+	Username string
+	// Limit caps the number of records returned, keeping the newest
+	Limit int
+}
+
+func (f Filter) matches(r *Record) bool {
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.Time.Before(f.Until) {
+		return false
+	}
+	if f.UserID != "" && r.UserID != f.UserID {
+		return false
+	}
+	return f.Username == "" || r.Username == f.Username
+}
+
+// Log writes records to its sinks and retains the most recent ones in a
+// fixed-size ring for queries
+type Log struct {
+	mu    sync.Mutex
+	ring  []Record
+	next  int
+	full  bool
+	sinks []Sink
+
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// NewLog creates a log that keeps the last capacity records in memory.
+// Sink failures are logged and never fail the audited request.
+func NewLog(capacity int, logger *zap.Logger, sinks ...Sink) *Log {
+	if capacity <= 0 {
+		capacity = DefaultBufferSize
+	}
+	return &Log{
+		ring:   make([]Record, capacity),
+		sinks:  sinks,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Record stores r, stamping it with the current time when unset
+func (l *Log) Record(r Record) {
+	l.mu.Lock()
+	// Stamped under the lock so the ring stays in time order
+	if r.Time.IsZero() {
+		r.Time = l.now().UTC()
+	}
+	l.ring[l.next] = r
+	l.next = (l.next + 1) % len(l.ring)
+	if l.next == 0 {
+		l.full = true
+	}
+	// Sinks are written under the lock so files see records in ring order
+	for _, sink := range l.sinks {
+		if err := sink.Write(r); err != nil {
+			l.logger.Error("failed to write audit record",
+				zap.String("action", r.Action),
+				zap.Error(err),
+			)
+		}
+	}
+	l.mu.Unlock()
+}
+
+// Query returns the retained records matching f, newest first
+func (l *Log) Query(f Filter) []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.ring)
+	}
+
+	var out []Record
+	for i := 1; i <= n; i++ {
+		r := &l.ring[(l.next-i+len(l.ring))%len(l.ring)]
+		if !f.matches(r) {
+			continue
+		}
+		out = append(out, *r)
+		if f.Limit > 0 && len(out) == f.Limit {
+			break
+		}
+	}
+	return out
+}
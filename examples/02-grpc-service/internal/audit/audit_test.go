@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestLog_Query(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	log := NewLog(4, zap.NewNop())
+
+	// Six records into a ring of four: the first two fall out
+	for i, user := range []string{"u0", "u1", "alice", "bob", "alice", "bob"} {
+		log.Record(Record{
+			Time:    base.Add(time.Duration(i) * time.Minute),
+			Action:  ActionLogin,
+			Outcome: OutcomeSuccess,
+			UserID:  user,
+		})
+	}
+
+	minutes := func(records []Record) []int {
+		out := []int{}
+		for _, r := range records {
+			out = append(out, int(r.Time.Sub(base)/time.Minute))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []int
+	}{
+		{name: "all retained, newest first", filter: Filter{}, want: []int{5, 4, 3, 2}},
+		{name: "by user", filter: Filter{UserID: "alice"}, want: []int{4, 2}},
+		{name: "evicted user", filter: Filter{UserID: "u0"}, want: []int{}},
+		{name: "time range", filter: Filter{Since: base.Add(3 * time.Minute), Until: base.Add(5 * time.Minute)}, want: []int{4, 3}},
+		{name: "limit keeps newest", filter: Filter{Limit: 3}, want: []int{5, 4, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minutes(log.Query(tt.filter)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected records at minutes %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+type failingSink struct{ writes int }
+
+func (s *failingSink) Write(Record) error {
+	s.writes++
+	return os.ErrPermission
+}
+
+func TestLog_SinkFailureKeepsRecord(t *testing.T) {
+	sink := &failingSink{}
+	log := NewLog(10, zap.NewNop(), sink)
+	log.Record(Record{Action: ActionLogout, Outcome: OutcomeSuccess})
+
+	records := log.Query(Filter{})
+	if len(records) != 1 || sink.writes != 1 {
+		t.Fatalf("expected the record to be kept despite the sink error, got %v", records)
+	}
+	if records[0].Time.IsZero() {
+		t.Error("expected the record to be timestamped")
+	}
+}
+
+func TestFileSink_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	// Each line is about 85 bytes, so each file holds two records
+	sink, err := NewFileSink(path, 200, 2)
+	if err != nil {
+		t.Fatalf("failed to open sink: %v", err)
+	}
+	for _, user := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		if err := sink.Write(Record{Action: ActionLogin, Outcome: OutcomeFailure, Username: user}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	want := map[string][]string{
+		path:        {"g"},
+		path + ".1": {"e", "f"},
+		path + ".2": {"c", "d"},
+	}
+	for file, users := range want {
+		if got := readUsernames(t, file); !reflect.DeepEqual(got, users) {
+			t.Errorf("%s: expected %v, got %v", filepath.Base(file), users, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, stat .3: %v", err)
+	}
+
+	if err := sink.Write(Record{}); err == nil {
+		t.Error("expected write after close to fail")
+	}
+}
+
+func readUsernames(t *testing.T, path string) []string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var users []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		users = append(users, r.Username)
+	}
+	return users
+}
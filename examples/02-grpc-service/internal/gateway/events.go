@@ -0,0 +1,167 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EventsPath is the SSE endpoint for StreamEvents
+const EventsPath = "/v1/events"
+
+// keepAliveInterval is how often a comment line is sent on idle streams so
+// proxies don't close the connection
+const keepAliveInterval = 15 * time.Second
+
+// eventStream serves StreamEvents as Server-Sent Events.
+//
+// Query parameters event_type and user_id may be repeated to filter events.
+// The stream resumes after the Last-Event-ID header, which browsers send
+// automatically on reconnect, or the resume_after_sequence parameter.
+type eventStream struct {
+	client authv1.AuthServiceClient
+	mux    *runtime.ServeMux
+	logger *zap.Logger
+}
+
+func (h *eventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, marshaler := runtime.MarshalerForRequest(h.mux, r)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		runtime.HTTPError(r.Context(), h.mux, marshaler, w, r,
+			status.Error(codes.Unimplemented, "streaming not supported"))
+		return
+	}
+
+	req, err := eventsRequest(r)
+	if err != nil {
+		runtime.HTTPError(r.Context(), h.mux, marshaler, w, r, err)
+		return
+	}
+
+	ctx, err := runtime.AnnotateContext(r.Context(), h.mux, r,
+		"/auth.v1.AuthService/StreamEvents", runtime.WithHTTPPathPattern(EventsPath))
+	if err != nil {
+		runtime.HTTPError(r.Context(), h.mux, marshaler, w, r, err)
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := h.client.StreamEvents(ctx, req)
+	if err != nil {
+		runtime.HTTPError(ctx, h.mux, marshaler, w, r, err)
+		return
+	}
+
+	// Wait for the server to accept the subscription so auth and resume
+	// errors become proper HTTP statuses instead of a broken stream
+	md, err := stream.Header()
+	if err == nil && md == nil {
+		_, err = stream.Recv()
+	}
+	if err != nil {
+		runtime.HTTPError(ctx, h.mux, marshaler, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events := make(chan *authv1.Event)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	sent := 0
+	for {
+		select {
+		case <-ctx.Done():
+			h.logger.Debug("sse client disconnected", zap.Int("events_sent", sent))
+			return
+		case err := <-recvErr:
+			if !errors.Is(err, io.EOF) {
+				h.logger.Warn("sse stream ended", zap.Error(err))
+				writeStreamError(w, marshaler, err)
+				flusher.Flush()
+			}
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			data, err := marshaler.Marshal(event)
+			if err != nil {
+				h.logger.Error("failed to marshal event", zap.Error(err))
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.EventType, data)
+			flusher.Flush()
+			sent++
+		}
+	}
+}
+
+// eventsRequest builds the StreamEvents request from query parameters and
+// the Last-Event-ID header
+func eventsRequest(r *http.Request) (*authv1.EventsRequest, error) {
+	query := r.URL.Query()
+	req := &authv1.EventsRequest{
+		EventTypes: query["event_type"],
+		UserIds:    query["user_id"],
+	}
+
+	resume := r.Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = query.Get("resume_after_sequence")
+	}
+	if resume != "" {
+		seq, err := strconv.ParseUint(resume, 10, 64)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid resume sequence %q", resume)
+		}
+		req.ResumeAfterSequence = &seq
+	}
+
+	return req, nil
+}
+
+// writeStreamError reports a mid-stream failure as an SSE error event,
+// since the HTTP status has already been sent
+func writeStreamError(w io.Writer, marshaler runtime.Marshaler, err error) {
+	data, merr := marshaler.Marshal(status.Convert(err).Proto())
+	if merr != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+}
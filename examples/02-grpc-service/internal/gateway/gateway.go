@@ -0,0 +1,81 @@
+// Package gateway serves AuthService over HTTP/JSON. Unary RPCs are
+// transcoded from the google.api.http annotations in auth.proto and
+// StreamEvents is exposed as Server-Sent Events.
+package gateway
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// forwardedHeaders are passed through to gRPC metadata as is, in addition
+// to Authorization and X-Forwarded-For which grpc-gateway always forwards
+var forwardedHeaders = map[string]bool{
+	"traceparent":  true,
+	"tracestate":   true,
+	"baggage":      true,
+	"x-request-id": true,
+}
+
+// New returns an HTTP handler that proxies REST and SSE requests to the
+// AuthService reachable through conn
+func New(ctx context.Context, conn *grpc.ClientConn, logger *zap.Logger) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(headerMatcher),
+		runtime.WithErrorHandler(errorHandler),
+		runtime.WithHealthzEndpoint(healthpb.NewHealthClient(conn)),
+	)
+
+	client := authv1.NewAuthServiceClient(conn)
+	if err := authv1.RegisterAuthServiceHandlerClient(ctx, mux, client); err != nil {
+		return nil, err
+	}
+
+	events := &eventStream{
+		client: client,
+		mux:    mux,
+		logger: logger,
+	}
+
+	root := http.NewServeMux()
+	root.Handle("GET "+EventsPath, events)
+	root.Handle("/", mux)
+
+	return root, nil
+}
+
+// headerMatcher forwards tracing headers under their own names and falls
+// back to the grpc-gateway defaults for everything else
+func headerMatcher(key string) (string, bool) {
+	lower := strings.ToLower(key)
+	if forwardedHeaders[lower] {
+		return lower, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// errorHandler adds a Retry-After header when the status carries RetryInfo,
+// e.g. during login backoff, then writes the standard error body
+func errorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if st, ok := status.FromError(err); ok {
+		for _, detail := range st.Details() {
+			if info, ok := detail.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+				seconds := int(math.Ceil(info.RetryDelay.AsDuration().Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			}
+		}
+	}
+
+	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+}
@@ -0,0 +1,319 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// stubAuthService records incoming metadata and returns canned responses
+type stubAuthService struct {
+	authv1.UnimplementedAuthServiceServer
+	mu       sync.Mutex
+	metadata metadata.MD
+	events   []*authv1.Event
+}
+
+func (s *stubAuthService) record(ctx context.Context) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.mu.Lock()
+	s.metadata = md
+	s.mu.Unlock()
+}
+
+func (s *stubAuthService) lastMetadata() metadata.MD {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.metadata
+}
+
+func (s *stubAuthService) Login(ctx context.Context, req *authv1.LoginRequest) (*authv1.LoginResponse, error) {
+	s.record(ctx)
+	switch req.Password {
+	case "password":
+		return &authv1.LoginResponse{Token: "access-token", RefreshToken: "refresh-token"}, nil
+	case "throttled":
+		st, _ := status.New(codes.ResourceExhausted, "too many failed login attempts").WithDetails(
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)},
+		)
+		return nil, st.Err()
+	default:
+		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+}
+
+func (s *stubAuthService) ValidateToken(ctx context.Context, req *authv1.ValidateRequest) (*authv1.ValidateResponse, error) {
+	s.record(ctx)
+	return &authv1.ValidateResponse{Valid: req.Token == "access-token"}, nil
+}
+
+func (s *stubAuthService) StreamEvents(req *authv1.EventsRequest, stream authv1.AuthService_StreamEventsServer) error {
+	s.record(stream.Context())
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	if len(md.Get("authorization")) == 0 {
+		return status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	if req.ResumeAfterSequence != nil && *req.ResumeAfterSequence == 0 {
+		return status.Error(codes.OutOfRange, "resume sequence no longer retained")
+	}
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for _, event := range s.events {
+		if req.ResumeAfterSequence != nil && event.Sequence <= *req.ResumeAfterSequence {
+			continue
+		}
+		if len(req.EventTypes) > 0 && req.EventTypes[0] != event.EventType {
+			continue
+		}
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func newTestGateway(t *testing.T, stub *stubAuthService) *httptest.Server {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	authv1.RegisterAuthServiceServer(grpcServer, stub)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	handler, err := New(context.Background(), conn, zap.NewNop())
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGateway_UnaryStatusMapping(t *testing.T) {
+	srv := newTestGateway(t, &stubAuthService{})
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+		retryAfter string
+	}{
+		{
+			name:       "login succeeds",
+			path:       "/v1/auth/login",
+			body:       `{"username":"alice","password":"password"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `"token":"access-token"`,
+		},
+		{
+			name:       "bad credentials",
+			path:       "/v1/auth/login",
+			body:       `{"username":"alice","password":"wrong"}`,
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `"message":"invalid credentials"`,
+		},
+		{
+			name:       "backoff sets Retry-After",
+			path:       "/v1/auth/login",
+			body:       `{"username":"alice","password":"throttled"}`,
+			wantStatus: http.StatusTooManyRequests,
+			retryAfter: "2",
+		},
+		{
+			name:       "malformed body",
+			path:       "/v1/auth/validate",
+			body:       `{"token":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "validate",
+			path:       "/v1/auth/validate",
+			body:       `{"token":"access-token"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `"valid":true`,
+		},
+		{
+			name:       "not transcoded",
+			path:       "/v1/auth/unlock",
+			body:       `{}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(srv.URL+tt.path, "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Retry-After"); got != tt.retryAfter {
+				t.Errorf("expected Retry-After %q, got %q", tt.retryAfter, got)
+			}
+			if tt.wantBody != "" {
+				var body strings.Builder
+				bufio.NewReader(resp.Body).WriteTo(&body)
+				if !strings.Contains(body.String(), tt.wantBody) {
+					t.Errorf("expected body to contain %s, got %s", tt.wantBody, body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestGateway_ForwardsHeaders(t *testing.T) {
+	stub := &stubAuthService{}
+	srv := newTestGateway(t, stub)
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/auth/validate", strings.NewReader(`{"token":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer access-token")
+	req.Header.Set("Traceparent", traceparent)
+	req.Header.Set("X-Request-Id", "req-1")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	md := stub.lastMetadata()
+	expected := map[string]string{
+		"authorization": "Bearer access-token",
+		"traceparent":   traceparent,
+		"x-request-id":  "req-1",
+	}
+	for key, want := range expected {
+		if got := md.Get(key); len(got) != 1 || got[0] != want {
+			t.Errorf("metadata %s: expected %q, got %v", key, want, got)
+		}
+	}
+}
+
+func TestGateway_EventsSSE(t *testing.T) {
+	stub := &stubAuthService{
+		events: []*authv1.Event{
+			{EventType: "login", UserId: "u1", Sequence: 1},
+			{EventType: "logout", UserId: "u1", Sequence: 2},
+			{EventType: "login", UserId: "u2", Sequence: 3},
+		},
+	}
+	srv := newTestGateway(t, stub)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+EventsPath+"?event_type=login", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	req.Header.Set("Last-Event-ID", "1")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", ct)
+	}
+
+	// Only the login event after sequence 1 should be delivered
+	scanner := bufio.NewScanner(resp.Body)
+	var lines []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 3 || lines[0] != "id: 3" || lines[1] != "event: login" {
+		t.Fatalf("unexpected event frame: %q", lines)
+	}
+	var event struct {
+		UserID   string `json:"userId"`
+		Sequence string `json:"sequence"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &event); err != nil {
+		t.Fatalf("invalid event data: %v", err)
+	}
+	if event.UserID != "u2" || event.Sequence != "3" {
+		t.Errorf("unexpected event payload: %+v", event)
+	}
+}
+
+func TestGateway_EventsErrors(t *testing.T) {
+	srv := newTestGateway(t, &stubAuthService{})
+
+	tests := []struct {
+		name       string
+		query      string
+		auth       bool
+		wantStatus int
+	}{
+		{name: "missing token", wantStatus: http.StatusUnauthorized},
+		{name: "resume too old", query: "?resume_after_sequence=0", auth: true, wantStatus: http.StatusBadRequest},
+		{name: "invalid resume", query: "?resume_after_sequence=abc", auth: true, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+EventsPath+tt.query, nil)
+			if tt.auth {
+				req.Header.Set("Authorization", "Bearer admin-token")
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+}
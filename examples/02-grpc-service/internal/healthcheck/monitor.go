@@ -0,0 +1,113 @@
+package healthcheck
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Check reports whether a dependency is usable
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Monitor runs dependency checks per gRPC service and publishes the result
+// to a health server. The overall ("") status is SERVING only while every
+// registered service is serving.
+type Monitor struct {
+	server   *health.Server
+	logger   *zap.Logger
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	services map[string][]namedCheck
+}
+
+// NewMonitor creates a monitor that re-runs its checks every interval
+func NewMonitor(server *health.Server, logger *zap.Logger, interval time.Duration) *Monitor {
+	return &Monitor{
+		server:   server,
+		logger:   logger,
+		interval: interval,
+		timeout:  interval / 2,
+		services: make(map[string][]namedCheck),
+	}
+}
+
+// AddCheck registers a dependency check for a service
+func (m *Monitor) AddCheck(service, name string, check Check) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.services[service] = append(m.services[service], namedCheck{name: name, check: check})
+}
+
+// CheckNow runs every check once and updates the health server
+func (m *Monitor) CheckNow(ctx context.Context) {
+	m.mu.Lock()
+	services := make([]string, 0, len(m.services))
+	for service := range m.services {
+		services = append(services, service)
+	}
+	m.mu.Unlock()
+	sort.Strings(services)
+
+	overall := healthpb.HealthCheckResponse_SERVING
+	for _, service := range services {
+		status := m.checkService(ctx, service)
+		m.server.SetServingStatus(service, status)
+		if status != healthpb.HealthCheckResponse_SERVING {
+			overall = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	m.server.SetServingStatus("", overall)
+}
+
+// Run checks immediately and then on every interval until ctx is done
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.CheckNow(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) checkService(ctx context.Context, service string) healthpb.HealthCheckResponse_ServingStatus {
+	m.mu.Lock()
+	checks := append([]namedCheck(nil), m.services[service]...)
+	m.mu.Unlock()
+
+	status := healthpb.HealthCheckResponse_SERVING
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, m.timeout)
+		err := c.check(checkCtx)
+		cancel()
+
+		if err != nil {
+			m.logger.Warn("health check failed",
+				zap.String("service", service),
+				zap.String("check", c.name),
+				zap.Error(err),
+			)
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+
+	return status
+}
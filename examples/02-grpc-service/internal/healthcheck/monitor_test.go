@@ -0,0 +1,76 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestMonitor_CheckNow(t *testing.T) {
+	server := health.NewServer()
+	monitor := NewMonitor(server, zap.NewNop(), time.Second)
+
+	var storeErr error
+	monitor.AddCheck("auth.v1.AuthService", "token_store", func(context.Context) error { return nil })
+	monitor.AddCheck("auth.v1.AuthService", "session_store", func(context.Context) error { return storeErr })
+
+	tests := []struct {
+		name     string
+		storeErr error
+		want     healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{
+			name: "all checks pass",
+			want: healthpb.HealthCheckResponse_SERVING,
+		},
+		{
+			name:     "dependency failing",
+			storeErr: errors.New("store unavailable"),
+			want:     healthpb.HealthCheckResponse_NOT_SERVING,
+		},
+		{
+			name: "dependency recovered",
+			want: healthpb.HealthCheckResponse_SERVING,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storeErr = tt.storeErr
+			monitor.CheckNow(context.Background())
+
+			for _, service := range []string{"", "auth.v1.AuthService"} {
+				resp, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+				if err != nil {
+					t.Fatalf("check %q failed: %v", service, err)
+				}
+				if resp.Status != tt.want {
+					t.Errorf("service %q: expected %v, got %v", service, tt.want, resp.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestMonitor_Shutdown(t *testing.T) {
+	server := health.NewServer()
+	monitor := NewMonitor(server, zap.NewNop(), time.Second)
+	monitor.AddCheck("auth.v1.AuthService", "token_store", func(context.Context) error { return nil })
+
+	monitor.CheckNow(context.Background())
+	server.Shutdown()
+	monitor.CheckNow(context.Background())
+
+	resp, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "auth.v1.AuthService"})
+	if err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("expected NOT_SERVING after shutdown, got %v", resp.Status)
+	}
+}
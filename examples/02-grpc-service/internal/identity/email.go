@@ -0,0 +1,27 @@
+package identity
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+// ErrInvalidEmail is returned for anything but a bare addr-spec such as
+// "alice@example.com"
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// NormalizeEmail validates an email address and lowercases it, so that
+// addresses differing only in case are treated as one for uniqueness
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+
+	at := strings.LastIndexByte(addr.Address, '@')
+	if at < 1 || !strings.Contains(addr.Address[at+1:], ".") {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(addr.Address), nil
+}
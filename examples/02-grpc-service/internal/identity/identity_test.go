@@ -0,0 +1,92 @@
+package identity
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "lowercase", input: "alice", want: "alice"},
+		{name: "case folded", input: "Alice", want: "alice"},
+		{name: "fullwidth", input: "ＡＬＩＣＥ", want: "alice"},
+		{name: "sharp s folds", input: "Straße", want: "strasse"},
+		{name: "ligature", input: "ﬁnn", want: "finn"},
+		{name: "composed accent", input: "José", want: "josé"},
+		{name: "separators and digits", input: "user_1.test-2", want: "user_1.test-2"},
+		{name: "single script", input: "Алиса", want: "алиса"},
+		{name: "japanese", input: "やまだタロウ", want: "やまだタロウ"},
+		{name: "empty", input: "", wantErr: ErrInvalidUsername},
+		{name: "space", input: "alice smith", wantErr: ErrInvalidUsername},
+		{name: "symbol", input: "alice@example", wantErr: ErrInvalidUsername},
+		{name: "control", input: "alice\u0000", wantErr: ErrInvalidUsername},
+		{name: "too long", input: strings.Repeat("a", MaxUsernameLength+1), wantErr: ErrInvalidUsername},
+		{name: "latin with cyrillic a", input: "pаypal", wantErr: ErrMixedScript},
+		{name: "latin with greek omicron", input: "gοogle", wantErr: ErrMixedScript},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeUsername(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizeUsername(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeUsername(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{a: "scope", b: "ѕсоре", same: true},
+		{a: "alice", b: "alicé", same: true},
+		{a: "bob1", b: "bobl", same: true},
+		{a: "root", b: "r00t", same: true},
+		{a: "alice", b: "alicia", same: false},
+		{a: "алиса", b: "alice", same: false},
+	}
+
+	for _, tt := range tests {
+		if got := Skeleton(tt.a) == Skeleton(tt.b); got != tt.same {
+			t.Errorf("Skeleton(%q) == Skeleton(%q) is %v, want %v (%q, %q)", tt.a, tt.b, got, tt.same, Skeleton(tt.a), Skeleton(tt.b))
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "alice@example.com", want: "alice@example.com"},
+		{input: " Alice@Example.COM ", want: "alice@example.com"},
+		{input: "Alice <alice@example.com>", wantErr: true},
+		{input: "alice", wantErr: true},
+		{input: "alice@localhost", wantErr: true},
+		{input: "@example.com", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeEmail(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package identity normalizes usernames and email addresses so that
+// visually or canonically equivalent spellings resolve to the same account.
+//
+// Usernames are mapped to NFKC with full case folding, so "Alice", "alice"
+// and "ａｌｉｃｅ" (fullwidth) are one user. Usernames mixing letters from
+// several scripts, such as a Latin name with a Cyrillic "а", are rejected,
+// and Skeleton maps look-alike characters to a common form so the user
+// store can refuse a new name that is confusable with an existing one.
+package identity
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxUsernameLength is the maximum length of a normalized username in runes
+const MaxUsernameLength = 64
+
+var (
+	// ErrInvalidUsername is returned for empty or overlong usernames and
+	// usernames with characters other than letters, digits, '.', '_' and '-'
+	ErrInvalidUsername = errors.New("invalid username")
+	// ErrMixedScript is returned for usernames mixing letters of different
+	// scripts, a common spoofing technique
+	ErrMixedScript = errors.New("username mixes characters from different scripts")
+)
+
+// NormalizeUsername returns the canonical form of a username: NFKC with
+// full case folding, per the Unicode NFKC_Casefold mapping
+func NormalizeUsername(username string) (string, error) {
+	folded := norm.NFKC.String(cases.Fold().String(norm.NFKC.String(username)))
+
+	n := utf8.RuneCountInString(folded)
+	if n == 0 || n > MaxUsernameLength {
+		return "", ErrInvalidUsername
+	}
+
+	script := ""
+	for _, r := range folded {
+		switch {
+		case r == '.' || r == '_' || r == '-':
+			continue
+		case unicode.IsDigit(r) || unicode.Is(unicode.Mn, r):
+			continue
+		case !unicode.IsLetter(r):
+			return "", ErrInvalidUsername
+		}
+
+		s := scriptOf(r)
+		if script == "" {
+			script = s
+		} else if s != script {
+			return "", ErrMixedScript
+		}
+	}
+	return folded, nil
+}
+
+// scripts are checked in order; Han, kana and Hangul share a group because
+// Chinese, Japanese and Korean names legitimately combine them
+var scripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"latin", unicode.Latin},
+	{"cyrillic", unicode.Cyrillic},
+	{"greek", unicode.Greek},
+	{"armenian", unicode.Armenian},
+	{"hebrew", unicode.Hebrew},
+	{"arabic", unicode.Arabic},
+	{"devanagari", unicode.Devanagari},
+	{"thai", unicode.Thai},
+	{"georgian", unicode.Georgian},
+	{"cjk", unicode.Han},
+	{"cjk", unicode.Hiragana},
+	{"cjk", unicode.Katakana},
+	{"cjk", unicode.Hangul},
+	{"cjk", unicode.Bopomofo},
+}
+
+func scriptOf(r rune) string {
+	for _, s := range scripts {
+		if unicode.Is(s.table, r) {
+			return s.name
+		}
+	}
+	return "other"
+}
+
+// confusables maps characters of a normalized username to the Latin
+// character they are commonly mistaken for. It covers the Cyrillic and Greek
+// homoglyphs behind most whole-script spoofs, plus digits that pass for
+// letters.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i',
+	'ј': 'j', 'к': 'k', 'ӏ': 'l', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'ԛ': 'q', 'ѕ': 's', 'т': 't', 'ս': 'u', 'ԝ': 'w', 'х': 'x', 'у': 'y',
+	'ү': 'y', 'ѵ': 'v', 'ё': 'e', 'ї': 'i',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y',
+	// Digits and Latin look-alikes
+	'0': 'o', '1': 'l', 'ı': 'i', 'ł': 'l',
+}
+
+// Skeleton maps a normalized username to a form in which confusable
+// usernames are equal, e.g. the Latin "scope" and the Cyrillic "ѕсоре".
+// Combining marks are dropped, so "alicé" and "alice" collide too.
+func Skeleton(username string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(username) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,279 @@
+// Package lockout tracks failed login attempts per username and per client
+// IP, applying exponential backoff and temporary lockout.
+package lockout
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Scope identifies what a failure counter is keyed on
+type Scope string
+
+const (
+	ScopeUsername Scope = "username"
+	ScopeClientIP Scope = "client_ip"
+)
+
+// maxTrackedKeys bounds the number of records before expired ones are swept
+const maxTrackedKeys = 10000
+
+// ErrLocked is returned when a username or client IP is locked out
+var ErrLocked = errors.New("too many failed login attempts")
+
+// ErrBackoff is returned when a retry comes before the backoff has elapsed
+var ErrBackoff = errors.New("login attempted too soon after a failure")
+
+// Config holds brute-force protection thresholds
+type Config struct {
+	Enabled bool
+	// FreeFailures is the number of failures allowed before backoff starts
+	FreeFailures int
+	// BaseDelay is the backoff after the first counted failure; it doubles
+	// with every further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxUserFailures and MaxIPFailures lock the username or client IP for
+	// LockoutDuration once reached. Zero disables that lockout.
+	MaxUserFailures int
+	MaxIPFailures   int
+	LockoutDuration time.Duration
+	// FailureWindow forgets failures once no new failure occurred for this long
+	FailureWindow time.Duration
+	// TrustedNetworks are exempt from per-IP tracking, e.g. load generators
+	TrustedNetworks []*net.IPNet
+}
+
+// DefaultConfig returns thresholds suitable for the demo service
+func DefaultConfig() Config {
+	return Config{
+		Enabled:         true,
+		FreeFailures:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		MaxUserFailures: 10,
+		MaxIPFailures:   100,
+		LockoutDuration: 15 * time.Minute,
+		FailureWindow:   15 * time.Minute,
+	}
+}
+
+// Block describes why an attempt is refused and when it may be retried
+type Block struct {
+	Err        error
+	Scope      Scope
+	Key        string
+	RetryAfter time.Duration
+}
+
+// Lockout is reported by RecordFailure when a failure locks a key
+type Lockout struct {
+	Scope       Scope
+	Key         string
+	Failures    int
+	LockedUntil time.Time
+}
+
+type record struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	lockedUntil  time.Time
+}
+
+// Tracker counts failed attempts and decides whether new attempts are allowed
+type Tracker struct {
+	mu    sync.Mutex
+	cfg   Config
+	users map[string]*record
+	ips   map[string]*record
+	now   func() time.Time
+}
+
+// NewTracker creates a tracker with the given thresholds
+func NewTracker(cfg Config) *Tracker {
+	return &Tracker{
+		cfg:   cfg,
+		users: make(map[string]*record),
+		ips:   make(map[string]*record),
+		now:   time.Now,
+	}
+}
+
+// Check returns a non-nil Block when an attempt for username from ip must
+// be refused
+func (t *Tracker) Check(username, ip string) *Block {
+	if !t.cfg.Enabled {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if block := t.checkRecord(t.users[username], ScopeUsername, username, now); block != nil {
+		return block
+	}
+	if t.trackIP(ip) {
+		return t.checkRecord(t.ips[ip], ScopeClientIP, ip, now)
+	}
+	return nil
+}
+
+// RecordFailure counts a failed attempt. It returns the lockouts that this
+// failure triggered, if any.
+func (t *Tracker) RecordFailure(username, ip string) []Lockout {
+	if !t.cfg.Enabled {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if len(t.users)+len(t.ips) > maxTrackedKeys {
+		t.sweep(now)
+	}
+
+	var lockouts []Lockout
+	if l := t.fail(t.users, ScopeUsername, username, t.cfg.MaxUserFailures, now); l != nil {
+		lockouts = append(lockouts, *l)
+	}
+	if t.trackIP(ip) {
+		if l := t.fail(t.ips, ScopeClientIP, ip, t.cfg.MaxIPFailures, now); l != nil {
+			lockouts = append(lockouts, *l)
+		}
+	}
+	return lockouts
+}
+
+// RecordSuccess clears the username's failures. Client IP failures are kept
+// so one valid account cannot mask stuffing attempts from the same address.
+func (t *Tracker) RecordSuccess(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.users, username)
+}
+
+// Unlock clears the failures of a username or client IP and reports whether
+// anything was tracked
+func (t *Tracker) Unlock(scope Scope, key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	records := t.users
+	if scope == ScopeClientIP {
+		records = t.ips
+	}
+
+	_, exists := records[key]
+	delete(records, key)
+	return exists
+}
+
+func (t *Tracker) checkRecord(r *record, scope Scope, key string, now time.Time) *Block {
+	if r == nil {
+		return nil
+	}
+	if now.Before(r.lockedUntil) {
+		return &Block{Err: ErrLocked, Scope: scope, Key: key, RetryAfter: r.lockedUntil.Sub(now)}
+	}
+	if now.Before(r.blockedUntil) {
+		return &Block{Err: ErrBackoff, Scope: scope, Key: key, RetryAfter: r.blockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+func (t *Tracker) fail(records map[string]*record, scope Scope, key string, max int, now time.Time) *Lockout {
+	r, exists := records[key]
+	if !exists || t.expired(r, now) {
+		r = &record{}
+		records[key] = r
+	}
+
+	r.failures++
+	r.lastFailure = now
+	if delay := t.backoff(r.failures); delay > 0 {
+		r.blockedUntil = now.Add(delay)
+	}
+
+	if max > 0 && r.failures >= max {
+		r.lockedUntil = now.Add(t.cfg.LockoutDuration)
+		return &Lockout{Scope: scope, Key: key, Failures: r.failures, LockedUntil: r.lockedUntil}
+	}
+	return nil
+}
+
+// backoff returns BaseDelay * 2^(failures-FreeFailures-1), capped at MaxDelay
+func (t *Tracker) backoff(failures int) time.Duration {
+	n := failures - t.cfg.FreeFailures
+	if n <= 0 || t.cfg.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := t.cfg.BaseDelay
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if t.cfg.MaxDelay > 0 && delay >= t.cfg.MaxDelay {
+			return t.cfg.MaxDelay
+		}
+	}
+	return delay
+}
+
+func (t *Tracker) expired(r *record, now time.Time) bool {
+	return now.After(r.lockedUntil) && now.Sub(r.lastFailure) > t.cfg.FailureWindow
+}
+
+func (t *Tracker) trackIP(ip string) bool {
+	if ip == "" {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	for _, network := range t.cfg.TrustedNetworks {
+		if parsed != nil && network.Contains(parsed) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *Tracker) sweep(now time.Time) {
+	for key, r := range t.users {
+		if t.expired(r, now) {
+			delete(t.users, key)
+		}
+	}
+	for key, r := range t.ips {
+		if t.expired(r, now) {
+			delete(t.ips, key)
+		}
+	}
+}
+
+// ParseNetworks parses a list of CIDRs or bare IPs
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		if ip := net.ParseIP(value); ip != nil {
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -0,0 +1,182 @@
+package lockout
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestTracker(cfg Config) (*Tracker, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tracker := NewTracker(cfg)
+	tracker.now = clock.Now
+	return tracker, clock
+}
+
+func testConfig() Config {
+	return Config{
+		Enabled:         true,
+		FreeFailures:    2,
+		BaseDelay:       time.Second,
+		MaxDelay:        4 * time.Second,
+		MaxUserFailures: 6,
+		MaxIPFailures:   10,
+		LockoutDuration: time.Minute,
+		FailureWindow:   10 * time.Minute,
+	}
+}
+
+func TestTracker_Backoff(t *testing.T) {
+	tracker, clock := newTestTracker(testConfig())
+
+	tests := []struct {
+		failures  int
+		wantDelay time.Duration
+	}{
+		{failures: 1, wantDelay: 0},
+		{failures: 2, wantDelay: 0},
+		{failures: 3, wantDelay: time.Second},
+		{failures: 4, wantDelay: 2 * time.Second},
+		{failures: 5, wantDelay: 4 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if block := tracker.Check("alice", "10.0.0.1"); block != nil {
+			t.Fatalf("failure %d: unexpected block %v", tt.failures, block.Err)
+		}
+		tracker.RecordFailure("alice", "10.0.0.1")
+
+		block := tracker.Check("alice", "10.0.0.1")
+		if tt.wantDelay == 0 {
+			if block != nil {
+				t.Errorf("failure %d: expected no backoff, got %v", tt.failures, block.RetryAfter)
+			}
+			continue
+		}
+		if block == nil || !errors.Is(block.Err, ErrBackoff) || block.RetryAfter != tt.wantDelay {
+			t.Errorf("failure %d: expected backoff %v, got %+v", tt.failures, tt.wantDelay, block)
+		}
+		clock.Advance(tt.wantDelay)
+	}
+}
+
+func TestTracker_UserLockout(t *testing.T) {
+	tracker, clock := newTestTracker(testConfig())
+
+	var lockouts []Lockout
+	for i := 0; i < 6; i++ {
+		lockouts = tracker.RecordFailure("alice", "")
+		clock.Advance(5 * time.Second)
+	}
+	if len(lockouts) != 1 || lockouts[0].Scope != ScopeUsername || lockouts[0].Key != "alice" {
+		t.Fatalf("expected username lockout on the last failure, got %+v", lockouts)
+	}
+
+	block := tracker.Check("alice", "")
+	if block == nil || !errors.Is(block.Err, ErrLocked) {
+		t.Fatalf("expected lockout, got %+v", block)
+	}
+	if block.RetryAfter != 55*time.Second {
+		t.Errorf("expected retry after 55s, got %v", block.RetryAfter)
+	}
+
+	// Other users are unaffected
+	if block := tracker.Check("bob", ""); block != nil {
+		t.Errorf("expected bob to be allowed, got %v", block.Err)
+	}
+
+	clock.Advance(time.Minute)
+	if block := tracker.Check("alice", ""); block != nil {
+		t.Errorf("expected lockout to expire, got %v", block.Err)
+	}
+}
+
+func TestTracker_IPLockoutAcrossUsers(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxIPFailures = 3
+	tracker, _ := newTestTracker(cfg)
+
+	var lockouts []Lockout
+	for _, user := range []string{"a", "b", "c"} {
+		lockouts = tracker.RecordFailure(user, "10.0.0.1")
+	}
+	if len(lockouts) != 1 || lockouts[0].Scope != ScopeClientIP {
+		t.Fatalf("expected client IP lockout, got %+v", lockouts)
+	}
+
+	block := tracker.Check("d", "10.0.0.1")
+	if block == nil || block.Scope != ScopeClientIP {
+		t.Fatalf("expected new username from locked IP to be blocked, got %+v", block)
+	}
+	if block := tracker.Check("d", "10.0.0.2"); block != nil {
+		t.Errorf("expected other IP to be allowed, got %v", block.Err)
+	}
+
+	if !tracker.Unlock(ScopeClientIP, "10.0.0.1") {
+		t.Error("expected unlock to clear a record")
+	}
+	if block := tracker.Check("d", "10.0.0.1"); block != nil {
+		t.Errorf("expected IP to be unlocked, got %v", block.Err)
+	}
+}
+
+func TestTracker_SuccessAndWindow(t *testing.T) {
+	tracker, clock := newTestTracker(testConfig())
+
+	for i := 0; i < 3; i++ {
+		tracker.RecordFailure("alice", "")
+	}
+	tracker.RecordSuccess("alice")
+	if block := tracker.Check("alice", ""); block != nil {
+		t.Errorf("expected success to reset failures, got %v", block.Err)
+	}
+
+	for i := 0; i < 2; i++ {
+		tracker.RecordFailure("bob", "")
+	}
+	clock.Advance(11 * time.Minute)
+	tracker.RecordFailure("bob", "")
+	if block := tracker.Check("bob", ""); block != nil {
+		t.Errorf("expected failures outside the window to be forgotten, got %v", block.Err)
+	}
+}
+
+func TestTracker_TrustedNetworksAndDisabled(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxIPFailures = 1
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", "192.168.1.5"})
+	if err != nil {
+		t.Fatalf("parse networks failed: %v", err)
+	}
+	cfg.TrustedNetworks = networks
+	tracker, _ := newTestTracker(cfg)
+
+	tracker.RecordFailure("a", "10.1.2.3")
+	tracker.RecordFailure("b", "192.168.1.5")
+	if block := tracker.Check("c", "10.1.2.3"); block != nil {
+		t.Errorf("expected trusted network to be exempt, got %v", block.Err)
+	}
+	if block := tracker.Check("c", "192.168.1.5"); block != nil {
+		t.Errorf("expected trusted IP to be exempt, got %v", block.Err)
+	}
+
+	disabled := NewTracker(Config{})
+	for i := 0; i < 100; i++ {
+		disabled.RecordFailure("alice", "10.0.0.1")
+	}
+	if block := disabled.Check("alice", "10.0.0.1"); block != nil {
+		t.Errorf("expected disabled tracker to allow, got %v", block.Err)
+	}
+
+	if _, err := ParseNetworks([]string{"not-a-cidr"}); err == nil {
+		t.Error("expected invalid network to fail")
+	}
+}
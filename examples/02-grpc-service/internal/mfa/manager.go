@@ -0,0 +1,259 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrAlreadyEnrolled is returned when enrolling a user whose MFA is active
+	ErrAlreadyEnrolled = errors.New("mfa already enabled")
+	// ErrNotEnrolled is returned when confirming without a pending enrollment
+	ErrNotEnrolled = errors.New("no pending mfa enrollment")
+	// ErrInvalidCode is returned for a wrong TOTP or recovery code
+	ErrInvalidCode = errors.New("invalid mfa code")
+	// ErrCodeReused is returned when a TOTP code's time step was already used
+	ErrCodeReused = errors.New("mfa code already used")
+	// ErrChallengeNotFound is returned for unknown, expired or exhausted challenges
+	ErrChallengeNotFound = errors.New("mfa challenge not found or expired")
+)
+
+// Config holds TOTP and challenge settings
+type Config struct {
+	Issuer string
+	Period time.Duration
+	Digits int
+	// Skew is the number of time steps accepted either side of now
+	Skew                 int
+	ChallengeTTL         time.Duration
+	MaxChallengeAttempts int
+	RecoveryCodes        int
+}
+
+// DefaultConfig returns settings compatible with common authenticator apps
+func DefaultConfig() Config {
+	return Config{
+		Issuer:               "mop-auth",
+		Period:               30 * time.Second,
+		Digits:               6,
+		Skew:                 1,
+		ChallengeTTL:         5 * time.Minute,
+		MaxChallengeAttempts: 5,
+		RecoveryCodes:        10,
+	}
+}
+
+type enrollment struct {
+	secret    []byte
+	confirmed bool
+	// lastStep is the most recent accepted time step, for replay prevention
+	lastStep     int64
+	recoveryHash map[string]bool
+}
+
+type challenge struct {
+	username  string
+	expiresAt time.Time
+	attempts  int
+}
+
+// Manager stores MFA enrollments by username and pending login challenges
+type Manager struct {
+	mu          sync.Mutex
+	cfg         Config
+	enrollments map[string]*enrollment
+	challenges  map[string]*challenge
+	now         func() time.Time
+}
+
+// NewManager creates an MFA manager
+func NewManager(cfg Config) *Manager {
+	return &Manager{
+		cfg:         cfg,
+		enrollments: make(map[string]*enrollment),
+		challenges:  make(map[string]*challenge),
+		now:         time.Now,
+	}
+}
+
+// Enroll creates (or replaces) a pending enrollment and returns the base32
+// secret and otpauth URI
+func (m *Manager) Enroll(username string) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.enrollments[username]; ok && e.confirmed {
+		return "", "", ErrAlreadyEnrolled
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	m.enrollments[username] = &enrollment{secret: secret}
+
+	return EncodeSecret(secret), ProvisioningURI(m.cfg.Issuer, username, secret, m.cfg.Period, m.cfg.Digits), nil
+}
+
+// Confirm activates a pending enrollment with a valid code and returns
+// single-use recovery codes
+func (m *Manager) Confirm(username, code string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.enrollments[username]
+	if !ok {
+		return nil, ErrNotEnrolled
+	}
+	if e.confirmed {
+		return nil, ErrAlreadyEnrolled
+	}
+	if err := m.verifyTOTP(e, code); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, m.cfg.RecoveryCodes)
+	e.recoveryHash = make(map[string]bool, len(codes))
+	for i := range codes {
+		c, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = c
+		e.recoveryHash[hashRecoveryCode(c)] = true
+	}
+	e.confirmed = true
+
+	return codes, nil
+}
+
+// Enabled reports whether a user has confirmed MFA
+func (m *Manager) Enabled(username string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.enrollments[username]
+	return ok && e.confirmed
+}
+
+// NewChallenge starts a second login step for a user with MFA enabled
+func (m *Manager) NewChallenge(username string) (string, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweepChallenges(now)
+
+	token := uuid.New().String()
+	expiresAt := now.Add(m.cfg.ChallengeTTL)
+	m.challenges[token] = &challenge{username: username, expiresAt: expiresAt}
+
+	return token, expiresAt
+}
+
+// ChallengeUser returns the username a live challenge was issued for
+func (m *Manager) ChallengeUser(token string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.challenges[token]
+	if !ok || !m.now().Before(c.expiresAt) {
+		return "", false
+	}
+	return c.username, true
+}
+
+// VerifyChallenge completes a challenge with either a TOTP code or a
+// recovery code. It returns the username and whether a recovery code was
+// consumed. Challenges are single use and invalidated after too many
+// wrong codes.
+func (m *Manager) VerifyChallenge(token, code, recoveryCode string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.challenges[token]
+	if !ok || !m.now().Before(c.expiresAt) {
+		delete(m.challenges, token)
+		return "", false, ErrChallengeNotFound
+	}
+
+	e, ok := m.enrollments[c.username]
+	if !ok || !e.confirmed {
+		delete(m.challenges, token)
+		return "", false, ErrChallengeNotFound
+	}
+
+	var err error
+	usedRecovery := false
+	if recoveryCode != "" {
+		usedRecovery = true
+		err = m.useRecoveryCode(e, recoveryCode)
+	} else {
+		err = m.verifyTOTP(e, code)
+	}
+
+	if err != nil {
+		c.attempts++
+		if c.attempts >= m.cfg.MaxChallengeAttempts {
+			delete(m.challenges, token)
+		}
+		return c.username, false, err
+	}
+
+	delete(m.challenges, token)
+	return c.username, usedRecovery, nil
+}
+
+func (m *Manager) verifyTOTP(e *enrollment, code string) error {
+	step, ok := matchStep(e.secret, strings.TrimSpace(code), m.now(), m.cfg.Period, m.cfg.Digits, m.cfg.Skew)
+	if !ok {
+		return ErrInvalidCode
+	}
+	if step <= e.lastStep {
+		return ErrCodeReused
+	}
+	e.lastStep = step
+	return nil
+}
+
+func (m *Manager) useRecoveryCode(e *enrollment, code string) error {
+	hash := hashRecoveryCode(code)
+	for stored := range e.recoveryHash {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			delete(e.recoveryHash, stored)
+			return nil
+		}
+	}
+	return ErrInvalidCode
+}
+
+func (m *Manager) sweepChallenges(now time.Time) {
+	for token, c := range m.challenges {
+		if !now.Before(c.expiresAt) {
+			delete(m.challenges, token)
+		}
+	}
+}
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(secretEncoding.EncodeToString(b))
+	return s[:4] + "-" + s[4:], nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
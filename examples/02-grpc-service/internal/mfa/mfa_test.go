@@ -0,0 +1,185 @@
+package mfa
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors for SHA1
+func TestGenerateCode_RFC6238(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "94287082"},
+		{unix: 1111111109, want: "07081804"},
+		{unix: 1111111111, want: "14050471"},
+		{unix: 1234567890, want: "89005924"},
+		{unix: 2000000000, want: "69279037"},
+		{unix: 20000000000, want: "65353130"},
+	}
+
+	for _, tt := range tests {
+		step := TimeStep(time.Unix(tt.unix, 0), 30*time.Second)
+		if got := GenerateCode(secret, step, 8); got != tt.want {
+			t.Errorf("T=%d: expected %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestManager() (*Manager, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	m := NewManager(DefaultConfig())
+	m.now = clock.Now
+	return m, clock
+}
+
+func codeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	raw, err := DecodeSecret(secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	return GenerateCode(raw, TimeStep(at, 30*time.Second), 6)
+}
+
+func enrolled(t *testing.T, m *Manager, clock *fakeClock, username string) (string, []string) {
+	t.Helper()
+	secret, uri, err := m.Enroll(username)
+	if err != nil {
+		t.Fatalf("enroll failed: %v", err)
+	}
+	if !strings.HasPrefix(uri, "otpauth://totp/") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("unexpected otpauth URI %s", uri)
+	}
+
+	recovery, err := m.Confirm(username, codeAt(t, secret, clock.now))
+	if err != nil {
+		t.Fatalf("confirm failed: %v", err)
+	}
+	return secret, recovery
+}
+
+func TestManager_EnrollConfirm(t *testing.T) {
+	m, clock := newTestManager()
+
+	if _, err := m.Confirm("alice", "123456"); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("expected %v, got %v", ErrNotEnrolled, err)
+	}
+
+	secret, _, err := m.Enroll("alice")
+	if err != nil {
+		t.Fatalf("enroll failed: %v", err)
+	}
+	if m.Enabled("alice") {
+		t.Error("expected mfa to stay disabled until confirmed")
+	}
+	if _, err := m.Confirm("alice", "000000"); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("expected %v, got %v", ErrInvalidCode, err)
+	}
+
+	recovery, err := m.Confirm("alice", codeAt(t, secret, clock.now))
+	if err != nil {
+		t.Fatalf("confirm failed: %v", err)
+	}
+	if len(recovery) != DefaultConfig().RecoveryCodes {
+		t.Errorf("expected %d recovery codes, got %d", DefaultConfig().RecoveryCodes, len(recovery))
+	}
+	if !m.Enabled("alice") {
+		t.Error("expected mfa to be enabled")
+	}
+	if _, _, err := m.Enroll("alice"); !errors.Is(err, ErrAlreadyEnrolled) {
+		t.Errorf("expected %v, got %v", ErrAlreadyEnrolled, err)
+	}
+}
+
+func TestManager_VerifyChallenge(t *testing.T) {
+	m, clock := newTestManager()
+	secret, _ := enrolled(t, m, clock, "alice")
+	period := 30 * time.Second
+
+	tests := []struct {
+		name    string
+		offset  time.Duration
+		wantErr error
+	}{
+		{name: "code from the confirm step is replayed", offset: 0, wantErr: ErrCodeReused},
+		{name: "next step within skew", offset: period, wantErr: nil},
+		{name: "same step again is replayed", offset: period, wantErr: ErrCodeReused},
+		{name: "two steps ahead outside skew", offset: 3 * period, wantErr: ErrInvalidCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _ := m.NewChallenge("alice")
+			username, usedRecovery, err := m.VerifyChallenge(token, codeAt(t, secret, clock.now.Add(tt.offset)), "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if username != "alice" || usedRecovery {
+				t.Errorf("expected alice without recovery, got %s recovery=%v", username, usedRecovery)
+			}
+		})
+	}
+}
+
+func TestManager_RecoveryCodes(t *testing.T) {
+	m, clock := newTestManager()
+	_, recovery := enrolled(t, m, clock, "alice")
+
+	token, _ := m.NewChallenge("alice")
+	if _, used, err := m.VerifyChallenge(token, "", strings.ToUpper(recovery[0])); err != nil || !used {
+		t.Fatalf("expected recovery code to work, got used=%v err=%v", used, err)
+	}
+
+	token, _ = m.NewChallenge("alice")
+	if _, _, err := m.VerifyChallenge(token, "", recovery[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("expected recovery code to be single use, got %v", err)
+	}
+}
+
+func TestManager_ChallengeLifetime(t *testing.T) {
+	m, clock := newTestManager()
+	secret, _ := enrolled(t, m, clock, "alice")
+
+	// Single use
+	token, _ := m.NewChallenge("alice")
+	clock.now = clock.now.Add(30 * time.Second)
+	if _, _, err := m.VerifyChallenge(token, codeAt(t, secret, clock.now), ""); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if _, _, err := m.VerifyChallenge(token, codeAt(t, secret, clock.now), ""); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("expected used challenge to be gone, got %v", err)
+	}
+
+	// Expiry
+	token, _ = m.NewChallenge("alice")
+	clock.now = clock.now.Add(DefaultConfig().ChallengeTTL)
+	if _, ok := m.ChallengeUser(token); ok {
+		t.Error("expected expired challenge to be unknown")
+	}
+	if _, _, err := m.VerifyChallenge(token, codeAt(t, secret, clock.now), ""); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("expected %v, got %v", ErrChallengeNotFound, err)
+	}
+
+	// Too many wrong codes
+	token, _ = m.NewChallenge("alice")
+	for i := 0; i < DefaultConfig().MaxChallengeAttempts; i++ {
+		if _, _, err := m.VerifyChallenge(token, "000000", ""); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("attempt %d: expected %v, got %v", i+1, ErrInvalidCode, err)
+		}
+	}
+	if _, _, err := m.VerifyChallenge(token, codeAt(t, secret, clock.now.Add(30*time.Second)), ""); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("expected exhausted challenge to be gone, got %v", err)
+	}
+}
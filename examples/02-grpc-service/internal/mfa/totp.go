@@ -0,0 +1,76 @@
+// Package mfa implements TOTP (RFC 6238) multi-factor authentication with
+// enrollment, login challenges, recovery codes and replay prevention.
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // RFC 6238 default algorithm, required by authenticator apps
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EncodeSecret returns the base32 form shown to users and authenticator apps
+func EncodeSecret(secret []byte) string {
+	return secretEncoding.EncodeToString(secret)
+}
+
+// DecodeSecret parses a base32 secret, ignoring case, spaces and padding
+func DecodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	return secretEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// TimeStep returns the RFC 6238 counter for t
+func TimeStep(t time.Time, period time.Duration) int64 {
+	return t.Unix() / int64(period/time.Second)
+}
+
+// GenerateCode computes the HOTP value (RFC 4226) for a time step
+func GenerateCode(secret []byte, step int64, digits int) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// matchStep returns the time step within ±skew of now whose code equals
+// code, or false if none does
+func matchStep(secret []byte, code string, now time.Time, period time.Duration, digits, skew int) (int64, bool) {
+	current := TimeStep(now, period)
+	for offset := -skew; offset <= skew; offset++ {
+		step := current + int64(offset)
+		if hmac.Equal([]byte(GenerateCode(secret, step, digits)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// ProvisioningURI builds the otpauth:// URI encoded in enrollment QR codes
+func ProvisioningURI(issuer, account string, secret []byte, period time.Duration, digits int) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", EncodeSecret(secret))
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", digits))
+	params.Set("period", fmt.Sprintf("%d", int(period/time.Second)))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
@@ -0,0 +1,112 @@
+// Package notify delivers messages to users, such as email verification
+// codes. LogNotifier suits development; SMTPNotifier sends real email.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message is a plain-text message to one recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// LogNotifier writes messages to the log instead of delivering them. The
+// body is logged too, so it must not be used where logs are less trusted
+// than the recipients' mailboxes.
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+// NewLogNotifier creates a notifier that logs to logger
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+// Notify logs the message
+func (n *LogNotifier) Notify(ctx context.Context, msg Message) error {
+	n.logger.Info("notification",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body),
+	)
+	return nil
+}
+
+// SMTPConfig holds SMTP relay settings. Username and Password are optional;
+// when set, PLAIN authentication is used, which net/smtp only permits over
+// TLS or to localhost.
+type SMTPConfig struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// SMTPNotifier sends messages as email through an SMTP relay
+type SMTPNotifier struct {
+	cfg  SMTPConfig
+	auth smtp.Auth
+	now  func() time.Time
+}
+
+// NewSMTPNotifier creates a notifier sending through the relay at cfg.Addr
+func NewSMTPNotifier(cfg SMTPConfig) (*SMTPNotifier, error) {
+	if cfg.Addr == "" || cfg.From == "" {
+		return nil, errors.New("smtp notifier requires an address and a sender")
+	}
+
+	n := &SMTPNotifier{cfg: cfg, now: time.Now}
+	if cfg.Username != "" {
+		host, _, _ := strings.Cut(cfg.Addr, ":")
+		n.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	return n, nil
+}
+
+// Notify sends the message. net/smtp does not take a context, so ctx is
+// only checked before connecting.
+func (n *SMTPNotifier) Notify(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := smtp.SendMail(n.cfg.Addr, n.auth, n.cfg.From, []string{msg.To}, n.format(msg)); err != nil {
+		return fmt.Errorf("smtp send failed: %w", err)
+	}
+	return nil
+}
+
+// format renders msg as an RFC 5322 message. Header values come from the
+// service, never from clients, but line breaks are stripped regardless so
+// they cannot inject headers.
+func (n *SMTPNotifier) format(msg Message) []byte {
+	header := func(v string) string {
+		return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header(n.cfg.From))
+	fmt.Fprintf(&b, "To: %s\r\n", header(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", n.now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
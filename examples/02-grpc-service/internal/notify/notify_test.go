@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSMTPNotifier_Format(t *testing.T) {
+	n, err := NewSMTPNotifier(SMTPConfig{Addr: "localhost:25", From: "auth@example.com"})
+	if err != nil {
+		t.Fatalf("NewSMTPNotifier failed: %v", err)
+	}
+	n.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	got := string(n.format(Message{
+		To:      "alice@example.com",
+		Subject: "Verify\r\nBcc: eve@example.com",
+		Body:    "line one\nline two",
+	}))
+
+	want := "From: auth@example.com\r\n" +
+		"To: alice@example.com\r\n" +
+		"Subject: VerifyBcc: eve@example.com\r\n" +
+		"Date: Fri, 02 Jan 2026 03:04:05 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"line one\r\nline two\r\n"
+	if got != want {
+		t.Errorf("unexpected message:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestNewSMTPNotifier_RequiresAddrAndFrom(t *testing.T) {
+	if _, err := NewSMTPNotifier(SMTPConfig{Addr: "localhost:25"}); err == nil {
+		t.Error("expected an error without a sender")
+	}
+	if _, err := NewSMTPNotifier(SMTPConfig{From: "auth@example.com"}); err == nil {
+		t.Error("expected an error without an address")
+	}
+}
@@ -0,0 +1,124 @@
+// Package oauth serves the OAuth2 endpoints of the auth service: RFC 7662
+// token introspection, RFC 7009 token revocation and the client-credentials
+// grant for service-to-service tokens.
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Client is a registered OAuth2 client
+type Client struct {
+	ID string `yaml:"id"`
+	// SecretSHA256 is the hex-encoded SHA-256 of the client secret
+	SecretSHA256 string `yaml:"secret_sha256"`
+	// Scopes the client may request with the client-credentials grant
+	Scopes []string `yaml:"scopes,omitempty"`
+
+	secretHash []byte
+}
+
+// Clients is the registry of OAuth2 clients
+type Clients struct {
+	byID map[string]*Client
+}
+
+// NewClients validates and indexes clients by ID
+func NewClients(clients ...Client) (*Clients, error) {
+	c := &Clients{byID: make(map[string]*Client, len(clients))}
+	for i := range clients {
+		client := clients[i]
+		if client.ID == "" {
+			return nil, fmt.Errorf("client %d: missing id", i)
+		}
+		if _, exists := c.byID[client.ID]; exists {
+			return nil, fmt.Errorf("client %s: duplicate id", client.ID)
+		}
+
+		hash, err := hex.DecodeString(client.SecretSHA256)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("client %s: secret_sha256 must be a hex-encoded SHA-256", client.ID)
+		}
+		client.secretHash = hash
+
+		for _, scope := range client.Scopes {
+			if scope == "" || strings.ContainsAny(scope, " \"\\") {
+				return nil, fmt.Errorf("client %s: invalid scope %q", client.ID, scope)
+			}
+		}
+
+		c.byID[client.ID] = &client
+	}
+	return c, nil
+}
+
+// ParseClients decodes and validates a YAML client registry
+func ParseClients(data []byte) (*Clients, error) {
+	var file struct {
+		Clients []Client `yaml:"clients"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse clients: %w", err)
+	}
+	return NewClients(file.Clients...)
+}
+
+// LoadClientsFile reads a YAML client registry from path
+func LoadClientsFile(path string) (*Clients, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read clients: %w", err)
+	}
+	return ParseClients(data)
+}
+
+// HashSecret returns the value to store as secret_sha256 for secret
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Len returns the number of registered clients
+func (c *Clients) Len() int {
+	return len(c.byID)
+}
+
+// Authenticate returns the client if id and secret match a registered client
+func (c *Clients) Authenticate(id, secret string) (*Client, bool) {
+	client, exists := c.byID[id]
+	sum := sha256.Sum256([]byte(secret))
+	if !exists {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare(sum[:], client.secretHash) != 1 {
+		return nil, false
+	}
+	return client, true
+}
+
+// GrantScopes resolves a space-delimited scope request against the scopes
+// the client is registered for. An empty request grants all of them.
+func (c *Client) GrantScopes(requested string) ([]string, bool) {
+	if requested == "" {
+		return slices.Clone(c.Scopes), true
+	}
+
+	var granted []string
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(c.Scopes, scope) {
+			return nil, false
+		}
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted, true
+}
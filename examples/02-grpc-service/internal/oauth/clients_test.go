@@ -0,0 +1,94 @@
+package oauth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseClients(t *testing.T) {
+	hash := HashSecret("secret")
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			yaml: "clients:\n  - id: billing\n    secret_sha256: " + hash + "\n    scopes: [orders:read]\n",
+		},
+		{
+			name:    "missing id",
+			yaml:    "clients:\n  - secret_sha256: " + hash + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate id",
+			yaml:    "clients:\n  - id: a\n    secret_sha256: " + hash + "\n  - id: a\n    secret_sha256: " + hash + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "plaintext secret",
+			yaml:    "clients:\n  - id: a\n    secret_sha256: secret\n",
+			wantErr: true,
+		},
+		{
+			name:    "scope with space",
+			yaml:    "clients:\n  - id: a\n    secret_sha256: " + hash + "\n    scopes: [\"a b\"]\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseClients([]byte(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseClients() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClients_Authenticate(t *testing.T) {
+	clients, err := NewClients(Client{ID: "billing", SecretSHA256: HashSecret("secret")})
+	if err != nil {
+		t.Fatalf("NewClients failed: %v", err)
+	}
+
+	if _, ok := clients.Authenticate("billing", "secret"); !ok {
+		t.Error("expected valid credentials to authenticate")
+	}
+	if _, ok := clients.Authenticate("billing", "wrong"); ok {
+		t.Error("expected wrong secret to fail")
+	}
+	if _, ok := clients.Authenticate("unknown", "secret"); ok {
+		t.Error("expected unknown client to fail")
+	}
+}
+
+func TestClient_GrantScopes(t *testing.T) {
+	client := &Client{Scopes: []string{"orders:read", "orders:write"}}
+
+	tests := []struct {
+		requested string
+		want      []string
+		wantOK    bool
+	}{
+		{requested: "", want: []string{"orders:read", "orders:write"}, wantOK: true},
+		{requested: "orders:write", want: []string{"orders:write"}, wantOK: true},
+		{requested: "orders:read  orders:read", want: []string{"orders:read"}, wantOK: true},
+		{requested: "orders:read admin", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.requested, func(t *testing.T) {
+			got, ok := client.GrantScopes(tt.requested)
+			if ok != tt.wantOK {
+				t.Fatalf("expected ok=%v, got %v", tt.wantOK, ok)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Endpoint paths
+const (
+	TokenPath      = "/oauth2/token"
+	IntrospectPath = "/oauth2/introspect"
+	RevokePath     = "/oauth2/revoke"
+)
+
+// ErrTokenNotOwned is returned when a client revokes a token issued to
+// another client
+var ErrTokenNotOwned = errors.New("token was issued to another client")
+
+// Introspection is an RFC 7662 introspection response
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+}
+
+// TokenService issues, describes and revokes tokens on behalf of the
+// endpoints; AuthService implements it on top of its token store
+type TokenService interface {
+	// IssueClientToken creates an access token for a client-credentials grant
+	IssueClientToken(ctx context.Context, clientID string, scopes []string) (string, time.Time, error)
+	// IntrospectToken describes a token; unknown tokens are inactive, not errors
+	IntrospectToken(ctx context.Context, token string) (*Introspection, error)
+	// RevokeClientToken revokes a token on behalf of clientID. Unknown
+	// tokens are not an error; tokens of other clients are ErrTokenNotOwned.
+	RevokeClientToken(ctx context.Context, clientID, token string) error
+}
+
+// Handler serves the OAuth2 token, introspection and revocation endpoints.
+// Every endpoint requires client authentication with HTTP Basic or the
+// client_id and client_secret form parameters.
+type Handler struct {
+	clients *Clients
+	tokens  TokenService
+	logger  *zap.Logger
+	mux     *http.ServeMux
+}
+
+// NewHandler creates the OAuth2 endpoints for clients backed by tokens
+func NewHandler(clients *Clients, tokens TokenService, logger *zap.Logger) *Handler {
+	h := &Handler{
+		clients: clients,
+		tokens:  tokens,
+		logger:  logger,
+		mux:     http.NewServeMux(),
+	}
+	h.mux.HandleFunc("POST "+TokenPath, h.token)
+	h.mux.HandleFunc("POST "+IntrospectPath, h.introspect)
+	h.mux.HandleFunc("POST "+RevokePath, h.revoke)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r.WithContext(callerContext(r)))
+}
+
+// callerContext describes the caller the way a gRPC call would, with its
+// address as the peer and User-Agent and X-Request-Id as incoming metadata,
+// so the token service can audit both kinds of callers alike
+func callerContext(r *http.Request) context.Context {
+	ctx := peer.NewContext(r.Context(), &peer.Peer{Addr: remoteAddr(r.RemoteAddr)})
+
+	md := metadata.MD{}
+	if ua := r.UserAgent(); ua != "" {
+		md.Set("user-agent", ua)
+	}
+	if id := r.Header.Get("X-Request-Id"); id != "" {
+		md.Set("x-request-id", id)
+	}
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+type remoteAddr string
+
+func (a remoteAddr) Network() string { return "tcp" }
+func (a remoteAddr) String() string  { return string(a) }
+
+// token implements the client-credentials grant (RFC 6749 section 4.4)
+func (h *Handler) token(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if grantType := r.PostForm.Get("grant_type"); grantType != "client_credentials" {
+		if grantType == "" {
+			writeError(w, http.StatusBadRequest, "invalid_request", "missing grant_type")
+		} else {
+			writeError(w, http.StatusBadRequest, "unsupported_grant_type", "only client_credentials is supported")
+		}
+		return
+	}
+
+	scopes, ok := client.GrantScopes(r.PostForm.Get("scope"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_scope", "requested scope exceeds the client's registration")
+		return
+	}
+
+	token, expiresAt, err := h.tokens.IssueClientToken(r.Context(), client.ID, scopes)
+	if err != nil {
+		h.serverError(w, "issue client token", err)
+		return
+	}
+
+	h.logger.Info("client token issued", zap.String("client_id", client.ID), zap.Strings("scopes", scopes))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int64(time.Until(expiresAt).Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// introspect implements RFC 7662 token introspection
+func (h *Handler) introspect(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authenticate(w, r); !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "missing token")
+		return
+	}
+
+	info, err := h.tokens.IntrospectToken(r.Context(), token)
+	if err != nil {
+		h.serverError(w, "introspect token", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// revoke implements RFC 7009 token revocation
+func (h *Handler) revoke(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "missing token")
+		return
+	}
+
+	err := h.tokens.RevokeClientToken(r.Context(), client.ID, token)
+	if errors.Is(err, ErrTokenNotOwned) {
+		writeError(w, http.StatusBadRequest, "unauthorized_client", err.Error())
+		return
+	}
+	if err != nil {
+		h.serverError(w, "revoke token", err)
+		return
+	}
+
+	// Unknown and already revoked tokens also succeed (RFC 7009 section 2.2)
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticate parses the form and verifies the client credentials. It
+// writes the error response and returns false when they are missing or wrong.
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (*Client, bool) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return nil, false
+	}
+
+	id, secret, basic := r.BasicAuth()
+	formID, formSecret := r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	switch {
+	case basic && (formID != "" || formSecret != ""):
+		writeError(w, http.StatusBadRequest, "invalid_request", "use only one client authentication method")
+		return nil, false
+	case basic:
+		// Credentials are form-urlencoded before Basic encoding (RFC 6749 section 2.3.1)
+		var errID, errSecret error
+		id, errID = url.QueryUnescape(id)
+		secret, errSecret = url.QueryUnescape(secret)
+		if errID != nil || errSecret != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "malformed client credentials")
+			return nil, false
+		}
+	default:
+		id, secret = formID, formSecret
+	}
+
+	client, ok := h.clients.Authenticate(id, secret)
+	if !ok {
+		h.logger.Warn("client authentication failed", zap.String("client_id", id), zap.String("path", r.URL.Path))
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+		}
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return nil, false
+	}
+	return client, true
+}
+
+func (h *Handler) serverError(w http.ResponseWriter, op string, err error) {
+	h.logger.Error("oauth2 request failed", zap.String("op", op), zap.Error(err))
+	writeError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "token store unavailable")
+}
+
+func writeError(w http.ResponseWriter, code int, errorCode, description string) {
+	writeJSON(w, code, map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
+
+// writeJSON writes an uncacheable JSON response as RFC 6749 requires for
+// anything that may contain tokens
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
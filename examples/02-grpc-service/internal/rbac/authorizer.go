@@ -0,0 +1,207 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrUnknownRole is returned when assigning a role the policy does not define
+var ErrUnknownRole = errors.New("unknown role")
+
+// MatchedRule identifies the permission that decided an authorization.
+// Permission.Effect is always set.
+type MatchedRule struct {
+	Role       string
+	Permission Permission
+}
+
+// String formats the rule as "role: effect action on resource"
+func (r MatchedRule) String() string {
+	return fmt.Sprintf("%s: %s %s on %s", r.Role, r.Permission.Effect, r.Permission.Action, r.Permission.Resource)
+}
+
+// Decision is the result of an authorization check. Rule is nil when no
+// permission matched and access was denied by default.
+type Decision struct {
+	Allowed bool
+	Rule    *MatchedRule
+}
+
+// Authorizer evaluates a policy and tracks runtime role assignments.
+// Runtime grants and revocations survive policy reloads.
+type Authorizer struct {
+	mu          sync.RWMutex
+	policy      *Policy
+	grants      map[string]map[string]bool
+	revocations map[string]map[string]bool
+}
+
+// NewAuthorizer creates an authorizer for a validated policy
+func NewAuthorizer(policy *Policy) *Authorizer {
+	return &Authorizer{
+		policy:      policy,
+		grants:      make(map[string]map[string]bool),
+		revocations: make(map[string]map[string]bool),
+	}
+}
+
+// SetPolicy replaces the active policy
+func (a *Authorizer) SetPolicy(policy *Policy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.policy = policy
+}
+
+// RolesFor returns the roles assigned to a user, without inherited roles
+func (a *Authorizer) RolesFor(username string) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.assignedLocked(username)
+}
+
+// EffectiveRoles returns the roles assigned to a user together with every
+// role they inherit. Use it wherever roles gate access.
+func (a *Authorizer) EffectiveRoles(username string) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.policy.expand(a.assignedLocked(username))
+}
+
+// Assign grants a role to a user and returns the user's roles
+func (a *Authorizer) Assign(username, role string) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.policy.Roles[role]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRole, role)
+	}
+
+	delete(a.revocations[username], role)
+	if a.grants[username] == nil {
+		a.grants[username] = make(map[string]bool)
+	}
+	a.grants[username][role] = true
+
+	return a.assignedLocked(username), nil
+}
+
+// Revoke removes a role from a user and returns the user's roles
+func (a *Authorizer) Revoke(username, role string) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.policy.Roles[role]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRole, role)
+	}
+
+	delete(a.grants[username], role)
+	if a.revocations[username] == nil {
+		a.revocations[username] = make(map[string]bool)
+	}
+	a.revocations[username][role] = true
+
+	return a.assignedLocked(username), nil
+}
+
+// Authorize decides whether a user may perform action on resource. Deny
+// rules take precedence over allow rules; no match denies.
+func (a *Authorizer) Authorize(username, action, resource string) Decision {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var allow *MatchedRule
+	for _, role := range a.policy.expand(a.assignedLocked(username)) {
+		for _, perm := range a.policy.Roles[role].Permissions {
+			if !perm.matches(action, resource) {
+				continue
+			}
+			perm.Effect = perm.effect()
+			rule := &MatchedRule{Role: role, Permission: perm}
+			if perm.Effect == Deny {
+				return Decision{Allowed: false, Rule: rule}
+			}
+			if allow == nil {
+				allow = rule
+			}
+		}
+	}
+
+	if allow != nil {
+		return Decision{Allowed: true, Rule: allow}
+	}
+	return Decision{Allowed: false}
+}
+
+// Watch reloads the policy from path whenever the file changes, until ctx
+// is done. Invalid policies are logged and the previous policy is kept.
+func (a *Authorizer) Watch(ctx context.Context, path string, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastMod, lastSize := fileVersion(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		mod, size := fileVersion(path)
+		if mod.Equal(lastMod) && size == lastSize {
+			continue
+		}
+		lastMod, lastSize = mod, size
+
+		policy, err := LoadPolicyFile(path)
+		if err != nil {
+			logger.Error("policy reload failed, keeping previous policy", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		a.SetPolicy(policy)
+		logger.Info("policy reloaded", zap.String("path", path), zap.Int("roles", len(policy.Roles)))
+	}
+}
+
+func fileVersion(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return info.ModTime(), info.Size()
+}
+
+func (a *Authorizer) assignedLocked(username string) []string {
+	set := make(map[string]bool)
+	for _, role := range a.policy.DefaultRoles {
+		set[role] = true
+	}
+	for _, role := range a.policy.Assignments[username] {
+		set[role] = true
+	}
+	for role := range a.grants[username] {
+		set[role] = true
+	}
+	for role := range a.revocations[username] {
+		delete(set, role)
+	}
+
+	roles := make([]string, 0, len(set))
+	for role := range set {
+		// Skip roles removed from the policy by a reload
+		if _, ok := a.policy.Roles[role]; ok {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
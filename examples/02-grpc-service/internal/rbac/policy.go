@@ -0,0 +1,194 @@
+// Package rbac implements role-based access control: roles are sets of
+// permissions on resources, roles may inherit from other roles, and users
+// are assigned roles by username.
+package rbac
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Effect of a matching permission
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Permission grants or denies an action on a resource. Action and resource
+// accept "*" for anything and a trailing "*" for a prefix match.
+type Permission struct {
+	Action   string `yaml:"action"`
+	Resource string `yaml:"resource"`
+	Effect   Effect `yaml:"effect,omitempty"`
+}
+
+// Role is a named set of permissions, optionally inheriting other roles
+type Role struct {
+	Inherits    []string     `yaml:"inherits,omitempty"`
+	Permissions []Permission `yaml:"permissions,omitempty"`
+}
+
+// Policy is the full RBAC configuration
+type Policy struct {
+	// DefaultRoles are held by every user
+	DefaultRoles []string        `yaml:"default_roles"`
+	Roles        map[string]Role `yaml:"roles"`
+	// Assignments maps usernames to additional roles
+	Assignments map[string][]string `yaml:"assignments"`
+}
+
+// DefaultPolicy is used when no policy file is configured
+func DefaultPolicy() *Policy {
+	return &Policy{
+		DefaultRoles: []string{"user"},
+		Roles: map[string]Role{
+			"user": {
+				Permissions: []Permission{
+					{Action: "read", Resource: "profile:self"},
+					{Action: "validate", Resource: "token"},
+				},
+			},
+			"admin": {
+				Inherits: []string{"user"},
+				Permissions: []Permission{
+					{Action: "*", Resource: "*"},
+				},
+			},
+		},
+		Assignments: map[string][]string{
+			"admin": {"admin"},
+		},
+	}
+}
+
+// ParsePolicy decodes and validates a YAML policy
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// LoadPolicyFile reads and validates a YAML policy file
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	return ParsePolicy(data)
+}
+
+// Validate checks that every referenced role exists, effects are known and
+// inheritance is acyclic
+func (p *Policy) Validate() error {
+	for _, name := range p.DefaultRoles {
+		if _, ok := p.Roles[name]; !ok {
+			return fmt.Errorf("default role %q is not defined", name)
+		}
+	}
+
+	for user, roles := range p.Assignments {
+		for _, name := range roles {
+			if _, ok := p.Roles[name]; !ok {
+				return fmt.Errorf("user %q is assigned undefined role %q", user, name)
+			}
+		}
+	}
+
+	for name, role := range p.Roles {
+		for _, parent := range role.Inherits {
+			if _, ok := p.Roles[parent]; !ok {
+				return fmt.Errorf("role %q inherits undefined role %q", name, parent)
+			}
+		}
+		for _, perm := range role.Permissions {
+			if perm.Action == "" || perm.Resource == "" {
+				return fmt.Errorf("role %q has a permission without action or resource", name)
+			}
+			if perm.Effect != "" && perm.Effect != Allow && perm.Effect != Deny {
+				return fmt.Errorf("role %q has unknown effect %q", name, perm.Effect)
+			}
+		}
+	}
+
+	for name := range p.Roles {
+		if err := p.checkCycle(name, map[string]bool{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Policy) checkCycle(name string, visiting map[string]bool) error {
+	if visiting[name] {
+		return fmt.Errorf("role inheritance cycle through %q", name)
+	}
+	visiting[name] = true
+	for _, parent := range p.Roles[name].Inherits {
+		if err := p.checkCycle(parent, visiting); err != nil {
+			return err
+		}
+	}
+	delete(visiting, name)
+	return nil
+}
+
+// expand returns roles plus every role they inherit, sorted
+func (p *Policy) expand(roles []string) []string {
+	seen := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		if _, ok := p.Roles[name]; !ok {
+			return
+		}
+		seen[name] = true
+		for _, parent := range p.Roles[name].Inherits {
+			visit(parent)
+		}
+	}
+	for _, name := range roles {
+		visit(name)
+	}
+
+	expanded := make([]string, 0, len(seen))
+	for name := range seen {
+		expanded = append(expanded, name)
+	}
+	sort.Strings(expanded)
+	return expanded
+}
+
+func (perm Permission) effect() Effect {
+	if perm.Effect == "" {
+		return Allow
+	}
+	return perm.Effect
+}
+
+func (perm Permission) matches(action, resource string) bool {
+	return matchPattern(perm.Action, action) && matchPattern(perm.Resource, resource)
+}
+
+func matchPattern(pattern, value string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(value, prefix)
+	}
+	return pattern == value
+}
@@ -0,0 +1,213 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const testPolicy = `
+default_roles: [user]
+roles:
+  user:
+    permissions:
+      - {action: read, resource: "profile:self"}
+  auditor:
+    inherits: [user]
+    permissions:
+      - {action: read, resource: "events:*"}
+      - {action: read, resource: "events:secret", effect: deny}
+  admin:
+    inherits: [auditor]
+    permissions:
+      - {action: "*", resource: "*"}
+assignments:
+  alice: [auditor]
+  root: [admin]
+`
+
+func TestParsePolicy_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{
+			name:    "undefined default role",
+			policy:  "default_roles: [ghost]\nroles: {}\n",
+			wantErr: "default role",
+		},
+		{
+			name:    "undefined assigned role",
+			policy:  "roles: {user: {}}\nassignments: {bob: [ghost]}\n",
+			wantErr: "undefined role",
+		},
+		{
+			name:    "undefined parent",
+			policy:  "roles: {user: {inherits: [ghost]}}\n",
+			wantErr: "inherits undefined role",
+		},
+		{
+			name:    "inheritance cycle",
+			policy:  "roles: {a: {inherits: [b]}, b: {inherits: [a]}}\n",
+			wantErr: "cycle",
+		},
+		{
+			name:    "unknown effect",
+			policy:  "roles: {a: {permissions: [{action: x, resource: y, effect: maybe}]}}\n",
+			wantErr: "unknown effect",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(tt.policy))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAuthorizer_Authorize(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	authz := NewAuthorizer(policy)
+
+	tests := []struct {
+		name        string
+		subject     string
+		action      string
+		resource    string
+		wantAllowed bool
+		wantRole    string
+	}{
+		{name: "default role", subject: "bob", action: "read", resource: "profile:self", wantAllowed: true, wantRole: "user"},
+		{name: "no matching rule", subject: "bob", action: "read", resource: "events:login"},
+		{name: "assigned role prefix match", subject: "alice", action: "read", resource: "events:login", wantAllowed: true, wantRole: "auditor"},
+		{name: "inherited role", subject: "alice", action: "read", resource: "profile:self", wantAllowed: true, wantRole: "user"},
+		{name: "deny overrides allow", subject: "root", action: "read", resource: "events:secret", wantRole: "auditor"},
+		{name: "wildcard", subject: "root", action: "delete", resource: "users:42", wantAllowed: true, wantRole: "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := authz.Authorize(tt.subject, tt.action, tt.resource)
+			if decision.Allowed != tt.wantAllowed {
+				t.Errorf("expected allowed=%v, got %v", tt.wantAllowed, decision.Allowed)
+			}
+			gotRole := ""
+			if decision.Rule != nil {
+				gotRole = decision.Rule.Role
+				if decision.Rule.Permission.Effect == "" {
+					t.Error("expected matched rule effect to be set")
+				}
+			}
+			if gotRole != tt.wantRole {
+				t.Errorf("expected matched role %q, got %q", tt.wantRole, gotRole)
+			}
+		})
+	}
+}
+
+func TestAuthorizer_AssignRevoke(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	authz := NewAuthorizer(policy)
+
+	roles, err := authz.Assign("bob", "admin")
+	if err != nil {
+		t.Fatalf("assign failed: %v", err)
+	}
+	if want := []string{"admin", "user"}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("expected roles %v, got %v", want, roles)
+	}
+	if !authz.Authorize("bob", "delete", "users:1").Allowed {
+		t.Error("expected assigned admin role to allow delete")
+	}
+
+	// Revoking a role from the policy file overrides the file assignment
+	roles, err = authz.Revoke("alice", "auditor")
+	if err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	if want := []string{"user"}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("expected roles %v, got %v", want, roles)
+	}
+
+	if _, err := authz.Assign("bob", "ghost"); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("expected %v, got %v", ErrUnknownRole, err)
+	}
+
+	// Runtime changes survive a policy reload
+	authz.SetPolicy(policy)
+	if want := []string{"admin", "user"}; !reflect.DeepEqual(authz.RolesFor("bob"), want) {
+		t.Errorf("expected roles %v after reload, got %v", want, authz.RolesFor("bob"))
+	}
+}
+
+func TestAuthorizer_EffectiveRoles(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	authz := NewAuthorizer(policy)
+
+	if want := []string{"admin", "user"}; !reflect.DeepEqual(authz.RolesFor("root"), want) {
+		t.Errorf("expected assigned roles %v, got %v", want, authz.RolesFor("root"))
+	}
+	if want := []string{"admin", "auditor", "user"}; !reflect.DeepEqual(authz.EffectiveRoles("root"), want) {
+		t.Errorf("expected effective roles %v, got %v", want, authz.EffectiveRoles("root"))
+	}
+}
+
+func TestAuthorizer_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(testPolicy), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	policy, err := LoadPolicyFile(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	authz := NewAuthorizer(policy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go authz.Watch(ctx, path, 10*time.Millisecond, zap.NewNop())
+
+	// An invalid file keeps the previous policy
+	if err := os.WriteFile(path, []byte("roles: {a: {inherits: [ghost]}}"), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	updated := strings.Replace(testPolicy, "alice: [auditor]", "alice: [admin]", 1)
+	time.Sleep(50 * time.Millisecond)
+	if !reflect.DeepEqual(authz.RolesFor("alice"), []string{"auditor", "user"}) {
+		t.Fatalf("expected invalid policy to be ignored, got %v", authz.RolesFor("alice"))
+	}
+
+	if err := os.WriteFile(path, []byte(updated), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	deadline := time.After(2 * time.Second)
+	for !reflect.DeepEqual(authz.RolesFor("alice"), []string{"admin", "user"}) {
+		select {
+		case <-deadline:
+			t.Fatalf("policy not reloaded, alice has %v", authz.RolesFor("alice"))
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lookup resolves a dotted path such as "user.roles.0" in a decoded response
+func lookup(v interface{}, path string) (interface{}, bool) {
+	for _, part := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			next, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// check returns a description of the first unmet condition, or "" when the
+// value satisfies the assertion
+func (a Assertion) check(value interface{}, found bool, vars map[string]interface{}) string {
+	if a.Absent {
+		if found && !isEmpty(value) {
+			return fmt.Sprintf("expected to be absent, got %s", format(value))
+		}
+		return ""
+	}
+	if !found {
+		return "not found in response"
+	}
+
+	if a.Equals != nil {
+		want, err := renderValue(a.Equals, vars)
+		if err != nil {
+			return fmt.Sprintf("equals: %v", err)
+		}
+		if !equal(want, value) {
+			return fmt.Sprintf("expected %s, got %s", format(want), format(value))
+		}
+	}
+	if a.NotEmpty && isEmpty(value) {
+		return "expected a non-empty value"
+	}
+	if a.Contains != "" {
+		want, err := render(a.Contains, vars)
+		if err != nil {
+			return fmt.Sprintf("contains: %v", err)
+		}
+		if !contains(value, want) {
+			return fmt.Sprintf("expected to contain %q, got %s", want, format(value))
+		}
+	}
+	if a.pattern != nil && !a.pattern.MatchString(scalar(value)) {
+		return fmt.Sprintf("expected to match %s, got %s", a.Matches, format(value))
+	}
+	if a.Len != nil {
+		n, ok := length(value)
+		if !ok {
+			return fmt.Sprintf("has no length: %s", format(value))
+		}
+		if n != *a.Len {
+			return fmt.Sprintf("expected length %d, got %d", *a.Len, n)
+		}
+	}
+	return ""
+}
+
+// equal compares YAML and JSON values. Scalars compare by their text so
+// that `equals: 3` matches both 3 and the string "3" protojson uses for
+// 64-bit integers.
+func equal(want, got interface{}) bool {
+	switch want.(type) {
+	case map[string]interface{}, []interface{}:
+		normalized, err := roundTrip(want)
+		if err != nil {
+			return false
+		}
+		return reflect.DeepEqual(normalized, got)
+	default:
+		return scalar(want) == scalar(got)
+	}
+}
+
+func roundTrip(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(data)
+}
+
+// decodeJSON decodes with json.Number so large integers survive intact
+func decodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func contains(value interface{}, want string) bool {
+	if list, ok := value.([]interface{}); ok {
+		for _, item := range list {
+			if scalar(item) == want {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.Contains(scalar(value), want)
+}
+
+func length(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return len(v), true
+	case map[string]interface{}:
+		return len(v), true
+	case string:
+		return len(v), true
+	}
+	return 0, false
+}
+
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	if n, ok := length(value); ok {
+		return n == 0
+	}
+	return false
+}
+
+func scalar(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func format(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
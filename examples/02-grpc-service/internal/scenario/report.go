@@ -0,0 +1,159 @@
+package scenario
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// SuiteResult is the outcome of one scenario
+type SuiteResult struct {
+	Name     string
+	Steps    []StepResult
+	Duration time.Duration
+}
+
+// StepResult is the outcome of one step; it passed when Failures is empty
+type StepResult struct {
+	Name     string
+	Call     string
+	Duration time.Duration
+	Failures []string
+}
+
+// Passed reports whether the step met every expectation
+func (s StepResult) Passed() bool {
+	return len(s.Failures) == 0
+}
+
+// Failed returns the number of failed steps
+func (s *SuiteResult) Failed() int {
+	failed := 0
+	for _, step := range s.Steps {
+		if !step.Passed() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// WriteTAP reports suites in TAP version 13, one test point per step with
+// the failures in a YAML diagnostic block
+func WriteTAP(w io.Writer, suites []*SuiteResult) error {
+	total := 0
+	for _, suite := range suites {
+		total += len(suite.Steps)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "TAP version 13\n1..%d\n", total)
+
+	n := 0
+	for _, suite := range suites {
+		fmt.Fprintf(&b, "# %s\n", suite.Name)
+		for _, step := range suite.Steps {
+			n++
+			status := "ok"
+			if !step.Passed() {
+				status = "not ok"
+			}
+			fmt.Fprintf(&b, "%s %d - %s: %s\n", status, n, suite.Name, step.Name)
+			if step.Passed() {
+				continue
+			}
+
+			b.WriteString("  ---\n")
+			fmt.Fprintf(&b, "  call: %q\n", step.Call)
+			fmt.Fprintf(&b, "  duration_ms: %d\n", step.Duration.Milliseconds())
+			b.WriteString("  failures:\n")
+			for _, f := range step.Failures {
+				fmt.Fprintf(&b, "    - %q\n", f)
+			}
+			b.WriteString("  ...\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit reports suites as JUnit XML with one testsuite per scenario
+func WriteJUnit(w io.Writer, suites []*SuiteResult) error {
+	report := junitSuites{}
+	var total time.Duration
+	for _, suite := range suites {
+		js := junitSuite{
+			Name:     suite.Name,
+			Tests:    len(suite.Steps),
+			Failures: suite.Failed(),
+			Time:     seconds(suite.Duration),
+		}
+		for _, step := range suite.Steps {
+			jc := junitCase{
+				Name:      step.Name,
+				Classname: suite.Name,
+				Time:      seconds(step.Duration),
+			}
+			if !step.Passed() {
+				jc.Failure = &junitFailure{
+					Message: step.Failures[0],
+					Type:    step.Call,
+					Text:    strings.Join(step.Failures, "\n"),
+				}
+			}
+			js.Cases = append(js.Cases, jc)
+		}
+
+		report.Suites = append(report.Suites, js)
+		report.Tests += js.Tests
+		report.Failures += js.Failures
+		total += suite.Duration
+	}
+	report.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,313 @@
+package scenario
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// templateFuncs are available in every template
+var templateFuncs = template.FuncMap{
+	"env":  os.Getenv,
+	"uuid": func() string { return uuid.New().String() },
+}
+
+// responseJSON renders responses with proto field names and default values
+// so assertions can address every field
+var responseJSON = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// Runner executes scenarios over a gRPC connection
+type Runner struct {
+	conn grpc.ClientConnInterface
+	// Vars override scenario vars, e.g. credentials for a deployment
+	Vars map[string]interface{}
+}
+
+// NewRunner creates a runner calling through conn
+func NewRunner(conn grpc.ClientConnInterface) *Runner {
+	return &Runner{conn: conn}
+}
+
+// Run executes every step of s in order. A failing step does not stop the
+// scenario; steps that depend on its captures fail to render instead.
+func (r *Runner) Run(ctx context.Context, s *Scenario) *SuiteResult {
+	suite := &SuiteResult{Name: s.Name}
+	start := time.Now()
+
+	// Scenario vars are rendered once, so {{ uuid }} yields one value per run
+	rendered, err := renderValue(s.Vars, nil)
+	if err != nil {
+		suite.Steps = append(suite.Steps, StepResult{Name: "vars", Failures: []string{err.Error()}})
+		return suite
+	}
+	vars := make(map[string]interface{})
+	maps.Copy(vars, rendered.(map[string]interface{}))
+	maps.Copy(vars, r.Vars)
+
+	for i := range s.Steps {
+		suite.Steps = append(suite.Steps, r.runStep(ctx, &s.Steps[i], vars))
+	}
+	suite.Duration = time.Since(start)
+	return suite
+}
+
+func (r *Runner) runStep(ctx context.Context, step *Step, vars map[string]interface{}) StepResult {
+	result := StepResult{Name: step.Name, Call: step.Call}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	repeat := max(step.Repeat, 1)
+	concurrency := min(max(step.Concurrency, 1), repeat)
+
+	// Each iteration writes only its own slot, so no locking is needed
+	responses := make([]interface{}, repeat)
+	failures := make([][]string, repeat)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < repeat; i++ {
+		iterVars := maps.Clone(vars)
+		iterVars["iteration"] = i
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			responses[i], failures[i] = r.call(ctx, step, iterVars)
+		}()
+	}
+	wg.Wait()
+
+	for i, iterFailures := range failures {
+		for _, f := range iterFailures {
+			if repeat > 1 {
+				f = fmt.Sprintf("iteration %d: %s", i, f)
+			}
+			result.Failures = append(result.Failures, f)
+		}
+	}
+	response := responses[0]
+
+	if len(result.Failures) > 0 {
+		return result
+	}
+
+	// Only single calls capture, so the first response is the only one
+	for name, path := range step.Capture {
+		value, ok := lookup(response, path)
+		if !ok {
+			result.Failures = append(result.Failures, fmt.Sprintf("capture %s: no field %s in response", name, path))
+			continue
+		}
+		vars[name] = value
+	}
+	return result
+}
+
+// call performs one invocation of step and checks it against the
+// expectations, returning the decoded response and any failures
+func (r *Runner) call(ctx context.Context, step *Step, vars map[string]interface{}) (interface{}, []string) {
+	req, err := r.buildRequest(step, vars)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+
+	md := metadata.MD{}
+	for key, value := range step.Metadata {
+		rendered, err := render(value, vars)
+		if err != nil {
+			return nil, []string{fmt.Sprintf("metadata %s: %v", key, err)}
+		}
+		md.Append(key, rendered)
+	}
+
+	timeout := step.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(ctx, md), timeout)
+	defer cancel()
+
+	var response interface{}
+	if step.method.IsStreamingServer() {
+		response, err = r.stream(ctx, step, req)
+	} else {
+		response, err = r.unary(ctx, step, req)
+	}
+
+	st := status.Convert(err)
+	var failures []string
+	if st.Code() != step.code {
+		failures = append(failures, fmt.Sprintf("expected status %s, got %s: %s", step.code, st.Code(), st.Message()))
+		return response, failures
+	}
+	if step.Expect.Message != nil {
+		if f := step.Expect.Message.check(st.Message(), true, vars); f != "" {
+			failures = append(failures, "status message "+f)
+		}
+	}
+
+	for _, path := range sortedKeys(step.Expect.Fields) {
+		assertion := step.Expect.Fields[path]
+		value, found := lookup(response, path)
+		if f := assertion.check(value, found, vars); f != "" {
+			failures = append(failures, path+" "+f)
+		}
+	}
+	return response, failures
+}
+
+func (r *Runner) buildRequest(step *Step, vars map[string]interface{}) (proto.Message, error) {
+	fields, err := renderValue(step.Request, vars)
+	if err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+
+	req := newMessage(step.method.Input())
+	if err := protojson.Unmarshal(data, req); err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	return req, nil
+}
+
+func (r *Runner) unary(ctx context.Context, step *Step, req proto.Message) (interface{}, error) {
+	resp := newMessage(step.method.Output())
+	if err := r.conn.Invoke(ctx, methodPath(step.method), req, resp); err != nil {
+		return nil, err
+	}
+	return decode(resp)
+}
+
+func (r *Runner) stream(ctx context.Context, step *Step, req proto.Message) (interface{}, error) {
+	// Cancelled once enough messages are in so the server stops sending
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := r.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, methodPath(step.method))
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	maxMessages := 0
+	if step.Stream != nil {
+		maxMessages = step.Stream.MaxMessages
+	}
+
+	messages := []interface{}{}
+	for maxMessages == 0 || len(messages) < maxMessages {
+		msg := newMessage(step.method.Output())
+		err := stream.RecvMsg(msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return map[string]interface{}{"messages": messages}, err
+		}
+
+		decoded, err := decode(msg)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, decoded)
+	}
+	return map[string]interface{}{"messages": messages}, nil
+}
+
+func methodPath(m protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("/%s/%s", m.Parent().FullName(), m.Name())
+}
+
+// newMessage instantiates the generated type when it is linked in and a
+// dynamic message otherwise
+func newMessage(d protoreflect.MessageDescriptor) proto.Message {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(d.FullName()); err == nil {
+		return mt.New().Interface()
+	}
+	return dynamicpb.NewMessage(d)
+}
+
+// decode converts a message into generic JSON values for path lookups
+func decode(m proto.Message) (interface{}, error) {
+	data, err := responseJSON.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(data)
+}
+
+// render executes a template string over vars; referencing an unset
+// variable is an error
+func render(text string, vars map[string]interface{}) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// renderValue renders every string inside a decoded YAML value
+func renderValue(v interface{}, vars map[string]interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return render(v, vars)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			rendered, err := renderValue(value, vars)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			out[key] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			rendered, err := renderValue(value, vars)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", i, err)
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,266 @@
+// Package scenario runs declarative YAML scenarios against any deployment
+// of AuthService and reports the results as TAP or JUnit, so the example
+// client doubles as a contract-test runner.
+//
+// A scenario is a sequence of RPCs with templated request fields, expected
+// status codes, assertions on response fields and captured outputs that
+// later steps can reference:
+//
+//	name: login and validate
+//	vars:
+//	  username: alice
+//	steps:
+//	  - name: login
+//	    call: Login
+//	    request: {username: "{{ .username }}", password: password}
+//	    expect:
+//	      fields:
+//	        user.username: {equals: "{{ .username }}"}
+//	    capture:
+//	      token: token
+//	  - name: validate
+//	    call: ValidateToken
+//	    request: {token: "{{ .token }}"}
+//	    expect:
+//	      fields:
+//	        valid: {equals: true}
+package scenario
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"gopkg.in/yaml.v3"
+
+	// Registered so scenarios can call grpc.health.v1.Health/Check
+	_ "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// DefaultTimeout bounds each call of a step without its own timeout
+const DefaultTimeout = 10 * time.Second
+
+// defaultService is used for calls given as a bare method name
+var defaultService = authv1.AuthService_ServiceDesc.ServiceName
+
+// Scenario is a named sequence of steps
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Vars seed the template variables; captures and runner vars override them
+	Vars  map[string]interface{} `yaml:"vars,omitempty"`
+	Steps []Step                 `yaml:"steps"`
+}
+
+// Step is one RPC, optionally repeated
+type Step struct {
+	Name string `yaml:"name"`
+	// Call is a method of auth.v1.AuthService such as "Login", or a fully
+	// qualified method such as "grpc.health.v1.Health/Check"
+	Call string `yaml:"call"`
+	// Request is the request message in protojson field names; string
+	// values are Go templates over the scenario variables
+	Request map[string]interface{} `yaml:"request,omitempty"`
+	// Metadata is sent as request headers; values are templates
+	Metadata map[string]string `yaml:"metadata,omitempty"`
+	Timeout  time.Duration     `yaml:"timeout,omitempty"`
+	// Stream configures server-streaming calls
+	Stream *StreamOptions `yaml:"stream,omitempty"`
+	Expect Expect         `yaml:"expect,omitempty"`
+	// Capture maps variable names to response field paths
+	Capture map[string]string `yaml:"capture,omitempty"`
+	// Repeat runs the call this many times, Concurrency at once. Each
+	// iteration sees its zero-based index as {{ .iteration }}.
+	Repeat      int `yaml:"repeat,omitempty"`
+	Concurrency int `yaml:"concurrency,omitempty"`
+
+	method protoreflect.MethodDescriptor
+	code   codes.Code
+}
+
+// StreamOptions bounds a server-streaming call. The response of a stream
+// step is {"messages": [...]}.
+type StreamOptions struct {
+	// MaxMessages ends the stream successfully after this many messages;
+	// zero reads until the server closes it
+	MaxMessages int `yaml:"max_messages"`
+}
+
+// Expect describes the expected outcome of a call
+type Expect struct {
+	// Code is the expected status code name, e.g. "OK" or "PermissionDenied";
+	// defaults to OK
+	Code string `yaml:"code,omitempty"`
+	// Message is checked against the status message
+	Message *Assertion `yaml:"message,omitempty"`
+	// Fields maps response field paths ("user.roles.0") to assertions
+	Fields map[string]Assertion `yaml:"fields,omitempty"`
+}
+
+// Assertion checks a single value; all set conditions must hold
+type Assertion struct {
+	Equals   interface{} `yaml:"equals,omitempty"`
+	NotEmpty bool        `yaml:"not_empty,omitempty"`
+	Contains string      `yaml:"contains,omitempty"`
+	Matches  string      `yaml:"matches,omitempty"`
+	Len      *int        `yaml:"len,omitempty"`
+	Absent   bool        `yaml:"absent,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Parse decodes and validates a YAML scenario
+func Parse(data []byte) (*Scenario, error) {
+	return parse(data, "scenario")
+}
+
+// LoadFile reads a YAML scenario from path. Unnamed scenarios are named
+// after the file.
+func LoadFile(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read scenario: %w", err)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	s, err := parse(data, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func parse(data []byte, defaultName string) (*Scenario, error) {
+	var s Scenario
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse scenario: %w", err)
+	}
+	if s.Name == "" {
+		s.Name = defaultName
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Scenario) validate() error {
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("scenario %q has no steps", s.Name)
+	}
+
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step %d", i+1)
+		}
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("step %q: %w", step.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Step) validate() error {
+	method, err := resolveMethod(s.Call)
+	if err != nil {
+		return err
+	}
+	if method.IsStreamingClient() {
+		return fmt.Errorf("%s: client-streaming calls are not supported", s.Call)
+	}
+	if s.Stream != nil && !method.IsStreamingServer() {
+		return fmt.Errorf("%s: stream options on a unary call", s.Call)
+	}
+	s.method = method
+
+	s.code, err = parseCode(s.Expect.Code)
+	if err != nil {
+		return err
+	}
+
+	if s.Repeat < 0 || s.Concurrency < 0 {
+		return fmt.Errorf("repeat and concurrency must not be negative")
+	}
+	if s.Repeat > 1 && len(s.Capture) > 0 {
+		return fmt.Errorf("capture is ambiguous on a repeated step")
+	}
+
+	if s.Expect.Message != nil {
+		if err := s.Expect.Message.compile(); err != nil {
+			return fmt.Errorf("message: %w", err)
+		}
+	}
+	for path, a := range s.Expect.Fields {
+		if err := a.compile(); err != nil {
+			return fmt.Errorf("field %s: %w", path, err)
+		}
+		s.Expect.Fields[path] = a
+	}
+	return nil
+}
+
+func (a *Assertion) compile() error {
+	if a.Matches == "" {
+		return nil
+	}
+	pattern, err := regexp.Compile(a.Matches)
+	if err != nil {
+		return err
+	}
+	a.pattern = pattern
+	return nil
+}
+
+// resolveMethod looks up "Method" on AuthService or "pkg.Service/Method"
+func resolveMethod(call string) (protoreflect.MethodDescriptor, error) {
+	if call == "" {
+		return nil, fmt.Errorf("missing call")
+	}
+
+	service, name := defaultService, call
+	if i := strings.LastIndex(call, "/"); i >= 0 {
+		service, name = strings.TrimPrefix(call[:i], "/"), call[i+1:]
+	}
+
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("unknown service %s", service)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	method := sd.Methods().ByName(protoreflect.Name(name))
+	if method == nil {
+		return nil, fmt.Errorf("unknown method %s/%s", service, name)
+	}
+	return method, nil
+}
+
+// parseCode accepts status code names in either spelling, e.g.
+// "PermissionDenied" or "PERMISSION_DENIED"
+func parseCode(name string) (codes.Code, error) {
+	if name == "" {
+		return codes.OK, nil
+	}
+
+	normalize := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, "_", ""))
+	}
+	want := normalize(name)
+	if want == "cancelled" {
+		return codes.Canceled, nil
+	}
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if normalize(c.String()) == want {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown status code %q", name)
+}
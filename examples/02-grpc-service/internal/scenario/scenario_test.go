@@ -0,0 +1,217 @@
+package scenario
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/service"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/grpcauth"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newRunner starts an AuthService with the production interceptors and
+// returns a runner connected to it
+func newRunner(t *testing.T) *Runner {
+	t.Helper()
+
+	authService := service.NewAuthService(zap.NewNop())
+	authConfig := grpcauth.Config{
+		Validator: authService,
+		Policies: grpcauth.PoliciesFromService(
+			authv1.File_proto_auth_v1_auth_proto.Services().ByName("AuthService"),
+		).Merge(grpcauth.Policies{
+			"/grpc.health.v1.Health/": grpcauth.Public(),
+		}),
+	}
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcauth.UnaryServerInterceptor(authConfig)),
+		grpc.ChainStreamInterceptor(grpcauth.StreamServerInterceptor(authConfig)),
+	)
+	authv1.RegisterAuthServiceServer(server, authService)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return NewRunner(conn)
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{name: "no steps", yaml: "name: empty\n", want: "no steps"},
+		{name: "unknown method", yaml: "steps:\n  - call: Nope\n", want: "unknown method"},
+		{name: "unknown service", yaml: "steps:\n  - call: x.Y/Z\n", want: "unknown service"},
+		{name: "unknown code", yaml: "steps:\n  - call: Login\n    expect: {code: Bogus}\n", want: "unknown status code"},
+		{name: "stream options on unary", yaml: "steps:\n  - call: Login\n    stream: {max_messages: 1}\n", want: "unary"},
+		{name: "capture on repeat", yaml: "steps:\n  - call: Login\n    repeat: 2\n    capture: {t: token}\n", want: "ambiguous"},
+		{name: "bad pattern", yaml: "steps:\n  - call: Login\n    expect:\n      fields:\n        token: {matches: \"(\"}\n", want: "field token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseCode(t *testing.T) {
+	for _, name := range []string{"PermissionDenied", "PERMISSION_DENIED", "permission_denied"} {
+		if c, err := parseCode(name); err != nil || c.String() != "PermissionDenied" {
+			t.Errorf("parseCode(%q) = %v, %v", name, c, err)
+		}
+	}
+	if c, err := parseCode("CANCELLED"); err != nil || c.String() != "Canceled" {
+		t.Errorf("parseCode(CANCELLED) = %v, %v", c, err)
+	}
+}
+
+func TestRunner_ContractScenario(t *testing.T) {
+	s, err := LoadFile("../../scenarios/auth-contract.yaml")
+	if err != nil {
+		t.Fatalf("failed to load scenario: %v", err)
+	}
+
+	result := newRunner(t).Run(context.Background(), s)
+	for _, step := range result.Steps {
+		if !step.Passed() {
+			t.Errorf("step %q failed: %v", step.Name, step.Failures)
+		}
+	}
+	if len(result.Steps) != len(s.Steps) {
+		t.Errorf("expected %d step results, got %d", len(s.Steps), len(result.Steps))
+	}
+}
+
+func TestRunner_ReportsFailures(t *testing.T) {
+	s, err := Parse([]byte(`
+name: failing
+steps:
+  - name: wrong code
+    call: Login
+    request: {username: alice, password: password}
+    expect: {code: Unauthenticated}
+  - name: wrong field
+    call: Login
+    request: {username: alice, password: password}
+    expect:
+      fields:
+        user.username: {equals: bob}
+        user.id: {matches: "^[0-9a-f-]{36}$"}
+        missing.field: {not_empty: true}
+  - name: missing capture
+    call: ValidateToken
+    request: {token: "{{ .never_captured }}"}
+  - name: repeated failure
+    call: Login
+    repeat: 3
+    request: {username: "user-{{ .iteration }}", password: wrong}
+`))
+	if err != nil {
+		t.Fatalf("failed to parse scenario: %v", err)
+	}
+
+	result := newRunner(t).Run(context.Background(), s)
+	if result.Failed() != 4 {
+		t.Fatalf("expected 4 failed steps, got %d: %+v", result.Failed(), result.Steps)
+	}
+
+	wantFailures := map[string][]string{
+		"wrong code":       {"expected status Unauthenticated, got OK"},
+		"wrong field":      {"missing.field not found in response", `user.username expected "bob", got "alice"`},
+		"missing capture":  {"never_captured"},
+		"repeated failure": {"iteration 0:", "iteration 1:", "iteration 2:"},
+	}
+	for _, step := range result.Steps {
+		joined := strings.Join(step.Failures, "\n")
+		for _, want := range wantFailures[step.Name] {
+			if !strings.Contains(joined, want) {
+				t.Errorf("step %q: expected failure containing %q, got %q", step.Name, want, joined)
+			}
+		}
+	}
+	// The ID pattern holds, so it must not be reported
+	if strings.Contains(strings.Join(result.Steps[1].Failures, "\n"), "user.id") {
+		t.Errorf("unexpected ID failure: %v", result.Steps[1].Failures)
+	}
+}
+
+func TestReports(t *testing.T) {
+	suites := []*SuiteResult{
+		{
+			Name: "first",
+			Steps: []StepResult{
+				{Name: "login", Call: "Login"},
+				{Name: "validate", Call: "ValidateToken", Failures: []string{`valid expected true, got false`}},
+			},
+		},
+		{
+			Name:  "second",
+			Steps: []StepResult{{Name: "health", Call: "grpc.health.v1.Health/Check"}},
+		},
+	}
+
+	t.Run("tap", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteTAP(&buf, suites); err != nil {
+			t.Fatalf("WriteTAP failed: %v", err)
+		}
+		out := buf.String()
+		for _, want := range []string{
+			"TAP version 13\n1..3\n",
+			"ok 1 - first: login\n",
+			"not ok 2 - first: validate\n  ---\n",
+			`    - "valid expected true, got false"`,
+			"ok 3 - second: health\n",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("expected TAP output to contain %q, got:\n%s", want, out)
+			}
+		}
+	})
+
+	t.Run("junit", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteJUnit(&buf, suites); err != nil {
+			t.Fatalf("WriteJUnit failed: %v", err)
+		}
+
+		var report junitSuites
+		if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+			t.Fatalf("invalid JUnit XML: %v\n%s", err, buf.String())
+		}
+		if report.Tests != 3 || report.Failures != 1 || len(report.Suites) != 2 {
+			t.Errorf("unexpected totals: %+v", report)
+		}
+		failure := report.Suites[0].Cases[1].Failure
+		if failure == nil || failure.Message != "valid expected true, got false" {
+			t.Errorf("expected failure on validate, got %+v", failure)
+		}
+	})
+}
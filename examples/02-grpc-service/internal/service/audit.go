@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/audit"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditLog returns the log that audit records are written to
+func (s *AuthService) AuditLog() *audit.Log {
+	return s.audit
+}
+
+// recordAudit completes r with the caller's address, user agent and
+// correlation ID and writes it to the audit log
+func (s *AuthService) recordAudit(ctx context.Context, r audit.Record) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	r.ClientIP = s.clientIP(ctx)
+	// The HTTP gateway forwards the browser's User-Agent under its own key
+	r.UserAgent = firstValue(md, "grpcgateway-user-agent")
+	if r.UserAgent == "" {
+		r.UserAgent = firstValue(md, "user-agent")
+	}
+	r.CorrelationID = firstValue(md, "x-request-id")
+	if r.CorrelationID == "" {
+		r.CorrelationID = uuid.New().String()
+	}
+	s.audit.Record(r)
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ListAuditEvents returns the retained audit records matching the request,
+// newest first
+func (s *AuthService) ListAuditEvents(ctx context.Context, req *authv1.ListAuditEventsRequest) (*authv1.ListAuditEventsResponse, error) {
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultAuditLimit
+	}
+	limit = min(limit, maxAuditLimit)
+
+	filter := audit.Filter{
+		UserID:   req.UserId,
+		Username: req.Username,
+		Limit:    limit,
+	}
+	if req.StartTime != nil {
+		filter.Since = req.StartTime.AsTime()
+	}
+	if req.EndTime != nil {
+		filter.Until = req.EndTime.AsTime()
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Until.After(filter.Since) {
+		return nil, status.Error(codes.InvalidArgument, "end_time must be after start_time")
+	}
+
+	records := s.audit.Query(filter)
+	resp := &authv1.ListAuditEventsResponse{
+		Events: make([]*authv1.AuditEvent, 0, len(records)),
+	}
+	for _, r := range records {
+		resp.Events = append(resp.Events, &authv1.AuditEvent{
+			Time:          timestamppb.New(r.Time),
+			Action:        r.Action,
+			Outcome:       string(r.Outcome),
+			Reason:        r.Reason,
+			UserId:        r.UserID,
+			Username:      r.Username,
+			ClientId:      r.ClientID,
+			ClientIp:      r.ClientIP,
+			UserAgent:     r.UserAgent,
+			CorrelationId: r.CorrelationID,
+		})
+	}
+	return resp, nil
+}
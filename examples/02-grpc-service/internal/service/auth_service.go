@@ -2,32 +2,207 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/audit"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/identity"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/lockout"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/mfa"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/notify"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/rbac"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/store"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/verification"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/grpcauth"
 	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// Config holds auth service configuration
+type Config struct {
+	// Authorizer holds roles and role assignments. A nil Authorizer uses
+	// rbac.DefaultPolicy.
+	Authorizer *rbac.Authorizer
+	// Lockout configures brute-force protection for Login
+	Lockout lockout.Config
+	// MFA configures TOTP enrollment and login challenges
+	MFA mfa.Config
+	// Tokens and Sessions hold issued tokens and active sessions. Nil uses
+	// process-local maps; share a Redis backend between replicas.
+	Tokens   store.TokenStore
+	Sessions store.SessionStore
+	// Users holds user accounts and enforces unique usernames and verified
+	// email addresses. Nil uses a process-local map.
+	Users store.UserStore
+	// Notifier delivers email verification codes. Nil logs them instead.
+	Notifier notify.Notifier
+	// Verification configures email verification codes
+	Verification verification.Config
+	// Audit receives security audit records. Nil keeps the most recent
+	// records in memory only.
+	Audit *audit.Log
+	// TrustedProxies are the networks of proxies, such as the HTTP gateway,
+	// whose X-Forwarded-For header names the real client. Empty trusts none.
+	TrustedProxies []*net.IPNet
+}
+
+// DefaultConfig returns the configuration used by NewAuthService
+func DefaultConfig() Config {
+	return Config{
+		Lockout:      lockout.DefaultConfig(),
+		MFA:          mfa.DefaultConfig(),
+		Verification: verification.DefaultConfig(),
+	}
+}
+
 // AuthService implements the gRPC AuthService
 type AuthService struct {
 	authv1.UnimplementedAuthServiceServer
-	sessions *SessionStore
-	tokens   *TokenManager
+	sessions store.SessionStore
+	tokens   store.TokenStore
+	users    store.UserStore
+	events   *EventBus
+	authz    *rbac.Authorizer
+	failures *lockout.Tracker
+	mfa      *mfa.Manager
+	verifier *verification.Manager
+	notifier notify.Notifier
+	audit    *audit.Log
 	logger   *zap.Logger
+
+	trustedProxies []*net.IPNet
 }
 
-// NewAuthService creates a new auth service
+// NewAuthService creates a new auth service with the default configuration
 func NewAuthService(logger *zap.Logger) *AuthService {
+	return NewAuthServiceWithConfig(logger, DefaultConfig())
+}
+
+// NewAuthServiceWithConfig creates a new auth service
+func NewAuthServiceWithConfig(logger *zap.Logger, cfg Config) *AuthService {
+	authz := cfg.Authorizer
+	if authz == nil {
+		authz = rbac.NewAuthorizer(rbac.DefaultPolicy())
+	}
+	tokens := cfg.Tokens
+	if tokens == nil {
+		tokens = store.NewMemoryTokenStore()
+	}
+	sessions := cfg.Sessions
+	if sessions == nil {
+		sessions = store.NewMemorySessionStore()
+	}
+	users := cfg.Users
+	if users == nil {
+		users = store.NewMemoryUserStore()
+	}
+	notifier := cfg.Notifier
+	if notifier == nil {
+		notifier = notify.NewLogNotifier(logger)
+	}
+	auditLog := cfg.Audit
+	if auditLog == nil {
+		auditLog = audit.NewLog(audit.DefaultBufferSize, logger)
+	}
+
 	return &AuthService{
-		sessions: NewSessionStore(),
-		tokens:   NewTokenManager(),
+		sessions: sessions,
+		tokens:   tokens,
+		users:    users,
+		events:   NewEventBus(defaultSubscriberBuffer, defaultEventRetention, DropOldest),
+		authz:    authz,
+		failures: lockout.NewTracker(cfg.Lockout),
+		mfa:      mfa.NewManager(cfg.MFA),
+		verifier: verification.NewManager(cfg.Verification),
+		notifier: notifier,
+		audit:    auditLog,
 		logger:   logger,
+
+		trustedProxies: cfg.TrustedProxies,
+	}
+}
+
+// Events returns the bus that authentication events are published to
+func (s *AuthService) Events() *EventBus {
+	return s.events
+}
+
+// CheckTokenStore is a health check for the token store
+func (s *AuthService) CheckTokenStore(ctx context.Context) error {
+	return s.tokens.HealthCheck(ctx)
+}
+
+// CheckSessionStore is a health check for the session store
+func (s *AuthService) CheckSessionStore(ctx context.Context) error {
+	return s.sessions.HealthCheck(ctx)
+}
+
+// CheckUserStore is a health check for the user store
+func (s *AuthService) CheckUserStore(ctx context.Context) error {
+	return s.users.HealthCheck(ctx)
+}
+
+// ValidateBearer resolves an access token to its principal for the
+// grpcauth interceptors. Refresh tokens and OAuth2 client tokens are
+// rejected.
+func (s *AuthService) ValidateBearer(ctx context.Context, token string) (*grpcauth.Principal, error) {
+	info, err := s.tokens.Lookup(ctx, token)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && (info.IsRefresh || info.ClientID != "")) {
+		s.recordAudit(ctx, audit.Record{
+			Action:  audit.ActionTokenValidate,
+			Outcome: audit.OutcomeFailure,
+			Reason:  audit.ReasonInvalidToken,
+		})
+		return nil, grpcauth.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.sessions.GetSession(ctx, info.SessionID)
+	if errors.Is(err, store.ErrNotFound) {
+		s.recordAudit(ctx, audit.Record{
+			Action:  audit.ActionTokenValidate,
+			Outcome: audit.OutcomeFailure,
+			Reason:  audit.ReasonSessionNotFound,
+			UserID:  info.UserID,
+		})
+		return nil, grpcauth.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcauth.Principal{
+		UserID:   session.UserID,
+		Username: session.Username,
+		Roles:    s.authz.EffectiveRoles(session.Username),
+		Token:    token,
+	}, nil
+}
+
+// ValidatePeer resolves a verified client certificate to a principal for
+// the grpcauth interceptors. The SPIFFE ID acts as the username, so roles
+// are assigned to workloads like to users.
+func (s *AuthService) ValidatePeer(ctx context.Context, id *grpcauth.PeerIdentity) (*grpcauth.Principal, error) {
+	if id.SPIFFEID == "" {
+		return nil, errors.New("client certificate has no SPIFFE ID")
 	}
+
+	return &grpcauth.Principal{
+		UserID:   id.SPIFFEID,
+		Username: id.SPIFFEID,
+		Roles:    s.authz.EffectiveRoles(id.SPIFFEID),
+	}, nil
 }
 
 // Login handles user authentication
@@ -36,34 +211,124 @@ func (s *AuthService) Login(ctx context.Context, req *authv1.LoginRequest) (*aut
 
 	// Validate request
 	if req.Username == "" || req.Password == "" {
+		s.recordAudit(ctx, audit.Record{
+			Action:   audit.ActionLogin,
+			Outcome:  audit.OutcomeFailure,
+			Reason:   audit.ReasonMissingCredentials,
+			Username: req.Username,
+		})
 		return nil, status.Error(codes.InvalidArgument, "username and password required")
 	}
 
+	// Usernames differing only in case or Unicode form are the same user
+	username, err := identity.NormalizeUsername(req.Username)
+	if err != nil {
+		s.recordAudit(ctx, audit.Record{
+			Action:   audit.ActionLogin,
+			Outcome:  audit.OutcomeFailure,
+			Reason:   audit.ReasonInvalidUsername,
+			Username: req.Username,
+		})
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Refuse attempts during backoff or lockout before checking credentials
+	ip := s.clientIP(ctx)
+	if block := s.failures.Check(username, ip); block != nil {
+		s.logger.Warn("login blocked",
+			zap.String("username", username),
+			zap.String("client_ip", ip),
+			zap.String("scope", string(block.Scope)),
+			zap.Duration("retry_after", block.RetryAfter),
+		)
+		s.recordLockedOut(ctx, username)
+		return nil, loginBlockedError(block)
+	}
+
 	// Simple authentication - in production, check against a database
 	// For demo purposes, we accept any username with password "password"
 	if req.Password != "password" {
+		s.recordLoginFailure(ctx, username, ip, audit.ReasonInvalidCredentials)
 		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
 	}
 
-	// Generate user ID and tokens
-	userID := uuid.New().String()
-	token, tokenExpiry := s.tokens.GenerateToken(userID)
-	refreshToken, _ := s.tokens.GenerateRefreshToken(userID)
+	// Users with MFA get a challenge instead of tokens
+	if s.mfa.Enabled(username) {
+		challenge, expiresAt := s.mfa.NewChallenge(username)
+		s.logger.Info("mfa challenge issued", zap.String("username", username))
+		s.events.Publish(EventMFAChallenge, "", map[string]string{"username": username})
+
+		return &authv1.LoginResponse{
+			MfaRequired:           true,
+			MfaChallenge:          challenge,
+			MfaChallengeExpiresAt: timestamppb.New(expiresAt),
+		}, nil
+	}
+
+	s.failures.RecordSuccess(username)
+	return s.issueTokens(ctx, username, audit.ReasonPassword)
+}
+
+// issueTokens creates a new session for a fully authenticated user; every
+// login gets its own, so logging out elsewhere does not end it. The reason
+// records how the user authenticated.
+func (s *AuthService) issueTokens(ctx context.Context, username, reason string) (*authv1.LoginResponse, error) {
+	account, err := s.userFor(ctx, username)
+	if errors.Is(err, store.ErrUsernameTaken) {
+		s.recordAudit(ctx, audit.Record{
+			Action:   audit.ActionLogin,
+			Outcome:  audit.OutcomeFailure,
+			Reason:   audit.ReasonConfusableUsername,
+			Username: username,
+		})
+		return nil, status.Error(codes.AlreadyExists, "username is confusable with an existing username")
+	}
+	if err != nil {
+		return nil, s.storeError("resolve user", err)
+	}
+
+	// Generate tokens
+	userID := account.ID
+	sessionID := uuid.New().String()
+	token, tokenExpiry, err := s.tokens.GenerateToken(ctx, userID, sessionID)
+	if err != nil {
+		return nil, s.storeError("issue token", err)
+	}
+	refreshToken, _, err := s.tokens.GenerateRefreshToken(ctx, userID, sessionID)
+	if err != nil {
+		return nil, s.storeError("issue refresh token", err)
+	}
 
 	// Create session
-	email := fmt.Sprintf("%s@example.com", req.Username)
-	roles := []string{"user"}
-	s.sessions.CreateSession(userID, req.Username, email, roles)
+	roles := s.authz.RolesFor(username)
+	err = s.sessions.CreateSession(ctx, &store.Session{
+		ID:       sessionID,
+		UserID:   userID,
+		Username: username,
+		Email:    account.Email,
+		Roles:    roles,
+	})
+	if err != nil {
+		return nil, s.storeError("create session", err)
+	}
 
 	// Build response
 	user := &authv1.User{
 		Id:       userID,
-		Username: req.Username,
-		Email:    email,
+		Username: username,
+		Email:    account.Email,
 		Roles:    roles,
 	}
 
 	s.logger.Info("login successful", zap.String("user_id", userID))
+	s.recordAudit(ctx, audit.Record{
+		Action:   audit.ActionLogin,
+		Outcome:  audit.OutcomeSuccess,
+		Reason:   reason,
+		UserID:   userID,
+		Username: username,
+	})
+	s.events.Publish(EventLogin, userID, map[string]string{"username": username})
 
 	return &authv1.LoginResponse{
 		Token:        token,
@@ -73,21 +338,118 @@ func (s *AuthService) Login(ctx context.Context, req *authv1.LoginRequest) (*aut
 	}, nil
 }
 
+// userFor returns the account for a normalized username, registering it on
+// first login. It returns store.ErrUsernameTaken when the username is new
+// but confusable with an existing one.
+func (s *AuthService) userFor(ctx context.Context, username string) (*store.User, error) {
+	user, err := s.users.GetUserByUsername(ctx, username)
+	if !errors.Is(err, store.ErrNotFound) {
+		return user, err
+	}
+
+	user = &store.User{
+		ID:        uuid.New().String(),
+		Username:  username,
+		Skeleton:  identity.Skeleton(username),
+		CreatedAt: time.Now(),
+	}
+	err = s.users.CreateUser(ctx, user)
+	if errors.Is(err, store.ErrUsernameTaken) {
+		// A concurrent first login may have registered the same username
+		if existing, err := s.users.GetUserByUsername(ctx, username); !errors.Is(err, store.ErrNotFound) {
+			return existing, err
+		}
+		return nil, store.ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("user registered", zap.String("user_id", user.ID), zap.String("username", username))
+	return user, nil
+}
+
+// storeError logs a token or session store failure and hides its details
+// from the caller
+func (s *AuthService) storeError(op string, err error) error {
+	s.logger.Error("store operation failed", zap.String("op", op), zap.Error(err))
+	return status.Error(codes.Unavailable, "token store unavailable")
+}
+
+// recordLoginFailure audits and publishes a failed login and applies
+// brute-force tracking
+func (s *AuthService) recordLoginFailure(ctx context.Context, username, ip, reason string) {
+	s.recordAudit(ctx, audit.Record{
+		Action:   audit.ActionLogin,
+		Outcome:  audit.OutcomeFailure,
+		Reason:   reason,
+		Username: username,
+	})
+	s.events.Publish(EventLoginFailed, "", map[string]string{
+		"username":  username,
+		"client_ip": ip,
+		"reason":    reason,
+	})
+	for _, l := range s.failures.RecordFailure(username, ip) {
+		s.logger.Warn("login locked out",
+			zap.String("scope", string(l.Scope)),
+			zap.String("key", l.Key),
+			zap.Int("failures", l.Failures),
+		)
+		s.events.Publish(EventAccountLocked, "", map[string]string{
+			"scope":         string(l.Scope),
+			string(l.Scope): l.Key,
+			"failures":      strconv.Itoa(l.Failures),
+			"locked_until":  l.LockedUntil.UTC().Format(time.RFC3339),
+		})
+	}
+}
+
+// recordLockedOut audits a login refused during backoff or lockout
+func (s *AuthService) recordLockedOut(ctx context.Context, username string) {
+	s.recordAudit(ctx, audit.Record{
+		Action:   audit.ActionLogin,
+		Outcome:  audit.OutcomeFailure,
+		Reason:   audit.ReasonLockedOut,
+		Username: username,
+	})
+}
+
 // Logout handles user logout
 func (s *AuthService) Logout(ctx context.Context, req *authv1.LogoutRequest) (*authv1.LogoutResponse, error) {
 	s.logger.Info("logout attempt")
 
 	// Validate token
-	userID, valid := s.tokens.ValidateToken(req.Token)
-	if !valid {
+	info, err := s.tokens.Lookup(ctx, req.Token)
+	if errors.Is(err, store.ErrNotFound) {
+		s.recordAudit(ctx, audit.Record{
+			Action:  audit.ActionLogout,
+			Outcome: audit.OutcomeFailure,
+			Reason:  audit.ReasonInvalidToken,
+		})
 		return nil, status.Error(codes.Unauthenticated, "invalid token")
 	}
+	if err != nil {
+		return nil, s.storeError("lookup token", err)
+	}
+	userID := info.UserID
 
-	// Revoke token and delete session
-	s.tokens.RevokeToken(req.Token)
-	s.sessions.DeleteSession(userID)
+	// Revoke the token and end its session; the user's other sessions stay
+	if err := s.tokens.RevokeToken(ctx, req.Token); err != nil {
+		return nil, s.storeError("revoke token", err)
+	}
+	if err := s.sessions.DeleteSession(ctx, info.SessionID); err != nil {
+		return nil, s.storeError("delete session", err)
+	}
 
 	s.logger.Info("logout successful", zap.String("user_id", userID))
+	s.recordAudit(ctx, audit.Record{
+		Action:  audit.ActionLogout,
+		Outcome: audit.OutcomeSuccess,
+		UserID:  userID,
+	})
+	s.events.Publish(EventTokenRevoked, userID, map[string]string{"token_type": "access"})
+	s.events.Publish(EventLogout, userID, nil)
 
 	return &authv1.LogoutResponse{
 		Success: true,
@@ -99,27 +461,55 @@ func (s *AuthService) ValidateToken(ctx context.Context, req *authv1.ValidateReq
 	s.logger.Info("validate token attempt")
 
 	// Validate token
-	userID, valid := s.tokens.ValidateToken(req.Token)
-	if !valid {
+	info, err := s.tokens.Lookup(ctx, req.Token)
+	if errors.Is(err, store.ErrNotFound) {
+		s.recordAudit(ctx, audit.Record{
+			Action:  audit.ActionTokenValidate,
+			Outcome: audit.OutcomeFailure,
+			Reason:  audit.ReasonInvalidToken,
+		})
 		return &authv1.ValidateResponse{
 			Valid: false,
 		}, nil
 	}
+	if err != nil {
+		return nil, s.storeError("lookup token", err)
+	}
+	userID := info.UserID
 
 	// Get session
-	session, exists := s.sessions.GetSession(userID)
-	if !exists {
+	session, err := s.sessions.GetSession(ctx, info.SessionID)
+	if errors.Is(err, store.ErrNotFound) {
+		s.recordAudit(ctx, audit.Record{
+			Action:  audit.ActionTokenValidate,
+			Outcome: audit.OutcomeFailure,
+			Reason:  audit.ReasonSessionNotFound,
+			UserID:  userID,
+		})
 		return &authv1.ValidateResponse{
 			Valid: false,
 		}, nil
 	}
+	if err != nil {
+		return nil, s.storeError("get session", err)
+	}
+
+	// The email may have been verified since the session was created
+	email := session.Email
+	account, err := s.users.GetUser(ctx, userID)
+	if err == nil {
+		email = account.Email
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, s.storeError("get user", err)
+	}
 
-	// Build user
+	// Build user with the current effective roles, so callers gating on
+	// them see inherited roles too
 	user := &authv1.User{
 		Id:       session.UserID,
 		Username: session.Username,
-		Email:    session.Email,
-		Roles:    session.Roles,
+		Email:    email,
+		Roles:    s.authz.EffectiveRoles(session.Username),
 	}
 
 	s.logger.Info("token valid", zap.String("user_id", userID))
@@ -127,66 +517,272 @@ func (s *AuthService) ValidateToken(ctx context.Context, req *authv1.ValidateReq
 	return &authv1.ValidateResponse{
 		Valid:     true,
 		User:      user,
-		ExpiresAt: timestamppb.New(time.Now().Add(1 * time.Hour)),
+		ExpiresAt: timestamppb.New(info.ExpiresAt),
 	}, nil
 }
 
-// RefreshToken generates a new access token from a refresh token
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token can be used once.
 func (s *AuthService) RefreshToken(ctx context.Context, req *authv1.RefreshRequest) (*authv1.RefreshResponse, error) {
 	s.logger.Info("refresh token attempt")
 
-	// Validate refresh token
-	userID, valid := s.tokens.ValidateToken(req.RefreshToken)
-	if !valid {
+	// Consume the refresh token and issue the new pair atomically
+	pair, err := s.tokens.RotateRefreshToken(ctx, req.RefreshToken)
+	if errors.Is(err, store.ErrNotFound) {
+		s.recordAudit(ctx, audit.Record{
+			Action:  audit.ActionTokenRefresh,
+			Outcome: audit.OutcomeFailure,
+			Reason:  audit.ReasonInvalidToken,
+		})
 		return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
 	}
-
-	if !s.tokens.IsRefreshToken(req.RefreshToken) {
+	if errors.Is(err, store.ErrNotRefreshToken) {
+		s.recordAudit(ctx, audit.Record{
+			Action:  audit.ActionTokenRefresh,
+			Outcome: audit.OutcomeFailure,
+			Reason:  audit.ReasonNotRefreshToken,
+		})
 		return nil, status.Error(codes.InvalidArgument, "not a refresh token")
 	}
+	if err != nil {
+		return nil, s.storeError("rotate refresh token", err)
+	}
 
-	// Generate new access token
-	token, tokenExpiry := s.tokens.GenerateToken(userID)
+	// A refresh token of a session ended by Logout is rejected; tokens
+	// issued for it would never validate
+	if _, err := s.sessions.GetSession(ctx, pair.SessionID); errors.Is(err, store.ErrNotFound) {
+		s.recordAudit(ctx, audit.Record{
+			Action:  audit.ActionTokenRefresh,
+			Outcome: audit.OutcomeFailure,
+			Reason:  audit.ReasonSessionNotFound,
+			UserID:  pair.UserID,
+		})
+		return nil, status.Error(codes.Unauthenticated, "session has ended")
+	} else if err != nil {
+		return nil, s.storeError("get session", err)
+	}
 
-	s.logger.Info("token refreshed", zap.String("user_id", userID))
+	s.logger.Info("token refreshed", zap.String("user_id", pair.UserID))
+	s.recordAudit(ctx, audit.Record{
+		Action:  audit.ActionTokenRefresh,
+		Outcome: audit.OutcomeSuccess,
+		UserID:  pair.UserID,
+	})
+	s.events.Publish(EventTokenRefreshed, pair.UserID, nil)
 
 	return &authv1.RefreshResponse{
-		Token:     token,
-		ExpiresAt: timestamppb.New(tokenExpiry),
+		Token:        pair.AccessToken,
+		ExpiresAt:    timestamppb.New(pair.AccessExpiresAt),
+		RefreshToken: pair.RefreshToken,
 	}, nil
 }
 
-// StreamEvents sends authentication events to the client (server streaming)
+// StreamEvents sends authentication events to the client (server streaming).
+// Events are filtered by type and user, and retained events can be replayed
+// by passing the last sequence the client has seen.
 func (s *AuthService) StreamEvents(req *authv1.EventsRequest, stream authv1.AuthService_StreamEventsServer) error {
-	s.logger.Info("stream events started", zap.Strings("event_types", req.EventTypes))
+	s.logger.Info("stream events started",
+		zap.Strings("event_types", req.EventTypes),
+		zap.Strings("user_ids", req.UserIds),
+	)
+
+	sub, err := s.events.Subscribe(EventFilter{
+		EventTypes: req.EventTypes,
+		UserIDs:    req.UserIds,
+	}, req.ResumeAfterSequence)
+	if errors.Is(err, ErrResumeTooOld) {
+		return status.Error(codes.OutOfRange, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.Internal, "failed to subscribe to events")
+	}
+	defer sub.Close()
 
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+	// Send headers right away so clients such as the HTTP gateway know the
+	// subscription is live before the first event arrives
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return status.Error(codes.Internal, "failed to send headers")
+	}
 
 	eventCount := 0
 	for {
-		select {
-		case <-stream.Context().Done():
-			s.logger.Info("stream events ended", zap.Int("events_sent", eventCount))
+		event, err := sub.Next(stream.Context())
+		if err != nil {
+			s.logger.Info("stream events ended",
+				zap.Int("events_sent", eventCount),
+				zap.Uint64("events_dropped", sub.Dropped()),
+			)
 			return nil
-		case <-ticker.C:
-			event := &authv1.Event{
-				EventType: "user_activity",
-				UserId:    uuid.New().String(),
-				Timestamp: timestamppb.Now(),
-				Metadata: map[string]string{
-					"action": "login_attempt",
-					"source": "web",
-				},
-			}
-
-			if err := stream.Send(event); err != nil {
-				s.logger.Error("failed to send event", zap.Error(err))
-				return status.Error(codes.Internal, "failed to send event")
-			}
-
-			eventCount++
-			s.logger.Debug("event sent", zap.Int("count", eventCount))
 		}
+
+		if err := stream.Send(event); err != nil {
+			s.logger.Error("failed to send event", zap.Error(err))
+			return status.Error(codes.Internal, "failed to send event")
+		}
+
+		eventCount++
+		s.logger.Debug("event sent", zap.Int("count", eventCount), zap.Uint64("sequence", event.Sequence))
+	}
+}
+
+// AssignRole grants a role to a user
+func (s *AuthService) AssignRole(ctx context.Context, req *authv1.AssignRoleRequest) (*authv1.RoleAssignmentResponse, error) {
+	if req.Username == "" || req.Role == "" {
+		return nil, status.Error(codes.InvalidArgument, "username and role required")
+	}
+
+	username := subjectName(req.Username)
+	roles, err := s.authz.Assign(username, req.Role)
+	if errors.Is(err, rbac.ErrUnknownRole) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to assign role")
+	}
+
+	s.logger.Info("role assigned", zap.String("username", username), zap.String("role", req.Role))
+	s.events.Publish(EventRoleAssigned, "", map[string]string{"username": username, "role": req.Role})
+
+	return &authv1.RoleAssignmentResponse{
+		Username: username,
+		Roles:    roles,
+	}, nil
+}
+
+// RevokeRole removes a role from a user
+func (s *AuthService) RevokeRole(ctx context.Context, req *authv1.RevokeRoleRequest) (*authv1.RoleAssignmentResponse, error) {
+	if req.Username == "" || req.Role == "" {
+		return nil, status.Error(codes.InvalidArgument, "username and role required")
+	}
+
+	username := subjectName(req.Username)
+	roles, err := s.authz.Revoke(username, req.Role)
+	if errors.Is(err, rbac.ErrUnknownRole) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to revoke role")
+	}
+
+	s.logger.Info("role revoked", zap.String("username", username), zap.String("role", req.Role))
+	s.events.Publish(EventRoleRevoked, "", map[string]string{"username": username, "role": req.Role})
+
+	return &authv1.RoleAssignmentResponse{
+		Username: username,
+		Roles:    roles,
+	}, nil
+}
+
+// Authorize decides whether a subject may perform an action on a resource.
+// Only admins may ask about subjects other than themselves, so callers
+// cannot probe other users' permissions.
+func (s *AuthService) Authorize(ctx context.Context, req *authv1.AuthorizeRequest) (*authv1.AuthorizeResponse, error) {
+	principal, ok := grpcauth.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if req.Subject == "" || req.Action == "" || req.Resource == "" {
+		return nil, status.Error(codes.InvalidArgument, "subject, action and resource required")
+	}
+
+	subject := subjectName(req.Subject)
+	if subject != principal.Username && !principal.HasAnyRole("admin") {
+		return nil, status.Error(codes.PermissionDenied, "only admins may authorize other subjects")
+	}
+
+	decision := s.authz.Authorize(subject, req.Action, req.Resource)
+
+	resp := &authv1.AuthorizeResponse{
+		Allowed: decision.Allowed,
+	}
+	if decision.Rule != nil {
+		perm := decision.Rule.Permission
+		resp.MatchedRule = &authv1.Rule{
+			Role:     decision.Rule.Role,
+			Effect:   string(perm.Effect),
+			Action:   perm.Action,
+			Resource: perm.Resource,
+		}
+	}
+
+	s.logger.Debug("authorization decision",
+		zap.String("subject", req.Subject),
+		zap.String("action", req.Action),
+		zap.String("resource", req.Resource),
+		zap.Bool("allowed", decision.Allowed),
+	)
+
+	return resp, nil
+}
+
+// Unlock clears failed login tracking for a username and/or client IP
+func (s *AuthService) Unlock(ctx context.Context, req *authv1.UnlockRequest) (*authv1.UnlockResponse, error) {
+	if req.Username == "" && req.ClientIp == "" {
+		return nil, status.Error(codes.InvalidArgument, "username or client_ip required")
+	}
+
+	username := ""
+	if req.Username != "" {
+		username = subjectName(req.Username)
+	}
+
+	unlocked := false
+	if username != "" && s.failures.Unlock(lockout.ScopeUsername, username) {
+		unlocked = true
+	}
+	if req.ClientIp != "" && s.failures.Unlock(lockout.ScopeClientIP, req.ClientIp) {
+		unlocked = true
+	}
+
+	s.logger.Info("login failures cleared",
+		zap.String("username", username),
+		zap.String("client_ip", req.ClientIp),
+		zap.Bool("unlocked", unlocked),
+	)
+	if unlocked {
+		s.events.Publish(EventAccountUnlocked, "", map[string]string{
+			"username":  username,
+			"client_ip": req.ClientIp,
+		})
+	}
+
+	return &authv1.UnlockResponse{
+		Unlocked: unlocked,
+	}, nil
+}
+
+// subjectName normalizes a username given to an admin RPC so it matches the
+// name users log in with. Other subjects, such as SPIFFE IDs, are not valid
+// usernames and are used verbatim.
+func subjectName(subject string) string {
+	if username, err := identity.NormalizeUsername(subject); err == nil {
+		return username
+	}
+	return subject
+}
+
+// loginBlockedError builds a RESOURCE_EXHAUSTED status carrying RetryInfo
+// and ErrorInfo details
+func loginBlockedError(block *lockout.Block) error {
+	reason := "LOGIN_BACKOFF"
+	if errors.Is(block.Err, lockout.ErrLocked) {
+		reason = "ACCOUNT_LOCKED"
+	}
+
+	st, err := status.New(codes.ResourceExhausted, block.Err.Error()).WithDetails(
+		&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(block.RetryAfter),
+		},
+		&errdetails.ErrorInfo{
+			Reason: reason,
+			Domain: "auth.v1",
+			Metadata: map[string]string{
+				"scope": string(block.Scope),
+			},
+		},
+	)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, block.Err.Error())
 	}
+	return st.Err()
 }
@@ -2,13 +2,30 @@ package service
 
 import (
 	"context"
+	"errors"
+	"net"
+	"reflect"
+	"regexp"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/mfa"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/notify"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/rbac"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/store"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/grpcauth"
 	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestAuthService_Login(t *testing.T) {
@@ -153,6 +170,51 @@ func TestAuthService_Logout(t *testing.T) {
 	}
 }
 
+func TestAuthService_LogoutKeepsOtherSessions(t *testing.T) {
+	service := NewAuthService(zap.NewNop())
+	ctx := context.Background()
+
+	// The same user signs in on two devices
+	laptop, err := service.Login(ctx, &authv1.LoginRequest{Username: "testuser", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	phone, err := service.Login(ctx, &authv1.LoginRequest{Username: "testuser", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	// Both logins stay valid; the second does not replace the first
+	for name, token := range map[string]string{"laptop": laptop.Token, "phone": phone.Token} {
+		if resp, err := service.ValidateToken(ctx, &authv1.ValidateRequest{Token: token}); err != nil || !resp.Valid {
+			t.Errorf("expected the %s token to be valid, got %v err=%v", name, resp, err)
+		}
+	}
+
+	if _, err := service.Logout(ctx, &authv1.LogoutRequest{Token: laptop.Token}); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+
+	if resp, err := service.ValidateToken(ctx, &authv1.ValidateRequest{Token: phone.Token}); err != nil || !resp.Valid {
+		t.Errorf("expected the phone token to survive the laptop logout, got %v err=%v", resp, err)
+	}
+	if got, err := service.IntrospectToken(ctx, phone.Token); err != nil || !got.Active {
+		t.Errorf("expected the phone token to introspect as active, got %+v err=%v", got, err)
+	}
+	if _, err := service.RefreshToken(ctx, &authv1.RefreshRequest{RefreshToken: phone.RefreshToken}); err != nil {
+		t.Errorf("expected the phone refresh token to work, got %v", err)
+	}
+
+	// The laptop session is gone, so its refresh token is refused too
+	if resp, err := service.ValidateToken(ctx, &authv1.ValidateRequest{Token: laptop.Token}); err != nil || resp.Valid {
+		t.Errorf("expected the laptop token to be invalid, got %v err=%v", resp, err)
+	}
+	_, err = service.RefreshToken(ctx, &authv1.RefreshRequest{RefreshToken: laptop.RefreshToken})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected the laptop refresh token to be rejected, got %v", err)
+	}
+}
+
 func TestAuthService_ValidateToken(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	service := NewAuthService(logger)
@@ -229,6 +291,12 @@ func TestAuthService_RefreshToken(t *testing.T) {
 			token:   loginResp.RefreshToken,
 			wantErr: false,
 		},
+		{
+			name:        "reused refresh token",
+			token:       loginResp.RefreshToken,
+			wantErr:     true,
+			expectedErr: codes.Unauthenticated,
+		},
 		{
 			name:        "invalid refresh token",
 			token:       "invalid-token",
@@ -269,74 +337,820 @@ func TestAuthService_RefreshToken(t *testing.T) {
 			if resp.Token == "" {
 				t.Error("expected new token, got empty string")
 			}
+			if resp.RefreshToken == "" || resp.RefreshToken == tt.token {
+				t.Errorf("expected rotated refresh token, got %q", resp.RefreshToken)
+			}
 		})
 	}
 }
 
+func TestAuthService_SharedRedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	newReplica := func() *AuthService {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+
+		cfg := DefaultConfig()
+		cfg.Tokens = store.NewRedisTokenStore(client, 0)
+		cfg.Sessions = store.NewRedisSessionStore(client)
+		cfg.Users = store.NewRedisUserStore(client)
+		return NewAuthServiceWithConfig(zap.NewNop(), cfg)
+	}
+	ctx := context.Background()
+
+	a, b := newReplica(), newReplica()
+
+	loginResp, err := a.Login(ctx, &authv1.LoginRequest{Username: "testuser", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	// A token issued by one replica is valid on the other
+	validateResp, err := b.ValidateToken(ctx, &authv1.ValidateRequest{Token: loginResp.Token})
+	if err != nil || !validateResp.Valid {
+		t.Fatalf("expected token to be valid on second replica, got %v err=%v", validateResp, err)
+	}
+	if validateResp.User.Username != "testuser" {
+		t.Errorf("expected testuser, got %s", validateResp.User.Username)
+	}
+
+	// The user account is shared too, so both replicas agree on the ID
+	otherResp, err := b.Login(ctx, &authv1.LoginRequest{Username: "TestUser", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if otherResp.User.Id != loginResp.User.Id {
+		t.Errorf("expected user ID %s on second replica, got %s", loginResp.User.Id, otherResp.User.Id)
+	}
+
+	// A refresh token can be redeemed once across replicas
+	if _, err := b.RefreshToken(ctx, &authv1.RefreshRequest{RefreshToken: loginResp.RefreshToken}); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	_, err = a.RefreshToken(ctx, &authv1.RefreshRequest{RefreshToken: loginResp.RefreshToken})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected reused refresh token to be rejected, got %v", err)
+	}
+
+	// Logging out on one replica invalidates the token on the other
+	if _, err := b.Logout(ctx, &authv1.LogoutRequest{Token: loginResp.Token}); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+	validateResp, err = a.ValidateToken(ctx, &authv1.ValidateRequest{Token: loginResp.Token})
+	if err != nil || validateResp.Valid {
+		t.Errorf("expected token to be invalid after logout, got %v err=%v", validateResp, err)
+	}
+
+	// The other login has its own session and is still signed in
+	validateResp, err = a.ValidateToken(ctx, &authv1.ValidateRequest{Token: otherResp.Token})
+	if err != nil || !validateResp.Valid {
+		t.Errorf("expected the second login to survive the logout, got %v err=%v", validateResp, err)
+	}
+}
+
+func TestAuthService_UsernameNormalization(t *testing.T) {
+	service := NewAuthService(zap.NewNop())
+	ctx := context.Background()
+
+	first, err := service.Login(ctx, &authv1.LoginRequest{Username: "scope", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		wantCode codes.Code
+	}{
+		{name: "same user", username: "scope", wantCode: codes.OK},
+		{name: "case folded", username: "Scope", wantCode: codes.OK},
+		{name: "fullwidth", username: "ｓｃｏｐｅ", wantCode: codes.OK},
+		{name: "cyrillic confusable", username: "ѕсоре", wantCode: codes.AlreadyExists},
+		{name: "digit confusable", username: "sc0pe", wantCode: codes.AlreadyExists},
+		{name: "mixed script", username: "ѕcope", wantCode: codes.InvalidArgument},
+		{name: "invalid character", username: "scope!", wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := service.Login(ctx, &authv1.LoginRequest{Username: tt.username, Password: "password"})
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("expected %v, got %v", tt.wantCode, err)
+			}
+			if err != nil {
+				return
+			}
+			if resp.User.Id != first.User.Id || resp.User.Username != "scope" {
+				t.Errorf("expected user %s (scope), got %s (%s)", first.User.Id, resp.User.Id, resp.User.Username)
+			}
+		})
+	}
+}
+
+type captureNotifier struct {
+	messages []notify.Message
+	err      error
+}
+
+func (n *captureNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	n.messages = append(n.messages, msg)
+	return n.err
+}
+
+// code extracts the verification code from the last message sent
+func (n *captureNotifier) code(t *testing.T) string {
+	t.Helper()
+	if len(n.messages) == 0 {
+		t.Fatal("expected a verification message")
+	}
+	code := regexp.MustCompile(`\b\d{6}\b`).FindString(n.messages[len(n.messages)-1].Body)
+	if code == "" {
+		t.Fatalf("no code in message %q", n.messages[len(n.messages)-1].Body)
+	}
+	return code
+}
+
+func TestAuthService_EmailVerification(t *testing.T) {
+	notifier := &captureNotifier{}
+	cfg := DefaultConfig()
+	cfg.Notifier = notifier
+	cfg.Verification.ResendInterval = 0
+	service := NewAuthServiceWithConfig(zap.NewNop(), cfg)
+	ctx := context.Background()
+
+	login := func(username string) (*authv1.LoginResponse, context.Context) {
+		resp, err := service.Login(ctx, &authv1.LoginRequest{Username: username, Password: "password"})
+		if err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+		principal, err := service.ValidateBearer(ctx, resp.Token)
+		if err != nil {
+			t.Fatalf("validate bearer failed: %v", err)
+		}
+		return resp, grpcauth.NewContext(ctx, principal)
+	}
+
+	aliceResp, aliceCtx := login("alice")
+	if aliceResp.User.Email != "" {
+		t.Errorf("expected no email before verification, got %q", aliceResp.User.Email)
+	}
+
+	if _, err := service.RequestEmailVerification(ctx, &authv1.RequestEmailVerificationRequest{Email: "alice@example.com"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected %v without principal, got %v", codes.Unauthenticated, err)
+	}
+	if _, err := service.RequestEmailVerification(aliceCtx, &authv1.RequestEmailVerificationRequest{Email: "not an email"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected %v for invalid email, got %v", codes.InvalidArgument, err)
+	}
+	if _, err := service.VerifyEmail(aliceCtx, &authv1.VerifyEmailRequest{Code: "123456"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected %v without pending verification, got %v", codes.FailedPrecondition, err)
+	}
+
+	reqResp, err := service.RequestEmailVerification(aliceCtx, &authv1.RequestEmailVerificationRequest{Email: "Alice@Example.com"})
+	if err != nil {
+		t.Fatalf("request verification failed: %v", err)
+	}
+	if reqResp.ExpiresAt == nil {
+		t.Error("expected expiry")
+	}
+	if to := notifier.messages[0].To; to != "alice@example.com" {
+		t.Errorf("expected code sent to normalized address, got %q", to)
+	}
+	code := notifier.code(t)
+
+	if _, err := service.VerifyEmail(aliceCtx, &authv1.VerifyEmailRequest{Code: "not-the-code"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected %v for wrong code, got %v", codes.InvalidArgument, err)
+	}
+	verifyResp, err := service.VerifyEmail(aliceCtx, &authv1.VerifyEmailRequest{Code: code})
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if verifyResp.User.Email != "alice@example.com" {
+		t.Errorf("expected verified email, got %q", verifyResp.User.Email)
+	}
+
+	// Existing tokens and later logins see the verified address
+	validateResp, err := service.ValidateToken(ctx, &authv1.ValidateRequest{Token: aliceResp.Token})
+	if err != nil || validateResp.User.Email != "alice@example.com" {
+		t.Errorf("expected verified email on validate, got %v err=%v", validateResp, err)
+	}
+	if resp, _ := login("ALICE"); resp.User.Email != "alice@example.com" {
+		t.Errorf("expected verified email on login, got %q", resp.User.Email)
+	}
+
+	// Another user can request the address but not verify it
+	_, bobCtx := login("bob")
+	if _, err := service.RequestEmailVerification(bobCtx, &authv1.RequestEmailVerificationRequest{Email: "alice@example.com"}); err != nil {
+		t.Fatalf("request verification failed: %v", err)
+	}
+	if _, err := service.VerifyEmail(bobCtx, &authv1.VerifyEmailRequest{Code: notifier.code(t)}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected %v for taken email, got %v", codes.AlreadyExists, err)
+	}
+
+	// A failed delivery does not leave a pending code behind
+	notifier.err = errors.New("smtp down")
+	if _, err := service.RequestEmailVerification(bobCtx, &authv1.RequestEmailVerificationRequest{Email: "bob@example.com"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected %v when delivery fails, got %v", codes.Unavailable, err)
+	}
+	if _, err := service.VerifyEmail(bobCtx, &authv1.VerifyEmailRequest{Code: notifier.code(t)}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected %v after failed delivery, got %v", codes.FailedPrecondition, err)
+	}
+}
+
 func TestAuthService_StreamEvents(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	service := NewAuthService(logger)
 
-	// Create a mock stream
-	mockStream := &mockStreamEventsServer{
-		ctx:    context.Background(),
-		events: make([]*authv1.Event, 0),
+	// Generate events before subscribing and replay them from the ring
+	loginResp, err := service.Login(context.Background(), &authv1.LoginRequest{
+		Username: "testuser",
+		Password: "password",
+	})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if _, err := service.Login(context.Background(), &authv1.LoginRequest{
+		Username: "testuser",
+		Password: "wrongpassword",
+	}); err == nil {
+		t.Fatal("expected failed login")
+	}
+	if _, err := service.RefreshToken(context.Background(), &authv1.RefreshRequest{
+		RefreshToken: loginResp.RefreshToken,
+	}); err != nil {
+		t.Fatalf("refresh failed: %v", err)
 	}
 
-	// Start streaming in a goroutine
-	done := make(chan error)
+	mockStream := newMockStreamEventsServer()
+	done := make(chan error, 1)
 	go func() {
-		err := service.StreamEvents(&authv1.EventsRequest{
-			EventTypes: []string{"user_activity"},
+		done <- service.StreamEvents(&authv1.EventsRequest{
+			EventTypes:          []string{EventLogin, EventTokenRefreshed, EventLogout},
+			UserIds:             []string{loginResp.User.Id},
+			ResumeAfterSequence: proto.Uint64(0),
 		}, mockStream)
-		done <- err
 	}()
 
-	// Wait for a few events to be sent
-	time.Sleep(6 * time.Second)
+	// Replayed events
+	for _, want := range []string{EventLogin, EventTokenRefreshed} {
+		event := <-mockStream.events
+		if event.EventType != want {
+			t.Errorf("expected event type %s, got %s", want, event.EventType)
+		}
+		if event.UserId != loginResp.User.Id {
+			t.Errorf("expected user ID %s, got %s", loginResp.User.Id, event.UserId)
+		}
+	}
+
+	// Live event published after the replay
+	if _, err := service.Logout(context.Background(), &authv1.LogoutRequest{
+		Token: loginResp.Token,
+	}); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+	event := <-mockStream.events
+	if event.EventType != EventLogout {
+		t.Errorf("expected event type %s, got %s", EventLogout, event.EventType)
+	}
+	if event.Sequence != service.Events().LastSequence() {
+		t.Errorf("expected sequence %d, got %d", service.Events().LastSequence(), event.Sequence)
+	}
 
-	// Cancel the stream
 	mockStream.cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := service.Events().SubscriberCount(); n != 0 {
+		t.Errorf("expected subscription to be closed, got %d subscribers", n)
+	}
+}
 
-	// Wait for stream to finish
-	err := <-done
+func TestAuthService_StreamEventsResumeTooOld(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	service := NewAuthService(logger)
+	service.events = NewEventBus(4, 2, DropOldest)
+
+	for i := 0; i < 3; i++ {
+		service.events.Publish(EventLogin, "user", nil)
+	}
+
+	err := service.StreamEvents(&authv1.EventsRequest{
+		ResumeAfterSequence: proto.Uint64(0),
+	}, newMockStreamEventsServer())
+	if st, _ := status.FromError(err); st.Code() != codes.OutOfRange {
+		t.Errorf("expected error code %v, got %v", codes.OutOfRange, st.Code())
+	}
+}
+
+func TestAuthService_RoleAssignment(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	service := NewAuthService(logger)
+
+	loginResp, err := service.Login(context.Background(), &authv1.LoginRequest{
+		Username: "testuser",
+		Password: "password",
+	})
 	if err != nil {
-		t.Errorf("unexpected error: %v", err)
+		t.Fatalf("login failed: %v", err)
+	}
+	if !reflect.DeepEqual(loginResp.User.Roles, []string{"user"}) {
+		t.Errorf("expected default roles [user], got %v", loginResp.User.Roles)
 	}
 
-	// Verify we received at least one event
-	if len(mockStream.events) == 0 {
-		t.Error("expected at least one event, got none")
+	tests := []struct {
+		name        string
+		assign      bool
+		role        string
+		wantErr     bool
+		expectedErr codes.Code
+		wantRoles   []string
+	}{
+		{
+			name:      "assign admin",
+			assign:    true,
+			role:      "admin",
+			wantRoles: []string{"admin", "user"},
+		},
+		{
+			name:        "assign unknown role",
+			assign:      true,
+			role:        "ghost",
+			wantErr:     true,
+			expectedErr: codes.NotFound,
+		},
+		{
+			name:      "revoke admin",
+			role:      "admin",
+			wantRoles: []string{"user"},
+		},
+		{
+			name:        "missing role",
+			assign:      true,
+			wantErr:     true,
+			expectedErr: codes.InvalidArgument,
+		},
 	}
 
-	// Verify event structure
-	if len(mockStream.events) > 0 {
-		event := mockStream.events[0]
-		if event.EventType == "" {
-			t.Error("expected event type, got empty string")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *authv1.RoleAssignmentResponse
+			var err error
+			if tt.assign {
+				resp, err = service.AssignRole(context.Background(), &authv1.AssignRoleRequest{Username: "testuser", Role: tt.role})
+			} else {
+				resp, err = service.RevokeRole(context.Background(), &authv1.RevokeRoleRequest{Username: "testuser", Role: tt.role})
+			}
+
+			if tt.wantErr {
+				if st, _ := status.FromError(err); st.Code() != tt.expectedErr {
+					t.Errorf("expected error code %v, got %v", tt.expectedErr, st.Code())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(resp.Roles, tt.wantRoles) {
+				t.Errorf("expected roles %v, got %v", tt.wantRoles, resp.Roles)
+			}
+
+			// ValidateToken reflects the current assignment
+			validateResp, err := service.ValidateToken(context.Background(), &authv1.ValidateRequest{Token: loginResp.Token})
+			if err != nil {
+				t.Fatalf("validate failed: %v", err)
+			}
+			if !reflect.DeepEqual(validateResp.User.Roles, tt.wantRoles) {
+				t.Errorf("expected validated roles %v, got %v", tt.wantRoles, validateResp.User.Roles)
+			}
+		})
+	}
+}
+
+// A role that inherits admin must pass the admin-only access policies, not
+// just the rule checks in Authorize
+func TestAuthService_InheritedRolePassesAccessPolicy(t *testing.T) {
+	policy, err := rbac.ParsePolicy([]byte(`
+default_roles: [user]
+roles:
+  user: {}
+  admin:
+    inherits: [user]
+  superadmin:
+    inherits: [admin]
+assignments:
+  ops: [superadmin]
+`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	logger, _ := zap.NewDevelopment()
+	service := NewAuthServiceWithConfig(logger, Config{Authorizer: rbac.NewAuthorizer(policy)})
+
+	loginResp, err := service.Login(context.Background(), &authv1.LoginRequest{Username: "ops", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	interceptor := grpcauth.UnaryServerInterceptor(grpcauth.Config{
+		Validator: service,
+		Policies:  grpcauth.PoliciesFromService(authv1.File_proto_auth_v1_auth_proto.Services().ByName("AuthService")),
+	})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+loginResp.Token))
+	info := &grpc.UnaryServerInfo{FullMethod: authv1.AuthService_AssignRole_FullMethodName}
+
+	_, err = interceptor(ctx, &authv1.AssignRoleRequest{Username: "testuser", Role: "admin"}, info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return service.AssignRole(ctx, req.(*authv1.AssignRoleRequest))
+		})
+	if err != nil {
+		t.Fatalf("expected superadmin to assign roles, got %v", err)
+	}
+}
+
+func TestAuthService_Authorize(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	service := NewAuthService(logger)
+
+	user := &grpcauth.Principal{Username: "testuser", Roles: []string{"user"}}
+	admin := &grpcauth.Principal{Username: "admin", Roles: []string{"admin", "user"}}
+
+	tests := []struct {
+		name        string
+		caller      *grpcauth.Principal
+		subject     string
+		action      string
+		resource    string
+		wantAllowed bool
+		wantRole    string
+		wantErr     codes.Code
+	}{
+		{
+			name:        "user allowed on own profile",
+			caller:      user,
+			subject:     "testuser",
+			action:      "read",
+			resource:    "profile:self",
+			wantAllowed: true,
+			wantRole:    "user",
+		},
+		{
+			name:     "user denied by default",
+			caller:   user,
+			subject:  "TestUser",
+			action:   "delete",
+			resource: "users:42",
+		},
+		{
+			name:        "admin allowed by wildcard",
+			caller:      admin,
+			subject:     "admin",
+			action:      "delete",
+			resource:    "users:42",
+			wantAllowed: true,
+			wantRole:    "admin",
+		},
+		{
+			name:        "admin may ask about other subjects",
+			caller:      admin,
+			subject:     "testuser",
+			action:      "read",
+			resource:    "profile:self",
+			wantAllowed: true,
+			wantRole:    "user",
+		},
+		{
+			name:     "user may not ask about other subjects",
+			caller:   user,
+			subject:  "admin",
+			action:   "delete",
+			resource: "users:42",
+			wantErr:  codes.PermissionDenied,
+		},
+		{
+			name:    "missing fields",
+			caller:  user,
+			subject: "testuser",
+			wantErr: codes.InvalidArgument,
+		},
+		{
+			name:     "unauthenticated",
+			subject:  "testuser",
+			action:   "read",
+			resource: "profile:self",
+			wantErr:  codes.Unauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.caller != nil {
+				ctx = grpcauth.NewContext(ctx, tt.caller)
+			}
+			resp, err := service.Authorize(ctx, &authv1.AuthorizeRequest{
+				Subject:  tt.subject,
+				Action:   tt.action,
+				Resource: tt.resource,
+			})
+			if tt.wantErr != codes.OK {
+				if st, _ := status.FromError(err); st.Code() != tt.wantErr {
+					t.Errorf("expected error code %v, got %v", tt.wantErr, st.Code())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.Allowed != tt.wantAllowed {
+				t.Errorf("expected allowed=%v, got %v", tt.wantAllowed, resp.Allowed)
+			}
+			if resp.MatchedRule.GetRole() != tt.wantRole {
+				t.Errorf("expected matched role %q, got %q", tt.wantRole, resp.MatchedRule.GetRole())
+			}
+		})
+	}
+}
+
+func TestAuthService_LoginLockout(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	cfg := DefaultConfig()
+	cfg.Lockout.FreeFailures = 10
+	cfg.Lockout.MaxUserFailures = 3
+	service := NewAuthServiceWithConfig(logger, cfg)
+
+	sub, err := service.Events().Subscribe(EventFilter{EventTypes: []string{EventAccountLocked}}, nil)
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	defer sub.Close()
+
+	login := func(password string) error {
+		_, err := service.Login(context.Background(), &authv1.LoginRequest{
+			Username: "victim",
+			Password: password,
+		})
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := status.Code(login("wrongpassword")); code != codes.Unauthenticated {
+			t.Fatalf("attempt %d: expected %v, got %v", i+1, codes.Unauthenticated, code)
 		}
-		if event.UserId == "" {
-			t.Error("expected user ID, got empty string")
+	}
+
+	// Locked out even with the right password
+	err = login("password")
+	st, _ := status.FromError(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("expected %v, got %v", codes.ResourceExhausted, st.Code())
+	}
+
+	var retry *errdetails.RetryInfo
+	var info *errdetails.ErrorInfo
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.RetryInfo:
+			retry = d
+		case *errdetails.ErrorInfo:
+			info = d
 		}
 	}
+	if retry == nil || retry.RetryDelay.AsDuration() <= 0 {
+		t.Errorf("expected positive retry delay, got %v", retry)
+	}
+	if info == nil || info.Reason != "ACCOUNT_LOCKED" {
+		t.Errorf("expected ACCOUNT_LOCKED error info, got %v", info)
+	}
+
+	event, err := sub.Next(context.Background())
+	if err != nil {
+		t.Fatalf("expected lockout event: %v", err)
+	}
+	if event.Metadata["username"] != "victim" {
+		t.Errorf("expected lockout event for victim, got %v", event.Metadata)
+	}
+
+	// Admin unlock restores access
+	unlockResp, err := service.Unlock(context.Background(), &authv1.UnlockRequest{Username: "victim"})
+	if err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if !unlockResp.Unlocked {
+		t.Error("expected unlocked=true")
+	}
+	if err := login("password"); err != nil {
+		t.Errorf("expected login after unlock to succeed, got %v", err)
+	}
+
+	if _, err := service.Unlock(context.Background(), &authv1.UnlockRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected %v for empty unlock, got %v", codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestAuthService_MFALogin(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	service := NewAuthService(logger)
+	ctx := context.Background()
+
+	loginResp, err := service.Login(ctx, &authv1.LoginRequest{Username: "mfauser", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	principal, err := service.ValidateBearer(ctx, loginResp.Token)
+	if err != nil {
+		t.Fatalf("validate bearer failed: %v", err)
+	}
+	authedCtx := grpcauth.NewContext(ctx, principal)
+
+	if _, err := service.EnrollMFA(ctx, &authv1.EnrollMFARequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected %v without principal, got %v", codes.Unauthenticated, status.Code(err))
+	}
+
+	enrollResp, err := service.EnrollMFA(authedCtx, &authv1.EnrollMFARequest{})
+	if err != nil {
+		t.Fatalf("enroll failed: %v", err)
+	}
+	secret, err := mfa.DecodeSecret(enrollResp.Secret)
+	if err != nil {
+		t.Fatalf("decode secret failed: %v", err)
+	}
+	codeAt := func(offset time.Duration) string {
+		return mfa.GenerateCode(secret, mfa.TimeStep(time.Now().Add(offset), 30*time.Second), 6)
+	}
+
+	confirmResp, err := service.ConfirmMFA(authedCtx, &authv1.ConfirmMFARequest{Code: codeAt(-30 * time.Second)})
+	if err != nil {
+		t.Fatalf("confirm failed: %v", err)
+	}
+	if !confirmResp.Enabled || len(confirmResp.RecoveryCodes) == 0 {
+		t.Fatalf("expected mfa enabled with recovery codes, got %+v", confirmResp)
+	}
+
+	// Step 1: password login now returns a challenge instead of tokens
+	challengeResp, err := service.Login(ctx, &authv1.LoginRequest{Username: "mfauser", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if !challengeResp.MfaRequired || challengeResp.MfaChallenge == "" || challengeResp.Token != "" {
+		t.Fatalf("expected mfa challenge without tokens, got %+v", challengeResp)
+	}
+
+	// Step 2: exchange the challenge for tokens
+	tests := []struct {
+		name         string
+		code         string
+		recoveryCode string
+		wantCode     codes.Code
+	}{
+		{name: "missing code", wantCode: codes.InvalidArgument},
+		{name: "wrong code", code: "not-a-code", wantCode: codes.Unauthenticated},
+		{name: "valid code", code: codeAt(0), wantCode: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := service.VerifyMFA(ctx, &authv1.VerifyMFARequest{
+				MfaChallenge: challengeResp.MfaChallenge,
+				Code:         tt.code,
+				RecoveryCode: tt.recoveryCode,
+			})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("expected %v, got %v", tt.wantCode, code)
+			}
+			if tt.wantCode == codes.OK && (resp.Token == "" || resp.User.Username != "mfauser") {
+				t.Errorf("expected tokens for mfauser, got %+v", resp)
+			}
+		})
+	}
+
+	// A used challenge cannot be replayed; recovery codes work on a new one
+	if _, err := service.VerifyMFA(ctx, &authv1.VerifyMFARequest{
+		MfaChallenge: challengeResp.MfaChallenge,
+		Code:         codeAt(30 * time.Second),
+	}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected used challenge to be rejected, got %v", status.Code(err))
+	}
+
+	challengeResp, err = service.Login(ctx, &authv1.LoginRequest{Username: "mfauser", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if _, err := service.VerifyMFA(ctx, &authv1.VerifyMFARequest{
+		MfaChallenge: challengeResp.MfaChallenge,
+		RecoveryCode: confirmResp.RecoveryCodes[0],
+	}); err != nil {
+		t.Errorf("expected recovery code login to succeed, got %v", err)
+	}
 }
 
 // Mock stream for testing
 type mockStreamEventsServer struct {
-	ctx      context.Context
-	cancel   context.CancelFunc
-	events   []*authv1.Event
+	ctx    context.Context
+	cancel context.CancelFunc
+	events chan *authv1.Event
 	authv1.AuthService_StreamEventsServer
 }
 
+func TestAuthService_AuditTrail(t *testing.T) {
+	service := NewAuthService(zap.NewNop())
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 5000}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("user-agent", "audit-test/1.0", "x-request-id", "req-42"))
+
+	start := time.Now()
+	if _, err := service.Login(ctx, &authv1.LoginRequest{Username: "auditee", Password: "wrong"}); err == nil {
+		t.Fatal("expected login with a wrong password to fail")
+	}
+	loginResp, err := service.Login(ctx, &authv1.LoginRequest{Username: "auditee", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	userID := loginResp.User.Id
+	if _, err := service.RefreshToken(ctx, &authv1.RefreshRequest{RefreshToken: loginResp.Token}); err == nil {
+		t.Fatal("expected refresh with an access token to fail")
+	}
+	if _, err := service.ValidateToken(ctx, &authv1.ValidateRequest{Token: "bogus"}); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	if _, err := service.Logout(ctx, &authv1.LogoutRequest{Token: loginResp.Token}); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+	if _, err := service.Login(ctx, &authv1.LoginRequest{Username: "someone-else", Password: "password"}); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	type entry struct{ action, outcome, reason string }
+	summarize := func(events []*authv1.AuditEvent) []entry {
+		out := []entry{}
+		for _, e := range events {
+			out = append(out, entry{e.Action, e.Outcome, e.Reason})
+		}
+		return out
+	}
+
+	all, err := service.ListAuditEvents(ctx, &authv1.ListAuditEventsRequest{StartTime: timestamppb.New(start)})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	want := []entry{
+		{"login", "success", "password"},
+		{"logout", "success", ""},
+		{"token_validate", "failure", "invalid_token"},
+		{"token_refresh", "failure", "not_refresh_token"},
+		{"login", "success", "password"},
+		{"login", "failure", "invalid_credentials"},
+	}
+	if got := summarize(all.Events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected records %v, got %v", want, got)
+	}
+
+	// Every record carries the caller's details
+	for _, e := range all.Events {
+		if e.ClientIp != "203.0.113.7" || e.UserAgent != "audit-test/1.0" || e.CorrelationId != "req-42" {
+			t.Errorf("unexpected caller details on %s: ip=%q ua=%q id=%q", e.Action, e.ClientIp, e.UserAgent, e.CorrelationId)
+		}
+	}
+
+	byUser, err := service.ListAuditEvents(ctx, &authv1.ListAuditEventsRequest{UserId: userID})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if got := summarize(byUser.Events); !reflect.DeepEqual(got, []entry{{"logout", "success", ""}, {"login", "success", "password"}}) {
+		t.Errorf("unexpected records for user %s: %v", userID, got)
+	}
+
+	byName, err := service.ListAuditEvents(ctx, &authv1.ListAuditEventsRequest{Username: "auditee", Limit: 1})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if got := summarize(byName.Events); !reflect.DeepEqual(got, []entry{{"login", "success", "password"}}) {
+		t.Errorf("unexpected limited records for auditee: %v", got)
+	}
+
+	_, err = service.ListAuditEvents(ctx, &authv1.ListAuditEventsRequest{
+		StartTime: timestamppb.Now(),
+		EndTime:   timestamppb.New(start),
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected %v for an inverted range, got %v", codes.InvalidArgument, err)
+	}
+}
+
+func newMockStreamEventsServer() *mockStreamEventsServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &mockStreamEventsServer{
+		ctx:    ctx,
+		cancel: cancel,
+		events: make(chan *authv1.Event, 16),
+	}
+}
+
 func (m *mockStreamEventsServer) Send(event *authv1.Event) error {
-	m.events = append(m.events, event)
+	m.events <- event
+	return nil
+}
+
+func (m *mockStreamEventsServer) SendHeader(metadata.MD) error {
 	return nil
 }
 
 func (m *mockStreamEventsServer) Context() context.Context {
-	if m.cancel == nil {
-		m.ctx, m.cancel = context.WithCancel(m.ctx)
-	}
 	return m.ctx
 }
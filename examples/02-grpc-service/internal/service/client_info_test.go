@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/lockout"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestAuthService_ClientIP(t *testing.T) {
+	proxies, err := lockout.ParseNetworks([]string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	cfg := DefaultConfig()
+	cfg.TrustedProxies = proxies
+	service := NewAuthServiceWithConfig(zap.NewNop(), cfg)
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded []string
+		want      string
+	}{
+		{name: "direct client", peer: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "untrusted peer cannot spoof", peer: "203.0.113.7:5000", forwarded: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted proxy without header", peer: "10.1.2.3:5000", want: "10.1.2.3"},
+		{name: "gateway forwards client", peer: "10.1.2.3:5000", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "trusted hops skipped", peer: "[::1]:5000", forwarded: []string{"198.51.100.1, 10.9.9.9", "10.1.1.1"}, want: "198.51.100.1"},
+		{name: "spoofed left entries ignored", peer: "10.1.2.3:5000", forwarded: []string{"192.0.2.66, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "malformed entry stops the walk", peer: "10.1.2.3:5000", forwarded: []string{"198.51.100.1, junk, 10.9.9.9"}, want: "10.9.9.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := net.ResolveTCPAddr("tcp", tt.peer)
+			if err != nil {
+				t.Fatalf("resolve failed: %v", err)
+			}
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+			if tt.forwarded != nil {
+				ctx = metadata.NewIncomingContext(ctx, metadata.MD{"x-forwarded-for": tt.forwarded})
+			}
+			if got := service.clientIP(ctx); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/audit"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/identity"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/notify"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/store"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/verification"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/grpcauth"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// RequestEmailVerification sends a verification code to an email address of
+// the authenticated caller. Whether the address belongs to another user is
+// only checked in VerifyEmail, so this RPC does not reveal registered
+// addresses.
+func (s *AuthService) RequestEmailVerification(ctx context.Context, req *authv1.RequestEmailVerificationRequest) (*authv1.RequestEmailVerificationResponse, error) {
+	account, err := s.callerAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	email, err := identity.NormalizeEmail(req.Email)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	code, expiresAt, err := s.verifier.Start(account.ID, email)
+	if errors.Is(err, verification.ErrResendTooSoon) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to start email verification")
+	}
+
+	err = s.notifier.Notify(ctx, notify.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Your verification code is %s.\nIt expires at %s.",
+			code, expiresAt.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		// Let the caller retry right away instead of waiting out the resend interval
+		s.verifier.Cancel(account.ID)
+		s.logger.Error("failed to send verification code", zap.String("user_id", account.ID), zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "failed to send verification code")
+	}
+
+	s.logger.Info("email verification requested", zap.String("user_id", account.ID))
+
+	return &authv1.RequestEmailVerificationResponse{
+		ExpiresAt: timestamppb.New(expiresAt),
+	}, nil
+}
+
+// VerifyEmail confirms the caller's pending email address with the code
+// sent to it
+func (s *AuthService) VerifyEmail(ctx context.Context, req *authv1.VerifyEmailRequest) (*authv1.VerifyEmailResponse, error) {
+	account, err := s.callerAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Code == "" {
+		return nil, status.Error(codes.InvalidArgument, "code required")
+	}
+
+	record := audit.Record{
+		Action:   audit.ActionEmailVerify,
+		Outcome:  audit.OutcomeFailure,
+		UserID:   account.ID,
+		Username: account.Username,
+	}
+
+	email, err := s.verifier.Verify(account.ID, req.Code)
+	switch {
+	case errors.Is(err, verification.ErrNoPendingVerification):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, verification.ErrInvalidCode):
+		record.Reason = audit.ReasonInvalidCode
+		s.recordAudit(ctx, record)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, "failed to verify email")
+	}
+
+	err = s.users.SetEmail(ctx, account.ID, email)
+	if errors.Is(err, store.ErrEmailTaken) {
+		record.Reason = audit.ReasonEmailTaken
+		s.recordAudit(ctx, record)
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		return nil, s.storeError("set email", err)
+	}
+
+	s.logger.Info("email verified", zap.String("user_id", account.ID))
+	record.Outcome = audit.OutcomeSuccess
+	s.recordAudit(ctx, record)
+	s.events.Publish(EventEmailVerified, account.ID, map[string]string{"username": account.Username})
+
+	principal, _ := grpcauth.FromContext(ctx)
+	return &authv1.VerifyEmailResponse{
+		User: &authv1.User{
+			Id:       account.ID,
+			Username: account.Username,
+			Email:    email,
+			Roles:    principal.Roles,
+		},
+	}, nil
+}
+
+// callerAccount returns the user account of the authenticated caller.
+// Workloads authenticated by client certificate have no account.
+func (s *AuthService) callerAccount(ctx context.Context) (*store.User, error) {
+	principal, ok := grpcauth.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	account, err := s.users.GetUser(ctx, principal.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Error(codes.FailedPrecondition, "caller has no user account")
+	}
+	if err != nil {
+		return nil, s.storeError("get user", err)
+	}
+	return account, nil
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Event types published by AuthService
+const (
+	EventLogin           = "login"
+	EventLoginFailed     = "login_failed"
+	EventLogout          = "logout"
+	EventTokenRefreshed  = "token_refreshed"
+	EventTokenRevoked    = "token_revoked"
+	EventRoleAssigned    = "role_assigned"
+	EventRoleRevoked     = "role_revoked"
+	EventAccountLocked   = "account_locked"
+	EventAccountUnlocked = "account_unlocked"
+	EventMFAChallenge    = "mfa_challenge"
+	EventMFAEnabled      = "mfa_enabled"
+	EventEmailVerified   = "email_verified"
+)
+
+const (
+	defaultSubscriberBuffer = 64
+	defaultEventRetention   = 1024
+)
+
+// ErrResumeTooOld is returned when a subscriber asks to resume from a
+// sequence that has already fallen out of the retention ring
+var ErrResumeTooOld = errors.New("resume sequence no longer retained")
+
+// ErrSubscriptionClosed is returned by Next once a subscription is closed
+var ErrSubscriptionClosed = errors.New("subscription closed")
+
+// DropPolicy decides which event is discarded when a subscriber's buffer is full
+type DropPolicy int
+
+const (
+	// DropOldest discards the oldest buffered event to make room for the new one
+	DropOldest DropPolicy = iota
+	// DropNewest discards the incoming event and keeps the buffer as is
+	DropNewest
+)
+
+// EventFilter selects the events a subscriber receives.
+// Empty fields match everything.
+type EventFilter struct {
+	EventTypes []string
+	UserIDs    []string
+}
+
+func (f EventFilter) matches(event *authv1.Event) bool {
+	return matchesAny(f.EventTypes, event.EventType) && matchesAny(f.UserIDs, event.UserId)
+}
+
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// EventBus fans out auth events to subscribers and keeps the most recent
+// events in a retention ring so subscribers can resume by sequence number
+type EventBus struct {
+	mu         sync.Mutex
+	seq        uint64
+	ring       []*authv1.Event
+	subs       map[uint64]*Subscription
+	nextSubID  uint64
+	bufferSize int
+	dropPolicy DropPolicy
+	now        func() time.Time
+}
+
+// NewEventBus creates an event bus with the given per-subscriber buffer size
+// and retention ring size
+func NewEventBus(bufferSize, retention int, policy DropPolicy) *EventBus {
+	if bufferSize <= 0 {
+		bufferSize = defaultSubscriberBuffer
+	}
+	if retention <= 0 {
+		retention = defaultEventRetention
+	}
+
+	return &EventBus{
+		ring:       make([]*authv1.Event, retention),
+		subs:       make(map[uint64]*Subscription),
+		bufferSize: bufferSize,
+		dropPolicy: policy,
+		now:        time.Now,
+	}
+}
+
+// Publish assigns the next sequence number to an event, retains it and
+// delivers it to every matching subscriber without blocking
+func (b *EventBus) Publish(eventType, userID string, metadata map[string]string) *authv1.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := &authv1.Event{
+		EventType: eventType,
+		UserId:    userID,
+		Timestamp: timestamppb.New(b.now()),
+		Metadata:  metadata,
+		Sequence:  b.seq,
+	}
+	b.ring[b.seq%uint64(len(b.ring))] = event
+
+	for _, sub := range b.subs {
+		if sub.filter.matches(event) {
+			sub.push(event)
+		}
+	}
+
+	return event
+}
+
+// Subscribe registers a subscriber. When resumeAfter is non-nil, retained
+// events with a greater sequence are queued before any live event.
+func (b *EventBus) Subscribe(filter EventFilter, resumeAfter *uint64) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &Subscription{
+		bus:    b,
+		filter: filter,
+		limit:  b.bufferSize,
+		policy: b.dropPolicy,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	if resumeAfter != nil {
+		from := *resumeAfter + 1
+		if from <= b.seq && from < b.oldestRetained() {
+			return nil, ErrResumeTooOld
+		}
+		// Replayed events are queued in full; the buffer limit only
+		// applies to live events published after the subscription.
+		for seq := from; seq <= b.seq; seq++ {
+			event := b.ring[seq%uint64(len(b.ring))]
+			if filter.matches(event) {
+				sub.queue = append(sub.queue, event)
+			}
+		}
+		if len(sub.queue) > 0 {
+			sub.notify <- struct{}{}
+		}
+	}
+
+	b.nextSubID++
+	sub.id = b.nextSubID
+	b.subs[sub.id] = sub
+
+	return sub, nil
+}
+
+// LastSequence returns the sequence number of the most recent event
+func (b *EventBus) LastSequence() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.seq
+}
+
+// SubscriberCount returns the number of active subscribers
+func (b *EventBus) SubscriberCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subs)
+}
+
+func (b *EventBus) oldestRetained() uint64 {
+	retention := uint64(len(b.ring))
+	if b.seq < retention {
+		return 1
+	}
+	return b.seq - retention + 1
+}
+
+func (b *EventBus) unsubscribe(id uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subs, id)
+}
+
+// Subscription is a single subscriber's bounded event queue
+type Subscription struct {
+	id      uint64
+	bus     *EventBus
+	filter  EventFilter
+	limit   int
+	policy  DropPolicy
+	mu      sync.Mutex
+	queue   []*authv1.Event
+	dropped uint64
+	notify  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (s *Subscription) push(event *authv1.Event) {
+	s.mu.Lock()
+	if len(s.queue) >= s.limit {
+		s.dropped++
+		if s.policy == DropNewest {
+			s.mu.Unlock()
+			return
+		}
+		s.queue = s.queue[1:]
+	}
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Next blocks until an event is available, the context is done or the
+// subscription is closed
+func (s *Subscription) Next(ctx context.Context) (*authv1.Event, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			event := s.queue[0]
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return event, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.done:
+			return nil, ErrSubscriptionClosed
+		case <-s.notify:
+		}
+	}
+}
+
+// Dropped returns how many events were discarded because the buffer was full
+func (s *Subscription) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dropped
+}
+
+// Close unregisters the subscription from the bus
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.unsubscribe(s.id)
+		close(s.done)
+	})
+}
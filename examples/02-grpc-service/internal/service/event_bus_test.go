@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEventBus_Filtering(t *testing.T) {
+	bus := NewEventBus(8, 16, DropOldest)
+
+	sub, err := bus.Subscribe(EventFilter{
+		EventTypes: []string{EventLogin},
+		UserIDs:    []string{"alice"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	defer sub.Close()
+
+	bus.Publish(EventLogin, "bob", nil)
+	bus.Publish(EventLogout, "alice", nil)
+	want := bus.Publish(EventLogin, "alice", nil)
+
+	event, err := sub.Next(context.Background())
+	if err != nil {
+		t.Fatalf("next failed: %v", err)
+	}
+	if event.Sequence != want.Sequence {
+		t.Errorf("expected sequence %d, got %d", want.Sequence, event.Sequence)
+	}
+}
+
+func TestEventBus_Resume(t *testing.T) {
+	bus := NewEventBus(8, 4, DropOldest)
+	for i := 0; i < 6; i++ {
+		bus.Publish(EventLogin, "alice", nil)
+	}
+
+	tests := []struct {
+		name        string
+		resumeAfter *uint64
+		wantErr     error
+		wantFirst   uint64
+		wantQueued  int
+	}{
+		{
+			name:        "live only",
+			resumeAfter: nil,
+			wantQueued:  0,
+		},
+		{
+			name:        "resume within retention",
+			resumeAfter: proto.Uint64(3),
+			wantFirst:   4,
+			wantQueued:  3,
+		},
+		{
+			name:        "resume at oldest retained",
+			resumeAfter: proto.Uint64(2),
+			wantFirst:   3,
+			wantQueued:  4,
+		},
+		{
+			name:        "resume at head",
+			resumeAfter: proto.Uint64(6),
+			wantQueued:  0,
+		},
+		{
+			name:        "resume beyond retention",
+			resumeAfter: proto.Uint64(1),
+			wantErr:     ErrResumeTooOld,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := bus.Subscribe(EventFilter{}, tt.resumeAfter)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("subscribe failed: %v", err)
+			}
+			defer sub.Close()
+
+			if len(sub.queue) != tt.wantQueued {
+				t.Fatalf("expected %d queued events, got %d", tt.wantQueued, len(sub.queue))
+			}
+			if tt.wantQueued > 0 {
+				event, _ := sub.Next(context.Background())
+				if event.Sequence != tt.wantFirst {
+					t.Errorf("expected first sequence %d, got %d", tt.wantFirst, event.Sequence)
+				}
+			}
+		})
+	}
+}
+
+func TestEventBus_DropPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    DropPolicy
+		wantFirst uint64
+		wantLast  uint64
+	}{
+		{
+			name:      "drop oldest",
+			policy:    DropOldest,
+			wantFirst: 3,
+			wantLast:  4,
+		},
+		{
+			name:      "drop newest",
+			policy:    DropNewest,
+			wantFirst: 1,
+			wantLast:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewEventBus(2, 16, tt.policy)
+			sub, err := bus.Subscribe(EventFilter{}, nil)
+			if err != nil {
+				t.Fatalf("subscribe failed: %v", err)
+			}
+			defer sub.Close()
+
+			for i := 0; i < 4; i++ {
+				bus.Publish(EventLogin, "alice", nil)
+			}
+
+			if sub.Dropped() != 2 {
+				t.Errorf("expected 2 dropped events, got %d", sub.Dropped())
+			}
+			first, _ := sub.Next(context.Background())
+			last, _ := sub.Next(context.Background())
+			if first.Sequence != tt.wantFirst || last.Sequence != tt.wantLast {
+				t.Errorf("expected sequences %d,%d, got %d,%d",
+					tt.wantFirst, tt.wantLast, first.Sequence, last.Sequence)
+			}
+		})
+	}
+}
+
+func TestEventBus_Close(t *testing.T) {
+	bus := NewEventBus(8, 16, DropOldest)
+	sub, err := bus.Subscribe(EventFilter{}, nil)
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	sub.Close()
+	sub.Close()
+
+	if _, err := sub.Next(context.Background()); !errors.Is(err, ErrSubscriptionClosed) {
+		t.Errorf("expected %v, got %v", ErrSubscriptionClosed, err)
+	}
+	if bus.SubscriberCount() != 0 {
+		t.Errorf("expected no subscribers, got %d", bus.SubscriberCount())
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/audit"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/mfa"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/grpcauth"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EnrollMFA starts TOTP enrollment for the authenticated caller
+func (s *AuthService) EnrollMFA(ctx context.Context, req *authv1.EnrollMFARequest) (*authv1.EnrollMFAResponse, error) {
+	principal, ok := grpcauth.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	secret, uri, err := s.mfa.Enroll(principal.Username)
+	if errors.Is(err, mfa.ErrAlreadyEnrolled) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to enroll mfa")
+	}
+
+	s.logger.Info("mfa enrollment started", zap.String("username", principal.Username))
+
+	return &authv1.EnrollMFAResponse{
+		Secret:     secret,
+		OtpauthUri: uri,
+	}, nil
+}
+
+// ConfirmMFA activates TOTP for the caller and returns recovery codes
+func (s *AuthService) ConfirmMFA(ctx context.Context, req *authv1.ConfirmMFARequest) (*authv1.ConfirmMFAResponse, error) {
+	principal, ok := grpcauth.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if req.Code == "" {
+		return nil, status.Error(codes.InvalidArgument, "code required")
+	}
+
+	recoveryCodes, err := s.mfa.Confirm(principal.Username, req.Code)
+	switch {
+	case errors.Is(err, mfa.ErrNotEnrolled):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, mfa.ErrAlreadyEnrolled):
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, mfa.ErrInvalidCode), errors.Is(err, mfa.ErrCodeReused):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, "failed to confirm mfa")
+	}
+
+	s.logger.Info("mfa enabled", zap.String("username", principal.Username))
+	s.events.Publish(EventMFAEnabled, principal.UserID, map[string]string{"username": principal.Username})
+
+	return &authv1.ConfirmMFAResponse{
+		Enabled:       true,
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// VerifyMFA completes a two-step login by exchanging an MFA challenge and
+// a TOTP or recovery code for tokens
+func (s *AuthService) VerifyMFA(ctx context.Context, req *authv1.VerifyMFARequest) (*authv1.LoginResponse, error) {
+	if req.MfaChallenge == "" || (req.Code == "") == (req.RecoveryCode == "") {
+		return nil, status.Error(codes.InvalidArgument, "mfa_challenge and exactly one of code or recovery_code required")
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	ip := s.clientIP(ctx)
+	if username, ok := s.mfa.ChallengeUser(req.MfaChallenge); ok {
+		if block := s.failures.Check(username, ip); block != nil {
+			s.recordLockedOut(ctx, username)
+			return nil, loginBlockedError(block)
+		}
+	}
+
+	username, usedRecovery, err := s.mfa.VerifyChallenge(req.MfaChallenge, req.Code, req.RecoveryCode)
+	switch {
+	case errors.Is(err, mfa.ErrChallengeNotFound):
+		s.recordAudit(ctx, audit.Record{
+			Action:  audit.ActionLogin,
+			Outcome: audit.OutcomeFailure,
+			Reason:  audit.ReasonInvalidChallenge,
+		})
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, mfa.ErrInvalidCode), errors.Is(err, mfa.ErrCodeReused):
+		s.recordLoginFailure(ctx, username, ip, audit.ReasonInvalidMFACode)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, "failed to verify mfa")
+	}
+
+	reason := audit.ReasonMFACode
+	if usedRecovery {
+		s.logger.Warn("recovery code used", zap.String("username", username))
+		reason = audit.ReasonRecoveryCode
+	}
+
+	s.failures.RecordSuccess(username)
+	return s.issueTokens(ctx, username, reason)
+}
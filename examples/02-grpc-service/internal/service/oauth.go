@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/audit"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/oauth"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/store"
+	"go.uber.org/zap"
+)
+
+// IssueClientToken creates an access token for an OAuth2 client-credentials
+// grant. Client tokens are not accepted by the gRPC API, which needs a user
+// session; they are for services that introspect them.
+func (s *AuthService) IssueClientToken(ctx context.Context, clientID string, scopes []string) (string, time.Time, error) {
+	return s.tokens.GenerateClientToken(ctx, clientID, scopes)
+}
+
+// IntrospectToken describes a token issued by Login, RefreshToken or the
+// client-credentials grant
+func (s *AuthService) IntrospectToken(ctx context.Context, token string) (*oauth.Introspection, error) {
+	info, err := s.tokens.Lookup(ctx, token)
+	if errors.Is(err, store.ErrNotFound) {
+		return &oauth.Introspection{Active: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &oauth.Introspection{
+		Active: true,
+		Exp:    info.ExpiresAt.Unix(),
+	}
+	if !info.IsRefresh {
+		result.TokenType = "Bearer"
+	}
+
+	if info.ClientID != "" {
+		result.ClientID = info.ClientID
+		result.Sub = info.ClientID
+		result.Scope = strings.Join(info.Scopes, " ")
+		return result, nil
+	}
+
+	// User tokens are only active while their session is, as for ValidateToken
+	session, err := s.sessions.GetSession(ctx, info.SessionID)
+	if errors.Is(err, store.ErrNotFound) {
+		return &oauth.Introspection{Active: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Sub = session.UserID
+	result.Username = session.Username
+	return result, nil
+}
+
+// RevokeClientToken revokes a token on behalf of an OAuth2 client. Clients
+// may revoke their own tokens and tokens issued to users; the user's session
+// is kept, so only the revoked token stops working.
+func (s *AuthService) RevokeClientToken(ctx context.Context, clientID, token string) error {
+	info, err := s.tokens.Lookup(ctx, token)
+	if errors.Is(err, store.ErrNotFound) {
+		// RFC 7009 treats unknown tokens as revoked, but they are still audited
+		s.recordAudit(ctx, audit.Record{
+			Action:   audit.ActionTokenRevoke,
+			Outcome:  audit.OutcomeFailure,
+			Reason:   audit.ReasonInvalidToken,
+			ClientID: clientID,
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ClientID != "" && info.ClientID != clientID {
+		s.recordAudit(ctx, audit.Record{
+			Action:   audit.ActionTokenRevoke,
+			Outcome:  audit.OutcomeFailure,
+			Reason:   audit.ReasonTokenNotOwned,
+			ClientID: clientID,
+		})
+		return oauth.ErrTokenNotOwned
+	}
+
+	if err := s.tokens.RevokeToken(ctx, token); err != nil {
+		return err
+	}
+
+	tokenType := "access"
+	if info.IsRefresh {
+		tokenType = "refresh"
+	}
+	subject := info.UserID
+	if subject == "" {
+		subject = info.ClientID
+	}
+	s.logger.Info("token revoked", zap.String("client_id", clientID), zap.String("subject", subject))
+	s.recordAudit(ctx, audit.Record{
+		Action:   audit.ActionTokenRevoke,
+		Outcome:  audit.OutcomeSuccess,
+		Reason:   tokenType,
+		UserID:   info.UserID,
+		ClientID: clientID,
+	})
+	s.events.Publish(EventTokenRevoked, subject, map[string]string{
+		"token_type": tokenType,
+		"client_id":  clientID,
+	})
+	return nil
+}
@@ -0,0 +1,277 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryTokenStore keeps tokens in a process-local map
+type MemoryTokenStore struct {
+	tokens map[string]*TokenInfo
+	mu     sync.RWMutex
+	now    func() time.Time
+}
+
+// NewMemoryTokenStore creates an empty in-memory token store
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens: make(map[string]*TokenInfo),
+		now:    time.Now,
+	}
+}
+
+// GenerateToken creates a new access token
+func (m *MemoryTokenStore) GenerateToken(ctx context.Context, userID, sessionID string) (string, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, expiresAt := m.issueLocked(TokenInfo{UserID: userID, SessionID: sessionID}, AccessTokenTTL)
+	return token, expiresAt, nil
+}
+
+// GenerateRefreshToken creates a new refresh token
+func (m *MemoryTokenStore) GenerateRefreshToken(ctx context.Context, userID, sessionID string) (string, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, expiresAt := m.issueLocked(TokenInfo{UserID: userID, SessionID: sessionID, IsRefresh: true}, RefreshTokenTTL)
+	return token, expiresAt, nil
+}
+
+// GenerateClientToken creates an access token for an OAuth2 client
+func (m *MemoryTokenStore) GenerateClientToken(ctx context.Context, clientID string, scopes []string) (string, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info := TokenInfo{ClientID: clientID, Scopes: slices.Clone(scopes)}
+	token, expiresAt := m.issueLocked(info, AccessTokenTTL)
+	return token, expiresAt, nil
+}
+
+func (m *MemoryTokenStore) issueLocked(info TokenInfo, ttl time.Duration) (string, time.Time) {
+	token := uuid.New().String()
+	info.ExpiresAt = m.now().Add(ttl)
+	m.tokens[token] = &info
+
+	return token, info.ExpiresAt
+}
+
+// Lookup returns the metadata of a valid token
+func (m *MemoryTokenStore) Lookup(ctx context.Context, token string) (*TokenInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.lookupLocked(token)
+}
+
+func (m *MemoryTokenStore) lookupLocked(token string) (*TokenInfo, error) {
+	info, exists := m.tokens[token]
+	if !exists || m.now().After(info.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+
+	cp := *info
+	cp.Scopes = slices.Clone(info.Scopes)
+	return &cp, nil
+}
+
+// RevokeToken removes a token
+func (m *MemoryTokenStore) RevokeToken(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.tokens, token)
+	return nil
+}
+
+// RotateRefreshToken consumes a refresh token and issues a new token pair
+func (m *MemoryTokenStore) RotateRefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, err := m.lookupLocked(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsRefresh {
+		return nil, ErrNotRefreshToken
+	}
+
+	delete(m.tokens, refreshToken)
+
+	pair := &TokenPair{UserID: info.UserID, SessionID: info.SessionID}
+	pair.AccessToken, pair.AccessExpiresAt = m.issueLocked(TokenInfo{UserID: info.UserID, SessionID: info.SessionID}, AccessTokenTTL)
+	pair.RefreshToken, pair.RefreshExpiresAt = m.issueLocked(TokenInfo{UserID: info.UserID, SessionID: info.SessionID, IsRefresh: true}, RefreshTokenTTL)
+	return pair, nil
+}
+
+// HealthCheck reports whether the token store can be read before ctx expires
+func (m *MemoryTokenStore) HealthCheck(ctx context.Context) error {
+	return lockWithin(ctx, m.mu.RLocker())
+}
+
+// MemorySessionStore keeps sessions in a process-local map keyed by
+// session ID
+type MemorySessionStore struct {
+	sessions map[string]*Session
+	mu       sync.RWMutex
+}
+
+// NewMemorySessionStore creates an empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]*Session),
+	}
+}
+
+// CreateSession creates a new session
+func (m *MemorySessionStore) CreateSession(ctx context.Context, session *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cp := *session
+	m.sessions[session.ID] = &cp
+	return nil
+}
+
+// GetSession retrieves a session by ID
+func (m *MemorySessionStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, exists := m.sessions[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	cp := *session
+	return &cp, nil
+}
+
+// DeleteSession removes a session
+func (m *MemorySessionStore) DeleteSession(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// HealthCheck reports whether the session store can be read before ctx expires
+func (m *MemorySessionStore) HealthCheck(ctx context.Context) error {
+	return lockWithin(ctx, m.mu.RLocker())
+}
+
+// MemoryUserStore keeps users in process-local maps indexed by ID,
+// username, skeleton and email
+type MemoryUserStore struct {
+	users      map[string]*User
+	byUsername map[string]string
+	bySkeleton map[string]string
+	byEmail    map[string]string
+	mu         sync.RWMutex
+}
+
+// NewMemoryUserStore creates an empty in-memory user store
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users:      make(map[string]*User),
+		byUsername: make(map[string]string),
+		bySkeleton: make(map[string]string),
+		byEmail:    make(map[string]string),
+	}
+}
+
+// CreateUser stores a new user
+func (m *MemoryUserStore) CreateUser(ctx context.Context, user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.byUsername[user.Username]; exists {
+		return ErrUsernameTaken
+	}
+	if _, exists := m.bySkeleton[user.Skeleton]; exists {
+		return ErrUsernameTaken
+	}
+
+	cp := *user
+	cp.Email = ""
+	m.users[user.ID] = &cp
+	m.byUsername[user.Username] = user.ID
+	m.bySkeleton[user.Skeleton] = user.ID
+	return nil
+}
+
+// GetUser retrieves a user by ID
+func (m *MemoryUserStore) GetUser(ctx context.Context, id string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, exists := m.users[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	cp := *user
+	return &cp, nil
+}
+
+// GetUserByUsername retrieves a user by normalized username
+func (m *MemoryUserStore) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	m.mu.RLock()
+	id, exists := m.byUsername[username]
+	m.mu.RUnlock()
+
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return m.GetUser(ctx, id)
+}
+
+// SetEmail replaces the verified email address of a user
+func (m *MemoryUserStore) SetEmail(ctx context.Context, id, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, exists := m.users[id]
+	if !exists {
+		return ErrNotFound
+	}
+	if owner, taken := m.byEmail[email]; taken && owner != id {
+		return ErrEmailTaken
+	}
+
+	delete(m.byEmail, user.Email)
+	user.Email = email
+	if email != "" {
+		m.byEmail[email] = id
+	}
+	return nil
+}
+
+// HealthCheck reports whether the user store can be read before ctx expires
+func (m *MemoryUserStore) HealthCheck(ctx context.Context) error {
+	return lockWithin(ctx, m.mu.RLocker())
+}
+
+// lockWithin acquires and releases l, giving up once ctx is done so a wedged
+// store shows up as a failed health check instead of a hung probe
+func lockWithin(ctx context.Context, l sync.Locker) error {
+	acquired := make(chan struct{})
+	go func() {
+		l.Lock()
+		l.Unlock()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
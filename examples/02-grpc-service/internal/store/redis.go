@@ -0,0 +1,556 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	tokenKeyPrefix    = "auth:token:"
+	sessionKeyPrefix  = "auth:session:"
+	userKeyPrefix     = "auth:user:"
+	usernameKeyPrefix = "auth:username:"
+	skeletonKeyPrefix = "auth:skeleton:"
+	emailKeyPrefix    = "auth:email:"
+
+	// RevocationChannel is the pub/sub channel revoked tokens are announced
+	// on so every replica drops them from its local cache
+	RevocationChannel = "auth:token:revoked"
+
+	// maxCachedTokens bounds the per-replica token cache
+	maxCachedTokens = 10000
+)
+
+// rotateScript consumes a refresh token and writes the new pair in one step.
+// KEYS: old refresh, new access, new refresh.
+// ARGV: access expires_at ms, access ttl ms, refresh expires_at ms, refresh ttl ms.
+// Returns {0} when the token is missing, {1} when it is not a refresh token
+// and {2, user_id, session_id} on success.
+var rotateScript = redis.NewScript(`
+local fields = redis.call('HMGET', KEYS[1], 'user_id', 'refresh', 'session_id')
+local user = fields[1]
+local session = fields[3] or ''
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return {0}
+end
+if fields[2] ~= '1' or not user then
+  return {1}
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[2], 'user_id', user, 'session_id', session, 'refresh', '0', 'expires_at', ARGV[1])
+redis.call('PEXPIRE', KEYS[2], ARGV[2])
+redis.call('HSET', KEYS[3], 'user_id', user, 'session_id', session, 'refresh', '1', 'expires_at', ARGV[3])
+redis.call('PEXPIRE', KEYS[3], ARGV[4])
+return {2, user, session}
+`)
+
+// createUserScript claims a username and its skeleton and writes the user.
+// KEYS: user, username, skeleton.
+// ARGV: id, username, skeleton, created_at ms.
+// Returns 0 when the username or skeleton is taken and 1 on success.
+var createUserScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 or redis.call('EXISTS', KEYS[3]) == 1 then
+  return 0
+end
+redis.call('SET', KEYS[2], ARGV[1])
+redis.call('SET', KEYS[3], ARGV[1])
+redis.call('HSET', KEYS[1], 'username', ARGV[2], 'skeleton', ARGV[3], 'email', '', 'created_at', ARGV[4])
+return 1
+`)
+
+// setEmailScript moves a user's email claim from the old address to the new.
+// KEYS: user, new email, old email.
+// ARGV: id, new email, old email.
+// Returns 0 when the user is missing, 1 when the new address is taken, 2 on
+// success and 3 when the user's email changed since it was read.
+var setEmailScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return 0
+end
+if (redis.call('HGET', KEYS[1], 'email') or '') ~= ARGV[3] then
+  return 3
+end
+local owner = redis.call('GET', KEYS[2])
+if ARGV[2] ~= '' and owner and owner ~= ARGV[1] then
+  return 1
+end
+if ARGV[3] ~= '' and ARGV[3] ~= ARGV[2] then
+  redis.call('DEL', KEYS[3])
+end
+if ARGV[2] ~= '' then
+  redis.call('SET', KEYS[2], ARGV[1])
+end
+redis.call('HSET', KEYS[1], 'email', ARGV[2])
+return 2
+`)
+
+// RedisConfig holds Redis connection settings
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// NewRedisClient connects to Redis and verifies the connection
+func NewRedisClient(ctx context.Context, cfg RedisConfig) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis connection failed: %w", err)
+	}
+
+	return client, nil
+}
+
+type cachedToken struct {
+	info        TokenInfo
+	cachedUntil time.Time
+}
+
+// RedisTokenStore keeps tokens in Redis hashes that expire with the token.
+//
+// Validated tokens can be cached per replica for cacheTTL to save a round
+// trip on every request. Revocations are published on RevocationChannel and
+// WatchRevocations evicts them, so a revoked token is rejected everywhere
+// as soon as the message arrives and after cacheTTL at the latest.
+type RedisTokenStore struct {
+	client   redis.UniversalClient
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedToken
+}
+
+// NewRedisTokenStore creates a token store on client. A zero cacheTTL
+// disables the local cache.
+func NewRedisTokenStore(client redis.UniversalClient, cacheTTL time.Duration) *RedisTokenStore {
+	return &RedisTokenStore{
+		client:   client,
+		cacheTTL: cacheTTL,
+		now:      time.Now,
+		cache:    make(map[string]cachedToken),
+	}
+}
+
+// GenerateToken creates a new access token
+func (r *RedisTokenStore) GenerateToken(ctx context.Context, userID, sessionID string) (string, time.Time, error) {
+	return r.issue(ctx, AccessTokenTTL, "user_id", userID, "session_id", sessionID, "refresh", "0")
+}
+
+// GenerateRefreshToken creates a new refresh token
+func (r *RedisTokenStore) GenerateRefreshToken(ctx context.Context, userID, sessionID string) (string, time.Time, error) {
+	return r.issue(ctx, RefreshTokenTTL, "user_id", userID, "session_id", sessionID, "refresh", "1")
+}
+
+// GenerateClientToken creates an access token for an OAuth2 client
+func (r *RedisTokenStore) GenerateClientToken(ctx context.Context, clientID string, scopes []string) (string, time.Time, error) {
+	return r.issue(ctx, AccessTokenTTL, "client_id", clientID, "scope", strings.Join(scopes, " "), "refresh", "0")
+}
+
+// issue writes a token hash with fields plus its expiry
+func (r *RedisTokenStore) issue(ctx context.Context, ttl time.Duration, fields ...interface{}) (string, time.Time, error) {
+	token := uuid.New().String()
+	expiresAt := r.now().Add(ttl)
+	key := tokenKeyPrefix + token
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, append(fields, "expires_at", expiresAt.UnixMilli())...)
+		pipe.PExpire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("redis token write failed: %w", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+// Lookup returns the metadata of a valid token
+func (r *RedisTokenStore) Lookup(ctx context.Context, token string) (*TokenInfo, error) {
+	now := r.now()
+	if info, ok := r.cached(token, now); ok {
+		return info, nil
+	}
+
+	values, err := r.client.HMGet(ctx, tokenKeyPrefix+token, "user_id", "refresh", "expires_at", "client_id", "scope", "session_id").Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis token read failed: %w", err)
+	}
+
+	info, err := parseToken(values)
+	if err != nil {
+		return nil, err
+	}
+	if now.After(info.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+
+	r.store(token, info, now)
+	cp := *info
+	cp.Scopes = slices.Clone(info.Scopes)
+	return &cp, nil
+}
+
+// RevokeToken deletes a token and announces the revocation to all replicas
+func (r *RedisTokenStore) RevokeToken(ctx context.Context, token string) error {
+	r.evict(token)
+
+	if err := r.client.Del(ctx, tokenKeyPrefix+token).Err(); err != nil {
+		return fmt.Errorf("redis token delete failed: %w", err)
+	}
+	return r.publishRevocation(ctx, token)
+}
+
+// RotateRefreshToken consumes a refresh token and issues a new token pair
+// with a Lua script, so concurrent rotations of the same token on
+// different replicas cannot both succeed
+func (r *RedisTokenStore) RotateRefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	now := r.now()
+	pair := &TokenPair{
+		AccessToken:      uuid.New().String(),
+		AccessExpiresAt:  now.Add(AccessTokenTTL),
+		RefreshToken:     uuid.New().String(),
+		RefreshExpiresAt: now.Add(RefreshTokenTTL),
+	}
+
+	result, err := rotateScript.Run(ctx, r.client,
+		[]string{
+			tokenKeyPrefix + refreshToken,
+			tokenKeyPrefix + pair.AccessToken,
+			tokenKeyPrefix + pair.RefreshToken,
+		},
+		pair.AccessExpiresAt.UnixMilli(), AccessTokenTTL.Milliseconds(),
+		pair.RefreshExpiresAt.UnixMilli(), RefreshTokenTTL.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("redis token rotation failed: %w", err)
+	}
+
+	outcome, _ := result[0].(int64)
+	switch outcome {
+	case 0:
+		return nil, ErrNotFound
+	case 1:
+		return nil, ErrNotRefreshToken
+	}
+
+	pair.UserID, _ = result[1].(string)
+	pair.SessionID, _ = result[2].(string)
+	r.evict(refreshToken)
+	if err := r.publishRevocation(ctx, refreshToken); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// HealthCheck pings Redis
+func (r *RedisTokenStore) HealthCheck(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// WatchRevocations evicts tokens revoked on any replica from the local
+// cache until ctx is done
+func (r *RedisTokenStore) WatchRevocations(ctx context.Context, logger *zap.Logger) {
+	pubsub := r.client.Subscribe(ctx, RevocationChannel)
+	defer pubsub.Close()
+
+	// Wait for the subscription so revocations published from now on are seen
+	if _, err := pubsub.Receive(ctx); err != nil {
+		if ctx.Err() == nil {
+			logger.Error("failed to subscribe to token revocations", zap.Error(err))
+		}
+		return
+	}
+
+	// Anything cached before the subscription may have been revoked since
+	r.mu.Lock()
+	r.cache = make(map[string]cachedToken)
+	r.mu.Unlock()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			r.evict(msg.Payload)
+		}
+	}
+}
+
+func (r *RedisTokenStore) publishRevocation(ctx context.Context, token string) error {
+	if err := r.client.Publish(ctx, RevocationChannel, token).Err(); err != nil {
+		return fmt.Errorf("redis revocation publish failed: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisTokenStore) cached(token string, now time.Time) (*TokenInfo, bool) {
+	if r.cacheTTL <= 0 {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.cache[token]
+	if !ok {
+		return nil, false
+	}
+	if now.After(entry.cachedUntil) || now.After(entry.info.ExpiresAt) {
+		delete(r.cache, token)
+		return nil, false
+	}
+
+	info := entry.info
+	info.Scopes = slices.Clone(entry.info.Scopes)
+	return &info, true
+}
+
+func (r *RedisTokenStore) store(token string, info *TokenInfo, now time.Time) {
+	if r.cacheTTL <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.cache) >= maxCachedTokens {
+		for key, entry := range r.cache {
+			if now.After(entry.cachedUntil) {
+				delete(r.cache, key)
+			}
+		}
+		if len(r.cache) >= maxCachedTokens {
+			r.cache = make(map[string]cachedToken)
+		}
+	}
+
+	r.cache[token] = cachedToken{info: *info, cachedUntil: now.Add(r.cacheTTL)}
+}
+
+func (r *RedisTokenStore) evict(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.cache, token)
+}
+
+// parseToken decodes the user_id, refresh, expires_at, client_id, scope and
+// session_id fields of a token hash
+func parseToken(values []interface{}) (*TokenInfo, error) {
+	userID, _ := values[0].(string)
+	refresh, _ := values[1].(string)
+	expiresAt, _ := values[2].(string)
+	clientID, _ := values[3].(string)
+	scope, _ := values[4].(string)
+	sessionID, _ := values[5].(string)
+	if expiresAt == "" {
+		return nil, ErrNotFound
+	}
+
+	ms, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token expiry %q: %w", expiresAt, err)
+	}
+
+	return &TokenInfo{
+		UserID:    userID,
+		SessionID: sessionID,
+		ClientID:  clientID,
+		Scopes:    strings.Fields(scope),
+		ExpiresAt: time.UnixMilli(ms),
+		IsRefresh: refresh == "1",
+	}, nil
+}
+
+// RedisSessionStore keeps sessions in Redis hashes keyed by session ID that
+// expire after SessionTTL
+type RedisSessionStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisSessionStore creates a session store on client
+func NewRedisSessionStore(client redis.UniversalClient) *RedisSessionStore {
+	return &RedisSessionStore{client: client}
+}
+
+// CreateSession creates a new session
+func (r *RedisSessionStore) CreateSession(ctx context.Context, session *Session) error {
+	key := sessionKeyPrefix + session.ID
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			"user_id", session.UserID,
+			"username", session.Username,
+			"email", session.Email,
+			"roles", strings.Join(session.Roles, ","),
+		)
+		pipe.PExpire(ctx, key, SessionTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis session write failed: %w", err)
+	}
+	return nil
+}
+
+// GetSession retrieves a session by ID
+func (r *RedisSessionStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	values, err := r.client.HGetAll(ctx, sessionKeyPrefix+id).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis session read failed: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+
+	session := &Session{
+		ID:       id,
+		UserID:   values["user_id"],
+		Username: values["username"],
+		Email:    values["email"],
+	}
+	if roles := values["roles"]; roles != "" {
+		session.Roles = strings.Split(roles, ",")
+	}
+	return session, nil
+}
+
+// DeleteSession removes a session
+func (r *RedisSessionStore) DeleteSession(ctx context.Context, id string) error {
+	if err := r.client.Del(ctx, sessionKeyPrefix+id).Err(); err != nil {
+		return fmt.Errorf("redis session delete failed: %w", err)
+	}
+	return nil
+}
+
+// HealthCheck pings Redis
+func (r *RedisSessionStore) HealthCheck(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// RedisUserStore keeps users in Redis hashes, with one key per username,
+// skeleton and email address pointing at the owning user ID. Users do not
+// expire.
+type RedisUserStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisUserStore creates a user store on client
+func NewRedisUserStore(client redis.UniversalClient) *RedisUserStore {
+	return &RedisUserStore{client: client}
+}
+
+// CreateUser stores a new user, claiming its username and skeleton in one
+// atomic step so concurrent logins on different replicas cannot both
+// register the same name
+func (r *RedisUserStore) CreateUser(ctx context.Context, user *User) error {
+	created, err := createUserScript.Run(ctx, r.client,
+		[]string{
+			userKeyPrefix + user.ID,
+			usernameKeyPrefix + user.Username,
+			skeletonKeyPrefix + user.Skeleton,
+		},
+		user.ID, user.Username, user.Skeleton, user.CreatedAt.UnixMilli(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("redis user write failed: %w", err)
+	}
+	if created == 0 {
+		return ErrUsernameTaken
+	}
+	return nil
+}
+
+// GetUser retrieves a user by ID
+func (r *RedisUserStore) GetUser(ctx context.Context, id string) (*User, error) {
+	values, err := r.client.HGetAll(ctx, userKeyPrefix+id).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis user read failed: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+
+	ms, _ := strconv.ParseInt(values["created_at"], 10, 64)
+	return &User{
+		ID:        id,
+		Username:  values["username"],
+		Skeleton:  values["skeleton"],
+		Email:     values["email"],
+		CreatedAt: time.UnixMilli(ms),
+	}, nil
+}
+
+// GetUserByUsername retrieves a user by normalized username
+func (r *RedisUserStore) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	id, err := r.client.Get(ctx, usernameKeyPrefix+username).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis user read failed: %w", err)
+	}
+	return r.GetUser(ctx, id)
+}
+
+// SetEmail replaces the verified email address of a user. The previous
+// address is read first and the script retries if it changed meanwhile.
+func (r *RedisUserStore) SetEmail(ctx context.Context, id, email string) error {
+	const maxAttempts = 3
+
+	for range maxAttempts {
+		old, err := r.client.HGet(ctx, userKeyPrefix+id, "email").Result()
+		if err == redis.Nil {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("redis user read failed: %w", err)
+		}
+
+		outcome, err := setEmailScript.Run(ctx, r.client,
+			[]string{userKeyPrefix + id, emailKeyPrefix + email, emailKeyPrefix + old},
+			id, email, old,
+		).Int()
+		if err != nil {
+			return fmt.Errorf("redis email write failed: %w", err)
+		}
+
+		switch outcome {
+		case 0:
+			return ErrNotFound
+		case 1:
+			return ErrEmailTaken
+		case 2:
+			return nil
+		}
+	}
+	return fmt.Errorf("redis email write failed: concurrent updates to user %s", id)
+}
+
+// HealthCheck pings Redis
+func (r *RedisUserStore) HealthCheck(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
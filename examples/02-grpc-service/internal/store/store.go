@@ -0,0 +1,129 @@
+// Package store defines the token, session and user storage used by the
+// auth service. The in-memory backends suit a single replica; the Redis
+// backends share state between replicas behind a load balancer.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// AccessTokenTTL is how long access tokens are valid
+	AccessTokenTTL = 1 * time.Hour
+	// RefreshTokenTTL is how long refresh tokens are valid
+	RefreshTokenTTL = 24 * time.Hour
+	// SessionTTL bounds how long shared sessions are kept; it matches the
+	// refresh token lifetime so a session never outlives its tokens
+	SessionTTL = RefreshTokenTTL
+)
+
+// ErrNotFound is returned for unknown, expired or revoked tokens and sessions
+var ErrNotFound = errors.New("not found")
+
+// ErrNotRefreshToken is returned when rotating an access token
+var ErrNotRefreshToken = errors.New("not a refresh token")
+
+// ErrUsernameTaken is returned when creating a user whose username, or a
+// username confusable with it, already belongs to another user
+var ErrUsernameTaken = errors.New("username taken")
+
+// ErrEmailTaken is returned when setting an email address that another user
+// has already verified
+var ErrEmailTaken = errors.New("email address taken")
+
+// TokenInfo stores token metadata. Tokens from a gRPC login belong to a
+// user and the session of that login; tokens from the OAuth2
+// client-credentials grant belong to a client and carry its granted scopes.
+type TokenInfo struct {
+	UserID    string
+	SessionID string
+	ClientID  string
+	Scopes    []string
+	ExpiresAt time.Time
+	IsRefresh bool
+}
+
+// TokenPair is the result of rotating a refresh token
+type TokenPair struct {
+	UserID           string
+	SessionID        string
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// Session represents one login of a user. A user has a session per login,
+// so logging out on one device leaves the others signed in.
+type Session struct {
+	ID       string
+	UserID   string
+	Username string
+	Email    string
+	Roles    []string
+}
+
+// User is a registered account. Username is the normalized username and
+// Skeleton its confusable skeleton; both are unique across users, as is a
+// non-empty Email.
+type User struct {
+	ID       string
+	Username string
+	Skeleton string
+	// Email is the verified email address, empty until verified
+	Email     string
+	CreatedAt time.Time
+}
+
+// TokenStore issues, resolves and revokes bearer tokens
+type TokenStore interface {
+	// GenerateToken creates a new access token for a user's session
+	GenerateToken(ctx context.Context, userID, sessionID string) (string, time.Time, error)
+	// GenerateRefreshToken creates a new refresh token for a user's session
+	GenerateRefreshToken(ctx context.Context, userID, sessionID string) (string, time.Time, error)
+	// GenerateClientToken creates an access token for an OAuth2 client
+	GenerateClientToken(ctx context.Context, clientID string, scopes []string) (string, time.Time, error)
+	// Lookup returns the metadata of a valid token or ErrNotFound
+	Lookup(ctx context.Context, token string) (*TokenInfo, error)
+	// RevokeToken invalidates a token; revoking an unknown token is not an error
+	RevokeToken(ctx context.Context, token string) error
+	// RotateRefreshToken consumes a refresh token and issues a new access
+	// and refresh token for the same user and session in one atomic step, so
+	// a refresh token can be redeemed at most once
+	RotateRefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error)
+	// HealthCheck reports whether the store is reachable before ctx expires
+	HealthCheck(ctx context.Context) error
+}
+
+// SessionStore manages active sessions keyed by session ID
+type SessionStore interface {
+	// CreateSession stores session under session.ID
+	CreateSession(ctx context.Context, session *Session) error
+	// GetSession returns the session or ErrNotFound
+	GetSession(ctx context.Context, id string) (*Session, error)
+	// DeleteSession removes one session; other sessions of the same user
+	// are kept
+	DeleteSession(ctx context.Context, id string) error
+	// HealthCheck reports whether the store is reachable before ctx expires
+	HealthCheck(ctx context.Context) error
+}
+
+// UserStore manages user accounts and enforces the uniqueness of usernames,
+// their skeletons and verified email addresses
+type UserStore interface {
+	// CreateUser stores a new user or returns ErrUsernameTaken
+	CreateUser(ctx context.Context, user *User) error
+	// GetUser returns the user with the given ID or ErrNotFound
+	GetUser(ctx context.Context, id string) (*User, error)
+	// GetUserByUsername returns the user with the given normalized username
+	// or ErrNotFound
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	// SetEmail replaces the verified email address of a user, returning
+	// ErrNotFound for unknown users and ErrEmailTaken when another user
+	// holds the address
+	SetEmail(ctx context.Context, id, email string) error
+	// HealthCheck reports whether the store is reachable before ctx expires
+	HealthCheck(ctx context.Context) error
+}
@@ -0,0 +1,449 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// backend is a token and session store pair under test. expire moves the
+// clock past the lifetime of every token issued so far.
+type backend struct {
+	tokens   TokenStore
+	sessions SessionStore
+	users    UserStore
+	expire   func()
+}
+
+func newMemoryBackend(t *testing.T) backend {
+	tokens := NewMemoryTokenStore()
+	now := time.Now()
+	tokens.now = func() time.Time { return now }
+
+	return backend{
+		tokens:   tokens,
+		sessions: NewMemorySessionStore(),
+		users:    NewMemoryUserStore(),
+		expire:   func() { now = now.Add(RefreshTokenTTL + time.Second) },
+	}
+}
+
+func newRedisBackend(t *testing.T) backend {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return backend{
+		tokens:   NewRedisTokenStore(client, 0),
+		sessions: NewRedisSessionStore(client),
+		users:    NewRedisUserStore(client),
+		expire:   func() { mr.FastForward(RefreshTokenTTL + time.Second) },
+	}
+}
+
+var backends = []struct {
+	name string
+	new  func(t *testing.T) backend
+}{
+	{name: "memory", new: newMemoryBackend},
+	{name: "redis", new: newRedisBackend},
+}
+
+func TestTokenStore(t *testing.T) {
+	ctx := context.Background()
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			t.Run("lookup", func(t *testing.T) {
+				s := b.new(t).tokens
+
+				access, expiresAt, err := s.GenerateToken(ctx, "user-1", "session-1")
+				if err != nil {
+					t.Fatalf("GenerateToken failed: %v", err)
+				}
+				refresh, _, err := s.GenerateRefreshToken(ctx, "user-1", "session-1")
+				if err != nil {
+					t.Fatalf("GenerateRefreshToken failed: %v", err)
+				}
+
+				info, err := s.Lookup(ctx, access)
+				if err != nil {
+					t.Fatalf("Lookup failed: %v", err)
+				}
+				if info.UserID != "user-1" || info.SessionID != "session-1" || info.IsRefresh {
+					t.Errorf("unexpected access token info %+v", info)
+				}
+				if info.ExpiresAt.Sub(expiresAt).Abs() > time.Millisecond {
+					t.Errorf("expected expiry %v, got %v", expiresAt, info.ExpiresAt)
+				}
+
+				info, err = s.Lookup(ctx, refresh)
+				if err != nil || !info.IsRefresh {
+					t.Errorf("expected refresh token, got %+v err=%v", info, err)
+				}
+
+				if _, err := s.Lookup(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+					t.Errorf("expected ErrNotFound, got %v", err)
+				}
+			})
+
+			t.Run("client token", func(t *testing.T) {
+				s := b.new(t).tokens
+
+				token, _, err := s.GenerateClientToken(ctx, "billing", []string{"orders:read", "orders:write"})
+				if err != nil {
+					t.Fatalf("GenerateClientToken failed: %v", err)
+				}
+
+				info, err := s.Lookup(ctx, token)
+				if err != nil {
+					t.Fatalf("Lookup failed: %v", err)
+				}
+				if info.ClientID != "billing" || info.UserID != "" || info.IsRefresh {
+					t.Errorf("unexpected client token info %+v", info)
+				}
+				if !slices.Equal(info.Scopes, []string{"orders:read", "orders:write"}) {
+					t.Errorf("expected granted scopes, got %v", info.Scopes)
+				}
+
+				if _, err := s.RotateRefreshToken(ctx, token); !errors.Is(err, ErrNotRefreshToken) {
+					t.Errorf("expected ErrNotRefreshToken, got %v", err)
+				}
+			})
+
+			t.Run("expiry", func(t *testing.T) {
+				be := b.new(t)
+
+				token, _, err := be.tokens.GenerateToken(ctx, "user-1", "session-1")
+				if err != nil {
+					t.Fatalf("GenerateToken failed: %v", err)
+				}
+				be.expire()
+
+				if _, err := be.tokens.Lookup(ctx, token); !errors.Is(err, ErrNotFound) {
+					t.Errorf("expected expired token to be gone, got %v", err)
+				}
+			})
+
+			t.Run("revoke", func(t *testing.T) {
+				s := b.new(t).tokens
+
+				token, _, err := s.GenerateToken(ctx, "user-1", "session-1")
+				if err != nil {
+					t.Fatalf("GenerateToken failed: %v", err)
+				}
+				if err := s.RevokeToken(ctx, token); err != nil {
+					t.Fatalf("RevokeToken failed: %v", err)
+				}
+				if _, err := s.Lookup(ctx, token); !errors.Is(err, ErrNotFound) {
+					t.Errorf("expected revoked token to be gone, got %v", err)
+				}
+				if err := s.RevokeToken(ctx, "unknown"); err != nil {
+					t.Errorf("expected revoking unknown token to succeed, got %v", err)
+				}
+			})
+
+			t.Run("rotate", func(t *testing.T) {
+				s := b.new(t).tokens
+
+				access, _, _ := s.GenerateToken(ctx, "user-1", "session-1")
+				refresh, _, _ := s.GenerateRefreshToken(ctx, "user-1", "session-1")
+
+				pair, err := s.RotateRefreshToken(ctx, refresh)
+				if err != nil {
+					t.Fatalf("RotateRefreshToken failed: %v", err)
+				}
+				if pair.UserID != "user-1" || pair.SessionID != "session-1" {
+					t.Errorf("expected user-1 and session-1, got %s and %s", pair.UserID, pair.SessionID)
+				}
+				if info, err := s.Lookup(ctx, pair.AccessToken); err != nil || info.IsRefresh || info.SessionID != "session-1" {
+					t.Errorf("expected new access token, got %+v err=%v", info, err)
+				}
+				if info, err := s.Lookup(ctx, pair.RefreshToken); err != nil || !info.IsRefresh || info.SessionID != "session-1" {
+					t.Errorf("expected new refresh token, got %+v err=%v", info, err)
+				}
+
+				if _, err := s.RotateRefreshToken(ctx, refresh); !errors.Is(err, ErrNotFound) {
+					t.Errorf("expected reused refresh token to fail with ErrNotFound, got %v", err)
+				}
+				if _, err := s.RotateRefreshToken(ctx, access); !errors.Is(err, ErrNotRefreshToken) {
+					t.Errorf("expected ErrNotRefreshToken, got %v", err)
+				}
+				if _, err := s.Lookup(ctx, access); err != nil {
+					t.Errorf("expected access token to survive a failed rotation, got %v", err)
+				}
+			})
+
+			t.Run("concurrent rotation", func(t *testing.T) {
+				s := b.new(t).tokens
+
+				refresh, _, _ := s.GenerateRefreshToken(ctx, "user-1", "session-1")
+
+				const workers = 8
+				var wg sync.WaitGroup
+				results := make(chan error, workers)
+				for range workers {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						_, err := s.RotateRefreshToken(ctx, refresh)
+						results <- err
+					}()
+				}
+				wg.Wait()
+				close(results)
+
+				succeeded := 0
+				for err := range results {
+					if err == nil {
+						succeeded++
+					} else if !errors.Is(err, ErrNotFound) {
+						t.Errorf("unexpected error: %v", err)
+					}
+				}
+				if succeeded != 1 {
+					t.Errorf("expected exactly one rotation to succeed, got %d", succeeded)
+				}
+			})
+		})
+	}
+}
+
+func TestSessionStore(t *testing.T) {
+	ctx := context.Background()
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			s := b.new(t).sessions
+
+			want := &Session{ID: "session-1", UserID: "user-1", Username: "alice", Email: "alice@example.com", Roles: []string{"user", "admin"}}
+			if err := s.CreateSession(ctx, want); err != nil {
+				t.Fatalf("CreateSession failed: %v", err)
+			}
+
+			got, err := s.GetSession(ctx, "session-1")
+			if err != nil {
+				t.Fatalf("GetSession failed: %v", err)
+			}
+			if got.ID != want.ID || got.UserID != want.UserID || got.Username != want.Username || got.Email != want.Email || !slices.Equal(got.Roles, want.Roles) {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+
+			if err := s.DeleteSession(ctx, "session-1"); err != nil {
+				t.Fatalf("DeleteSession failed: %v", err)
+			}
+			if _, err := s.GetSession(ctx, "session-1"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+
+			if err := s.HealthCheck(ctx); err != nil {
+				t.Errorf("HealthCheck failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionStore_SessionsPerLogin(t *testing.T) {
+	ctx := context.Background()
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			s := b.new(t).sessions
+
+			// Two logins of the same user, e.g. on a laptop and a phone
+			for _, id := range []string{"laptop", "phone"} {
+				if err := s.CreateSession(ctx, &Session{ID: id, UserID: "user-1", Username: "alice"}); err != nil {
+					t.Fatalf("CreateSession failed: %v", err)
+				}
+			}
+
+			for _, tt := range []struct{ logout, other string }{
+				{logout: "laptop", other: "phone"},
+				{logout: "phone", other: "laptop"},
+			} {
+				if err := s.DeleteSession(ctx, tt.logout); err != nil {
+					t.Fatalf("DeleteSession failed: %v", err)
+				}
+				if _, err := s.GetSession(ctx, tt.logout); !errors.Is(err, ErrNotFound) {
+					t.Errorf("expected the %s session to be gone, got %v", tt.logout, err)
+				}
+				if got, err := s.GetSession(ctx, tt.other); err != nil || got.UserID != "user-1" {
+					t.Errorf("expected the %s session to survive, got %+v err=%v", tt.other, got, err)
+				}
+				if err := s.CreateSession(ctx, &Session{ID: tt.logout, UserID: "user-1", Username: "alice"}); err != nil {
+					t.Fatalf("CreateSession failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestUserStore(t *testing.T) {
+	ctx := context.Background()
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			s := b.new(t).users
+
+			alice := &User{ID: "user-1", Username: "alice", Skeleton: "alice", CreatedAt: time.UnixMilli(1700000000000)}
+			if err := s.CreateUser(ctx, alice); err != nil {
+				t.Fatalf("CreateUser failed: %v", err)
+			}
+
+			got, err := s.GetUserByUsername(ctx, "alice")
+			if err != nil {
+				t.Fatalf("GetUserByUsername failed: %v", err)
+			}
+			if *got != *alice {
+				t.Errorf("expected %+v, got %+v", alice, got)
+			}
+			if _, err := s.GetUser(ctx, "user-2"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound for unknown ID, got %v", err)
+			}
+			if _, err := s.GetUserByUsername(ctx, "bob"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound for unknown username, got %v", err)
+			}
+
+			// Same username, and a different username with the same skeleton
+			for _, dup := range []*User{
+				{ID: "user-2", Username: "alice", Skeleton: "alice2"},
+				{ID: "user-2", Username: "alicé", Skeleton: "alice"},
+			} {
+				if err := s.CreateUser(ctx, dup); !errors.Is(err, ErrUsernameTaken) {
+					t.Errorf("expected ErrUsernameTaken for %q, got %v", dup.Username, err)
+				}
+			}
+			if _, err := s.GetUser(ctx, "user-2"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected rejected user not to be stored, got %v", err)
+			}
+
+			bob := &User{ID: "user-2", Username: "bob", Skeleton: "bob"}
+			if err := s.CreateUser(ctx, bob); err != nil {
+				t.Fatalf("CreateUser failed: %v", err)
+			}
+
+			if err := s.SetEmail(ctx, "user-1", "alice@example.com"); err != nil {
+				t.Fatalf("SetEmail failed: %v", err)
+			}
+			if err := s.SetEmail(ctx, "user-1", "alice@example.com"); err != nil {
+				t.Errorf("expected setting the same email again to succeed, got %v", err)
+			}
+			if err := s.SetEmail(ctx, "user-2", "alice@example.com"); !errors.Is(err, ErrEmailTaken) {
+				t.Errorf("expected ErrEmailTaken, got %v", err)
+			}
+			if err := s.SetEmail(ctx, "user-3", "carol@example.com"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound for unknown user, got %v", err)
+			}
+
+			// Changing the address releases the old one
+			if err := s.SetEmail(ctx, "user-1", "alice@example.org"); err != nil {
+				t.Fatalf("SetEmail failed: %v", err)
+			}
+			if err := s.SetEmail(ctx, "user-2", "alice@example.com"); err != nil {
+				t.Errorf("expected released email to be available, got %v", err)
+			}
+
+			got, err = s.GetUser(ctx, "user-1")
+			if err != nil {
+				t.Fatalf("GetUser failed: %v", err)
+			}
+			if got.Email != "alice@example.org" {
+				t.Errorf("expected email alice@example.org, got %q", got.Email)
+			}
+
+			if err := s.HealthCheck(ctx); err != nil {
+				t.Errorf("HealthCheck failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestRedisSessionStore_Expiry(t *testing.T) {
+	be := newRedisBackend(t)
+	ctx := context.Background()
+
+	if err := be.sessions.CreateSession(ctx, &Session{ID: "session-1", UserID: "user-1", Username: "alice"}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	be.expire()
+	if _, err := be.sessions.GetSession(ctx, "session-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected expired session to be gone, got %v", err)
+	}
+}
+
+func TestRedisTokenStore_RevocationBroadcast(t *testing.T) {
+	mr := miniredis.RunT(t)
+	newReplica := func() *RedisTokenStore {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewRedisTokenStore(client, time.Hour)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	issuer := newReplica()
+	follower := newReplica()
+	go follower.WatchRevocations(ctx, zap.NewNop())
+
+	// Wait for the subscription so the revocation below is not missed
+	deadline := time.Now().Add(5 * time.Second)
+	for len(mr.PubSubChannels(RevocationChannel)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("follower did not subscribe to revocations")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	token, _, err := issuer.GenerateToken(ctx, "user-1", "session-1")
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+	// Warm the follower's cache so only the broadcast can evict the token
+	if _, err := follower.Lookup(ctx, token); err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+
+	if err := issuer.RevokeToken(ctx, token); err != nil {
+		t.Fatalf("RevokeToken failed: %v", err)
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		_, err := follower.Lookup(ctx, token)
+		if errors.Is(err, ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected revoked token to be evicted on the follower, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRedisTokenStore_Unavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	s := NewRedisTokenStore(client, 0)
+
+	mr.Close()
+
+	ctx := context.Background()
+	if _, _, err := s.GenerateToken(ctx, "user-1", "session-1"); err == nil {
+		t.Error("expected GenerateToken to fail")
+	}
+	if _, err := s.Lookup(ctx, "token"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected connection error, got %v", err)
+	}
+	if err := s.HealthCheck(ctx); err == nil {
+		t.Error("expected HealthCheck to fail")
+	}
+}
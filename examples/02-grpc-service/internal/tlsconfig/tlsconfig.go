@@ -0,0 +1,324 @@
+// Package tlsconfig builds TLS and mutual TLS configurations for the gRPC
+// server and clients from PEM files that are reloaded when they change.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Mode selects the transport security of a connection
+type Mode string
+
+const (
+	// ModePlaintext disables TLS
+	ModePlaintext Mode = "plaintext"
+	// ModeTLS encrypts the connection and authenticates the server
+	ModeTLS Mode = "tls"
+	// ModeMTLS additionally requires a client certificate signed by the CA
+	ModeMTLS Mode = "mtls"
+)
+
+// ParseMode parses a mode name; an empty string means plaintext
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "", ModePlaintext:
+		return ModePlaintext, nil
+	case ModeTLS, ModeMTLS:
+		return Mode(s), nil
+	default:
+		return "", fmt.Errorf("unknown TLS mode %q (want plaintext, tls or mtls)", s)
+	}
+}
+
+// Config holds the certificate files for one side of a connection
+type Config struct {
+	Mode Mode
+	// CertFile and KeyFile are the local certificate. Required for servers
+	// in tls and mtls modes and for clients in mtls mode.
+	CertFile string
+	KeyFile  string
+	// CAFile verifies the other side: client certificates on servers in
+	// mtls mode, the server certificate on clients. Clients without a
+	// CAFile use the system roots.
+	CAFile string
+	// ServerName overrides the name clients verify the server certificate
+	// against; by default the dial target host is used
+	ServerName string
+}
+
+// Validate checks that the files required by the mode are set for a server
+// or client
+func (c Config) Validate(server bool) error {
+	if c.Mode == ModePlaintext {
+		return nil
+	}
+	needCert := server || c.Mode == ModeMTLS
+	if needCert && (c.CertFile == "" || c.KeyFile == "") {
+		return fmt.Errorf("%s mode requires a certificate and key", c.Mode)
+	}
+	if server && c.Mode == ModeMTLS && c.CAFile == "" {
+		return errors.New("mtls mode requires a CA file to verify clients")
+	}
+	return nil
+}
+
+// fileVersion identifies a version of a file by modification time and size
+type fileVersion struct {
+	mod  time.Time
+	size int64
+}
+
+func statFile(path string) fileVersion {
+	if path == "" {
+		return fileVersion{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{size: -1}
+	}
+	return fileVersion{mod: info.ModTime(), size: info.Size()}
+}
+
+// Reloader holds the current certificate and CA pool and swaps them when
+// the files change. TLS configs built from it pick up new material on the
+// next handshake; established connections are not affected.
+type Reloader struct {
+	cfg      Config
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	versions [3]fileVersion
+}
+
+// NewReloader loads the files named in cfg
+func NewReloader(cfg Config) (*Reloader, error) {
+	r := &Reloader{cfg: cfg}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, key and CA files again. On error the
+// previous material stays in use.
+func (r *Reloader) Reload() error {
+	versions := r.stat()
+
+	var cert *tls.Certificate
+	if r.cfg.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load key pair: %w", err)
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.CAFile != "" {
+		data, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("read CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", r.cfg.CAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = cert
+	r.pool = pool
+	r.versions = versions
+	return nil
+}
+
+// Watch polls the files every interval and reloads them when one changes
+// until ctx is done. Failed reloads are retried on the next tick.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := r.reloadIfChanged()
+		if err != nil {
+			logger.Error("certificate reload failed, keeping previous certificates", zap.Error(err))
+			continue
+		}
+		if changed {
+			logger.Info("certificates reloaded",
+				zap.String("cert_file", r.cfg.CertFile),
+				zap.String("ca_file", r.cfg.CAFile),
+			)
+		}
+	}
+}
+
+func (r *Reloader) reloadIfChanged() (bool, error) {
+	r.mu.RLock()
+	unchanged := r.versions == r.stat()
+	r.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+	if err := r.Reload(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *Reloader) stat() [3]fileVersion {
+	return [3]fileVersion{
+		statFile(r.cfg.CertFile),
+		statFile(r.cfg.KeyFile),
+		statFile(r.cfg.CAFile),
+	}
+}
+
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, r.pool
+}
+
+// ServerTLSConfig returns a server config that resolves the certificate and
+// client CA pool on every handshake
+func (r *Reloader) ServerTLSConfig() *tls.Config {
+	return r.serverTLSConfig([]string{"h2"})
+}
+
+// HTTPServerTLSConfig is ServerTLSConfig for net/http servers, which also
+// accept HTTP/1.1 clients
+func (r *Reloader) HTTPServerTLSConfig() *tls.Config {
+	return r.serverTLSConfig([]string{"h2", "http/1.1"})
+}
+
+func (r *Reloader) serverTLSConfig(nextProtos []string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				NextProtos:   nextProtos,
+			}
+			if r.cfg.Mode == ModeMTLS {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = pool
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// ClientTLSConfig returns a client config that presents the current client
+// certificate in mtls mode and verifies the server against the current CA
+func (r *Reloader) ClientTLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: r.cfg.ServerName,
+	}
+
+	if r.cfg.Mode == ModeMTLS {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		}
+	}
+
+	if r.cfg.CAFile != "" {
+		// The standard verifier only sees the RootCAs captured at dial time,
+		// so verify against the reloadable pool in VerifyConnection instead
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			_, pool := r.current()
+			return verifyServer(cs, pool)
+		}
+	}
+
+	return cfg
+}
+
+func verifyServer(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// ServerCredentials returns gRPC server credentials for cfg. In TLS modes
+// the returned Reloader should be watched to pick up rotated files; it is
+// nil in plaintext mode.
+func ServerCredentials(cfg Config) (credentials.TransportCredentials, *Reloader, error) {
+	return newCredentials(cfg, true)
+}
+
+// ClientCredentials returns gRPC client credentials for cfg, like
+// ServerCredentials
+func ClientCredentials(cfg Config) (credentials.TransportCredentials, *Reloader, error) {
+	return newCredentials(cfg, false)
+}
+
+// ServerReloader validates cfg and loads the server certificate for servers
+// that terminate TLS themselves, such as net/http. It returns nil in
+// plaintext mode.
+func ServerReloader(cfg Config) (*Reloader, error) {
+	if cfg.Mode == ModePlaintext {
+		return nil, nil
+	}
+	if err := cfg.Validate(true); err != nil {
+		return nil, err
+	}
+	return NewReloader(cfg)
+}
+
+func newCredentials(cfg Config, server bool) (credentials.TransportCredentials, *Reloader, error) {
+	if cfg.Mode == ModePlaintext {
+		return insecure.NewCredentials(), nil, nil
+	}
+	if err := cfg.Validate(server); err != nil {
+		return nil, nil, err
+	}
+
+	r, err := NewReloader(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if server {
+		return credentials.NewTLS(r.ServerTLSConfig()), r, nil
+	}
+	return credentials.NewTLS(r.ClientTLSConfig()), r, nil
+}
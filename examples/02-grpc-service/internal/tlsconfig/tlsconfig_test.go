@@ -0,0 +1,189 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/tlsconfig/tlstest"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Mode
+		wantErr bool
+	}{
+		{input: "", want: ModePlaintext},
+		{input: "plaintext", want: ModePlaintext},
+		{input: "tls", want: ModeTLS},
+		{input: "mtls", want: ModeMTLS},
+		{input: "TLS", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		server  bool
+		wantErr bool
+	}{
+		{name: "plaintext", cfg: Config{Mode: ModePlaintext}, server: true},
+		{name: "tls server without cert", cfg: Config{Mode: ModeTLS}, server: true, wantErr: true},
+		{name: "tls server", cfg: Config{Mode: ModeTLS, CertFile: "c", KeyFile: "k"}, server: true},
+		{name: "mtls server without CA", cfg: Config{Mode: ModeMTLS, CertFile: "c", KeyFile: "k"}, server: true, wantErr: true},
+		{name: "tls client without files", cfg: Config{Mode: ModeTLS}},
+		{name: "mtls client without cert", cfg: Config{Mode: ModeMTLS, CAFile: "ca"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(tt.server); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeServerFiles issues a server certificate from ca into dir
+func writeServerFiles(t *testing.T, dir string, ca *tlstest.CA) Config {
+	t.Helper()
+
+	cert, err := ca.IssueServer("localhost")
+	if err != nil {
+		t.Fatalf("failed to issue certificate: %v", err)
+	}
+	cfg := Config{
+		Mode:     ModeMTLS,
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+	}
+	if err := cert.WriteFiles(cfg.CertFile, cfg.KeyFile); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := ca.WriteCert(cfg.CAFile); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+	return cfg
+}
+
+func TestReloader_ReloadIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	ca1, err := tlstest.NewCA("ca1")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	cfg := writeServerFiles(t, dir, ca1)
+
+	r, err := NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+
+	if changed, err := r.reloadIfChanged(); err != nil || changed {
+		t.Fatalf("expected no change, got changed=%v err=%v", changed, err)
+	}
+
+	// Rotate to a new CA and make sure the timestamps differ
+	ca2, err := tlstest.NewCA("ca2")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	writeServerFiles(t, dir, ca2)
+	future := time.Now().Add(time.Minute)
+	for _, path := range []string{cfg.CertFile, cfg.KeyFile, cfg.CAFile} {
+		os.Chtimes(path, future, future)
+	}
+
+	changed, err := r.reloadIfChanged()
+	if err != nil || !changed {
+		t.Fatalf("expected reload, got changed=%v err=%v", changed, err)
+	}
+
+	cert, pool := r.current()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	if leaf.Issuer.CommonName != "ca2" {
+		t.Errorf("expected certificate issued by ca2, got %s", leaf.Issuer.CommonName)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+		t.Errorf("expected reloaded pool to trust reloaded certificate: %v", err)
+	}
+}
+
+func TestReloader_KeepsPreviousOnError(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := tlstest.NewCA("ca")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	cfg := writeServerFiles(t, dir, ca)
+
+	r, err := NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	before, _ := r.current()
+
+	// A half-written key pair must not replace the working one
+	if err := os.WriteFile(cfg.KeyFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	if _, err := r.reloadIfChanged(); err == nil {
+		t.Fatal("expected reload error")
+	}
+
+	after, _ := r.current()
+	if after != before {
+		t.Error("expected previous certificate to stay in use")
+	}
+}
+
+func TestReloader_TLSConfigs(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := tlstest.NewCA("ca")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	cfg := writeServerFiles(t, dir, ca)
+
+	r, err := NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+
+	serverCfg, err := r.ServerTLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetConfigForClient failed: %v", err)
+	}
+	if serverCfg.ClientAuth != tls.RequireAndVerifyClientCert || serverCfg.ClientCAs == nil {
+		t.Error("expected mtls server config to require verified client certificates")
+	}
+
+	clientCfg := r.ClientTLSConfig()
+	if clientCfg.GetClientCertificate == nil {
+		t.Error("expected mtls client config to present a certificate")
+	}
+	if clientCfg.VerifyConnection == nil {
+		t.Error("expected client config to verify the server against the CA file")
+	}
+}
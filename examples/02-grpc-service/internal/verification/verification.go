@@ -0,0 +1,153 @@
+// Package verification issues and checks the short-lived numeric codes that
+// prove a user controls an email address.
+package verification
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoPendingVerification is returned when a user has no live code,
+	// including after it expired or too many wrong codes were entered
+	ErrNoPendingVerification = errors.New("no pending email verification")
+	// ErrInvalidCode is returned for a wrong verification code
+	ErrInvalidCode = errors.New("invalid verification code")
+	// ErrResendTooSoon is returned when a new code is requested before
+	// ResendInterval has passed since the last one
+	ErrResendTooSoon = errors.New("verification code requested too soon")
+)
+
+// Config holds verification code settings
+type Config struct {
+	CodeTTL time.Duration
+	Digits  int
+	// MaxAttempts is the number of wrong codes after which a pending
+	// verification is discarded
+	MaxAttempts int
+	// ResendInterval is the minimum time between codes for one user
+	ResendInterval time.Duration
+}
+
+// DefaultConfig returns settings suited to codes delivered by email
+func DefaultConfig() Config {
+	return Config{
+		CodeTTL:        15 * time.Minute,
+		Digits:         6,
+		MaxAttempts:    5,
+		ResendInterval: time.Minute,
+	}
+}
+
+type pending struct {
+	email     string
+	codeHash  [sha256.Size]byte
+	issuedAt  time.Time
+	expiresAt time.Time
+	attempts  int
+}
+
+// Manager keeps at most one pending verification per user. Pending codes
+// live in memory, so a code must be redeemed on the replica that issued it.
+type Manager struct {
+	mu      sync.Mutex
+	cfg     Config
+	pending map[string]*pending
+	now     func() time.Time
+}
+
+// NewManager creates a verification manager
+func NewManager(cfg Config) *Manager {
+	return &Manager{
+		cfg:     cfg,
+		pending: make(map[string]*pending),
+		now:     time.Now,
+	}
+}
+
+// Start issues a code verifying email for a user, replacing any pending
+// verification, and returns the code and its expiry
+func (m *Manager) Start(userID, email string) (string, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	if p, ok := m.pending[userID]; ok && now.Before(p.issuedAt.Add(m.cfg.ResendInterval)) {
+		return "", time.Time{}, ErrResendTooSoon
+	}
+
+	code, err := newCode(m.cfg.Digits)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	p := &pending{
+		email:     email,
+		codeHash:  sha256.Sum256([]byte(code)),
+		issuedAt:  now,
+		expiresAt: now.Add(m.cfg.CodeTTL),
+	}
+	m.pending[userID] = p
+
+	return code, p.expiresAt, nil
+}
+
+// Cancel discards a user's pending verification, e.g. when the code could
+// not be delivered
+func (m *Manager) Cancel(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.pending, userID)
+}
+
+// Verify checks a code and returns the email address it verifies. Codes are
+// single use and discarded after MaxAttempts wrong codes.
+func (m *Manager) Verify(userID, code string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.pending[userID]
+	if !ok || !m.now().Before(p.expiresAt) {
+		delete(m.pending, userID)
+		return "", ErrNoPendingVerification
+	}
+
+	hash := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	if subtle.ConstantTimeCompare(hash[:], p.codeHash[:]) != 1 {
+		p.attempts++
+		if p.attempts >= m.cfg.MaxAttempts {
+			delete(m.pending, userID)
+		}
+		return "", ErrInvalidCode
+	}
+
+	delete(m.pending, userID)
+	return p.email, nil
+}
+
+func (m *Manager) sweep(now time.Time) {
+	for userID, p := range m.pending {
+		if !now.Before(p.expiresAt) {
+			delete(m.pending, userID)
+		}
+	}
+}
+
+func newCode(digits int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
@@ -0,0 +1,125 @@
+package verification
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestManager() (*Manager, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := NewManager(DefaultConfig())
+	m.now = clock.Now
+	return m, clock
+}
+
+func TestManager_StartVerify(t *testing.T) {
+	m, _ := newTestManager()
+
+	code, expiresAt, err := m.Start("user-1", "alice@example.com")
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if len(code) != 6 {
+		t.Errorf("expected a 6-digit code, got %q", code)
+	}
+	if want := m.now().Add(15 * time.Minute); !expiresAt.Equal(want) {
+		t.Errorf("expected expiry %v, got %v", want, expiresAt)
+	}
+
+	if _, err := m.Verify("user-2", code); !errors.Is(err, ErrNoPendingVerification) {
+		t.Errorf("expected another user's code to be rejected, got %v", err)
+	}
+
+	email, err := m.Verify("user-1", " "+code+" ")
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if email != "alice@example.com" {
+		t.Errorf("expected alice@example.com, got %q", email)
+	}
+
+	if _, err := m.Verify("user-1", code); !errors.Is(err, ErrNoPendingVerification) {
+		t.Errorf("expected code to be single use, got %v", err)
+	}
+}
+
+func TestManager_Limits(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(m *Manager, clock *fakeClock, code string) error
+		want error
+	}{
+		{
+			name: "expired",
+			run: func(m *Manager, clock *fakeClock, code string) error {
+				clock.now = clock.now.Add(15 * time.Minute)
+				_, err := m.Verify("user-1", code)
+				return err
+			},
+			want: ErrNoPendingVerification,
+		},
+		{
+			name: "too many attempts",
+			run: func(m *Manager, clock *fakeClock, code string) error {
+				for range 5 {
+					if _, err := m.Verify("user-1", "not-the-code"); !errors.Is(err, ErrInvalidCode) {
+						return err
+					}
+				}
+				_, err := m.Verify("user-1", code)
+				return err
+			},
+			want: ErrNoPendingVerification,
+		},
+		{
+			name: "resend too soon",
+			run: func(m *Manager, clock *fakeClock, code string) error {
+				clock.now = clock.now.Add(30 * time.Second)
+				_, _, err := m.Start("user-1", "alice@example.com")
+				return err
+			},
+			want: ErrResendTooSoon,
+		},
+		{
+			name: "resend replaces code",
+			run: func(m *Manager, clock *fakeClock, code string) error {
+				clock.now = clock.now.Add(time.Minute)
+				if _, _, err := m.Start("user-1", "alice@example.org"); err != nil {
+					return err
+				}
+				_, err := m.Verify("user-1", code)
+				return err
+			},
+			want: ErrInvalidCode,
+		},
+		{
+			name: "cancelled",
+			run: func(m *Manager, clock *fakeClock, code string) error {
+				m.Cancel("user-1")
+				_, err := m.Verify("user-1", code)
+				return err
+			},
+			want: ErrNoPendingVerification,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, clock := newTestManager()
+			code, _, err := m.Start("user-1", "alice@example.com")
+			if err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			if err := tt.run(m, clock, code); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
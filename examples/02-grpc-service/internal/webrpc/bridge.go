@@ -0,0 +1,218 @@
+package webrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// bridge runs Connect and gRPC-Web calls through the generated gRPC method
+// handlers, so they pass the same interceptors as native gRPC calls
+type bridge struct {
+	desc    *grpc.ServiceDesc
+	impl    interface{}
+	unary   grpc.UnaryServerInterceptor
+	stream  grpc.StreamServerInterceptor
+	options []connect.HandlerOption
+}
+
+func (b *bridge) procedure(method string) string {
+	return fmt.Sprintf("/%s/%s", b.desc.ServiceName, method)
+}
+
+func (b *bridge) methodDesc(method string) grpc.MethodDesc {
+	for _, md := range b.desc.Methods {
+		if md.MethodName == method {
+			return md
+		}
+	}
+	panic(fmt.Sprintf("webrpc: %s has no unary method %s", b.desc.ServiceName, method))
+}
+
+func (b *bridge) streamDesc(method string) grpc.StreamDesc {
+	for _, sd := range b.desc.Streams {
+		if sd.StreamName == method && sd.ServerStreams && !sd.ClientStreams {
+			return sd
+		}
+	}
+	panic(fmt.Sprintf("webrpc: %s has no server-streaming method %s", b.desc.ServiceName, method))
+}
+
+// unary returns a Connect handler for a unary method of the service
+func unary[Req, Res any](b *bridge, method string) (string, http.Handler) {
+	md := b.methodDesc(method)
+	procedure := b.procedure(method)
+
+	return procedure, connect.NewUnaryHandler(procedure,
+		func(ctx context.Context, req *connect.Request[Req]) (*connect.Response[Res], error) {
+			ts := &transportStream{method: procedure}
+			ctx = grpc.NewContextWithServerTransportStream(incomingContext(ctx, req.Header()), ts)
+
+			dec := func(in interface{}) error {
+				proto.Merge(in.(proto.Message), any(req.Msg).(proto.Message))
+				return nil
+			}
+			out, err := md.Handler(b.impl, ctx, dec, b.unary)
+			if err != nil {
+				return nil, connectError(err, ts.header, ts.trailer)
+			}
+
+			res := connect.NewResponse(out.(*Res))
+			copyMetadata(res.Header(), ts.header)
+			copyMetadata(res.Trailer(), ts.trailer)
+			return res, nil
+		},
+		b.options...,
+	)
+}
+
+// serverStream returns a Connect handler for a server-streaming method
+func serverStream[Req, Res any](b *bridge, method string) (string, http.Handler) {
+	sd := b.streamDesc(method)
+	procedure := b.procedure(method)
+	info := &grpc.StreamServerInfo{FullMethod: procedure, IsServerStream: true}
+
+	return procedure, connect.NewServerStreamHandler(procedure,
+		func(ctx context.Context, req *connect.Request[Req], stream *connect.ServerStream[Res]) error {
+			ss := &streamAdapter[Req, Res]{
+				ctx:    incomingContext(ctx, req.Header()),
+				req:    req,
+				stream: stream,
+			}
+
+			var err error
+			if b.stream != nil {
+				err = b.stream(b.impl, ss, info, sd.Handler)
+			} else {
+				err = sd.Handler(b.impl, ss)
+			}
+			if err != nil {
+				return connectError(err, nil, nil)
+			}
+			return nil
+		},
+		b.options...,
+	)
+}
+
+// incomingContext exposes the request headers as gRPC metadata
+func incomingContext(ctx context.Context, header http.Header) context.Context {
+	md := make(metadata.MD, len(header))
+	for key, values := range header {
+		key = strings.ToLower(key)
+		for _, v := range values {
+			if strings.HasSuffix(key, "-bin") {
+				decoded, err := connect.DecodeBinaryHeader(v)
+				if err != nil {
+					continue
+				}
+				v = string(decoded)
+			}
+			md[key] = append(md[key], v)
+		}
+	}
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+func copyMetadata(dst http.Header, md metadata.MD) {
+	for key, values := range md {
+		for _, v := range values {
+			if strings.HasSuffix(key, "-bin") {
+				v = connect.EncodeBinaryHeader([]byte(v))
+			}
+			dst.Add(key, v)
+		}
+	}
+}
+
+// connectError converts a gRPC status error, keeping its details such as
+// RetryInfo
+func connectError(err error, header, trailer metadata.MD) error {
+	st := status.Convert(err)
+
+	cerr := connect.NewError(connect.Code(st.Code()), errors.New(st.Message()))
+	for _, detail := range st.Proto().GetDetails() {
+		if d, err := connect.NewErrorDetail(detail); err == nil {
+			cerr.AddDetail(d)
+		}
+	}
+	copyMetadata(cerr.Meta(), header)
+	copyMetadata(cerr.Meta(), trailer)
+	return cerr
+}
+
+// transportStream collects the headers and trailers a unary handler sets
+// with grpc.SetHeader and grpc.SetTrailer
+type transportStream struct {
+	method  string
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *transportStream) Method() string {
+	return s.method
+}
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *transportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+// streamAdapter presents a Connect server stream as a grpc.ServerStream.
+// Connect writes headers along with the first message, so SendHeader only
+// records them.
+type streamAdapter[Req, Res any] struct {
+	ctx      context.Context
+	req      *connect.Request[Req]
+	received bool
+	stream   *connect.ServerStream[Res]
+}
+
+func (s *streamAdapter[Req, Res]) SetHeader(md metadata.MD) error {
+	copyMetadata(s.stream.ResponseHeader(), md)
+	return nil
+}
+
+func (s *streamAdapter[Req, Res]) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *streamAdapter[Req, Res]) SetTrailer(md metadata.MD) {
+	copyMetadata(s.stream.ResponseTrailer(), md)
+}
+
+func (s *streamAdapter[Req, Res]) Context() context.Context {
+	return s.ctx
+}
+
+func (s *streamAdapter[Req, Res]) SendMsg(m interface{}) error {
+	return s.stream.Send(m.(*Res))
+}
+
+// RecvMsg yields the single request message, then io.EOF
+func (s *streamAdapter[Req, Res]) RecvMsg(m interface{}) error {
+	if s.received {
+		return io.EOF
+	}
+	s.received = true
+	proto.Merge(m.(proto.Message), any(s.req.Msg).(proto.Message))
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package webrpc serves AuthService to browsers and HTTP/1.1 clients over
+// the Connect and gRPC-Web protocols on the same port as native gRPC.
+//
+// Requests are routed by content type: native gRPC over HTTP/2 goes
+// straight to the grpc.Server, while Connect and gRPC-Web requests are
+// decoded by connect-go and run through the generated gRPC method handlers
+// with the server's interceptor chain, so authentication, policies and
+// logging behave the same for every protocol.
+package webrpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+	connectcors "connectrpc.com/cors"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"github.com/rs/cors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Config configures the multiplexing handler
+type Config struct {
+	// UnaryInterceptors and StreamInterceptors are applied, in order, to
+	// Connect and gRPC-Web calls; pass the ones the grpc.Server chains
+	UnaryInterceptors  []grpc.UnaryServerInterceptor
+	StreamInterceptors []grpc.StreamServerInterceptor
+	// HandlerOptions are passed to every Connect handler, e.g. to add
+	// connect interceptors for tracing
+	HandlerOptions []connect.HandlerOption
+	// AllowedOrigins lists the browser origins allowed to make cross-origin
+	// calls; "*" allows any. CORS is disabled when empty.
+	AllowedOrigins []string
+}
+
+// NewHandler returns an HTTP handler that serves native gRPC from
+// grpcServer and AuthService over Connect and gRPC-Web from auth. It must
+// be served with HTTP/2 enabled (h2c in plaintext) for native gRPC.
+func NewHandler(grpcServer *grpc.Server, auth authv1.AuthServiceServer, cfg Config) http.Handler {
+	b := &bridge{
+		desc:    &authv1.AuthService_ServiceDesc,
+		impl:    auth,
+		unary:   chainUnary(cfg.UnaryInterceptors),
+		stream:  chainStream(cfg.StreamInterceptors),
+		options: cfg.HandlerOptions,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(unary[authv1.LoginRequest, authv1.LoginResponse](b, "Login"))
+	mux.Handle(unary[authv1.LogoutRequest, authv1.LogoutResponse](b, "Logout"))
+	mux.Handle(unary[authv1.ValidateRequest, authv1.ValidateResponse](b, "ValidateToken"))
+	mux.Handle(unary[authv1.RefreshRequest, authv1.RefreshResponse](b, "RefreshToken"))
+	mux.Handle(serverStream[authv1.EventsRequest, authv1.Event](b, "StreamEvents"))
+	mux.Handle(unary[authv1.EnrollMFARequest, authv1.EnrollMFAResponse](b, "EnrollMFA"))
+	mux.Handle(unary[authv1.ConfirmMFARequest, authv1.ConfirmMFAResponse](b, "ConfirmMFA"))
+	mux.Handle(unary[authv1.VerifyMFARequest, authv1.LoginResponse](b, "VerifyMFA"))
+	mux.Handle(unary[authv1.AssignRoleRequest, authv1.RoleAssignmentResponse](b, "AssignRole"))
+	mux.Handle(unary[authv1.RevokeRoleRequest, authv1.RoleAssignmentResponse](b, "RevokeRole"))
+	mux.Handle(unary[authv1.UnlockRequest, authv1.UnlockResponse](b, "Unlock"))
+	mux.Handle(unary[authv1.AuthorizeRequest, authv1.AuthorizeResponse](b, "Authorize"))
+	mux.Handle(unary[authv1.ListAuditEventsRequest, authv1.ListAuditEventsResponse](b, "ListAuditEvents"))
+	mux.Handle(unary[authv1.RequestEmailVerificationRequest, authv1.RequestEmailVerificationResponse](b, "RequestEmailVerification"))
+	mux.Handle(unary[authv1.VerifyEmailRequest, authv1.VerifyEmailResponse](b, "VerifyEmail"))
+
+	var web http.Handler = withPeer(mux)
+	if len(cfg.AllowedOrigins) > 0 {
+		web = newCORS(cfg.AllowedOrigins).Handler(web)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && isNativeGRPC(r.Header.Get("Content-Type")) {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		web.ServeHTTP(w, r)
+	})
+}
+
+// isNativeGRPC matches application/grpc and application/grpc+proto but not
+// the gRPC-Web content types
+func isNativeGRPC(contentType string) bool {
+	return contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+")
+}
+
+func newCORS(origins []string) *cors.Cors {
+	return cors.New(cors.Options{
+		AllowedOrigins: origins,
+		AllowedMethods: connectcors.AllowedMethods(),
+		AllowedHeaders: append(connectcors.AllowedHeaders(), "Authorization", "X-Request-Id"),
+		ExposedHeaders: connectcors.ExposedHeaders(),
+		MaxAge:         7200,
+	})
+}
+
+// withPeer records the caller's address and TLS state the way grpc-go does
+// for native calls, so client IPs and mTLS peer identities resolve the same
+func withPeer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := &peer.Peer{Addr: strAddr(r.RemoteAddr)}
+		if r.TLS != nil {
+			p.AuthInfo = credentials.TLSInfo{
+				State:          *r.TLS,
+				CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(peer.NewContext(r.Context(), p)))
+	})
+}
+
+type strAddr string
+
+var _ net.Addr = strAddr("")
+
+func (a strAddr) Network() string { return "tcp" }
+func (a strAddr) String() string  { return string(a) }
+
+func chainUnary(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	if len(interceptors) == 0 {
+		return nil
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, inner)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+func chainStream(interceptors []grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	if len(interceptors) == 0 {
+		return nil
+	}
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(srv interface{}, ss grpc.ServerStream) error {
+				return interceptor(srv, ss, info, inner)
+			}
+		}
+		return next(srv, ss)
+	}
+}
@@ -0,0 +1,52 @@
+package webrpc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestIsNativeGRPC(t *testing.T) {
+	tests := map[string]bool{
+		"application/grpc":           true,
+		"application/grpc+proto":     true,
+		"application/grpc-web":       false,
+		"application/grpc-web+proto": false,
+		"application/grpc-web-text":  false,
+		"application/connect+proto":  false,
+		"application/json":           false,
+	}
+	for contentType, want := range tests {
+		if got := isNativeGRPC(contentType); got != want {
+			t.Errorf("isNativeGRPC(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
+
+func TestChainUnary_Order(t *testing.T) {
+	var calls []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name)
+			return handler(ctx, req)
+		}
+	}
+
+	chain := chainUnary([]grpc.UnaryServerInterceptor{record("logging"), record("auth")})
+	_, err := chain(context.Background(), nil, &grpc.UnaryServerInfo{}, func(context.Context, interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"logging", "auth", "handler"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("expected calls %v, got %v", want, calls)
+	}
+	if chainUnary(nil) != nil {
+		t.Error("expected a nil interceptor for an empty chain")
+	}
+}
@@ -0,0 +1,152 @@
+package grpcauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ErrInvalidToken is returned by validators for unknown or expired tokens
+var ErrInvalidToken = errors.New("invalid token")
+
+// TokenValidator resolves a bearer token to the principal it was issued to
+type TokenValidator interface {
+	ValidateBearer(ctx context.Context, token string) (*Principal, error)
+}
+
+// ValidatorFunc adapts a function to the TokenValidator interface
+type ValidatorFunc func(ctx context.Context, token string) (*Principal, error)
+
+// ValidateBearer calls f(ctx, token)
+func (f ValidatorFunc) ValidateBearer(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+// Config configures the auth interceptors
+type Config struct {
+	Validator TokenValidator
+	// PeerValidator authenticates calls without a bearer token by their
+	// verified client certificate. Nil disables certificate authentication.
+	PeerValidator PeerValidator
+	Policies      Policies
+	// DefaultPolicy applies to methods missing from Policies. Its zero
+	// value requires authentication.
+	DefaultPolicy Policy
+}
+
+// UnaryServerInterceptor authenticates and authorizes unary RPCs
+func UnaryServerInterceptor(cfg Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, cfg, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authenticates and authorizes streaming RPCs
+func StreamServerInterceptor(cfg Config) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), cfg, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// BearerToken extracts the token from the "authorization: Bearer <token>"
+// metadata entry of an incoming context
+func BearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	for _, value := range md.Get("authorization") {
+		scheme, token, found := strings.Cut(value, " ")
+		if found && strings.EqualFold(scheme, "bearer") && token != "" {
+			return strings.TrimSpace(token), true
+		}
+	}
+	return "", false
+}
+
+func authorize(ctx context.Context, cfg Config, fullMethod string) (context.Context, error) {
+	policy := cfg.Policies.Lookup(fullMethod, cfg.DefaultPolicy)
+
+	// Public methods need no credentials, so none are checked: a stale
+	// token sent to Login or RefreshToken is neither rejected nor audited
+	if policy.Access == AccessPublic {
+		return ctx, nil
+	}
+
+	p, err := authenticate(ctx, cfg)
+	if err != nil {
+		return ctx, err
+	}
+	if p == nil {
+		return ctx, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	if policy.Access == AccessRoleRequired && !p.HasAnyRole(policy.Roles...) {
+		return ctx, status.Errorf(codes.PermissionDenied, "requires one of roles %v", policy.Roles)
+	}
+
+	return NewContext(ctx, p), nil
+}
+
+// authenticate resolves the caller from its bearer token or, failing that,
+// its client certificate. It returns a nil principal and error when the
+// call carries neither.
+func authenticate(ctx context.Context, cfg Config) (*Principal, error) {
+	id, hasPeer := PeerIdentityFromContext(ctx)
+
+	if token, ok := BearerToken(ctx); ok {
+		if cfg.Validator == nil {
+			return nil, status.Error(codes.Unauthenticated, "no token validator configured")
+		}
+		p, err := cfg.Validator.ValidateBearer(ctx, token)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+		}
+		if hasPeer {
+			return withPeer(p, id), nil
+		}
+		return p, nil
+	}
+
+	if hasPeer && cfg.PeerValidator != nil {
+		p, err := cfg.PeerValidator.ValidatePeer(ctx, id)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "untrusted client certificate")
+		}
+		return withPeer(p, id), nil
+	}
+
+	return nil, nil
+}
+
+// withPeer returns a copy of p with the peer identity attached, leaving
+// principals cached by validators untouched
+func withPeer(p *Principal, id *PeerIdentity) *Principal {
+	cp := *p
+	cp.Peer = id
+	return &cp
+}
+
+// wrappedStream overrides the context of a server stream
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *wrappedStream) Context() context.Context {
+	return w.ctx
+}
@@ -0,0 +1,284 @@
+package grpcauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/url"
+	"testing"
+
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var testPrincipals = map[string]*Principal{
+	"user-token":  {UserID: "u1", Username: "alice", Roles: []string{"user"}},
+	"admin-token": {UserID: "u2", Username: "root", Roles: []string{"user", "admin"}},
+}
+
+func testConfig() Config {
+	return Config{
+		Validator: ValidatorFunc(func(_ context.Context, token string) (*Principal, error) {
+			if p, ok := testPrincipals[token]; ok {
+				return p, nil
+			}
+			return nil, ErrInvalidToken
+		}),
+		Policies: Policies{
+			"/test.Service/Public":  Public(),
+			"/test.Service/Private": Authenticated(),
+			"/test.Service/Admin":   RequireRole("admin"),
+			"/test.Open/":           Public(),
+		},
+	}
+}
+
+func withToken(token string) context.Context {
+	if token == "" {
+		return context.Background()
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(testConfig())
+
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		wantCode codes.Code
+		wantUser string
+	}{
+		{name: "public anonymous", method: "/test.Service/Public", wantCode: codes.OK},
+		{name: "public with token", method: "/test.Service/Public", token: "user-token", wantCode: codes.OK},
+		{name: "public invalid token", method: "/test.Service/Public", token: "bogus", wantCode: codes.OK},
+		{name: "service prefix", method: "/test.Open/Anything", wantCode: codes.OK},
+		{name: "authenticated anonymous", method: "/test.Service/Private", wantCode: codes.Unauthenticated},
+		{name: "authenticated invalid token", method: "/test.Service/Private", token: "bogus", wantCode: codes.Unauthenticated},
+		{name: "authenticated valid", method: "/test.Service/Private", token: "user-token", wantCode: codes.OK, wantUser: "u1"},
+		{name: "role missing", method: "/test.Service/Admin", token: "user-token", wantCode: codes.PermissionDenied},
+		{name: "role present", method: "/test.Service/Admin", token: "admin-token", wantCode: codes.OK, wantUser: "u2"},
+		{name: "unknown method defaults to authenticated", method: "/test.Service/Other", wantCode: codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser string
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				if p, ok := FromContext(ctx); ok {
+					gotUser = p.UserID
+				}
+				return "ok", nil
+			}
+
+			_, err := interceptor(withToken(tt.token), nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("expected code %v, got %v", tt.wantCode, code)
+			}
+			if gotUser != tt.wantUser {
+				t.Errorf("expected user %q in context, got %q", tt.wantUser, gotUser)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(testConfig())
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Admin", IsServerStream: true}
+
+	var gotUser string
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		if p, ok := FromContext(ss.Context()); ok {
+			gotUser = p.Username
+		}
+		return nil
+	}
+
+	err := interceptor(nil, &fakeStream{ctx: withToken("user-token")}, info, handler)
+	if code := status.Code(err); code != codes.PermissionDenied {
+		t.Errorf("expected code %v, got %v", codes.PermissionDenied, code)
+	}
+
+	if err := interceptor(nil, &fakeStream{ctx: withToken("admin-token")}, info, handler); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotUser != "root" {
+		t.Errorf("expected principal root in stream context, got %q", gotUser)
+	}
+}
+
+func TestUnaryServerInterceptor_PublicSkipsValidation(t *testing.T) {
+	cfg := testConfig()
+	calls := 0
+	cfg.Validator = ValidatorFunc(func(context.Context, string) (*Principal, error) {
+		calls++
+		return nil, ErrInvalidToken
+	})
+	interceptor := UnaryServerInterceptor(cfg)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+	// A stale token sent to a public method is never validated
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Public"}
+	if _, err := interceptor(withToken("stale"), nil, info, handler); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("expected no token validation for a public method, got %d", calls)
+	}
+
+	info = &grpc.UnaryServerInfo{FullMethod: "/test.Service/Private"}
+	if _, err := interceptor(withToken("stale"), nil, info, handler); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected the token to be validated once for a private method, got %d", calls)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+		wantOK bool
+	}{
+		{name: "bearer", header: "Bearer abc", want: "abc", wantOK: true},
+		{name: "lowercase scheme", header: "bearer abc", want: "abc", wantOK: true},
+		{name: "basic scheme", header: "Basic abc", wantOK: false},
+		{name: "missing token", header: "Bearer ", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", tt.header))
+			got, ok := BearerToken(ctx)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("expected (%q, %v), got (%q, %v)", tt.want, tt.wantOK, got, ok)
+			}
+		})
+	}
+}
+
+func TestPoliciesFromService(t *testing.T) {
+	policies := PoliciesFromService(authv1.File_proto_auth_v1_auth_proto.Services().ByName("AuthService"))
+
+	login := policies.Lookup(authv1.AuthService_Login_FullMethodName, Policy{})
+	if login.Access != AccessPublic {
+		t.Errorf("expected Login to be public, got %v", login.Access)
+	}
+
+	stream := policies.Lookup(authv1.AuthService_StreamEvents_FullMethodName, Policy{})
+	if stream.Access != AccessRoleRequired || len(stream.Roles) != 1 || stream.Roles[0] != "admin" {
+		t.Errorf("expected StreamEvents to require admin, got %+v", stream)
+	}
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (f *fakeStream) Context() context.Context {
+	return f.ctx
+}
+
+// withPeerCert returns ctx as seen by a server after verifying a client
+// certificate with the given URI SAN
+func withPeerCert(ctx context.Context, uri string) context.Context {
+	u, _ := url.Parse(uri)
+	cert := &x509.Certificate{URIs: []*url.URL{u}}
+	return peer.NewContext(ctx, &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}},
+	})
+}
+
+func TestUnaryServerInterceptor_PeerIdentity(t *testing.T) {
+	cfg := testConfig()
+	cfg.PeerValidator = peerValidatorFunc(func(_ context.Context, id *PeerIdentity) (*Principal, error) {
+		if id.SPIFFEID != "spiffe://test/operator" {
+			return nil, errors.New("unknown workload")
+		}
+		return &Principal{UserID: id.SPIFFEID, Username: id.SPIFFEID, Roles: []string{"admin"}}, nil
+	})
+	interceptor := UnaryServerInterceptor(cfg)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		method   string
+		wantCode codes.Code
+		wantUser string
+		wantPeer string
+	}{
+		{
+			name:     "certificate authenticates",
+			ctx:      withPeerCert(context.Background(), "spiffe://test/operator"),
+			method:   "/test.Service/Admin",
+			wantCode: codes.OK,
+			wantUser: "spiffe://test/operator",
+			wantPeer: "spiffe://test/operator",
+		},
+		{
+			name:     "untrusted workload",
+			ctx:      withPeerCert(context.Background(), "spiffe://test/other"),
+			method:   "/test.Service/Private",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "token wins over certificate",
+			ctx:      withPeerCert(withToken("user-token"), "spiffe://test/operator"),
+			method:   "/test.Service/Admin",
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "token principal carries peer",
+			ctx:      withPeerCert(withToken("user-token"), "spiffe://test/other"),
+			method:   "/test.Service/Private",
+			wantCode: codes.OK,
+			wantUser: "u1",
+			wantPeer: "spiffe://test/other",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser, gotPeer string
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				if p, ok := FromContext(ctx); ok {
+					gotUser = p.UserID
+					if p.Peer != nil {
+						gotPeer = p.Peer.SPIFFEID
+					}
+				}
+				return "ok", nil
+			}
+
+			_, err := interceptor(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("expected code %v, got %v", tt.wantCode, code)
+			}
+			if gotUser != tt.wantUser || gotPeer != tt.wantPeer {
+				t.Errorf("expected user %q peer %q, got %q %q", tt.wantUser, tt.wantPeer, gotUser, gotPeer)
+			}
+		})
+	}
+
+	if testPrincipals["user-token"].Peer != nil {
+		t.Error("validator principal was modified")
+	}
+}
+
+type peerValidatorFunc func(ctx context.Context, id *PeerIdentity) (*Principal, error)
+
+func (f peerValidatorFunc) ValidatePeer(ctx context.Context, id *PeerIdentity) (*Principal, error) {
+	return f(ctx, id)
+}
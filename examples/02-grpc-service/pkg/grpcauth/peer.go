@@ -0,0 +1,50 @@
+package grpcauth
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// PeerIdentity is the identity in a verified client certificate
+type PeerIdentity struct {
+	// SPIFFEID is the first spiffe:// URI SAN, if any
+	SPIFFEID   string
+	URIs       []string
+	DNSNames   []string
+	CommonName string
+}
+
+// PeerValidator resolves a verified client certificate to a principal for
+// calls that carry no bearer token
+type PeerValidator interface {
+	ValidatePeer(ctx context.Context, id *PeerIdentity) (*Principal, error)
+}
+
+// PeerIdentityFromContext returns the identity of the client certificate
+// that was verified during the TLS handshake. It is false for plaintext
+// connections and TLS connections without a client certificate.
+func PeerIdentityFromContext(ctx context.Context) (*PeerIdentity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	id := &PeerIdentity{
+		DNSNames:   cert.DNSNames,
+		CommonName: cert.Subject.CommonName,
+	}
+	for _, uri := range cert.URIs {
+		id.URIs = append(id.URIs, uri.String())
+		if uri.Scheme == "spiffe" && id.SPIFFEID == "" {
+			id.SPIFFEID = uri.String()
+		}
+	}
+	return id, true
+}
@@ -0,0 +1,109 @@
+package grpcauth
+
+import (
+	"strings"
+
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Access is the level of authentication a method requires
+type Access int
+
+const (
+	// AccessAuthenticated requires a valid bearer token. It is the zero
+	// value so methods without a policy are denied to anonymous callers.
+	AccessAuthenticated Access = iota
+	// AccessPublic allows anonymous callers
+	AccessPublic
+	// AccessRoleRequired requires a valid bearer token and one of Roles
+	AccessRoleRequired
+)
+
+// Policy is the access rule for a method
+type Policy struct {
+	Access Access
+	Roles  []string
+}
+
+// Public allows anyone to call a method. Credentials sent to a public
+// method are ignored, so no principal is put in its context.
+func Public() Policy {
+	return Policy{Access: AccessPublic}
+}
+
+// Authenticated requires a valid bearer token
+func Authenticated() Policy {
+	return Policy{Access: AccessAuthenticated}
+}
+
+// RequireRole requires a valid bearer token and any one of roles
+func RequireRole(roles ...string) Policy {
+	return Policy{Access: AccessRoleRequired, Roles: roles}
+}
+
+// Policies maps methods to policies. Keys are full method names
+// ("/pkg.Service/Method") or service prefixes ("/pkg.Service/") that
+// apply to every method of a service.
+type Policies map[string]Policy
+
+// Lookup returns the policy for a full method name, falling back to its
+// service prefix and then to def
+func (p Policies) Lookup(fullMethod string, def Policy) Policy {
+	if policy, ok := p[fullMethod]; ok {
+		return policy
+	}
+	if i := strings.LastIndex(fullMethod, "/"); i > 0 {
+		if policy, ok := p[fullMethod[:i+1]]; ok {
+			return policy
+		}
+	}
+	return def
+}
+
+// Merge returns a copy of p with the entries of other added, overriding
+// existing keys
+func (p Policies) Merge(other Policies) Policies {
+	merged := make(Policies, len(p)+len(other))
+	for k, v := range p {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+	return merged
+}
+
+// PoliciesFromService builds a policy table from the (auth.v1.access_policy)
+// method options declared on a service. Methods without the option are
+// left out so the interceptor default applies.
+func PoliciesFromService(sd protoreflect.ServiceDescriptor) Policies {
+	policies := make(Policies)
+
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		opts := method.Options()
+		if opts == nil || !proto.HasExtension(opts, authv1.E_AccessPolicy) {
+			continue
+		}
+
+		ext, ok := proto.GetExtension(opts, authv1.E_AccessPolicy).(*authv1.AccessPolicy)
+		if !ok || ext == nil {
+			continue
+		}
+
+		fullMethod := "/" + string(sd.FullName()) + "/" + string(method.Name())
+		switch ext.Access {
+		case authv1.Access_ACCESS_PUBLIC:
+			policies[fullMethod] = Public()
+		case authv1.Access_ACCESS_ROLE_REQUIRED:
+			policies[fullMethod] = RequireRole(ext.Roles...)
+		default:
+			policies[fullMethod] = Authenticated()
+		}
+	}
+
+	return policies
+}
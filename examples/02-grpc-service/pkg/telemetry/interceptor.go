@@ -0,0 +1,58 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/grpcauth"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// userResponse is implemented by responses that authenticate a user, such
+// as LoginResponse
+type userResponse interface {
+	GetUser() *authv1.User
+}
+
+// UnaryServerInterceptor tags the RPC span with the caller's user ID, or
+// for logins with the ID of the user who just authenticated. Chain it after
+// the grpcauth interceptor.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		span := trace.SpanFromContext(ctx)
+		if !span.IsRecording() {
+			return handler(ctx, req)
+		}
+		setPrincipal(ctx, span)
+
+		resp, err := handler(ctx, req)
+		if r, ok := resp.(userResponse); ok && err == nil && r.GetUser() != nil {
+			span.SetAttributes(semconv.EnduserID(r.GetUser().Id))
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor tags the RPC span with the caller's user ID.
+// Chain it after the grpcauth interceptor.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		if span := trace.SpanFromContext(ctx); span.IsRecording() {
+			setPrincipal(ctx, span)
+		}
+		return handler(srv, ss)
+	}
+}
+
+// setPrincipal records the authenticated caller; for workloads on mTLS the
+// user ID is their SPIFFE ID
+func setPrincipal(ctx context.Context, span trace.Span) {
+	p, ok := grpcauth.FromContext(ctx)
+	if !ok {
+		return
+	}
+	span.SetAttributes(semconv.EnduserID(p.UserID))
+}
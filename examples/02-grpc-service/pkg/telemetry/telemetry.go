@@ -0,0 +1,99 @@
+// Package telemetry sets up OpenTelemetry tracing and metrics exported over
+// OTLP/gRPC. RPC spans and the RED metrics (rpc.server.duration,
+// rpc.server.requests_per_rpc, rpc.server.responses_per_rpc, labelled by
+// method and status code) come from the otelgrpc and otelconnect
+// instrumentation; this package adds the authenticated user to spans.
+//
+// Setup is shared with the client and the gRPC load generator in
+// load-generators/02-grpc, so every process exports the same way.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// Config holds OTLP export settings
+type Config struct {
+	ServiceName string
+	// Endpoint is the collector's OTLP/gRPC address, either host:port or a
+	// URL whose scheme selects TLS. Export is disabled when empty.
+	Endpoint string
+	// Insecure disables TLS for host:port endpoints
+	Insecure bool
+}
+
+// Setup installs the W3C trace context propagator and, when an endpoint is
+// configured, global tracer and meter providers exporting to it. The
+// returned function flushes and stops the exporters. The standard OTEL_*
+// environment variables, such as OTEL_SERVICE_NAME,
+// OTEL_RESOURCE_ATTRIBUTES and OTEL_METRIC_EXPORT_INTERVAL, are honored.
+//
+// Without an endpoint the global providers stay no-ops, so instrumentation
+// costs next to nothing but trace context is still passed through.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var traceOpts []otlptracegrpc.Option
+	var metricOpts []otlpmetricgrpc.Option
+	switch {
+	case strings.Contains(cfg.Endpoint, "://"):
+		traceOpts = append(traceOpts, otlptracegrpc.WithEndpointURL(cfg.Endpoint))
+		metricOpts = append(metricOpts, otlpmetricgrpc.WithEndpointURL(cfg.Endpoint))
+	case cfg.Insecure:
+		traceOpts = append(traceOpts, otlptracegrpc.WithEndpoint(cfg.Endpoint), otlptracegrpc.WithInsecure())
+		metricOpts = append(metricOpts, otlpmetricgrpc.WithEndpoint(cfg.Endpoint), otlpmetricgrpc.WithInsecure())
+	default:
+		traceOpts = append(traceOpts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		metricOpts = append(metricOpts, otlpmetricgrpc.WithEndpoint(cfg.Endpoint))
+	}
+
+	traceExporter, err := otlptracegrpc.New(ctx, traceOpts...)
+	if err != nil {
+		return nil, err
+	}
+	metricExporter, err := otlpmetricgrpc.New(ctx, metricOpts...)
+	if err != nil {
+		return nil, errors.Join(err, traceExporter.Shutdown(ctx))
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+	)
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+
+	return func(ctx context.Context) error {
+		return errors.Join(tp.Shutdown(ctx), mp.Shutdown(ctx))
+	}, nil
+}
@@ -0,0 +1,143 @@
+package telemetry
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/grpcauth"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestServerInstrumentation(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	metrics := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(metrics))
+	propagator := propagation.TraceContext{}
+
+	// Stand-in for the grpcauth interceptor
+	authenticate := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(grpcauth.NewContext(ctx, &grpcauth.Principal{UserID: "user-1"}), req)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler(
+			otelgrpc.WithTracerProvider(tp),
+			otelgrpc.WithMeterProvider(mp),
+			otelgrpc.WithPropagators(propagator),
+		)),
+		grpc.ChainUnaryInterceptor(authenticate, UnaryServerInterceptor()),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+			otelgrpc.WithTracerProvider(tp),
+			otelgrpc.WithPropagators(propagator),
+		)),
+	)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("health check failed: %v", err)
+	}
+	parent.End()
+
+	var serverSpan sdktrace.ReadOnlySpan
+	for _, s := range spans.Ended() {
+		if s.SpanKind() == trace.SpanKindServer {
+			serverSpan = s
+		}
+	}
+	if serverSpan == nil {
+		t.Fatal("expected a server span")
+	}
+
+	// The trace context crossed the wire in metadata
+	if serverSpan.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Errorf("expected server span in trace %s, got %s", parent.SpanContext().TraceID(), serverSpan.SpanContext().TraceID())
+	}
+	if got := attributeValue(serverSpan.Attributes(), "enduser.id"); got != "user-1" {
+		t.Errorf("expected enduser.id user-1, got %q", got)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := metrics.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	names := map[string]bool{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names[m.Name] = true
+		}
+	}
+	for _, want := range []string{"rpc.server.duration", "rpc.server.requests_per_rpc", "rpc.server.responses_per_rpc"} {
+		if !names[want] {
+			t.Errorf("expected metric %s, got %v", want, names)
+		}
+	}
+}
+
+func TestUnaryServerInterceptor_Login(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+
+	// Logins are unauthenticated, so the user comes from the response
+	ctx, span := tp.Tracer("test").Start(context.Background(), "login")
+	_, err := UnaryServerInterceptor()(ctx, &authv1.LoginRequest{}, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &authv1.LoginResponse{User: &authv1.User{Id: "user-2"}}, nil
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	span.End()
+
+	if got := attributeValue(spans.Ended()[0].Attributes(), "enduser.id"); got != "user-2" {
+		t.Errorf("expected enduser.id user-2, got %q", got)
+	}
+}
+
+func TestUnaryServerInterceptor_NotRecording(t *testing.T) {
+	called := false
+	_, err := UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			called = true
+			return nil, nil
+		})
+	if err != nil || !called {
+		t.Errorf("expected handler to run without a span, called=%v err=%v", called, err)
+	}
+}
+
+func attributeValue(attrs []attribute.KeyValue, key attribute.Key) string {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,220 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v4.25.1
+// source: proto/auth/v1/policy.proto
+
+package authv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Access level required to call a method
+type Access int32
+
+const (
+	Access_ACCESS_UNSPECIFIED Access = 0
+	// Anyone may call the method
+	Access_ACCESS_PUBLIC Access = 1
+	// Caller must present a valid bearer token
+	Access_ACCESS_AUTHENTICATED Access = 2
+	// Caller must present a valid bearer token and hold one of the roles
+	Access_ACCESS_ROLE_REQUIRED Access = 3
+)
+
+// Enum value maps for Access.
+var (
+	Access_name = map[int32]string{
+		0: "ACCESS_UNSPECIFIED",
+		1: "ACCESS_PUBLIC",
+		2: "ACCESS_AUTHENTICATED",
+		3: "ACCESS_ROLE_REQUIRED",
+	}
+	Access_value = map[string]int32{
+		"ACCESS_UNSPECIFIED":   0,
+		"ACCESS_PUBLIC":        1,
+		"ACCESS_AUTHENTICATED": 2,
+		"ACCESS_ROLE_REQUIRED": 3,
+	}
+)
+
+func (x Access) Enum() *Access {
+	p := new(Access)
+	*p = x
+	return p
+}
+
+func (x Access) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Access) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_auth_v1_policy_proto_enumTypes[0].Descriptor()
+}
+
+func (Access) Type() protoreflect.EnumType {
+	return &file_proto_auth_v1_policy_proto_enumTypes[0]
+}
+
+func (x Access) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Access.Descriptor instead.
+func (Access) EnumDescriptor() ([]byte, []int) {
+	return file_proto_auth_v1_policy_proto_rawDescGZIP(), []int{0}
+}
+
+// Authorization policy for a single RPC
+type AccessPolicy struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Access        Access                 `protobuf:"varint,1,opt,name=access,proto3,enum=auth.v1.Access" json:"access,omitempty"`
+	Roles         []string               `protobuf:"bytes,2,rep,name=roles,proto3" json:"roles,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AccessPolicy) Reset() {
+	*x = AccessPolicy{}
+	mi := &file_proto_auth_v1_policy_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccessPolicy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccessPolicy) ProtoMessage() {}
+
+func (x *AccessPolicy) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_auth_v1_policy_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccessPolicy.ProtoReflect.Descriptor instead.
+func (*AccessPolicy) Descriptor() ([]byte, []int) {
+	return file_proto_auth_v1_policy_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AccessPolicy) GetAccess() Access {
+	if x != nil {
+		return x.Access
+	}
+	return Access_ACCESS_UNSPECIFIED
+}
+
+func (x *AccessPolicy) GetRoles() []string {
+	if x != nil {
+		return x.Roles
+	}
+	return nil
+}
+
+var file_proto_auth_v1_policy_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: (*AccessPolicy)(nil),
+		Field:         51001,
+		Name:          "auth.v1.access_policy",
+		Tag:           "bytes,51001,opt,name=access_policy",
+		Filename:      "proto/auth/v1/policy.proto",
+	},
+}
+
+// Extension fields to descriptorpb.MethodOptions.
+var (
+	// optional auth.v1.AccessPolicy access_policy = 51001;
+	E_AccessPolicy = &file_proto_auth_v1_policy_proto_extTypes[0]
+)
+
+var File_proto_auth_v1_policy_proto protoreflect.FileDescriptor
+
+const file_proto_auth_v1_policy_proto_rawDesc = "" +
+	"\n" +
+	"\x1aproto/auth/v1/policy.proto\x12\aauth.v1\x1a google/protobuf/descriptor.proto\"M\n" +
+	"\fAccessPolicy\x12'\n" +
+	"\x06access\x18\x01 \x01(\x0e2\x0f.auth.v1.AccessR\x06access\x12\x14\n" +
+	"\x05roles\x18\x02 \x03(\tR\x05roles*g\n" +
+	"\x06Access\x12\x16\n" +
+	"\x12ACCESS_UNSPECIFIED\x10\x00\x12\x11\n" +
+	"\rACCESS_PUBLIC\x10\x01\x12\x18\n" +
+	"\x14ACCESS_AUTHENTICATED\x10\x02\x12\x18\n" +
+	"\x14ACCESS_ROLE_REQUIRED\x10\x03:\\\n" +
+	"\raccess_policy\x12\x1e.google.protobuf.MethodOptions\x18\xb9\x8e\x03 \x01(\v2\x15.auth.v1.AccessPolicyR\faccessPolicyBKZIgithub.com/raibid-labs/mop/examples/02-grpc-service/gen/go/auth/v1;authv1b\x06proto3"
+
+var (
+	file_proto_auth_v1_policy_proto_rawDescOnce sync.Once
+	file_proto_auth_v1_policy_proto_rawDescData []byte
+)
+
+func file_proto_auth_v1_policy_proto_rawDescGZIP() []byte {
+	file_proto_auth_v1_policy_proto_rawDescOnce.Do(func() {
+		file_proto_auth_v1_policy_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_auth_v1_policy_proto_rawDesc), len(file_proto_auth_v1_policy_proto_rawDesc)))
+	})
+	return file_proto_auth_v1_policy_proto_rawDescData
+}
+
+var file_proto_auth_v1_policy_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_auth_v1_policy_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_proto_auth_v1_policy_proto_goTypes = []any{
+	(Access)(0),                        // 0: auth.v1.Access
+	(*AccessPolicy)(nil),               // 1: auth.v1.AccessPolicy
+	(*descriptorpb.MethodOptions)(nil), // 2: google.protobuf.MethodOptions
+}
+var file_proto_auth_v1_policy_proto_depIdxs = []int32{
+	0, // 0: auth.v1.AccessPolicy.access:type_name -> auth.v1.Access
+	2, // 1: auth.v1.access_policy:extendee -> google.protobuf.MethodOptions
+	1, // 2: auth.v1.access_policy:type_name -> auth.v1.AccessPolicy
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	2, // [2:3] is the sub-list for extension type_name
+	1, // [1:2] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_proto_auth_v1_policy_proto_init() }
+func file_proto_auth_v1_policy_proto_init() {
+	if File_proto_auth_v1_policy_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_auth_v1_policy_proto_rawDesc), len(file_proto_auth_v1_policy_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   1,
+			NumExtensions: 1,
+			NumServices:   0,
+		},
+		GoTypes:           file_proto_auth_v1_policy_proto_goTypes,
+		DependencyIndexes: file_proto_auth_v1_policy_proto_depIdxs,
+		EnumInfos:         file_proto_auth_v1_policy_proto_enumTypes,
+		MessageInfos:      file_proto_auth_v1_policy_proto_msgTypes,
+		ExtensionInfos:    file_proto_auth_v1_policy_proto_extTypes,
+	}.Build()
+	File_proto_auth_v1_policy_proto = out.File
+	file_proto_auth_v1_policy_proto_goTypes = nil
+	file_proto_auth_v1_policy_proto_depIdxs = nil
+}
@@ -0,0 +1,368 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/rbac"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/service"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/tlsconfig"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/tlsconfig/tlstest"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/webrpc"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/grpcauth"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	adminWorkload = "spiffe://mop.local/ns/mop-examples/sa/operator"
+	userWorkload  = "spiffe://mop.local/ns/mop-examples/sa/frontend"
+)
+
+// mtlsServer is an auth server serving native gRPC, Connect and gRPC-Web
+// with mutual TLS on one local port, built the way cmd/server does
+type mtlsServer struct {
+	addr     string
+	dir      string
+	ca       *tlstest.CA
+	reloader *tlsconfig.Reloader
+
+	mu        sync.Mutex
+	principal *grpcauth.Principal
+}
+
+func (s *mtlsServer) lastPrincipal() *grpcauth.Principal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.principal
+}
+
+func startMTLSServer(t *testing.T) *mtlsServer {
+	t.Helper()
+
+	dir := t.TempDir()
+	ca, err := tlstest.NewCA("mtls test CA")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	serverCert, err := ca.IssueServer("localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("failed to issue server certificate: %v", err)
+	}
+
+	tlsCfg := tlsconfig.Config{
+		Mode:     tlsconfig.ModeMTLS,
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+		CAFile:   filepath.Join(dir, "client-ca.crt"),
+	}
+	if err := serverCert.WriteFiles(tlsCfg.CertFile, tlsCfg.KeyFile); err != nil {
+		t.Fatalf("failed to write server certificate: %v", err)
+	}
+	if err := ca.WriteCert(tlsCfg.CAFile); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+	// Clients verify the server against their own copy of the CA
+	if err := ca.WriteCert(filepath.Join(dir, "ca.crt")); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+
+	reloader, err := tlsconfig.ServerReloader(tlsCfg)
+	if err != nil {
+		t.Fatalf("failed to load TLS configuration: %v", err)
+	}
+
+	authorizer := rbac.NewAuthorizer(rbac.DefaultPolicy())
+	if _, err := authorizer.Assign(adminWorkload, "admin"); err != nil {
+		t.Fatalf("failed to assign role: %v", err)
+	}
+	cfg := service.DefaultConfig()
+	cfg.Authorizer = authorizer
+	authService := service.NewAuthServiceWithConfig(zap.NewNop(), cfg)
+
+	srv := &mtlsServer{dir: dir, ca: ca, reloader: reloader}
+	authConfig := grpcauth.Config{
+		Validator:     authService,
+		PeerValidator: authService,
+		Policies: grpcauth.PoliciesFromService(
+			authv1.File_proto_auth_v1_auth_proto.Services().ByName("AuthService"),
+		),
+	}
+	recordPrincipal := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		p, _ := grpcauth.FromContext(ctx)
+		srv.mu.Lock()
+		srv.principal = p
+		srv.mu.Unlock()
+		return handler(ctx, req)
+	}
+	unaryInterceptors := []grpc.UnaryServerInterceptor{grpcauth.UnaryServerInterceptor(authConfig), recordPrincipal}
+
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(unaryInterceptors...))
+	authv1.RegisterAuthServiceServer(grpcServer, authService)
+
+	httpServer := &http.Server{
+		Handler:           webrpc.NewHandler(grpcServer, authService, webrpc.Config{UnaryInterceptors: unaryInterceptors}),
+		TLSConfig:         reloader.HTTPServerTLSConfig(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          log.New(io.Discard, "", 0),
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go httpServer.ServeTLS(lis, "", "")
+	t.Cleanup(func() {
+		httpServer.Close()
+		grpcServer.Stop()
+	})
+
+	srv.addr = lis.Addr().String()
+	return srv
+}
+
+// mtlsClient calls the RPCs the mTLS tests need over one protocol
+type mtlsClient struct {
+	login      func(ctx context.Context, req *authv1.LoginRequest) (*authv1.LoginResponse, error)
+	assignRole func(ctx context.Context, req *authv1.AssignRoleRequest) (*authv1.RoleAssignmentResponse, error)
+	authorize  func(ctx context.Context, token string, req *authv1.AuthorizeRequest) (*authv1.AuthorizeResponse, error)
+}
+
+// clientConfig returns the TLS configuration of a client with a
+// certificate for spiffeID issued by ca, or without a client certificate
+// when ca is nil
+func (s *mtlsServer) clientConfig(t *testing.T, ca *tlstest.CA, spiffeID string) tlsconfig.Config {
+	t.Helper()
+
+	cfg := tlsconfig.Config{
+		Mode:   tlsconfig.ModeTLS,
+		CAFile: filepath.Join(s.dir, "ca.crt"),
+	}
+	if ca != nil {
+		cert, err := ca.IssueClient(spiffeID)
+		if err != nil {
+			t.Fatalf("failed to issue client certificate: %v", err)
+		}
+		cfg.Mode = tlsconfig.ModeMTLS
+		cfg.CertFile = filepath.Join(t.TempDir(), "client.crt")
+		cfg.KeyFile = filepath.Join(t.TempDir(), "client.key")
+		if err := cert.WriteFiles(cfg.CertFile, cfg.KeyFile); err != nil {
+			t.Fatalf("failed to write client certificate: %v", err)
+		}
+	}
+	return cfg
+}
+
+// dial connects over native gRPC
+func (s *mtlsServer) dial(t *testing.T, ca *tlstest.CA, spiffeID string) mtlsClient {
+	t.Helper()
+
+	creds, _, err := tlsconfig.ClientCredentials(s.clientConfig(t, ca, spiffeID))
+	if err != nil {
+		t.Fatalf("failed to create client credentials: %v", err)
+	}
+	conn, err := grpc.NewClient(s.addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := authv1.NewAuthServiceClient(conn)
+
+	return mtlsClient{
+		login: func(ctx context.Context, req *authv1.LoginRequest) (*authv1.LoginResponse, error) {
+			return client.Login(ctx, req)
+		},
+		assignRole: func(ctx context.Context, req *authv1.AssignRoleRequest) (*authv1.RoleAssignmentResponse, error) {
+			return client.AssignRole(ctx, req)
+		},
+		authorize: func(ctx context.Context, token string, req *authv1.AuthorizeRequest) (*authv1.AuthorizeResponse, error) {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+			return client.Authorize(ctx, req)
+		},
+	}
+}
+
+// dialWeb connects over HTTP/2 with Connect, or with gRPC-Web when
+// connect.WithGRPCWeb is passed
+func (s *mtlsServer) dialWeb(t *testing.T, ca *tlstest.CA, spiffeID string, opts ...connect.ClientOption) mtlsClient {
+	t.Helper()
+
+	cfg := s.clientConfig(t, ca, spiffeID)
+	if err := cfg.Validate(false); err != nil {
+		t.Fatalf("invalid client TLS configuration: %v", err)
+	}
+	reloader, err := tlsconfig.NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("failed to load client certificate: %v", err)
+	}
+	transport := &http.Transport{TLSClientConfig: reloader.ClientTLSConfig(), ForceAttemptHTTP2: true}
+	t.Cleanup(transport.CloseIdleConnections)
+	httpClient := &http.Client{Transport: transport}
+	url := "https://" + s.addr
+
+	login := connect.NewClient[authv1.LoginRequest, authv1.LoginResponse](
+		httpClient, url+authv1.AuthService_Login_FullMethodName, opts...)
+	assignRole := connect.NewClient[authv1.AssignRoleRequest, authv1.RoleAssignmentResponse](
+		httpClient, url+authv1.AuthService_AssignRole_FullMethodName, opts...)
+	authorize := connect.NewClient[authv1.AuthorizeRequest, authv1.AuthorizeResponse](
+		httpClient, url+authv1.AuthService_Authorize_FullMethodName, opts...)
+
+	return mtlsClient{
+		login: func(ctx context.Context, req *authv1.LoginRequest) (*authv1.LoginResponse, error) {
+			resp, err := login.CallUnary(ctx, connect.NewRequest(req))
+			if err != nil {
+				return nil, err
+			}
+			return resp.Msg, nil
+		},
+		assignRole: func(ctx context.Context, req *authv1.AssignRoleRequest) (*authv1.RoleAssignmentResponse, error) {
+			resp, err := assignRole.CallUnary(ctx, connect.NewRequest(req))
+			if err != nil {
+				return nil, err
+			}
+			return resp.Msg, nil
+		},
+		authorize: func(ctx context.Context, token string, req *authv1.AuthorizeRequest) (*authv1.AuthorizeResponse, error) {
+			r := connect.NewRequest(req)
+			r.Header().Set("Authorization", "Bearer "+token)
+			resp, err := authorize.CallUnary(ctx, r)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Msg, nil
+		},
+	}
+}
+
+func TestIntegration_MTLS(t *testing.T) {
+	srv := startMTLSServer(t)
+
+	protocols := []struct {
+		name string
+		dial func(t *testing.T, ca *tlstest.CA, spiffeID string) mtlsClient
+	}{
+		{name: "grpc", dial: srv.dial},
+		{name: "connect", dial: func(t *testing.T, ca *tlstest.CA, spiffeID string) mtlsClient {
+			return srv.dialWeb(t, ca, spiffeID)
+		}},
+		{name: "grpc-web", dial: func(t *testing.T, ca *tlstest.CA, spiffeID string) mtlsClient {
+			return srv.dialWeb(t, ca, spiffeID, connect.WithGRPCWeb())
+		}},
+	}
+
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			t.Run("client certificate authenticates without token", func(t *testing.T) {
+				client := protocol.dial(t, srv.ca, adminWorkload)
+
+				resp, err := client.assignRole(ctx, &authv1.AssignRoleRequest{Username: "mtls-user", Role: "admin"})
+				if err != nil {
+					t.Fatalf("AssignRole over mTLS failed: %v", err)
+				}
+				if !slices.Contains(resp.Roles, "admin") {
+					t.Errorf("expected admin role, got %v", resp.Roles)
+				}
+
+				p := srv.lastPrincipal()
+				if p == nil || p.Username != adminWorkload || p.Token != "" {
+					t.Errorf("expected certificate principal %s, got %+v", adminWorkload, p)
+				}
+			})
+
+			t.Run("workload roles come from RBAC", func(t *testing.T) {
+				client := protocol.dial(t, srv.ca, userWorkload)
+
+				_, err := client.assignRole(ctx, &authv1.AssignRoleRequest{Username: "mtls-user", Role: "admin"})
+				if code := errorCode(err); code != codes.PermissionDenied {
+					t.Errorf("expected PermissionDenied, got %v (%v)", code, err)
+				}
+			})
+
+			t.Run("bearer token principal carries peer identity", func(t *testing.T) {
+				client := protocol.dial(t, srv.ca, userWorkload)
+
+				login, err := client.login(ctx, &authv1.LoginRequest{Username: "alice", Password: "password"})
+				if err != nil {
+					t.Fatalf("login failed: %v", err)
+				}
+				if _, err := client.authorize(ctx, login.Token, &authv1.AuthorizeRequest{Subject: "alice", Action: "read", Resource: "orders"}); err != nil {
+					t.Fatalf("Authorize failed: %v", err)
+				}
+
+				p := srv.lastPrincipal()
+				if p == nil || p.Username != "alice" {
+					t.Fatalf("expected token principal alice, got %+v", p)
+				}
+				if p.Peer == nil || p.Peer.SPIFFEID != userWorkload {
+					t.Errorf("expected peer identity %s, got %+v", userWorkload, p.Peer)
+				}
+			})
+
+			t.Run("missing client certificate is rejected", func(t *testing.T) {
+				client := protocol.dial(t, nil, "")
+
+				_, err := client.login(ctx, &authv1.LoginRequest{Username: "alice", Password: "password"})
+				if code := errorCode(err); code != codes.Unavailable {
+					t.Errorf("expected Unavailable, got %v (%v)", code, err)
+				}
+			})
+
+			t.Run("certificate from unknown CA is rejected", func(t *testing.T) {
+				otherCA, err := tlstest.NewCA("other CA")
+				if err != nil {
+					t.Fatalf("failed to create CA: %v", err)
+				}
+				client := protocol.dial(t, otherCA, adminWorkload)
+
+				_, err = client.login(ctx, &authv1.LoginRequest{Username: "alice", Password: "password"})
+				if code := errorCode(err); code != codes.Unavailable {
+					t.Errorf("expected Unavailable, got %v (%v)", code, err)
+				}
+			})
+		})
+	}
+}
+
+func TestIntegration_MTLSClientCARotation(t *testing.T) {
+	srv := startMTLSServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	newCA, err := tlstest.NewCA("rotated client CA")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	if err := newCA.WriteCert(filepath.Join(srv.dir, "client-ca.crt")); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+	if err := srv.reloader.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	// New connections are verified against the rotated CA
+	rotated := srv.dial(t, newCA, adminWorkload)
+	if _, err := rotated.login(ctx, &authv1.LoginRequest{Username: "alice", Password: "password"}); err != nil {
+		t.Errorf("expected certificate from rotated CA to be accepted: %v", err)
+	}
+
+	old := srv.dial(t, srv.ca, adminWorkload)
+	if _, err := old.login(ctx, &authv1.LoginRequest{Username: "alice", Password: "password"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected certificate from retired CA to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/oauth"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/service"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.uber.org/zap"
+)
+
+// oauthServer serves the OAuth2 endpoints for an AuthService with two
+// registered clients
+type oauthServer struct {
+	*httptest.Server
+	auth *service.AuthService
+}
+
+func startOAuthServer(t *testing.T) *oauthServer {
+	t.Helper()
+
+	clients, err := oauth.NewClients(
+		oauth.Client{ID: "billing", SecretSHA256: oauth.HashSecret("billing-secret"), Scopes: []string{"orders:read", "orders:write"}},
+		oauth.Client{ID: "reporting", SecretSHA256: oauth.HashSecret("reporting-secret"), Scopes: []string{"orders:read"}},
+	)
+	if err != nil {
+		t.Fatalf("failed to register clients: %v", err)
+	}
+
+	authService := service.NewAuthService(zap.NewNop())
+	srv := httptest.NewServer(oauth.NewHandler(clients, authService, zap.NewNop()))
+	t.Cleanup(srv.Close)
+
+	return &oauthServer{Server: srv, auth: authService}
+}
+
+// post sends a form to path authenticated with HTTP Basic, or unauthenticated
+// when clientID is empty, and decodes the JSON response into out
+func (s *oauthServer) post(t *testing.T, path, clientID, secret string, form url.Values, out interface{}) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, s.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(secret))
+	}
+
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.ContentLength != 0 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return resp
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+	Error       string `json:"error"`
+}
+
+func TestOAuth_ClientCredentials(t *testing.T) {
+	srv := startOAuthServer(t)
+
+	tests := []struct {
+		name      string
+		clientID  string
+		secret    string
+		form      url.Values
+		wantCode  int
+		wantError string
+		wantScope string
+	}{
+		{
+			name:      "all registered scopes",
+			clientID:  "billing",
+			secret:    "billing-secret",
+			form:      url.Values{"grant_type": {"client_credentials"}},
+			wantCode:  http.StatusOK,
+			wantScope: "orders:read orders:write",
+		},
+		{
+			name:      "narrowed scope",
+			clientID:  "billing",
+			secret:    "billing-secret",
+			form:      url.Values{"grant_type": {"client_credentials"}, "scope": {"orders:read"}},
+			wantCode:  http.StatusOK,
+			wantScope: "orders:read",
+		},
+		{
+			name:      "scope beyond registration",
+			clientID:  "reporting",
+			secret:    "reporting-secret",
+			form:      url.Values{"grant_type": {"client_credentials"}, "scope": {"orders:write"}},
+			wantCode:  http.StatusBadRequest,
+			wantError: "invalid_scope",
+		},
+		{
+			name:      "unsupported grant",
+			clientID:  "billing",
+			secret:    "billing-secret",
+			form:      url.Values{"grant_type": {"password"}},
+			wantCode:  http.StatusBadRequest,
+			wantError: "unsupported_grant_type",
+		},
+		{
+			name:      "wrong secret",
+			clientID:  "billing",
+			secret:    "wrong",
+			form:      url.Values{"grant_type": {"client_credentials"}},
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_client",
+		},
+		{
+			name:      "credentials in form body",
+			form:      url.Values{"grant_type": {"client_credentials"}, "client_id": {"reporting"}, "client_secret": {"reporting-secret"}},
+			wantCode:  http.StatusOK,
+			wantScope: "orders:read",
+		},
+		{
+			name:      "no credentials",
+			form:      url.Values{"grant_type": {"client_credentials"}},
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_client",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body tokenResponse
+			resp := srv.post(t, oauth.TokenPath, tt.clientID, tt.secret, tt.form, &body)
+
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("expected status %d, got %d (%+v)", tt.wantCode, resp.StatusCode, body)
+			}
+			if resp.Header.Get("Cache-Control") != "no-store" {
+				t.Error("expected Cache-Control: no-store")
+			}
+			if tt.wantError != "" {
+				if body.Error != tt.wantError {
+					t.Errorf("expected error %s, got %s", tt.wantError, body.Error)
+				}
+				return
+			}
+
+			if body.AccessToken == "" || body.TokenType != "Bearer" || body.ExpiresIn <= 0 {
+				t.Errorf("unexpected token response %+v", body)
+			}
+			if body.Scope != tt.wantScope {
+				t.Errorf("expected scope %q, got %q", tt.wantScope, body.Scope)
+			}
+		})
+	}
+
+	t.Run("basic auth failure challenges", func(t *testing.T) {
+		resp := srv.post(t, oauth.TokenPath, "billing", "wrong", url.Values{"grant_type": {"client_credentials"}}, nil)
+		if resp.Header.Get("WWW-Authenticate") == "" {
+			t.Error("expected WWW-Authenticate header")
+		}
+	})
+}
+
+func TestOAuth_Introspection(t *testing.T) {
+	srv := startOAuthServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Tokens issued through gRPC Login are introspectable
+	login, err := srv.auth.Login(ctx, &authv1.LoginRequest{Username: "alice", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	var issued tokenResponse
+	srv.post(t, oauth.TokenPath, "billing", "billing-secret", url.Values{"grant_type": {"client_credentials"}}, &issued)
+
+	tests := []struct {
+		name  string
+		token string
+		want  oauth.Introspection
+	}{
+		{
+			name:  "login access token",
+			token: login.Token,
+			want:  oauth.Introspection{Active: true, Username: "alice", Sub: login.User.Id, TokenType: "Bearer", Exp: login.ExpiresAt.AsTime().Unix()},
+		},
+		{
+			name:  "login refresh token",
+			token: login.RefreshToken,
+			want:  oauth.Introspection{Active: true, Username: "alice", Sub: login.User.Id},
+		},
+		{
+			name:  "client token",
+			token: issued.AccessToken,
+			want:  oauth.Introspection{Active: true, ClientID: "billing", Sub: "billing", Scope: "orders:read orders:write", TokenType: "Bearer"},
+		},
+		{
+			name:  "unknown token",
+			token: "not-a-token",
+			want:  oauth.Introspection{Active: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got oauth.Introspection
+			resp := srv.post(t, oauth.IntrospectPath, "reporting", "reporting-secret", url.Values{"token": {tt.token}}, &got)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected 200, got %d", resp.StatusCode)
+			}
+
+			// Expiry is checked separately where it is not known up front
+			if tt.want.Active && tt.want.Exp == 0 {
+				if got.Exp <= time.Now().Unix() {
+					t.Errorf("expected future exp, got %d", got.Exp)
+				}
+				got.Exp = 0
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("inactive after logout", func(t *testing.T) {
+		if _, err := srv.auth.Logout(ctx, &authv1.LogoutRequest{Token: login.Token}); err != nil {
+			t.Fatalf("logout failed: %v", err)
+		}
+
+		var got oauth.Introspection
+		srv.post(t, oauth.IntrospectPath, "reporting", "reporting-secret", url.Values{"token": {login.Token}}, &got)
+		if got != (oauth.Introspection{Active: false}) {
+			t.Errorf("expected inactive response with no other members, got %+v", got)
+		}
+	})
+
+	t.Run("requires client authentication", func(t *testing.T) {
+		resp := srv.post(t, oauth.IntrospectPath, "", "", url.Values{"token": {issued.AccessToken}}, nil)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		resp := srv.post(t, oauth.IntrospectPath, "reporting", "reporting-secret", url.Values{}, nil)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestOAuth_Revocation(t *testing.T) {
+	srv := startOAuthServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	introspect := func(token string) bool {
+		var got oauth.Introspection
+		srv.post(t, oauth.IntrospectPath, "reporting", "reporting-secret", url.Values{"token": {token}}, &got)
+		return got.Active
+	}
+
+	var billing tokenResponse
+	srv.post(t, oauth.TokenPath, "billing", "billing-secret", url.Values{"grant_type": {"client_credentials"}}, &billing)
+
+	t.Run("other client's token is refused", func(t *testing.T) {
+		var body tokenResponse
+		resp := srv.post(t, oauth.RevokePath, "reporting", "reporting-secret", url.Values{"token": {billing.AccessToken}}, &body)
+		if resp.StatusCode != http.StatusBadRequest || body.Error != "unauthorized_client" {
+			t.Errorf("expected 400 unauthorized_client, got %d %s", resp.StatusCode, body.Error)
+		}
+		if !introspect(billing.AccessToken) {
+			t.Error("expected token to stay active")
+		}
+	})
+
+	t.Run("own token", func(t *testing.T) {
+		resp := srv.post(t, oauth.RevokePath, "billing", "billing-secret", url.Values{"token": {billing.AccessToken}}, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		if introspect(billing.AccessToken) {
+			t.Error("expected revoked token to be inactive")
+		}
+	})
+
+	t.Run("unknown token succeeds", func(t *testing.T) {
+		resp := srv.post(t, oauth.RevokePath, "billing", "billing-secret", url.Values{"token": {billing.AccessToken}}, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected 200 for already revoked token, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("user token", func(t *testing.T) {
+		login, err := srv.auth.Login(ctx, &authv1.LoginRequest{Username: "bob", Password: "password"})
+		if err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+
+		resp := srv.post(t, oauth.RevokePath, "billing", "billing-secret", url.Values{"token": {login.Token}, "token_type_hint": {"access_token"}}, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+
+		validate, err := srv.auth.ValidateToken(ctx, &authv1.ValidateRequest{Token: login.Token})
+		if err != nil || validate.Valid {
+			t.Errorf("expected revoked token to fail gRPC validation, got %v err=%v", validate, err)
+		}
+		if !introspect(login.RefreshToken) {
+			t.Error("expected the refresh token to stay active")
+		}
+	})
+
+	t.Run("requires client authentication", func(t *testing.T) {
+		resp := srv.post(t, oauth.RevokePath, "billing", "wrong", url.Values{"token": {"anything"}}, nil)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/service"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/internal/webrpc"
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/grpcauth"
+	authv1 "github.com/raibid-labs/mop/examples/02-grpc-service/proto/auth/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const testOrigin = "https://app.example.com"
+
+// startMultiplexedServer serves native gRPC, Connect and gRPC-Web on one
+// plaintext port the way cmd/server does
+func startMultiplexedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	authService := service.NewAuthService(zap.NewNop())
+	authConfig := grpcauth.Config{
+		Validator: authService,
+		Policies: grpcauth.PoliciesFromService(
+			authv1.File_proto_auth_v1_auth_proto.Services().ByName("AuthService"),
+		).Merge(grpcauth.Policies{
+			"/grpc.health.v1.Health/": grpcauth.Public(),
+		}),
+	}
+	unaryInterceptors := []grpc.UnaryServerInterceptor{grpcauth.UnaryServerInterceptor(authConfig)}
+	streamInterceptors := []grpc.StreamServerInterceptor{grpcauth.StreamServerInterceptor(authConfig)}
+
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	)
+	authv1.RegisterAuthServiceServer(grpcServer, authService)
+	healthpb.RegisterHealthServer(grpcServer, health.NewServer())
+
+	srv := httptest.NewUnstartedServer(webrpc.NewHandler(grpcServer, authService, webrpc.Config{
+		UnaryInterceptors:  unaryInterceptors,
+		StreamInterceptors: streamInterceptors,
+		AllowedOrigins:     []string{testOrigin},
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(func() {
+		srv.Close()
+		grpcServer.Stop()
+	})
+	return srv
+}
+
+// protocolClient calls AuthService over one wire protocol
+type protocolClient struct {
+	login        func(ctx context.Context, req *authv1.LoginRequest) (*authv1.LoginResponse, error)
+	validate     func(ctx context.Context, req *authv1.ValidateRequest) (*authv1.ValidateResponse, error)
+	streamEvents func(ctx context.Context, token string, req *authv1.EventsRequest) (func() (*authv1.Event, error), error)
+}
+
+func nativeClient(t *testing.T, srv *httptest.Server) protocolClient {
+	conn, err := grpc.NewClient("passthrough:///"+srv.Listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := authv1.NewAuthServiceClient(conn)
+
+	return protocolClient{
+		login: func(ctx context.Context, req *authv1.LoginRequest) (*authv1.LoginResponse, error) {
+			return client.Login(ctx, req)
+		},
+		validate: func(ctx context.Context, req *authv1.ValidateRequest) (*authv1.ValidateResponse, error) {
+			return client.ValidateToken(ctx, req)
+		},
+		streamEvents: func(ctx context.Context, token string, req *authv1.EventsRequest) (func() (*authv1.Event, error), error) {
+			if token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+			}
+			stream, err := client.StreamEvents(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			return stream.Recv, nil
+		},
+	}
+}
+
+// webClient speaks Connect, or gRPC-Web with connect.WithGRPCWeb, over
+// HTTP/1.1 like a browser behind an HTTP/1.1 proxy would
+func webClient(srv *httptest.Server, opts ...connect.ClientOption) protocolClient {
+	httpClient := srv.Client()
+	login := connect.NewClient[authv1.LoginRequest, authv1.LoginResponse](
+		httpClient, srv.URL+authv1.AuthService_Login_FullMethodName, opts...)
+	validate := connect.NewClient[authv1.ValidateRequest, authv1.ValidateResponse](
+		httpClient, srv.URL+authv1.AuthService_ValidateToken_FullMethodName, opts...)
+	events := connect.NewClient[authv1.EventsRequest, authv1.Event](
+		httpClient, srv.URL+authv1.AuthService_StreamEvents_FullMethodName, opts...)
+
+	return protocolClient{
+		login: func(ctx context.Context, req *authv1.LoginRequest) (*authv1.LoginResponse, error) {
+			resp, err := login.CallUnary(ctx, connect.NewRequest(req))
+			if err != nil {
+				return nil, err
+			}
+			return resp.Msg, nil
+		},
+		validate: func(ctx context.Context, req *authv1.ValidateRequest) (*authv1.ValidateResponse, error) {
+			resp, err := validate.CallUnary(ctx, connect.NewRequest(req))
+			if err != nil {
+				return nil, err
+			}
+			return resp.Msg, nil
+		},
+		streamEvents: func(ctx context.Context, token string, req *authv1.EventsRequest) (func() (*authv1.Event, error), error) {
+			r := connect.NewRequest(req)
+			if token != "" {
+				r.Header().Set("Authorization", "Bearer "+token)
+			}
+			stream, err := events.CallServerStream(ctx, r)
+			if err != nil {
+				return nil, err
+			}
+			return func() (*authv1.Event, error) {
+				if stream.Receive() {
+					return stream.Msg(), nil
+				}
+				if err := stream.Err(); err != nil {
+					return nil, err
+				}
+				return nil, io.EOF
+			}, nil
+		},
+	}
+}
+
+// errorCode returns the status code of a gRPC or Connect error
+func errorCode(err error) codes.Code {
+	var connectErr *connect.Error
+	if errors.As(err, &connectErr) {
+		return codes.Code(connectErr.Code())
+	}
+	return status.Code(err)
+}
+
+func TestProtocols(t *testing.T) {
+	srv := startMultiplexedServer(t)
+
+	protocols := []struct {
+		name   string
+		client protocolClient
+	}{
+		{name: "grpc", client: nativeClient(t, srv)},
+		{name: "connect", client: webClient(srv)},
+		{name: "grpc-web", client: webClient(srv, connect.WithGRPCWeb())},
+	}
+
+	for _, p := range protocols {
+		t.Run(p.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			login, err := p.client.login(ctx, &authv1.LoginRequest{Username: p.name + "-user", Password: "password"})
+			if err != nil {
+				t.Fatalf("login failed: %v", err)
+			}
+			admin, err := p.client.login(ctx, &authv1.LoginRequest{Username: "admin", Password: "password"})
+			if err != nil {
+				t.Fatalf("admin login failed: %v", err)
+			}
+
+			validated, err := p.client.validate(ctx, &authv1.ValidateRequest{Token: login.Token})
+			if err != nil {
+				t.Fatalf("validate failed: %v", err)
+			}
+			if !validated.Valid || validated.User.GetUsername() != p.name+"-user" {
+				t.Errorf("expected a valid token for %s-user, got %+v", p.name, validated)
+			}
+
+			// Errors keep their gRPC status codes on every protocol
+			_, err = p.client.login(ctx, &authv1.LoginRequest{Username: p.name + "-user", Password: "wrong"})
+			if code := errorCode(err); code != codes.Unauthenticated {
+				t.Errorf("expected Unauthenticated for a wrong password, got %v (%v)", code, err)
+			}
+
+			// The stream interceptor guards StreamEvents for web clients too
+			recv, err := p.client.streamEvents(ctx, "", &authv1.EventsRequest{})
+			if err == nil {
+				_, err = recv()
+			}
+			if code := errorCode(err); code != codes.Unauthenticated {
+				t.Errorf("expected Unauthenticated for an anonymous stream, got %v (%v)", code, err)
+			}
+
+			// Resume from the start of the retention ring so the login is replayed
+			recv, err = p.client.streamEvents(ctx, admin.Token, &authv1.EventsRequest{
+				EventTypes:          []string{service.EventLogin},
+				UserIds:             []string{login.User.Id},
+				ResumeAfterSequence: proto.Uint64(0),
+			})
+			if err != nil {
+				t.Fatalf("stream failed: %v", err)
+			}
+			event, err := recv()
+			if err != nil {
+				t.Fatalf("receive failed: %v", err)
+			}
+			if event.EventType != service.EventLogin || event.UserId != login.User.Id {
+				t.Errorf("expected a login event for %s, got %s for %s", login.User.Id, event.EventType, event.UserId)
+			}
+		})
+	}
+}
+
+func TestProtocols_NativeGRPCServices(t *testing.T) {
+	srv := startMultiplexedServer(t)
+
+	conn, err := grpc.NewClient("passthrough:///"+srv.Listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Services registered only on the grpc.Server stay reachable
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("health check failed: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected SERVING, got %v", resp.Status)
+	}
+}
+
+func TestProtocols_CORS(t *testing.T) {
+	srv := startMultiplexedServer(t)
+
+	tests := []struct {
+		name       string
+		origin     string
+		wantOrigin string
+	}{
+		{name: "allowed origin", origin: testOrigin, wantOrigin: testOrigin},
+		{name: "other origin", origin: "https://evil.example.com", wantOrigin: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodOptions, srv.URL+authv1.AuthService_Login_FullMethodName, nil)
+			if err != nil {
+				t.Fatalf("failed to build request: %v", err)
+			}
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			req.Header.Set("Access-Control-Request-Headers", "authorization,connect-protocol-version,content-type")
+
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("preflight failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if got := resp.Header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("expected Access-Control-Allow-Origin %q, got %q", tt.wantOrigin, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/db"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/migrate"
+	"github.com/raibid-labs/mop/examples/03-sql-app/migrations"
+)
+
+const usage = `Usage: migrate [flags] <command>
+
+Commands:
+  up              Apply all pending migrations
+  down [N]        Roll back the last N migrations (default 1)
+  to VERSION      Migrate up or down to VERSION (0 rolls back everything)
+  status          List migrations and whether they are applied
+  force VERSION   Record VERSION as the current version without running SQL
+
+The database is configured with the same DB_* environment variables as the
+server.
+
+Flags:
+`
+
+func main() {
+	timeout := flag.Duration("timeout", 5*time.Minute, "Overall timeout, including waiting for the migration lock")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dbConfig := db.Config{
+		Host:     getEnv("DB_HOST", "localhost"),
+		Port:     getEnvAsInt("DB_PORT", 5432),
+		User:     getEnv("DB_USER", "postgres"),
+		Password: getEnv("DB_PASSWORD", "postgres"),
+		Database: getEnv("DB_NAME", "orders"),
+		SSLMode:  getEnv("DB_SSLMODE", "disable"),
+		MaxConns: 2,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	pool, err := db.NewPool(ctx, dbConfig)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	migrator, err := migrate.New(pool, migrations.FS)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	if err := run(ctx, migrator, args); err != nil {
+		pool.Close()
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, migrator *migrate.Migrator, args []string) error {
+	switch cmd := args[0]; {
+	case cmd == "up" && len(args) == 1:
+		return migrator.Up(ctx)
+	case cmd == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		return migrator.Down(ctx, steps)
+	case (cmd == "to" || cmd == "force") && len(args) == 2:
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if cmd == "to" {
+			return migrator.To(ctx, version)
+		}
+		return migrator.Force(ctx, version)
+	case cmd == "status" && len(args) == 1:
+		return printStatus(ctx, migrator)
+	default:
+		flag.Usage()
+		os.Exit(2)
+		return nil
+	}
+}
+
+func printStatus(ctx context.Context, migrator *migrate.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		state, appliedAt := "pending", ""
+		if s.Applied {
+			state, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		switch {
+		case s.Missing:
+			state = "applied, file missing"
+		case s.Modified:
+			state = "applied, MODIFIED"
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	return w.Flush()
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvAsInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		var result int
+		if _, err := fmt.Sscanf(value, "%d", &result); err == nil {
+			return result
+		}
+	}
+	return defaultValue
+}
@@ -7,13 +7,21 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/raibid-labs/mop/examples/03-sql-app/internal/db"
 	"github.com/raibid-labs/mop/examples/03-sql-app/internal/handlers"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/migrate"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/outbox"
 	"github.com/raibid-labs/mop/examples/03-sql-app/internal/repository"
+	"github.com/raibid-labs/mop/examples/03-sql-app/migrations"
 )
 
 func main() {
@@ -31,7 +39,28 @@ func main() {
 		MaxConnIdleTime: time.Duration(getEnvAsInt("DB_MAX_CONN_IDLE_TIME", 300)) * time.Second,
 	}
 
+	// Record queries over the threshold and explain a sample of them. Off
+	// unless a threshold is set.
+	if threshold := getEnvAsInt("DB_SLOW_QUERY_THRESHOLD_MS", 0); threshold > 0 {
+		dbConfig.SlowQueries = db.NewSlowQueryLog(db.SlowQueryConfig{
+			Threshold:         time.Duration(threshold) * time.Millisecond,
+			TopN:              getEnvAsInt("DB_SLOW_QUERY_TOP_N", 20),
+			ExplainSampleRate: getEnvAsFloat("DB_EXPLAIN_SAMPLE_RATE", 1),
+			ExplainInterval:   time.Duration(getEnvAsInt("DB_EXPLAIN_INTERVAL_MS", 1000)) * time.Millisecond,
+		})
+	}
+
 	serverPort := getEnv("SERVER_PORT", "8080")
+	autoMigrate := getEnvAsBool("DB_AUTO_MIGRATE", false)
+	nPlusOneThreshold := getEnvAsInt("DB_N_PLUS_ONE_THRESHOLD", 10)
+
+	kafkaBrokers := getEnv("KAFKA_BROKERS", "")
+	outboxConfig := outbox.Config{
+		PollInterval: time.Duration(getEnvAsInt("OUTBOX_POLL_INTERVAL_MS", 500)) * time.Millisecond,
+		BatchSize:    getEnvAsInt("OUTBOX_BATCH_SIZE", 100),
+		MinBackoff:   time.Duration(getEnvAsInt("OUTBOX_MIN_BACKOFF_MS", 1000)) * time.Millisecond,
+		MaxBackoff:   time.Duration(getEnvAsInt("OUTBOX_MAX_BACKOFF_MS", 300000)) * time.Millisecond,
+	}
 
 	// Create database connection pool
 	ctx := context.Background()
@@ -43,36 +72,91 @@ func main() {
 
 	log.Println("Successfully connected to database")
 
+	// Apply pending migrations, or just check that the applied ones have not
+	// been edited since
+	migrator, err := migrate.New(pool, migrations.FS)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	if autoMigrate {
+		if err := migrator.Up(ctx); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	} else if err := migrator.Verify(ctx); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
+	// Publish order events from the outbox. Without brokers, events are still
+	// written to the outbox and published once a relay runs.
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	var relayDone sync.WaitGroup
+	if kafkaBrokers != "" {
+		publisher := outbox.NewKafkaPublisher(strings.Split(kafkaBrokers, ","))
+		relay := outbox.NewRelay(pool, publisher, outboxConfig)
+		relayDone.Add(1)
+		go func() {
+			defer relayDone.Done()
+			defer publisher.Close()
+			log.Printf("Publishing order events to Kafka at %s", kafkaBrokers)
+			relay.Run(relayCtx)
+		}()
+	} else {
+		log.Println("KAFKA_BROKERS is not set, order events will stay in the outbox")
+	}
+
 	// Initialize repositories
 	customerRepo := repository.NewCustomerRepository(pool)
 	orderRepo := repository.NewOrderRepository(pool)
+	productRepo := repository.NewProductRepository(pool)
 
 	// Initialize handlers
 	healthHandler := handlers.NewHealthHandler(pool)
 	customerHandler := handlers.NewCustomerHandler(customerRepo)
 	orderHandler := handlers.NewOrderHandler(orderRepo)
+	productHandler := handlers.NewProductHandler(productRepo)
 
 	// Set up Gin router
 	router := gin.Default()
 
+	// Count the queries each request runs and flag N+1 patterns
+	queryStats := handlers.NewQueryStatsMiddleware(nPlusOneThreshold, prometheus.DefaultRegisterer)
+	router.Use(queryStats.Handle)
+
 	// Health check endpoints
 	router.GET("/health", healthHandler.Check)
 	router.GET("/ready", healthHandler.Ready)
 
+	// Prometheus metrics
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
 	// Customer endpoints
 	router.POST("/customers", customerHandler.Create)
 	router.GET("/customers/:id", customerHandler.GetByID)
 	router.GET("/customers", customerHandler.List)
+	router.PUT("/customers/:id", customerHandler.Replace)
+	router.PATCH("/customers/:id", customerHandler.Patch)
+	router.DELETE("/customers/:id", customerHandler.Delete)
+	router.POST("/customers/:id/erase", customerHandler.Erase)
+	router.GET("/customers/:id/export", customerHandler.Export)
+
+	// Product endpoints
+	router.POST("/products", productHandler.Create)
+	router.GET("/products/:id", productHandler.GetByID)
+	router.GET("/products", productHandler.List)
+	router.PUT("/products/:id", productHandler.Update)
+	router.DELETE("/products/:id", productHandler.Delete)
 
 	// Order endpoints
 	router.POST("/orders", orderHandler.Create)
 	router.GET("/orders/:id", orderHandler.GetByID)
 	router.PUT("/orders/:id/status", orderHandler.UpdateStatus)
-	router.GET("/customers/:customer_id/orders", orderHandler.ListByCustomer)
-	router.GET("/customers/:customer_id/orders/stats", orderHandler.GetStats)
+	router.GET("/orders/:id/history", orderHandler.GetHistory)
+	router.GET("/customers/:id/orders", orderHandler.ListByCustomer)
+	router.GET("/customers/:id/orders/stats", orderHandler.GetStats)
 
 	// Slow query endpoint for OBI testing
-	router.GET("/customers/:customer_id/orders/slow", orderHandler.SimulateSlowQuery)
+	router.GET("/customers/:id/orders/slow", orderHandler.SimulateSlowQuery)
+	router.GET("/customers/:id/orders/optimized", orderHandler.ListWithItems)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -88,6 +172,28 @@ func main() {
 		}
 	}()
 
+	// The slow query log is served on its own listener, on localhost by
+	// default, since it is unauthenticated
+	var debugSrv *http.Server
+	if dbConfig.SlowQueries != nil {
+		debugRouter := gin.New()
+		debugRouter.Use(gin.Recovery())
+		debugHandler := handlers.NewDebugHandler(dbConfig.SlowQueries)
+		debugRouter.GET("/debug/queries", debugHandler.Queries)
+		debugRouter.DELETE("/debug/queries", debugHandler.ResetQueries)
+
+		debugSrv = &http.Server{
+			Addr:    getEnv("DEBUG_ADDR", "127.0.0.1:6060"),
+			Handler: debugRouter,
+		}
+		go func() {
+			log.Printf("Starting debug server on %s", debugSrv.Addr)
+			if err := debugSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start debug server: %v", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -102,6 +208,12 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	if debugSrv != nil {
+		debugSrv.Shutdown(ctx)
+	}
+
+	stopRelay()
+	relayDone.Wait()
 
 	log.Println("Server exited")
 }
@@ -122,3 +234,21 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if result, err := strconv.ParseBool(value); err == nil {
+			return result
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if result, err := strconv.ParseFloat(value, 64); err == nil {
+			return result
+		}
+	}
+	return defaultValue
+}
@@ -22,6 +22,10 @@ type Config struct {
 	MinConns     int32
 	MaxConnLifetime time.Duration
 	MaxConnIdleTime time.Duration
+
+	// SlowQueries, if set, records slow queries and explains them using
+	// the new pool
+	SlowQueries *SlowQueryLog
 }
 
 // NewPool creates a new PostgreSQL connection pool
@@ -50,10 +54,16 @@ func NewPool(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
 		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
 	}
 
+	// Count queries for contexts created with WithQueryStats
+	poolConfig.ConnConfig.Tracer = QueryTracer{SlowQueries: cfg.SlowQueries}
+
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
+	if cfg.SlowQueries != nil {
+		cfg.SlowQueries.pool = pool
+	}
 
 	// Ping to verify connection
 	if err := pool.Ping(ctx); err != nil {
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QueryStats counts the queries run with a context, by statement
+// fingerprint. It is safe for concurrent use.
+type QueryStats struct {
+	mu     sync.Mutex
+	total  int
+	counts map[string]int
+}
+
+type queryStatsKey struct{}
+
+// WithQueryStats returns a context whose queries are counted in the returned
+// QueryStats, provided they run on a pool created by NewPool
+func WithQueryStats(ctx context.Context) (context.Context, *QueryStats) {
+	stats := &QueryStats{counts: make(map[string]int)}
+	return context.WithValue(ctx, queryStatsKey{}, stats), stats
+}
+
+// QueryStatsFromContext returns the QueryStats of ctx, or nil if it has none
+func QueryStatsFromContext(ctx context.Context) *QueryStats {
+	stats, _ := ctx.Value(queryStatsKey{}).(*QueryStats)
+	return stats
+}
+
+func (s *QueryStats) record(sql string) {
+	fingerprint := Fingerprint(sql)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total++
+	s.counts[fingerprint]++
+}
+
+// Total returns the number of queries run
+func (s *QueryStats) Total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// MostRepeated returns the fingerprint of the statement run most often and
+// how often it ran. Ties go to the lexically smallest fingerprint.
+func (s *QueryStats) MostRepeated() (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var fingerprint string
+	var count int
+	for f, n := range s.counts {
+		if n > count || (n == count && f < fingerprint) {
+			fingerprint, count = f, n
+		}
+	}
+	return fingerprint, count
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`(^|[^\w$])-?\d+(?:\.\d+)?\b`)
+)
+
+// Fingerprint normalizes a statement so that executions differing only in
+// literal values or whitespace compare equal. Statements using bind
+// parameters are already equal; literals matter for SQL built by hand.
+func Fingerprint(sql string) string {
+	return strings.Join(strings.Fields(stripLiterals(sql)), " ")
+}
+
+// stripLiterals replaces the string and numeric literals in sql with ?
+func stripLiterals(sql string) string {
+	sql = stringLiteral.ReplaceAllString(sql, "?")
+	return numericLiteral.ReplaceAllString(sql, "${1}?")
+}
+
+// QueryTracer is a pgx.QueryTracer that records each query in the
+// QueryStats of its context, if any, and slow queries in SlowQueries
+type QueryTracer struct {
+	SlowQueries *SlowQueryLog
+}
+
+type queryStartKey struct{}
+
+// untracedKey marks the queries the tracer itself runs
+type untracedKey struct{}
+
+type queryStart struct {
+	sql  string
+	args []any
+	at   time.Time
+}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (t QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if stats := QueryStatsFromContext(ctx); stats != nil {
+		stats.record(data.SQL)
+	}
+	if t.SlowQueries != nil && ctx.Value(untracedKey{}) == nil {
+		ctx = context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, args: data.Args, at: time.Now()})
+	}
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (t QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	duration := now.Sub(start.at)
+	if duration < t.SlowQueries.Threshold() {
+		return
+	}
+
+	// The query ends before its caller returns, so the caller is on the stack
+	if t.SlowQueries.observe(start.sql, duration, data.CommandTag.RowsAffected(), caller(), now) {
+		go t.SlowQueries.explain(start.sql, start.args)
+	}
+}
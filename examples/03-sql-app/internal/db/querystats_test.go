@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{
+			sql:  "SELECT id\n\t\tFROM orders\n\t\tWHERE id = $1",
+			want: "SELECT id FROM orders WHERE id = $1",
+		},
+		{
+			sql:  "SELECT * FROM orders WHERE id = 42 AND total > 9.99",
+			want: "SELECT * FROM orders WHERE id = ? AND total > ?",
+		},
+		{
+			sql:  "SELECT * FROM customers WHERE email = 'o''brien@example.com'",
+			want: "SELECT * FROM customers WHERE email = ?",
+		},
+		{
+			sql:  "SELECT col1, t2.x FROM t2 LIMIT $2",
+			want: "SELECT col1, t2.x FROM t2 LIMIT $2",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := Fingerprint(tt.sql); got != tt.want {
+			t.Errorf("Fingerprint(%q): expected %q, got %q", tt.sql, tt.want, got)
+		}
+	}
+}
+
+func TestQueryTracer(t *testing.T) {
+	var tracer pgx.QueryTracer = QueryTracer{}
+	trace := func(ctx context.Context, sql string) {
+		tracer.TraceQueryEnd(tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: sql}), nil, pgx.TraceQueryEndData{})
+	}
+
+	// Queries without stats are ignored
+	trace(context.Background(), "SELECT 1")
+
+	ctx, stats := WithQueryStats(context.Background())
+	if QueryStatsFromContext(ctx) != stats {
+		t.Fatal("Expected the stats to be stored in the context")
+	}
+
+	trace(ctx, "SELECT * FROM orders WHERE customer_id = $1")
+	for i := 0; i < 3; i++ {
+		trace(ctx, "SELECT * FROM order_items WHERE order_id = $1")
+	}
+	trace(ctx, "SELECT * FROM products WHERE id = 1")
+	trace(ctx, "SELECT * FROM products WHERE id = 2")
+
+	if got := stats.Total(); got != 6 {
+		t.Errorf("Expected 6 queries, got %d", got)
+	}
+	fingerprint, n := stats.MostRepeated()
+	if fingerprint != "SELECT * FROM order_items WHERE order_id = $1" || n != 3 {
+		t.Errorf("Expected the order items query to repeat 3 times, got %q %d times", fingerprint, n)
+	}
+}
+
+func TestQueryStatsMostRepeated_Empty(t *testing.T) {
+	_, stats := WithQueryStats(context.Background())
+	if fingerprint, n := stats.MostRepeated(); fingerprint != "" || n != 0 {
+		t.Errorf("Expected no repeated query, got %q %d times", fingerprint, n)
+	}
+}
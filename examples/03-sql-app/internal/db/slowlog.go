@@ -0,0 +1,296 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SlowQueryConfig holds slow query log configuration
+type SlowQueryConfig struct {
+	// Threshold is the duration from which a query counts as slow
+	Threshold time.Duration
+	// TopN is the number of statements kept, slowest first
+	TopN int
+	// ExplainSampleRate is the fraction of slow queries that are explained
+	ExplainSampleRate float64
+	// ExplainInterval is the minimum time between two EXPLAINs
+	ExplainInterval time.Duration
+	// ExplainTimeout bounds each EXPLAIN, which runs the query again
+	ExplainTimeout time.Duration
+}
+
+// SlowQuery summarizes the slow executions of one statement
+type SlowQuery struct {
+	Fingerprint string    `json:"fingerprint"`
+	Caller      string    `json:"caller"`
+	Count       int64     `json:"count"`
+	MaxMs       float64   `json:"max_ms"`
+	AvgMs       float64   `json:"avg_ms"`
+	LastRows    int64     `json:"last_rows"`
+	LastSeen    time.Time `json:"last_seen"`
+	// Plan is the output of EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) for the
+	// most recently explained execution, with literals replaced by ? so it
+	// keeps no parameter values
+	Plan         json.RawMessage `json:"plan,omitempty"`
+	PlanAt       *time.Time      `json:"plan_at,omitempty"`
+	ExplainError string          `json:"explain_error,omitempty"`
+}
+
+type slowQueryStats struct {
+	SlowQuery
+	total time.Duration
+	max   time.Duration
+}
+
+// SlowQueryLog records queries slower than a threshold and captures their
+// plans in the background. Set it in Config.SlowQueries to enable it.
+type SlowQueryLog struct {
+	cfg  SlowQueryConfig
+	pool *pgxpool.Pool
+
+	mu          sync.Mutex
+	queries     map[string]*slowQueryStats
+	lastExplain time.Time
+	explaining  bool
+}
+
+// NewSlowQueryLog creates a new slow query log
+func NewSlowQueryLog(cfg SlowQueryConfig) *SlowQueryLog {
+	if cfg.TopN <= 0 {
+		cfg.TopN = 20
+	}
+	if cfg.ExplainTimeout <= 0 {
+		cfg.ExplainTimeout = 10 * time.Second
+	}
+	return &SlowQueryLog{cfg: cfg, queries: make(map[string]*slowQueryStats)}
+}
+
+// Threshold returns the duration from which a query counts as slow
+func (l *SlowQueryLog) Threshold() time.Duration {
+	return l.cfg.Threshold
+}
+
+// Top returns the recorded statements, slowest first
+func (l *SlowQueryLog) Top() []SlowQuery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := make([]*slowQueryStats, 0, len(l.queries))
+	for _, s := range l.queries {
+		stats = append(stats, s)
+	}
+	sortSlowest(stats)
+
+	top := make([]SlowQuery, len(stats))
+	for i, s := range stats {
+		top[i] = s.SlowQuery
+		top[i].MaxMs = durationMs(s.max)
+		top[i].AvgMs = durationMs(s.total / time.Duration(s.Count))
+	}
+	return top
+}
+
+// Reset forgets all recorded statements
+func (l *SlowQueryLog) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queries = make(map[string]*slowQueryStats)
+}
+
+// observe records a finished query and reports whether it should be
+// explained
+func (l *SlowQueryLog) observe(sql string, duration time.Duration, rows int64, caller string, now time.Time) bool {
+	if duration < l.cfg.Threshold {
+		return false
+	}
+	fingerprint := Fingerprint(sql)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.queries[fingerprint]
+	if !ok {
+		s = &slowQueryStats{SlowQuery: SlowQuery{Fingerprint: fingerprint}}
+		l.queries[fingerprint] = s
+		l.evict()
+	}
+	s.Caller = caller
+	s.Count++
+	s.total += duration
+	s.max = max(s.max, duration)
+	s.LastRows = rows
+	s.LastSeen = now
+
+	// Sample, then allow one EXPLAIN at a time and at most one per interval
+	if l.pool == nil || !explainable(sql) || rand.Float64() >= l.cfg.ExplainSampleRate {
+		return false
+	}
+	if l.explaining || now.Sub(l.lastExplain) < l.cfg.ExplainInterval {
+		return false
+	}
+	l.explaining = true
+	l.lastExplain = now
+	return true
+}
+
+// evict drops the statements with the fastest maximum duration beyond TopN
+func (l *SlowQueryLog) evict() {
+	if len(l.queries) <= l.cfg.TopN {
+		return
+	}
+	stats := make([]*slowQueryStats, 0, len(l.queries))
+	for _, s := range l.queries {
+		stats = append(stats, s)
+	}
+	sortSlowest(stats)
+	for _, s := range stats[l.cfg.TopN:] {
+		delete(l.queries, s.Fingerprint)
+	}
+}
+
+func sortSlowest(stats []*slowQueryStats) {
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].max != stats[j].max {
+			return stats[i].max > stats[j].max
+		}
+		return stats[i].Fingerprint < stats[j].Fingerprint
+	})
+}
+
+// explain runs EXPLAIN ANALYZE for a slow query and stores the plan. It runs
+// in a read-only transaction that is rolled back, so statements that would
+// write or lock rows fail instead of having side effects.
+func (l *SlowQueryLog) explain(sql string, args []any) {
+	defer func() {
+		l.mu.Lock()
+		l.explaining = false
+		l.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.cfg.ExplainTimeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, untracedKey{}, true)
+
+	fingerprint := Fingerprint(sql)
+	plan, err := l.runExplain(ctx, sql, args)
+	if err != nil {
+		// Errors can quote the arguments, e.g. invalid input syntax
+		err = errors.New(stripLiterals(err.Error()))
+		log.Printf("Failed to explain slow query %q: %v", fingerprint, err)
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.queries[fingerprint]
+	if !ok {
+		return
+	}
+	if err != nil {
+		s.ExplainError = err.Error()
+		return
+	}
+	s.Plan, s.PlanAt, s.ExplainError = plan, &now, ""
+}
+
+func (l *SlowQueryLog) runExplain(ctx context.Context, sql string, args []any) (json.RawMessage, error) {
+	tx, err := l.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var plan []byte
+	if err := tx.QueryRow(ctx, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "+sql, args...).Scan(&plan); err != nil {
+		return nil, err
+	}
+	return redactPlan(plan)
+}
+
+// redactPlan replaces the literals in every string of an EXPLAIN plan with
+// ?. Postgres plans the query with the bound arguments, so conditions such
+// as "(email = 'a@example.com'::text)" would otherwise keep personal data
+// that outlives its erasure.
+func redactPlan(plan []byte) (json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(plan))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %w", err)
+	}
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(redactStrings(v)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(out.Bytes()), nil
+}
+
+func redactStrings(v any) any {
+	switch v := v.(type) {
+	case string:
+		return stripLiterals(v)
+	case []any:
+		for i := range v {
+			v[i] = redactStrings(v[i])
+		}
+	case map[string]any:
+		for key, value := range v {
+			v[key] = redactStrings(value)
+		}
+	}
+	return v
+}
+
+// explainable reports whether sql is a query EXPLAIN ANALYZE can safely
+// run again
+func explainable(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "WITH", "VALUES", "TABLE":
+		return true
+	}
+	return false
+}
+
+// caller returns the innermost function on the stack outside pgx and this
+// package, e.g. "repository.(*OrderRepository).GetByID"
+func caller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/jackc/") && !strings.HasPrefix(frame.Function, packagePath+".") {
+			return frame.Function[strings.LastIndex(frame.Function, "/")+1:]
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+var packagePath = reflect.TypeOf(SlowQueryLog{}).PkgPath()
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestSlowQueryLog_Top(t *testing.T) {
+	l := NewSlowQueryLog(SlowQueryConfig{Threshold: 10 * time.Millisecond, TopN: 2})
+	now := time.Now()
+
+	l.observe("SELECT * FROM orders WHERE id = $1", 5*time.Millisecond, 1, "fast", now)
+	l.observe("SELECT * FROM orders WHERE id = $1", 20*time.Millisecond, 1, "orders", now)
+	l.observe("SELECT * FROM orders WHERE id = $1", 40*time.Millisecond, 3, "orders", now)
+	l.observe("SELECT * FROM customers", 100*time.Millisecond, 7, "customers", now)
+	l.observe("SELECT * FROM products", 15*time.Millisecond, 2, "products", now)
+
+	top := l.Top()
+	if len(top) != 2 {
+		t.Fatalf("Expected the 2 slowest statements, got %d", len(top))
+	}
+	if top[0].Fingerprint != "SELECT * FROM customers" || top[0].MaxMs != 100 || top[0].LastRows != 7 {
+		t.Errorf("Unexpected slowest statement %+v", top[0])
+	}
+	orders := top[1]
+	if orders.Fingerprint != "SELECT * FROM orders WHERE id = $1" || orders.Caller != "orders" {
+		t.Errorf("Unexpected second statement %+v", orders)
+	}
+	// The fast execution is below the threshold and not counted
+	if orders.Count != 2 || orders.MaxMs != 40 || orders.AvgMs != 30 || orders.LastRows != 3 {
+		t.Errorf("Unexpected stats %+v", orders)
+	}
+
+	l.Reset()
+	if len(l.Top()) != 0 {
+		t.Error("Expected Reset to forget all statements")
+	}
+}
+
+func TestSlowQueryLog_ExplainLimits(t *testing.T) {
+	const query = "SELECT * FROM orders"
+	now := time.Now()
+
+	// Without a pool there is nothing to explain with
+	l := NewSlowQueryLog(SlowQueryConfig{ExplainSampleRate: 1})
+	if l.observe(query, time.Second, 0, "", now) {
+		t.Error("Expected no EXPLAIN without a pool")
+	}
+
+	l = NewSlowQueryLog(SlowQueryConfig{ExplainSampleRate: 1, ExplainInterval: time.Minute})
+	l.pool = &pgxpool.Pool{}
+	if l.observe("UPDATE orders SET status = $1", time.Second, 1, "", now) {
+		t.Error("Expected no EXPLAIN for a write")
+	}
+	if !l.observe(query, time.Second, 0, "", now) {
+		t.Fatal("Expected the first slow query to be explained")
+	}
+	if l.observe(query, time.Second, 0, "", now.Add(2*time.Minute)) {
+		t.Error("Expected no EXPLAIN while one is running")
+	}
+	l.explaining = false
+	if l.observe(query, time.Second, 0, "", now.Add(30*time.Second)) {
+		t.Error("Expected no EXPLAIN within the interval")
+	}
+	if !l.observe(query, time.Second, 0, "", now.Add(2*time.Minute)) {
+		t.Error("Expected an EXPLAIN after the interval")
+	}
+
+	l = NewSlowQueryLog(SlowQueryConfig{ExplainSampleRate: 0})
+	l.pool = &pgxpool.Pool{}
+	if l.observe(query, time.Second, 0, "", now) {
+		t.Error("Expected no EXPLAIN with a zero sample rate")
+	}
+}
+
+func TestExplainable(t *testing.T) {
+	tests := map[string]bool{
+		"SELECT 1":                             true,
+		"\n\t\tselect * FROM orders":           true,
+		"WITH x AS (SELECT 1) SELECT * FROM x": true,
+		"INSERT INTO orders DEFAULT VALUES":    false,
+		"UPDATE orders SET total = 0":          false,
+		"begin":                                false,
+		"":                                     false,
+	}
+
+	for sql, want := range tests {
+		if got := explainable(sql); got != want {
+			t.Errorf("explainable(%q): expected %v, got %v", sql, want, got)
+		}
+	}
+}
+
+func TestRedactPlan(t *testing.T) {
+	plan := `[{"Plan": {"Node Type": "Index Scan", "Index Name": "customers_email_key",
+		"Index Cond": "(email = 'o''brien@example.com'::text)", "Filter": "(id <> 42)",
+		"Actual Rows": 1, "Plans": [{"Node Type": "Seq Scan", "Filter": "(total > 19.99)"}]},
+		"Execution Time": 0.05}]`
+
+	got, err := redactPlan([]byte(plan))
+	if err != nil {
+		t.Fatalf("redactPlan failed: %v", err)
+	}
+
+	want := `[{"Execution Time":0.05,"Plan":{"Actual Rows":1,"Filter":"(id <> ?)","Index Cond":"(email = ?::text)","Index Name":"customers_email_key","Node Type":"Index Scan","Plans":[{"Filter":"(total > ?)","Node Type":"Seq Scan"}]}}]`
+	if string(got) != want {
+		t.Errorf("Unexpected plan\n got: %s\nwant: %s", got, want)
+	}
+
+	if _, err := redactPlan([]byte("not json")); err == nil {
+		t.Error("Expected an error for an invalid plan")
+	}
+}
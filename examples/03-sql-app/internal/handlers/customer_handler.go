@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -21,14 +22,15 @@ func NewCustomerHandler(repo *repository.CustomerRepository) *CustomerHandler {
 
 // Create creates a new customer
 func (h *CustomerHandler) Create(c *gin.Context) {
-	var customer models.Customer
-	if err := c.ShouldBindJSON(&customer); err != nil {
+	var req models.CustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	customer := models.Customer{Name: req.Name, Email: req.Email}
 	if err := h.repo.Create(c.Request.Context(), &customer); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create customer"})
+		respondError(c, err, "customer", "failed to create customer")
 		return
 	}
 
@@ -45,39 +47,128 @@ func (h *CustomerHandler) GetByID(c *gin.Context) {
 
 	customer, err := h.repo.GetByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
+		respondError(c, err, "customer", "failed to get customer")
 		return
 	}
 
 	c.JSON(http.StatusOK, customer)
 }
 
-// List retrieves all customers with pagination
+// List retrieves a page of active customers, newest first, optionally filtered by
+// name or email prefix
 func (h *CustomerHandler) List(c *gin.Context) {
-	limit := 20
-	offset := 0
-
-	if l := c.Query("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
-			limit = parsed
-		}
+	page, ok := parsePage(c)
+	if !ok {
+		return
 	}
 
-	if o := c.Query("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
-			offset = parsed
-		}
+	filter := models.CustomerFilter{
+		NamePrefix:  c.Query("name_prefix"),
+		EmailPrefix: c.Query("email_prefix"),
+		After:       page.cursor,
+		Limit:       page.limit,
+		Offset:      page.offset,
 	}
 
-	customers, err := h.repo.List(c.Request.Context(), limit, offset)
+	customers, next, err := h.repo.ListPage(c.Request.Context(), filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list customers"})
+		respondError(c, err, "customer", "failed to list customers")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"customers": customers,
-		"limit":     limit,
-		"offset":    offset,
+		"customers":   customers,
+		"limit":       page.limit,
+		"next_cursor": encodeCursor(next),
 	})
 }
+
+// Replace replaces a customer's name and email
+func (h *CustomerHandler) Replace(c *gin.Context) {
+	var req models.CustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.update(c, &models.CustomerPatch{Name: &req.Name, Email: &req.Email})
+}
+
+// Patch changes the customer fields present in the request
+func (h *CustomerHandler) Patch(c *gin.Context) {
+	var patch models.CustomerPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.update(c, &patch)
+}
+
+func (h *CustomerHandler) update(c *gin.Context, patch *models.CustomerPatch) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID"})
+		return
+	}
+
+	customer, err := h.repo.Update(c.Request.Context(), id, patch)
+	if err != nil {
+		respondError(c, err, "customer", "failed to update customer")
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+// Delete soft-deletes a customer, keeping their orders
+func (h *CustomerHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID"})
+		return
+	}
+
+	if err := h.repo.Delete(c.Request.Context(), id); err != nil {
+		respondError(c, err, "customer", "failed to delete customer")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Erase pseudonymizes a customer's personal data and deletes them, keeping
+// their orders for accounting
+func (h *CustomerHandler) Erase(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID"})
+		return
+	}
+
+	customer, err := h.repo.Erase(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "customer", "failed to erase customer")
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+// Export returns everything stored about a customer as a JSON download
+func (h *CustomerHandler) Export(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID"})
+		return
+	}
+
+	export, err := h.repo.Export(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "customer", "failed to export customer")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="customer-%d.json"`, id))
+	c.JSON(http.StatusOK, export)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/db"
+)
+
+// DebugHandler serves query profiling data
+type DebugHandler struct {
+	slowQueries *db.SlowQueryLog
+}
+
+// NewDebugHandler creates a new debug handler
+func NewDebugHandler(slowQueries *db.SlowQueryLog) *DebugHandler {
+	return &DebugHandler{slowQueries: slowQueries}
+}
+
+// Queries lists the slowest statements with their captured plans
+func (h *DebugHandler) Queries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"threshold_ms": h.slowQueries.Threshold().Milliseconds(),
+		"queries":      h.slowQueries.Top(),
+	})
+}
+
+// ResetQueries forgets the recorded statements
+func (h *DebugHandler) ResetQueries(c *gin.Context) {
+	h.slowQueries.Reset()
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/repository"
+)
+
+// retryAfterSeconds is suggested to clients for transient database errors
+const retryAfterSeconds = "1"
+
+// respondError writes the response for a repository error. resource names
+// the entity in client messages, and fallback is the message for errors
+// that are not classified.
+func respondError(c *gin.Context, err error, resource, fallback string) {
+	// Attach the error for logging middleware
+	c.Error(err)
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": resource + " not found"})
+	case errors.Is(err, repository.ErrUniqueViolation):
+		c.JSON(http.StatusConflict, gin.H{"error": resource + " already exists"})
+	case errors.Is(err, repository.ErrForeignKeyViolation):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": resource + " references a record that does not exist"})
+	case errors.Is(err, repository.ErrCheckViolation):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": resource + " violates a data constraint"})
+	case errors.Is(err, repository.ErrSerializationFailure):
+		c.Header("Retry-After", retryAfterSeconds)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "conflicting concurrent update, please retry"})
+	case errors.Is(err, repository.ErrTimeout):
+		c.Header("Retry-After", retryAfterSeconds)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database timeout, please retry"})
+	case errors.Is(err, repository.ErrUnavailable):
+		c.Header("Retry-After", retryAfterSeconds)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database unavailable"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/repository"
+)
+
+func TestRespondError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		kind       error
+		wantStatus int
+		wantRetry  bool
+	}{
+		{kind: repository.ErrNotFound, wantStatus: http.StatusNotFound},
+		{kind: repository.ErrUniqueViolation, wantStatus: http.StatusConflict},
+		{kind: repository.ErrForeignKeyViolation, wantStatus: http.StatusUnprocessableEntity},
+		{kind: repository.ErrCheckViolation, wantStatus: http.StatusUnprocessableEntity},
+		{kind: repository.ErrSerializationFailure, wantStatus: http.StatusServiceUnavailable, wantRetry: true},
+		{kind: repository.ErrTimeout, wantStatus: http.StatusServiceUnavailable, wantRetry: true},
+		{kind: repository.ErrUnavailable, wantStatus: http.StatusServiceUnavailable, wantRetry: true},
+		{kind: errors.New("boom"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind.Error(), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			err := fmt.Errorf("failed to get customer: %w", &repository.Error{Kind: tt.kind, Err: errors.New("driver error")})
+			if tt.wantStatus == http.StatusInternalServerError {
+				err = tt.kind
+			}
+			respondError(c, err, "customer", "failed to get customer")
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Retry-After") != ""; got != tt.wantRetry {
+				t.Errorf("Expected Retry-After %v, got %q", tt.wantRetry, w.Header().Get("Retry-After"))
+			}
+			if len(c.Errors) != 1 {
+				t.Errorf("Expected the error to be attached to the context")
+			}
+		})
+	}
+}
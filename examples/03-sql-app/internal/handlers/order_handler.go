@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -29,7 +30,22 @@ func (h *OrderHandler) Create(c *gin.Context) {
 
 	order, err := h.repo.Create(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create order"})
+		var unknown *repository.UnknownProductsError
+		var shortage *repository.InsufficientStockError
+		switch {
+		case errors.As(err, &unknown):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":       "unknown products",
+				"product_ids": unknown.ProductIDs,
+			})
+		case errors.As(err, &shortage):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "insufficient stock",
+				"items": shortage.Items,
+			})
+		default:
+			respondError(c, err, "order", "failed to create order")
+		}
 		return
 	}
 
@@ -55,47 +71,43 @@ func (h *OrderHandler) GetByID(c *gin.Context) {
 	}
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		respondError(c, err, "order", "failed to get order")
 		return
 	}
 
 	c.JSON(http.StatusOK, order)
 }
 
-// ListByCustomer retrieves all orders for a customer
+// ListByCustomer retrieves a page of a customer's orders, newest first,
+// optionally filtered by status, total and creation time
 func (h *OrderHandler) ListByCustomer(c *gin.Context) {
-	customerID, err := strconv.ParseInt(c.Param("customer_id"), 10, 64)
+	customerID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID"})
 		return
 	}
 
-	limit := 20
-	offset := 0
-
-	if l := c.Query("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
-			limit = parsed
-		}
+	page, ok := parsePage(c)
+	if !ok {
+		return
 	}
 
-	if o := c.Query("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
-			offset = parsed
-		}
+	filter := models.OrderFilter{After: page.cursor, Limit: page.limit, Offset: page.offset}
+	if !parseOrderFilter(c, &filter) {
+		return
 	}
 
-	orders, err := h.repo.ListByCustomer(c.Request.Context(), customerID, limit, offset)
+	orders, next, err := h.repo.ListByCustomerPage(c.Request.Context(), customerID, filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list orders"})
+		respondError(c, err, "order", "failed to list orders")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"orders":      orders,
 		"customer_id": customerID,
-		"limit":       limit,
-		"offset":      offset,
+		"limit":       page.limit,
+		"next_cursor": encodeCursor(next),
 	})
 }
 
@@ -113,17 +125,51 @@ func (h *OrderHandler) UpdateStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.repo.UpdateStatus(c.Request.Context(), id, req.Status); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order status"})
+	change, err := h.repo.UpdateStatus(c.Request.Context(), id, &req)
+	if err != nil {
+		var invalid *repository.InvalidTransitionError
+		switch {
+		case errors.As(err, &invalid):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":          invalid.Error(),
+				"current_status": invalid.From,
+				"allowed":        invalid.Allowed,
+			})
+		default:
+			respondError(c, err, "order", "failed to update order status")
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "order status updated"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "order status updated",
+		"transition": change,
+	})
+}
+
+// GetHistory retrieves an order's status transitions
+func (h *OrderHandler) GetHistory(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID"})
+		return
+	}
+
+	history, err := h.repo.GetStatusHistory(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "order", "failed to get order history")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id": id,
+		"history":  history,
+	})
 }
 
 // GetStats retrieves order statistics for a customer
 func (h *OrderHandler) GetStats(c *gin.Context) {
-	customerID, err := strconv.ParseInt(c.Param("customer_id"), 10, 64)
+	customerID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID"})
 		return
@@ -131,7 +177,7 @@ func (h *OrderHandler) GetStats(c *gin.Context) {
 
 	stats, err := h.repo.GetOrderStats(c.Request.Context(), customerID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get order stats"})
+		respondError(c, err, "order", "failed to get order stats")
 		return
 	}
 
@@ -140,7 +186,7 @@ func (h *OrderHandler) GetStats(c *gin.Context) {
 
 // SimulateSlowQuery demonstrates a slow query pattern for OBI testing
 func (h *OrderHandler) SimulateSlowQuery(c *gin.Context) {
-	customerID, err := strconv.ParseInt(c.Param("customer_id"), 10, 64)
+	customerID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID"})
 		return
@@ -148,7 +194,7 @@ func (h *OrderHandler) SimulateSlowQuery(c *gin.Context) {
 
 	orders, err := h.repo.SimulateSlowQuery(c.Request.Context(), customerID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get orders"})
+		respondError(c, err, "order", "failed to get orders")
 		return
 	}
 
@@ -158,3 +204,24 @@ func (h *OrderHandler) SimulateSlowQuery(c *gin.Context) {
 		"warning":     "This endpoint uses N+1 queries for demonstration purposes",
 	})
 }
+
+// ListWithItems is the set-based counterpart of SimulateSlowQuery: it
+// returns the same orders and items using a single query
+func (h *OrderHandler) ListWithItems(c *gin.Context) {
+	customerID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID"})
+		return
+	}
+
+	orders, err := h.repo.ListWithItems(c.Request.Context(), customerID, 100, 0)
+	if err != nil {
+		respondError(c, err, "order", "failed to get orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders":      orders,
+		"customer_id": customerID,
+	})
+}
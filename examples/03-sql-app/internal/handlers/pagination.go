@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/models"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/money"
+)
+
+// page holds the pagination query parameters of a listing
+type page struct {
+	limit  int
+	offset int
+	cursor *models.Cursor
+}
+
+// parsePage reads the limit, cursor and offset query parameters. It responds
+// with 400 and returns false if they are invalid. offset is deprecated in
+// favour of cursor; requests that still use it get a Deprecation header.
+func parsePage(c *gin.Context) (page, bool) {
+	p := page{limit: 20}
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return page{}, false
+		}
+		p.limit = parsed
+	}
+
+	if s := c.Query("cursor"); s != "" {
+		var err error
+		if p.cursor, err = models.DecodeCursor(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return page{}, false
+		}
+	}
+
+	if o := c.Query("offset"); o != "" {
+		parsed, err := strconv.Atoi(o)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+			return page{}, false
+		}
+		if p.cursor != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset cannot be combined with cursor"})
+			return page{}, false
+		}
+		p.offset = parsed
+		c.Header("Deprecation", "true")
+	}
+
+	return p, true
+}
+
+// encodeCursor returns the next_cursor field of a page
+func encodeCursor(cursor *models.Cursor) *string {
+	if cursor == nil {
+		return nil
+	}
+	s := cursor.Encode()
+	return &s
+}
+
+// parseOrderFilter reads the order filter query parameters into filter. It
+// responds with 400 and returns false if any is invalid.
+func parseOrderFilter(c *gin.Context, filter *models.OrderFilter) bool {
+	if s := c.Query("status"); s != "" {
+		for _, status := range strings.Split(s, ",") {
+			if !models.OrderStatus(status).Valid() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status " + strconv.Quote(status)})
+				return false
+			}
+			filter.Statuses = append(filter.Statuses, models.OrderStatus(status))
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **money.Money
+	}{{"min_total", &filter.MinTotal}, {"max_total", &filter.MaxTotal}} {
+		if s := c.Query(p.name); s != "" {
+			v, err := money.Parse(s, money.DefaultCurrency)
+			if err != nil || v.IsNegative() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + p.name})
+				return false
+			}
+			*p.dst = &v
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"created_after", &filter.CreatedAfter}, {"created_before", &filter.CreatedBefore}} {
+		if s := c.Query(p.name); s != "" {
+			v, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + p.name + ", expected an RFC 3339 time"})
+				return false
+			}
+			*p.dst = &v
+		}
+	}
+
+	return true
+}
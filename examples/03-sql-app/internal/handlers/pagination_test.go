@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/models"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/money"
+)
+
+func testContext(target string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", target, nil)
+	return c, w
+}
+
+func TestParsePage(t *testing.T) {
+	cursor := models.Cursor{CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ID: 9}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantOK     bool
+		wantLimit  int
+		wantOffset int
+		wantCursor bool
+	}{
+		{name: "defaults", query: "", wantOK: true, wantLimit: 20},
+		{name: "limit", query: "limit=50", wantOK: true, wantLimit: 50},
+		{name: "limit too large", query: "limit=1000"},
+		{name: "limit zero", query: "limit=0"},
+		{name: "limit not a number", query: "limit=ten"},
+		{name: "cursor", query: "cursor=" + cursor.Encode(), wantOK: true, wantLimit: 20, wantCursor: true},
+		{name: "invalid cursor", query: "cursor=garbage"},
+		{name: "offset", query: "limit=10&offset=30", wantOK: true, wantLimit: 10, wantOffset: 30},
+		{name: "negative offset", query: "offset=-1"},
+		{name: "offset with cursor", query: "offset=20&cursor=" + cursor.Encode()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := testContext("/customers?" + tt.query)
+			got, ok := parsePage(c)
+			if ok != tt.wantOK {
+				t.Fatalf("Expected ok %v, got %v", tt.wantOK, ok)
+			}
+			if !ok {
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("Expected status 400, got %d", w.Code)
+				}
+				return
+			}
+			if got.limit != tt.wantLimit || got.offset != tt.wantOffset {
+				t.Errorf("Expected limit %d and offset %d, got %d and %d", tt.wantLimit, tt.wantOffset, got.limit, got.offset)
+			}
+			if (got.cursor != nil) != tt.wantCursor || (got.cursor != nil && got.cursor.ID != cursor.ID) {
+				t.Errorf("Unexpected cursor %+v", got.cursor)
+			}
+			if deprecated := w.Header().Get("Deprecation") != ""; deprecated != (tt.wantOffset > 0) {
+				t.Errorf("Expected a Deprecation header only for offset, got %q", w.Header().Get("Deprecation"))
+			}
+		})
+	}
+}
+
+func TestParseOrderFilter(t *testing.T) {
+	c, _ := testContext("/orders?status=pending,shipped&min_total=10&max_total=99.5&created_after=2024-01-01T00:00:00Z&created_before=2024-02-01T00:00:00Z")
+	var filter models.OrderFilter
+	if !parseOrderFilter(c, &filter) {
+		t.Fatal("Expected the filter to parse")
+	}
+	if len(filter.Statuses) != 2 || filter.Statuses[0] != models.OrderStatusPending || filter.Statuses[1] != models.OrderStatusShipped {
+		t.Errorf("Unexpected statuses %v", filter.Statuses)
+	}
+	if filter.MinTotal == nil || *filter.MinTotal != money.New(1000, "USD") || filter.MaxTotal == nil || *filter.MaxTotal != money.New(9950, "USD") {
+		t.Errorf("Unexpected total range %v..%v", filter.MinTotal, filter.MaxTotal)
+	}
+	if filter.CreatedAfter == nil || filter.CreatedBefore == nil || !filter.CreatedBefore.After(*filter.CreatedAfter) {
+		t.Errorf("Unexpected date range %v..%v", filter.CreatedAfter, filter.CreatedBefore)
+	}
+
+	for _, query := range []string{"status=lost", "min_total=abc", "min_total=1.005", "max_total=-1", "created_after=yesterday"} {
+		c, w := testContext("/orders?" + query)
+		if parseOrderFilter(c, &models.OrderFilter{}) || w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
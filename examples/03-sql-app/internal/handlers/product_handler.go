@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/models"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/repository"
+)
+
+// ProductHandler handles product catalog HTTP requests
+type ProductHandler struct {
+	repo *repository.ProductRepository
+}
+
+// NewProductHandler creates a new product handler
+func NewProductHandler(repo *repository.ProductRepository) *ProductHandler {
+	return &ProductHandler{repo: repo}
+}
+
+// Create creates a new product
+func (h *ProductHandler) Create(c *gin.Context) {
+	var req models.ProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.repo.Create(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err, "product", "failed to create product")
+		return
+	}
+
+	c.JSON(http.StatusCreated, product)
+}
+
+// GetByID retrieves a product by ID
+func (h *ProductHandler) GetByID(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	product, err := h.repo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "product", "failed to get product")
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// List retrieves all products with pagination
+func (h *ProductHandler) List(c *gin.Context) {
+	limit := 20
+	offset := 0
+
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	products, err := h.repo.List(c.Request.Context(), limit, offset)
+	if err != nil {
+		respondError(c, err, "product", "failed to list products")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"products": products,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// Update replaces a product's details and stock level
+func (h *ProductHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	var req models.ProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.repo.Update(c.Request.Context(), id, &req)
+	if err != nil {
+		respondError(c, err, "product", "failed to update product")
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// Delete deletes a product that has never been ordered
+func (h *ProductHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	if err := h.repo.Delete(c.Request.Context(), id); err != nil {
+		if errors.Is(err, repository.ErrProductInUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": "product has been ordered and cannot be deleted"})
+			return
+		}
+		respondError(c, err, "product", "failed to delete product")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
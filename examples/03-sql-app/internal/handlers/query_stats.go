@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/db"
+)
+
+// Response headers reporting the database queries a request ran
+const (
+	HeaderQueryCount    = "X-DB-Query-Count"
+	HeaderQueryRepeats  = "X-DB-Query-Max-Repeats"
+	HeaderNPlusOneQuery = "X-DB-N-Plus-One"
+)
+
+// QueryStatsMiddleware counts the database queries each request runs and
+// flags N+1 patterns: the same statement running at least threshold times.
+// Counts are reported in response headers and Prometheus metrics, and
+// flagged requests are logged.
+type QueryStatsMiddleware struct {
+	threshold int
+	queries   *prometheus.HistogramVec
+	nPlusOne  *prometheus.CounterVec
+}
+
+// NewQueryStatsMiddleware creates the middleware and registers its metrics
+// with reg. A threshold of zero or less disables N+1 detection.
+func NewQueryStatsMiddleware(threshold int, reg prometheus.Registerer) *QueryStatsMiddleware {
+	m := &QueryStatsMiddleware{
+		threshold: threshold,
+		queries: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "sql_app_request_queries",
+				Help:    "Number of database queries per HTTP request",
+				Buckets: []float64{1, 2, 5, 10, 20, 50, 100, 200, 500},
+			},
+			[]string{"route"},
+		),
+		nPlusOne: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "sql_app_n_plus_one_requests_total",
+				Help: "Total number of HTTP requests flagged for N+1 queries",
+			},
+			[]string{"route"},
+		),
+	}
+
+	reg.MustRegister(m.queries, m.nPlusOne)
+	return m
+}
+
+// Handle is the gin middleware function
+func (m *QueryStatsMiddleware) Handle(c *gin.Context) {
+	ctx, stats := db.WithQueryStats(c.Request.Context())
+	c.Request = c.Request.WithContext(ctx)
+	w := &queryStatsWriter{ResponseWriter: c.Writer, stats: stats, m: m}
+	c.Writer = w
+
+	c.Next()
+
+	// Responses without a body are only written after the middleware returns
+	w.setHeaders()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	total := stats.Total()
+	m.queries.WithLabelValues(route).Observe(float64(total))
+
+	if statement, n := stats.MostRepeated(); m.flags(n) {
+		m.nPlusOne.WithLabelValues(route).Inc()
+		log.Printf("N+1 queries in %s %s: %q ran %d times (%d queries in total)",
+			c.Request.Method, route, statement, n, total)
+	}
+}
+
+func (m *QueryStatsMiddleware) flags(repeats int) bool {
+	return m.threshold > 0 && repeats >= m.threshold
+}
+
+// queryStatsWriter adds the query headers just before the response headers
+// are sent, when every query the handler needed has run
+type queryStatsWriter struct {
+	gin.ResponseWriter
+	stats *db.QueryStats
+	m     *QueryStatsMiddleware
+	done  bool
+}
+
+func (w *queryStatsWriter) setHeaders() {
+	if w.done || w.ResponseWriter.Written() {
+		return
+	}
+	w.done = true
+
+	_, repeats := w.stats.MostRepeated()
+	header := w.Header()
+	header.Set(HeaderQueryCount, strconv.Itoa(w.stats.Total()))
+	header.Set(HeaderQueryRepeats, strconv.Itoa(repeats))
+	if w.m.flags(repeats) {
+		header.Set(HeaderNPlusOneQuery, "true")
+	}
+}
+
+func (w *queryStatsWriter) WriteHeaderNow() {
+	w.setHeaders()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *queryStatsWriter) Write(data []byte) (int, error) {
+	w.setHeaders()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *queryStatsWriter) WriteString(s string) (int, error) {
+	w.setHeaders()
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/db"
+)
+
+func TestQueryStatsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	reg := prometheus.NewRegistry()
+	m := NewQueryStatsMiddleware(3, reg)
+
+	// runQueries simulates a handler running queries on a traced pool
+	runQueries := func(c *gin.Context, sqls ...string) {
+		for _, sql := range sqls {
+			db.QueryTracer{}.TraceQueryStart(c.Request.Context(), nil, pgx.TraceQueryStartData{SQL: sql})
+		}
+	}
+
+	router := gin.New()
+	router.Use(m.Handle)
+	router.GET("/n-plus-one", func(c *gin.Context) {
+		runQueries(c, "SELECT * FROM orders", "SELECT * FROM items WHERE id = 1", "SELECT * FROM items WHERE id = 2", "SELECT * FROM items WHERE id = 3")
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	router.GET("/single", func(c *gin.Context) {
+		runQueries(c, "SELECT * FROM orders")
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	router.DELETE("/empty", func(c *gin.Context) {
+		runQueries(c, "DELETE FROM orders WHERE id = $1")
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		method       string
+		path         string
+		wantCount    string
+		wantRepeats  string
+		wantNPlusOne string
+	}{
+		{method: "GET", path: "/n-plus-one", wantCount: "4", wantRepeats: "3", wantNPlusOne: "true"},
+		{method: "GET", path: "/single", wantCount: "1", wantRepeats: "1"},
+		{method: "DELETE", path: "/empty", wantCount: "1", wantRepeats: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if got := w.Header().Get(HeaderQueryCount); got != tt.wantCount {
+				t.Errorf("Expected %s %s, got %q", HeaderQueryCount, tt.wantCount, got)
+			}
+			if got := w.Header().Get(HeaderQueryRepeats); got != tt.wantRepeats {
+				t.Errorf("Expected %s %s, got %q", HeaderQueryRepeats, tt.wantRepeats, got)
+			}
+			if got := w.Header().Get(HeaderNPlusOneQuery); got != tt.wantNPlusOne {
+				t.Errorf("Expected %s %q, got %q", HeaderNPlusOneQuery, tt.wantNPlusOne, got)
+			}
+		})
+	}
+
+	if got := testutil.ToFloat64(m.nPlusOne.WithLabelValues("/n-plus-one")); got != 1 {
+		t.Errorf("Expected 1 flagged request, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.nPlusOne.WithLabelValues("/single")); got != 0 {
+		t.Errorf("Expected no flagged requests, got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.queries); got != 3 {
+		t.Errorf("Expected a query histogram per route, got %d", got)
+	}
+}
+
+func TestQueryStatsMiddleware_Disabled(t *testing.T) {
+	m := NewQueryStatsMiddleware(0, prometheus.NewRegistry())
+	if m.flags(1000) {
+		t.Error("Expected a zero threshold to disable N+1 detection")
+	}
+}
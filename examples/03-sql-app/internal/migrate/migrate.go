@@ -0,0 +1,457 @@
+// Package migrate applies the numbered SQL migrations in the migrations
+// directory and records them in the schema_migrations table.
+//
+// Each migration runs in its own transaction together with its
+// schema_migrations row, and the SHA-256 checksum of the up file is stored so
+// that edits to an already applied migration are detected. All changes are
+// made under a PostgreSQL advisory lock, so replicas starting at the same
+// time apply each migration exactly once.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockID is the advisory lock key held while migrating
+const lockID int64 = 0x6d6f702d6d696772 // "mop-migr"
+
+var (
+	// ErrChecksumMismatch is returned when an applied migration's up file
+	// no longer matches the checksum recorded when it was applied
+	ErrChecksumMismatch = errors.New("applied migration has been modified")
+	// ErrUnknownVersion is returned for a target version without a migration
+	ErrUnknownVersion = errors.New("unknown migration version")
+	// ErrIrreversible is returned when rolling back a migration that has no
+	// down file
+	ErrIrreversible = errors.New("migration has no down migration")
+)
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// String returns the migration's file name prefix, e.g. "001_create_customers"
+func (m Migration) String() string {
+	return fmt.Sprintf("%03d_%s", m.Version, m.Name)
+}
+
+// Status describes a migration file or applied version
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the file differs from the applied migration
+	Modified bool
+	// Missing is set for applied versions without a migration file, e.g.
+	// when a newer release has already migrated the database
+	Missing bool
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads NNN_name.up.sql and NNN_name.down.sql files from fsys, sorted
+// by version. Every version needs an up file; the down file is optional.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			sum := sha256.Sum256(data)
+			m.Up = string(data)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("migration %s has no up file", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// applied is a schema_migrations row
+type applied struct {
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+// New creates a migrator for the migrations in fsys
+func New(db *pgxpool.Pool, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest returns the highest migration version, or 0 without migrations
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies all pending migrations
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the most recently applied steps migrations
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn, state map[int64]applied) error {
+		if err := m.verify(state); err != nil {
+			return err
+		}
+
+		versions := make([]int64, 0, len(state))
+		for version := range state {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+
+		down, err := m.rollbacks(versions)
+		if err != nil {
+			return err
+		}
+		return m.run(ctx, conn, down, nil)
+	})
+}
+
+// To migrates to version: migrations above it are rolled back, newest
+// first, and pending migrations up to it are applied. Version 0 rolls back
+// everything.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return m.withLock(ctx, func(conn *pgxpool.Conn, state map[int64]applied) error {
+		if err := m.verify(state); err != nil {
+			return err
+		}
+		down, up, err := m.plan(state, version)
+		if err != nil {
+			return err
+		}
+		return m.run(ctx, conn, down, up)
+	})
+}
+
+// Force records the database as migrated to exactly version without running
+// any SQL, adopting the current checksums. It is used to baseline a
+// database whose schema was created by hand, to recover after a failed
+// manual fix, or to accept an intentionally edited migration.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return m.withLock(ctx, func(conn *pgxpool.Conn, _ map[int64]applied) error {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback(ctx)
+
+		if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version > $1`, version); err != nil {
+			return fmt.Errorf("failed to force version %d: %w", version, err)
+		}
+		for _, mig := range m.migrations {
+			if mig.Version > version {
+				break
+			}
+			_, err := tx.Exec(ctx, `
+				INSERT INTO schema_migrations (version, name, checksum)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (version) DO UPDATE
+				SET name = EXCLUDED.name, checksum = EXCLUDED.checksum
+			`, mig.Version, mig.Name, mig.Checksum)
+			if err != nil {
+				return fmt.Errorf("failed to force version %d: %w", version, err)
+			}
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+// Status lists every migration file and applied version, oldest first
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	state, err := readApplied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := state[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.AppliedAt
+			s.Modified = a.Checksum != mig.Checksum
+		}
+		statuses = append(statuses, s)
+	}
+	for version, a := range state {
+		if m.find(version) == nil {
+			statuses = append(statuses, Status{
+				Version:   version,
+				Name:      a.Name,
+				Applied:   true,
+				AppliedAt: a.AppliedAt,
+				Missing:   true,
+			})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Verify returns ErrChecksumMismatch if an applied migration's file has been
+// modified since it was applied. Applied versions without a file are
+// allowed so that an older release can run against a newer schema.
+func (m *Migrator) Verify(ctx context.Context) error {
+	state, err := readApplied(ctx, m.db)
+	if err != nil {
+		return err
+	}
+	return m.verify(state)
+}
+
+func (m *Migrator) verify(state map[int64]applied) error {
+	var errs []error
+	for _, mig := range m.migrations {
+		if a, ok := state[mig.Version]; ok && a.Checksum != mig.Checksum {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrChecksumMismatch, mig))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// plan returns the migrations to roll back, newest first, and the pending
+// migrations to apply, oldest first, to reach version
+func (m *Migrator) plan(state map[int64]applied, version int64) (down, up []Migration, err error) {
+	var above []int64
+	for v := range state {
+		if v > version {
+			above = append(above, v)
+		}
+	}
+	sort.Slice(above, func(i, j int) bool { return above[i] > above[j] })
+	if down, err = m.rollbacks(above); err != nil {
+		return nil, nil, err
+	}
+
+	for _, mig := range m.migrations {
+		if _, ok := state[mig.Version]; !ok && mig.Version <= version {
+			up = append(up, mig)
+		}
+	}
+	return down, up, nil
+}
+
+// rollbacks returns the migrations for versions, which must all be
+// reversible
+func (m *Migrator) rollbacks(versions []int64) ([]Migration, error) {
+	down := make([]Migration, 0, len(versions))
+	for _, v := range versions {
+		mig := m.find(v)
+		if mig == nil {
+			return nil, fmt.Errorf("cannot roll back version %d: %w", v, ErrUnknownVersion)
+		}
+		if mig.Down == "" {
+			return nil, fmt.Errorf("cannot roll back %s: %w", mig, ErrIrreversible)
+		}
+		down = append(down, *mig)
+	}
+	return down, nil
+}
+
+func (m *Migrator) run(ctx context.Context, conn *pgxpool.Conn, down, up []Migration) error {
+	for _, mig := range down {
+		err := inTx(ctx, conn, mig.Down, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+		if err != nil {
+			return fmt.Errorf("failed to roll back %s: %w", mig, err)
+		}
+		log.Printf("Rolled back migration %s", mig)
+	}
+	for _, mig := range up {
+		err := inTx(ctx, conn, mig.Up,
+			`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+			mig.Version, mig.Name, mig.Checksum)
+		if err != nil {
+			return fmt.Errorf("failed to apply %s: %w", mig, err)
+		}
+		log.Printf("Applied migration %s", mig)
+	}
+	return nil
+}
+
+// inTx runs a migration script and its bookkeeping statement in one
+// transaction. The script is sent without arguments, so pgx uses the simple
+// protocol and it may contain several statements.
+func inTx(ctx context.Context, conn *pgxpool.Conn, script, record string, args ...any) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory
+// lock, passing the applied migrations as read under the lock
+func (m *Migrator) withLock(ctx context.Context, fn func(*pgxpool.Conn, map[int64]applied) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// A connection that may still hold the lock must not go back to the
+		// pool; closing it releases the lock
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	state, err := readApplied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, state)
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// readApplied returns the schema_migrations rows by version; a database
+// without the table has nothing applied
+func readApplied(ctx context.Context, q querier) (map[int64]applied, error) {
+	state := make(map[int64]applied)
+
+	var exists bool
+	if err := q.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	if !exists {
+		return state, nil
+	}
+
+	rows, err := q.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var a applied
+		if err := rows.Scan(&version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		state[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	return state, nil
+}
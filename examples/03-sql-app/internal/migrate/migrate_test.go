@@ -0,0 +1,179 @@
+package migrate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/raibid-labs/mop/examples/03-sql-app/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_orders.up.sql":      {Data: []byte("CREATE TABLE orders ();")},
+		"002_add_orders.down.sql":    {Data: []byte("DROP TABLE orders;")},
+		"001_add_customers.up.sql":   {Data: []byte("CREATE TABLE customers ();")},
+		"010_irreversible.up.sql":    {Data: []byte("DROP TABLE legacy;")},
+		"migrations.go":              {Data: []byte("package migrations")},
+		"001_add_customers.down.sql": {Data: []byte("DROP TABLE customers;")},
+		"notes/003_ignored.up.sql":   {Data: []byte("SELECT 1;")},
+		"README_not_a_migration.sql": {Data: []byte("SELECT 1;")},
+	}
+
+	got, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var names []string
+	for _, m := range got {
+		names = append(names, m.String())
+	}
+	want := []string{"001_add_customers", "002_add_orders", "010_irreversible"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("Expected %v, got %v", want, names)
+	}
+	if got[1].Up != "CREATE TABLE orders ();" || got[1].Down != "DROP TABLE orders;" {
+		t.Errorf("Unexpected SQL for %s: %+v", got[1], got[1])
+	}
+	if got[2].Down != "" {
+		t.Errorf("Expected no down migration for %s", got[2])
+	}
+	if len(got[0].Checksum) != 64 || got[0].Checksum == got[1].Checksum {
+		t.Errorf("Unexpected checksums %q and %q", got[0].Checksum, got[1].Checksum)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "down without up",
+			fsys: fstest.MapFS{"001_init.down.sql": {Data: []byte("DROP TABLE t;")}},
+		},
+		{
+			name: "duplicate version",
+			fsys: fstest.MapFS{
+				"001_init.up.sql":  {Data: []byte("CREATE TABLE t ();")},
+				"001_other.up.sql": {Data: []byte("CREATE TABLE u ();")},
+			},
+		},
+		{
+			name: "version zero",
+			fsys: fstest.MapFS{"000_init.up.sql": {Data: []byte("CREATE TABLE t ();")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.fsys); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	got, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("Failed to load embedded migrations: %v", err)
+	}
+	if len(got) == 0 {
+		t.Fatal("Expected embedded migrations")
+	}
+	for i, m := range got {
+		if m.Version != int64(i+1) {
+			t.Errorf("Expected %s to have version %d", m, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("Expected %s to have a down migration", m)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	m := &Migrator{migrations: []Migration{
+		{Version: 1, Name: "a", Down: "DROP"},
+		{Version: 2, Name: "b", Down: "DROP"},
+		{Version: 3, Name: "c"},
+		{Version: 4, Name: "d", Down: "DROP"},
+	}}
+	versions := func(migrations []Migration) []int64 {
+		out := []int64{}
+		for _, mig := range migrations {
+			out = append(out, mig.Version)
+		}
+		return out
+	}
+	state := func(versions ...int64) map[int64]applied {
+		s := make(map[int64]applied)
+		for _, v := range versions {
+			s[v] = applied{}
+		}
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		state    map[int64]applied
+		target   int64
+		wantDown []int64
+		wantUp   []int64
+		wantErr  error
+	}{
+		{name: "fresh database", state: state(), target: 4, wantDown: []int64{}, wantUp: []int64{1, 2, 3, 4}},
+		{name: "up to date", state: state(1, 2, 3, 4), target: 4, wantDown: []int64{}, wantUp: []int64{}},
+		{name: "partial", state: state(1), target: 3, wantDown: []int64{}, wantUp: []int64{2, 3}},
+		{name: "out of order pending", state: state(1, 3), target: 4, wantDown: []int64{}, wantUp: []int64{2, 4}},
+		{name: "roll back newest first", state: state(1, 2), target: 0, wantDown: []int64{2, 1}, wantUp: []int64{}},
+		{name: "irreversible", state: state(1, 2, 3, 4), target: 2, wantErr: ErrIrreversible},
+		{name: "unknown applied version", state: state(1, 2, 7), target: 2, wantErr: ErrUnknownVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			down, up, err := m.plan(tt.state, tt.target)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if got := versions(down); !reflect.DeepEqual(got, tt.wantDown) {
+				t.Errorf("Expected rollbacks %v, got %v", tt.wantDown, got)
+			}
+			if got := versions(up); !reflect.DeepEqual(got, tt.wantUp) {
+				t.Errorf("Expected migrations %v, got %v", tt.wantUp, got)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m := &Migrator{migrations: []Migration{
+		{Version: 1, Name: "a", Checksum: "aaa"},
+		{Version: 2, Name: "b", Checksum: "bbb"},
+	}}
+
+	tests := []struct {
+		name    string
+		state   map[int64]applied
+		wantErr error
+	}{
+		{name: "nothing applied", state: map[int64]applied{}},
+		{name: "matching", state: map[int64]applied{1: {Checksum: "aaa"}, 2: {Checksum: "bbb"}}},
+		{name: "newer schema", state: map[int64]applied{1: {Checksum: "aaa"}, 3: {Checksum: "ccc"}}},
+		{name: "modified", state: map[int64]applied{1: {Checksum: "aaa"}, 2: {Checksum: "old"}}, wantErr: ErrChecksumMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.verify(tt.state); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
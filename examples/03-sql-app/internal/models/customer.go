@@ -8,4 +8,30 @@ type Customer struct {
 	Name      string    `json:"name" db:"name"`
 	Email     string    `json:"email" db:"email"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	// DeletedAt is set once the customer is soft-deleted, and ErasedAt once
+	// their personal data is pseudonymized
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	ErasedAt  *time.Time `json:"erased_at,omitempty" db:"erased_at"`
+}
+
+// CustomerRequest represents the request to create or replace a customer's
+// details
+type CustomerRequest struct {
+	Name  string `json:"name" binding:"required,max=255"`
+	Email string `json:"email" binding:"required,email,max=255"`
+}
+
+// CustomerPatch represents a partial update of a customer's details. Nil
+// fields are left unchanged.
+type CustomerPatch struct {
+	Name  *string `json:"name" binding:"omitempty,min=1,max=255"`
+	Email *string `json:"email" binding:"omitempty,email,max=255"`
+}
+
+// CustomerExport is everything stored about a customer, for data
+// portability requests
+type CustomerExport struct {
+	Customer   Customer         `json:"customer"`
+	Orders     []OrderWithItems `json:"orders"`
+	ExportedAt time.Time        `json:"exported_at"`
 }
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/money"
+)
 
 // OrderStatus represents the status of an order
 type OrderStatus string
@@ -13,24 +17,55 @@ const (
 	OrderStatusCancelled  OrderStatus = "cancelled"
 )
 
+// orderTransitions lists the statuses each status may move to. Delivered
+// and cancelled orders are final.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:    {OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusProcessing: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:    {OrderStatusDelivered},
+	OrderStatusDelivered:  {},
+	OrderStatusCancelled:  {},
+}
+
+// Valid reports whether s is a known status
+func (s OrderStatus) Valid() bool {
+	_, ok := orderTransitions[s]
+	return ok
+}
+
+// Next returns the statuses an order in status s may move to
+func (s OrderStatus) Next() []OrderStatus {
+	return append([]OrderStatus{}, orderTransitions[s]...)
+}
+
+// CanTransitionTo reports whether an order may move from s to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 // Order represents an order in the system
 type Order struct {
 	ID         int64       `json:"id" db:"id"`
 	CustomerID int64       `json:"customer_id" db:"customer_id"`
 	Status     OrderStatus `json:"status" db:"status"`
-	Total      float64     `json:"total" db:"total"`
+	Total      money.Money `json:"total" db:"total"`
 	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
 	UpdatedAt  time.Time   `json:"updated_at" db:"updated_at"`
 }
 
 // OrderItem represents an item in an order
 type OrderItem struct {
-	ID        int64     `json:"id" db:"id"`
-	OrderID   int64     `json:"order_id" db:"order_id"`
-	ProductID int64     `json:"product_id" db:"product_id"`
-	Quantity  int       `json:"quantity" db:"quantity"`
-	Price     float64   `json:"price" db:"price"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID        int64       `json:"id" db:"id"`
+	OrderID   int64       `json:"order_id" db:"order_id"`
+	ProductID int64       `json:"product_id" db:"product_id"`
+	Quantity  int         `json:"quantity" db:"quantity"`
+	Price     money.Money `json:"price" db:"price"`
+	CreatedAt time.Time   `json:"created_at" db:"created_at"`
 }
 
 // OrderWithItems represents an order with its items
@@ -43,17 +78,32 @@ type OrderWithItems struct {
 // CreateOrderRequest represents the request to create an order
 type CreateOrderRequest struct {
 	CustomerID int64              `json:"customer_id" binding:"required"`
-	Items      []CreateOrderItem  `json:"items" binding:"required,min=1"`
+	Items      []CreateOrderItem  `json:"items" binding:"required,min=1,dive"`
 }
 
-// CreateOrderItem represents an item in the create order request
+// CreateOrderItem represents an item in the create order request. The price
+// is taken from the product catalog, never from the client.
 type CreateOrderItem struct {
-	ProductID int64   `json:"product_id" binding:"required"`
-	Quantity  int     `json:"quantity" binding:"required,min=1"`
-	Price     float64 `json:"price" binding:"required,min=0"`
+	ProductID int64 `json:"product_id" binding:"required"`
+	Quantity  int   `json:"quantity" binding:"required,min=1"`
 }
 
 // UpdateOrderStatusRequest represents the request to update order status
 type UpdateOrderStatusRequest struct {
-	Status OrderStatus `json:"status" binding:"required"`
+	Status OrderStatus `json:"status" binding:"required,oneof=pending processing shipped delivered cancelled"`
+	// Actor identifies who made the change, e.g. a user or service name
+	Actor  string `json:"actor" binding:"max=255"`
+	Reason string `json:"reason"`
+}
+
+// OrderStatusChange is a recorded status transition. FromStatus is nil for
+// the entry recording the order's creation.
+type OrderStatusChange struct {
+	ID         int64        `json:"id" db:"id"`
+	OrderID    int64        `json:"order_id" db:"order_id"`
+	FromStatus *OrderStatus `json:"from_status" db:"from_status"`
+	ToStatus   OrderStatus  `json:"to_status" db:"to_status"`
+	Actor      string       `json:"actor" db:"actor"`
+	Reason     string       `json:"reason" db:"reason"`
+	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
 }
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from OrderStatus
+		to   OrderStatus
+		want bool
+	}{
+		{OrderStatusPending, OrderStatusProcessing, true},
+		{OrderStatusPending, OrderStatusCancelled, true},
+		{OrderStatusPending, OrderStatusShipped, false},
+		{OrderStatusProcessing, OrderStatusShipped, true},
+		{OrderStatusProcessing, OrderStatusPending, false},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		{OrderStatusShipped, OrderStatusCancelled, false},
+		{OrderStatusDelivered, OrderStatusCancelled, false},
+		{OrderStatusCancelled, OrderStatusPending, false},
+		{OrderStatusPending, OrderStatusPending, false},
+		{OrderStatus("lost"), OrderStatusPending, false},
+		{OrderStatusPending, OrderStatus("lost"), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+			t.Errorf("%s -> %s: expected %v, got %v", tt.from, tt.to, tt.want, got)
+		}
+	}
+}
+
+func TestOrderStatusNext(t *testing.T) {
+	if got, want := OrderStatusPending.Next(), []OrderStatus{OrderStatusProcessing, OrderStatusCancelled}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := OrderStatusCancelled.Next(); len(got) != 0 || got == nil {
+		t.Errorf("Expected an empty, non-nil list for a final status, got %#v", got)
+	}
+
+	// Callers cannot modify the transition table
+	next := OrderStatusPending.Next()
+	next[0] = OrderStatusDelivered
+	if !OrderStatusPending.CanTransitionTo(OrderStatusProcessing) {
+		t.Error("Expected the transition table to be unaffected")
+	}
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/money"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last row of a page in a listing ordered by
+// (created_at, id) descending. Clients only see it encoded.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+}
+
+// Encode returns the opaque form of the cursor sent to clients
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor returned by Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 || c.CreatedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// CustomerFilter selects a page of customers
+type CustomerFilter struct {
+	// NamePrefix and EmailPrefix match case-insensitively
+	NamePrefix  string
+	EmailPrefix string
+	After       *Cursor
+	Limit       int
+	// Offset skips rows before the page. It is deprecated in favour of After.
+	Offset int
+}
+
+// OrderFilter selects a page of a customer's orders
+type OrderFilter struct {
+	Statuses      []OrderStatus
+	MinTotal      *money.Money
+	MaxTotal      *money.Money
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	After         *Cursor
+	Limit         int
+	// Offset skips rows before the page. It is deprecated in favour of After.
+	Offset int
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := Cursor{CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC), ID: 42}
+
+	got, err := DecodeCursor(want.Encode())
+	if err != nil {
+		t.Fatalf("Failed to decode cursor: %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"not base64!",
+		Cursor{}.Encode(),
+		Cursor{CreatedAt: time.Now()}.Encode(),
+		"eyJ0IjoiMjAyNCJ9", // {"t":"2024"}
+	} {
+		if _, err := DecodeCursor(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q): expected %v, got %v", s, ErrInvalidCursor, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/money"
+)
+
+// Product represents a catalog product and its stock level
+type Product struct {
+	ID          int64       `json:"id" db:"id"`
+	Name        string      `json:"name" db:"name"`
+	Description string      `json:"description" db:"description"`
+	Price       money.Money `json:"price" db:"price"`
+	Stock       int         `json:"stock" db:"stock"`
+	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// ProductRequest represents the request to create or replace a product
+type ProductRequest struct {
+	Name        string      `json:"name" binding:"required,max=255"`
+	Description string      `json:"description"`
+	Price       money.Money `json:"price"`
+	Stock       int         `json:"stock" binding:"min=0"`
+}
+
+// Validate checks the fields the binding tags cannot express
+func (r *ProductRequest) Validate() error {
+	if r.Price.IsNegative() {
+		return errors.New("price must not be negative")
+	}
+	if r.Price.Currency != "" && r.Price.Currency != money.DefaultCurrency {
+		return fmt.Errorf("price must be in %s", money.DefaultCurrency)
+	}
+	return nil
+}
+
+// StockShortage describes an order item that exceeds the available stock
+type StockShortage struct {
+	ProductID int64 `json:"product_id"`
+	Requested int   `json:"requested"`
+	Available int   `json:"available"`
+}
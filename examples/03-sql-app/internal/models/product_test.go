@@ -0,0 +1,27 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/money"
+)
+
+func TestProductRequestValidate(t *testing.T) {
+	tests := []struct {
+		price money.Money
+		valid bool
+	}{
+		{money.New(1999, money.DefaultCurrency), true},
+		{money.New(0, money.DefaultCurrency), true},
+		{money.Money{}, true},
+		{money.New(-1, money.DefaultCurrency), false},
+		{money.New(1999, "EUR"), false},
+	}
+
+	for _, tt := range tests {
+		req := ProductRequest{Name: "Widget", Price: tt.price}
+		if err := req.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Price %+v: expected valid %v, got %v", tt.price, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Package money provides an exact decimal money type. Amounts are held in
+// integer hundredths, so sums and products never drift the way float64 does,
+// and they are exchanged with Postgres as NUMERIC without going through a
+// float.
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Scale is the number of decimal places of an amount. It matches the
+// DECIMAL(10,2) columns amounts are stored in.
+const Scale = 2
+
+// DefaultCurrency is the currency of every stored amount. The database has
+// no currency columns, so changing it would relabel existing amounts.
+const DefaultCurrency = "USD"
+
+var (
+	// ErrInvalidAmount is returned for amounts that are not decimal numbers
+	// with at most Scale decimal places
+	ErrInvalidAmount = errors.New("invalid amount")
+
+	// ErrInvalidCurrency is returned for currencies that are not ISO 4217
+	// codes
+	ErrInvalidCurrency = errors.New("invalid currency")
+
+	// ErrCurrencyMismatch is returned when combining amounts in different
+	// currencies
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+
+	// ErrOverflow is returned when an amount does not fit in an int64
+	ErrOverflow = errors.New("amount out of range")
+)
+
+// Money is an amount of money in a currency
+type Money struct {
+	// Amount is in hundredths of the currency unit, e.g. cents
+	Amount int64
+	// Currency is an ISO 4217 code such as "USD"
+	Currency string
+}
+
+var (
+	amountPattern   = regexp.MustCompile(`^-?\d+(\.\d{1,` + strconv.Itoa(Scale) + `})?$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	unit            = int64(math.Pow10(Scale))
+)
+
+// New returns amount hundredths of currency
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Parse parses a decimal amount such as "12.5" or "-0.05". It rejects
+// amounts with more than Scale decimal places rather than rounding them.
+func Parse(s, currency string) (Money, error) {
+	if !currencyPattern.MatchString(currency) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidCurrency, currency)
+	}
+	if !amountPattern.MatchString(s) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	digits := whole + frac + strings.Repeat("0", Scale-len(frac))
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrOverflow, s)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// String formats the amount with Scale decimal places, without the currency
+func (m Money) String() string {
+	sign := ""
+	abs := uint64(m.Amount)
+	if m.Amount < 0 {
+		sign = "-"
+		abs = -abs
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, abs/uint64(unit), Scale, abs%uint64(unit))
+}
+
+// IsNegative reports whether the amount is below zero
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Add returns m + o. Both must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Mul returns m * n, e.g. a unit price times a quantity
+func (m Money) Mul(n int64) (Money, error) {
+	product := m.Amount * n
+	if m.Amount != 0 && (product/m.Amount != n || (m.Amount == -1 && n == math.MinInt64)) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Float64 returns the amount as a float64, for consumers of formats that
+// predate this type. Never compute with the result.
+func (m Money) Float64() float64 {
+	return float64(m.Amount) / float64(unit)
+}
+
+// ScanNumeric implements pgtype.NumericScanner. Values with more than Scale
+// decimal places, such as an AVG, are rounded half away from zero. The
+// currency is set to DefaultCurrency unless already set, so a currency can
+// be scanned into m.Currency from a separate column.
+func (m *Money) ScanNumeric(n pgtype.Numeric) error {
+	if !n.Valid {
+		return errors.New("cannot scan NULL into money.Money")
+	}
+	if n.NaN || n.InfinityModifier != pgtype.Finite {
+		return fmt.Errorf("%w: not a finite number", ErrInvalidAmount)
+	}
+
+	amount, err := round(n.Int, n.Exp)
+	if err != nil {
+		return err
+	}
+	m.Amount = amount
+	if m.Currency == "" {
+		m.Currency = DefaultCurrency
+	}
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(m.Amount), Exp: -Scale, Valid: true}, nil
+}
+
+// round converts i * 10^exp to hundredths, rounding half away from zero
+func round(i *big.Int, exp int32) (int64, error) {
+	if i == nil {
+		return 0, nil
+	}
+
+	v := new(big.Int).Set(i)
+	shift := int64(exp) + Scale
+	if shift >= 0 {
+		v.Mul(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(shift), nil))
+	} else {
+		divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(-shift), nil)
+		remainder := new(big.Int)
+		v.QuoRem(v, divisor, remainder)
+
+		// QuoRem truncates towards zero; round up the magnitude from half
+		remainder.Abs(remainder)
+		if remainder.Lsh(remainder, 1).Cmp(divisor) >= 0 {
+			v.Add(v, big.NewInt(int64(i.Sign())))
+		}
+	}
+
+	if !v.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return v.Int64(), nil
+}
+
+type moneyJSON struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// MarshalJSON encodes m as {"amount": "12.50", "currency": "USD"}. The
+// amount is a string so clients do not parse it into a float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.String(), currency})
+}
+
+// UnmarshalJSON decodes the format written by MarshalJSON. The amount may
+// also be a JSON number, and a bare string or number is an amount in
+// DefaultCurrency. Numbers are parsed from their text, never as a float.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	v := moneyJSON{Amount: data}
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+	}
+	if v.Currency == "" {
+		v.Currency = DefaultCurrency
+	}
+
+	amount := string(v.Amount)
+	if len(amount) > 0 && amount[0] == '"' {
+		if err := json.Unmarshal(v.Amount, &amount); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := Parse(amount, v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
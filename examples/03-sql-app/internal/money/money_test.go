@@ -0,0 +1,334 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+	"testing/quick"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"12", 1200},
+		{"12.5", 1250},
+		{"12.50", 1250},
+		{"-0.05", -5},
+		{"99999999.99", 9999999999},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in, "USD")
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got != New(tt.want, "USD") {
+			t.Errorf("Parse(%q): expected %d, got %+v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, s := range []string{"", "abc", "1.234", "1.", ".5", "1e2", "+1", "1,5", "0x10"} {
+		if _, err := Parse(s, "USD"); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Parse(%q): expected %v, got %v", s, ErrInvalidAmount, err)
+		}
+	}
+	if _, err := Parse("99999999999999999999", "USD"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Expected %v, got %v", ErrOverflow, err)
+	}
+	for _, c := range []string{"", "usd", "US", "USDX"} {
+		if _, err := Parse("1", c); !errors.Is(err, ErrInvalidCurrency) {
+			t.Errorf("Parse with currency %q: expected %v, got %v", c, ErrInvalidCurrency, err)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount int64
+		want   string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1250, "12.50"},
+		{math.MinInt64, "-92233720368547758.08"},
+	}
+
+	for _, tt := range tests {
+		if got := New(tt.amount, "USD").String(); got != tt.want {
+			t.Errorf("String of %d: expected %s, got %s", tt.amount, tt.want, got)
+		}
+	}
+}
+
+func TestAdd_NoDrift(t *testing.T) {
+	a, _ := Parse("0.1", "USD")
+	b, _ := Parse("0.2", "USD")
+
+	sum, err := a.Add(b)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if sum.String() != "0.30" {
+		t.Errorf("Expected 0.30, got %s", sum)
+	}
+}
+
+func TestAdd_Errors(t *testing.T) {
+	if _, err := New(1, "USD").Add(New(1, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Expected %v, got %v", ErrCurrencyMismatch, err)
+	}
+	if _, err := New(math.MaxInt64, "USD").Add(New(1, "USD")); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Expected %v, got %v", ErrOverflow, err)
+	}
+	if _, err := New(math.MinInt64, "USD").Add(New(-1, "USD")); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Expected %v, got %v", ErrOverflow, err)
+	}
+}
+
+func TestMul_Overflow(t *testing.T) {
+	for _, tt := range []struct{ amount, n int64 }{
+		{math.MaxInt64, 2},
+		{-1, math.MinInt64},
+		{math.MinInt64, -1},
+		{9999999999, math.MaxInt32 * 1000},
+	} {
+		if _, err := New(tt.amount, "USD").Mul(tt.n); !errors.Is(err, ErrOverflow) {
+			t.Errorf("%d * %d: expected %v, got %v", tt.amount, tt.n, ErrOverflow, err)
+		}
+	}
+}
+
+// Property: Mul agrees with exact big.Int arithmetic whenever it succeeds,
+// and only fails when the exact product does not fit
+func TestMul_Property(t *testing.T) {
+	f := func(amount, n int64) bool {
+		got, err := New(amount, "USD").Mul(n)
+		exact := new(big.Int).Mul(big.NewInt(amount), big.NewInt(n))
+		if !exact.IsInt64() {
+			return errors.Is(err, ErrOverflow)
+		}
+		return err == nil && got.Amount == exact.Int64()
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Property: formatting and parsing round-trip every amount
+func TestParseString_Property(t *testing.T) {
+	f := func(amount int64) bool {
+		m := New(amount, "USD")
+		got, err := Parse(m.String(), "USD")
+		return err == nil && got == m
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Property: encoding to numeric and scanning back is exact
+func TestNumeric_RoundTrip_Property(t *testing.T) {
+	f := func(amount int64) bool {
+		n, err := New(amount, "USD").NumericValue()
+		if err != nil {
+			return false
+		}
+		var got Money
+		return got.ScanNumeric(n) == nil && got == New(amount, "USD")
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// roundReference rounds i * 10^exp to hundredths, half away from zero, with
+// exact rational arithmetic
+func roundReference(i int64, exp int32) int64 {
+	r := new(big.Rat).SetInt64(i)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs32(exp))), nil))
+	if exp < 0 {
+		r.Quo(r, scale)
+	} else {
+		r.Mul(r, scale)
+	}
+	r.Mul(r, big.NewRat(100, 1))
+
+	// Add or subtract a half, then truncate towards zero
+	half := big.NewRat(1, 2)
+	if r.Sign() < 0 {
+		r.Sub(r, half)
+	} else {
+		r.Add(r, half)
+	}
+	return new(big.Int).Quo(r.Num(), r.Denom()).Int64()
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Property: scanning a numeric with any number of decimal places rounds it
+// half away from zero
+func TestScanNumeric_Rounding_Property(t *testing.T) {
+	f := func(i int32, places uint8) bool {
+		exp := -int32(places % 10)
+		var got Money
+		if err := got.ScanNumeric(pgtype.Numeric{Int: big.NewInt(int64(i)), Exp: exp, Valid: true}); err != nil {
+			return false
+		}
+		return got.Amount == roundReference(int64(i), exp)
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Property: rounding is symmetric around zero
+func TestScanNumeric_Symmetric_Property(t *testing.T) {
+	f := func(i int32, places uint8) bool {
+		exp := -int32(places % 10)
+		var pos, neg Money
+		if pos.ScanNumeric(pgtype.Numeric{Int: big.NewInt(int64(i)), Exp: exp, Valid: true}) != nil {
+			return false
+		}
+		if neg.ScanNumeric(pgtype.Numeric{Int: big.NewInt(-int64(i)), Exp: exp, Valid: true}) != nil {
+			return false
+		}
+		return pos.Amount == -neg.Amount
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScanNumeric(t *testing.T) {
+	tests := []struct {
+		i    int64
+		exp  int32
+		want int64
+	}{
+		{1250, -2, 1250},
+		{125, -1, 1250},
+		{12, 0, 1200},
+		{12, 3, 1200000},
+		{12345, -3, 1235},
+		{12344, -3, 1234},
+		{-12345, -3, -1235},
+		{5, -3, 1},
+		{-5, -3, -1},
+		{499, -5, 0},
+		{4999, -5, 5},
+	}
+
+	for _, tt := range tests {
+		var got Money
+		if err := got.ScanNumeric(pgtype.Numeric{Int: big.NewInt(tt.i), Exp: tt.exp, Valid: true}); err != nil {
+			t.Errorf("%de%d: %v", tt.i, tt.exp, err)
+			continue
+		}
+		if got != New(tt.want, DefaultCurrency) {
+			t.Errorf("%de%d: expected %d, got %+v", tt.i, tt.exp, tt.want, got)
+		}
+	}
+}
+
+func TestScanNumeric_Invalid(t *testing.T) {
+	var m Money
+	if err := m.ScanNumeric(pgtype.Numeric{}); err == nil {
+		t.Error("Expected an error scanning NULL")
+	}
+	if err := m.ScanNumeric(pgtype.Numeric{NaN: true, Valid: true}); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Expected %v for NaN, got %v", ErrInvalidAmount, err)
+	}
+	huge := new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil)
+	if err := m.ScanNumeric(pgtype.Numeric{Int: huge, Valid: true}); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Expected %v, got %v", ErrOverflow, err)
+	}
+}
+
+func TestScanNumeric_KeepsCurrency(t *testing.T) {
+	m := Money{Currency: "EUR"}
+	if err := m.ScanNumeric(pgtype.Numeric{Int: big.NewInt(1), Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+	if m != New(100, "EUR") {
+		t.Errorf("Expected 1.00 EUR, got %+v", m)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(New(1250, "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"amount":"12.50","currency":"USD"}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+
+	var m Money
+	if err := json.Unmarshal(data, &m); err != nil || m != New(1250, "USD") {
+		t.Errorf("Expected 12.50 USD, got %+v (%v)", m, err)
+	}
+}
+
+func TestUnmarshalJSON_Forms(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{`"0.30"`, New(30, DefaultCurrency)},
+		{`0.30`, New(30, DefaultCurrency)},
+		{`29.99`, New(2999, DefaultCurrency)},
+		{`{"amount": 0.1, "currency": "EUR"}`, New(10, "EUR")},
+		{`{"amount": "7"}`, New(700, DefaultCurrency)},
+	}
+
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestUnmarshalJSON_Invalid(t *testing.T) {
+	for _, s := range []string{`"abc"`, `1.005`, `1e2`, `true`, `{"amount": "1", "currency": "usd"}`, `{"amount": []}`} {
+		var m Money
+		if err := json.Unmarshal([]byte(s), &m); err == nil {
+			t.Errorf("%s: expected an error, got %+v", s, m)
+		}
+	}
+}
+
+// Property: JSON round-trips every amount
+func TestJSON_Property(t *testing.T) {
+	f := func(amount int64) bool {
+		data, err := json.Marshal(New(amount, "EUR"))
+		if err != nil {
+			return false
+		}
+		var got Money
+		return json.Unmarshal(data, &got) == nil && got == New(amount, "EUR")
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,115 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/models"
+)
+
+// OrderEventType represents the type of order event
+type OrderEventType string
+
+// Order event types and the topics they are published to. They match the
+// Kafka streaming example, so its consumers can process the SQL app's orders.
+const (
+	OrderCreated   OrderEventType = "order.created"
+	OrderUpdated   OrderEventType = "order.updated"
+	OrderCancelled OrderEventType = "order.cancelled"
+)
+
+var orderTopics = map[OrderEventType]string{
+	OrderCreated:   "orders.created",
+	OrderUpdated:   "orders.updated",
+	OrderCancelled: "orders.cancelled",
+}
+
+// orderEventVersion is the version of the OrderEvent schema
+const orderEventVersion = 1
+
+// OrderEvent is an order event in the Kafka streaming example's format.
+// That format has float amounts; the currency is in the metadata.
+type OrderEvent struct {
+	ID         string           `json:"id"`
+	Type       OrderEventType   `json:"type"`
+	OrderID    string           `json:"order_id"`
+	CustomerID string           `json:"customer_id"`
+	Status     string           `json:"status"`
+	Total      float64          `json:"total"`
+	Items      []OrderEventItem `json:"items,omitempty"`
+	Timestamp  time.Time        `json:"timestamp"`
+	Version    int              `json:"version"`
+	Metadata   map[string]any   `json:"metadata,omitempty"`
+}
+
+// OrderEventItem represents an item in an order event
+type OrderEventItem struct {
+	ProductID string  `json:"product_id"`
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	Price     float64 `json:"price"`
+}
+
+// NewOrderEvent describes the state of an order after a status change. The
+// status change ID doubles as the event ID, so redelivered events can be
+// recognised.
+func NewOrderEvent(order *models.Order, items []OrderEventItem, change *models.OrderStatusChange) *OrderEvent {
+	eventType := OrderUpdated
+	switch {
+	case change.FromStatus == nil:
+		eventType = OrderCreated
+	case change.ToStatus == models.OrderStatusCancelled:
+		eventType = OrderCancelled
+	}
+
+	metadata := map[string]any{
+		"actor":    change.Actor,
+		"currency": order.Total.Currency,
+	}
+	if change.FromStatus != nil {
+		metadata["previous_status"] = string(*change.FromStatus)
+	}
+	if change.Reason != "" {
+		metadata["reason"] = change.Reason
+	}
+
+	return &OrderEvent{
+		ID:         strconv.FormatInt(change.ID, 10),
+		Type:       eventType,
+		OrderID:    strconv.FormatInt(order.ID, 10),
+		CustomerID: strconv.FormatInt(order.CustomerID, 10),
+		Status:     string(change.ToStatus),
+		Total:      order.Total.Float64(),
+		Items:      items,
+		Timestamp:  change.CreatedAt,
+		Version:    orderEventVersion,
+		Metadata:   metadata,
+	}
+}
+
+// Message converts the event to an outbox message keyed by order ID, so all
+// events for an order land on the same partition
+func (e *OrderEvent) Message() (Message, error) {
+	topic, ok := orderTopics[e.Type]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown event type: %s", e.Type)
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	return Message{
+		Topic:   topic,
+		Key:     e.OrderID,
+		Payload: payload,
+		Headers: map[string]string{
+			"event-type": string(e.Type),
+			"event-id":   e.ID,
+			"version":    strconv.Itoa(e.Version),
+		},
+	}, nil
+}
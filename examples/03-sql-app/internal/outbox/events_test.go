@@ -0,0 +1,83 @@
+package outbox
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/models"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/money"
+)
+
+func TestNewOrderEvent(t *testing.T) {
+	pending := models.OrderStatusPending
+	processing := models.OrderStatusProcessing
+	order := &models.Order{ID: 7, CustomerID: 3, Total: money.New(5997, "USD")}
+
+	tests := []struct {
+		name      string
+		from      *models.OrderStatus
+		to        models.OrderStatus
+		wantType  OrderEventType
+		wantTopic string
+	}{
+		{name: "created", from: nil, to: pending, wantType: OrderCreated, wantTopic: "orders.created"},
+		{name: "updated", from: &pending, to: processing, wantType: OrderUpdated, wantTopic: "orders.updated"},
+		{name: "cancelled", from: &processing, to: models.OrderStatusCancelled, wantType: OrderCancelled, wantTopic: "orders.cancelled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change := &models.OrderStatusChange{
+				ID:         42,
+				OrderID:    order.ID,
+				FromStatus: tt.from,
+				ToStatus:   tt.to,
+				Actor:      "alice",
+				CreatedAt:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			}
+			items := []OrderEventItem{{ProductID: "1", Name: "Widget", Quantity: 3, Price: 19.99}}
+
+			msg, err := NewOrderEvent(order, items, change).Message()
+			if err != nil {
+				t.Fatalf("Failed to build message: %v", err)
+			}
+			if msg.Topic != tt.wantTopic {
+				t.Errorf("Expected topic %s, got %s", tt.wantTopic, msg.Topic)
+			}
+			if msg.Key != "7" {
+				t.Errorf("Expected key 7, got %s", msg.Key)
+			}
+			if msg.Headers["event-type"] != string(tt.wantType) || msg.Headers["event-id"] != "42" {
+				t.Errorf("Unexpected headers %v", msg.Headers)
+			}
+
+			var event OrderEvent
+			if err := json.Unmarshal(msg.Payload, &event); err != nil {
+				t.Fatalf("Failed to unmarshal payload: %v", err)
+			}
+			if event.ID != "42" || event.Type != tt.wantType || event.OrderID != "7" || event.CustomerID != "3" {
+				t.Errorf("Unexpected event %+v", event)
+			}
+			if event.Status != string(tt.to) || event.Total != 59.97 || event.Version != 1 {
+				t.Errorf("Unexpected event %+v", event)
+			}
+			if len(event.Items) != 1 || event.Items[0] != items[0] {
+				t.Errorf("Expected items %v, got %v", items, event.Items)
+			}
+			if event.Metadata["currency"] != "USD" {
+				t.Errorf("Expected currency USD in metadata %v", event.Metadata)
+			}
+			if _, ok := event.Metadata["previous_status"]; ok != (tt.from != nil) {
+				t.Errorf("Unexpected metadata %v", event.Metadata)
+			}
+		})
+	}
+}
+
+func TestOrderEventMessage_UnknownType(t *testing.T) {
+	event := &OrderEvent{ID: "1", Type: "order.lost", OrderID: "1"}
+	if _, err := event.Message(); err == nil {
+		t.Error("Expected an error for an unknown event type")
+	}
+}
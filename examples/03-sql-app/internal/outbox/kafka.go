@@ -0,0 +1,78 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher publishes outbox messages to Kafka
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaPublisher creates a publisher for the given brokers. Each message is
+// written to its own topic and partitioned by key.
+func NewKafkaPublisher(brokers []string) *KafkaPublisher {
+	return &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Balancer:     &kafka.Hash{}, // Hash balancer for partition by key
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+		},
+	}
+}
+
+// Publish writes msgs to Kafka in a single call and waits for all in-sync
+// replicas to acknowledge them
+func (p *KafkaPublisher) Publish(ctx context.Context, msgs []Message) error {
+	batch := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		batch[i] = kafka.Message{
+			Topic:   msg.Topic,
+			Key:     []byte(msg.Key),
+			Value:   msg.Payload,
+			Time:    msg.CreatedAt,
+			Headers: kafkaHeaders(msg.Headers),
+		}
+	}
+
+	switch err := p.writer.WriteMessages(ctx, batch...).(type) {
+	case nil:
+		return nil
+	case kafka.WriteErrors:
+		errs := make(PublishErrors, len(msgs))
+		for i, msgErr := range err {
+			if msgErr != nil {
+				errs[i] = fmt.Errorf("failed to write message to topic %s: %w", msgs[i].Topic, msgErr)
+			}
+		}
+		return errs
+	default:
+		return fmt.Errorf("failed to write %d messages: %w", len(msgs), err)
+	}
+}
+
+// kafkaHeaders converts headers to Kafka headers, sorted by key
+func kafkaHeaders(h map[string]string) []kafka.Header {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	headers := make([]kafka.Header, 0, len(keys))
+	for _, key := range keys {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(h[key])})
+	}
+	return headers
+}
+
+// Close flushes and closes the underlying writer
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,66 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryPublisher records published messages in memory. It is intended for
+// tests.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []Message
+	batches  int
+	fail     func(Message) error
+}
+
+// NewMemoryPublisher creates a new in-memory publisher
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+// Publish records msgs, except those the function set by FailWith returns
+// an error for
+func (p *MemoryPublisher) Publish(ctx context.Context, msgs []Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.batches++
+	errs := make(PublishErrors, len(msgs))
+	failed := false
+	for i, msg := range msgs {
+		if p.fail != nil {
+			if errs[i] = p.fail(msg); errs[i] != nil {
+				failed = true
+				continue
+			}
+		}
+		p.messages = append(p.messages, msg)
+	}
+	if failed {
+		return errs
+	}
+	return nil
+}
+
+// FailWith makes Publish return the error fn returns for a message. A nil fn
+// makes every message succeed again.
+func (p *MemoryPublisher) FailWith(fn func(Message) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fail = fn
+}
+
+// Batches returns the number of times Publish has been called
+func (p *MemoryPublisher) Batches() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.batches
+}
+
+// Messages returns the messages published so far, in publication order
+func (p *MemoryPublisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
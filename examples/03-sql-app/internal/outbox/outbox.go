@@ -0,0 +1,81 @@
+// Package outbox implements the transactional outbox pattern. Messages are
+// written to the outbox table in the same transaction as the change they
+// describe, and a Relay publishes them afterwards, so a message is sent if
+// and only if its transaction commits.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Message is a message stored in the outbox
+type Message struct {
+	ID        int64
+	Topic     string
+	Key       string
+	Payload   []byte
+	Headers   map[string]string
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// Publisher delivers outbox messages to a broker. Publish sends a batch in
+// one round trip and must only return nil once the broker has accepted every
+// message. When only some messages fail it returns PublishErrors; any other
+// error fails the whole batch. Messages may be delivered more than once, so
+// consumers should deduplicate by event ID.
+type Publisher interface {
+	Publish(ctx context.Context, msgs []Message) error
+}
+
+// PublishErrors reports the outcome of each message of a partially
+// published batch. It has one entry per message, nil for those delivered.
+type PublishErrors []error
+
+func (e PublishErrors) Error() string {
+	failed := 0
+	for _, err := range e {
+		if err != nil {
+			failed++
+		}
+	}
+	return fmt.Sprintf("failed to publish %d of %d messages", failed, len(e))
+}
+
+// errorAt returns the error for message i of a batch that Publish returned
+// err for
+func errorAt(err error, i int) error {
+	if errs, ok := err.(PublishErrors); ok {
+		return errs[i]
+	}
+	return err
+}
+
+// Enqueue writes msg to the outbox as part of tx. It is published after tx
+// commits and discarded if tx rolls back.
+func Enqueue(ctx context.Context, tx pgx.Tx, msg Message) error {
+	headers := msg.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	query := `
+		INSERT INTO outbox (topic, key, payload, headers)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	if _, err := tx.Exec(ctx, query, msg.Topic, msg.Key, msg.Payload, headersJSON); err != nil {
+		return fmt.Errorf("failed to enqueue message: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Config holds relay configuration. Zero values are replaced by defaults.
+type Config struct {
+	// PollInterval is how long to wait after finding no messages
+	PollInterval time.Duration
+	// BatchSize is the maximum number of messages claimed at once
+	BatchSize int
+	// MinBackoff is the delay before retrying a failed message. It doubles
+	// with each further failure, up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.PollInterval <= 0 {
+		c.PollInterval = 500 * time.Millisecond
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = time.Second
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = max(5*time.Minute, c.MinBackoff)
+	}
+	return c
+}
+
+// backoff returns the delay before the next attempt after the given number
+// of failed attempts
+func (c Config) backoff(failures int) time.Duration {
+	delay := c.MinBackoff
+	for i := 1; i < failures && delay < c.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, c.MaxBackoff)
+}
+
+// Relay publishes outbox messages. Any number of relays may run against the
+// same database: each claims a batch with FOR UPDATE SKIP LOCKED and holds
+// the lock until the batch is published, so a message is only redelivered if
+// a relay stops between publishing it and marking it sent. Messages with the
+// same key are published in the order they were written.
+type Relay struct {
+	db        *pgxpool.Pool
+	publisher Publisher
+	cfg       Config
+}
+
+// NewRelay creates a new outbox relay
+func NewRelay(db *pgxpool.Pool, publisher Publisher, cfg Config) *Relay {
+	return &Relay{db: db, publisher: publisher, cfg: cfg.withDefaults()}
+}
+
+// Run publishes messages until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		n, err := r.ProcessBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Outbox relay failed: %v", err)
+		}
+
+		// Keep going while there is work, since each batch only holds the
+		// oldest unsent message of each key
+		if n > 0 && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.cfg.PollInterval):
+		}
+	}
+}
+
+// ProcessBatch claims a batch of due messages, publishes them with a single
+// Publish call, and marks them sent. Messages that fail to publish are
+// scheduled for a retry. It returns the number of messages claimed.
+func (r *Relay) ProcessBatch(ctx context.Context) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// A message is only due once every earlier message with its key is sent,
+	// which keeps each key in order even when an earlier message is backing
+	// off or claimed by another relay
+	claimQuery := `
+		SELECT id, topic, key, payload, headers, attempts, created_at
+		FROM outbox o
+		WHERE sent_at IS NULL
+			AND next_attempt_at <= CURRENT_TIMESTAMP
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox e
+				WHERE e.key = o.key AND e.sent_at IS NULL AND e.id < o.id
+			)
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := tx.Query(ctx, claimQuery, r.cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim messages: %w", err)
+	}
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		var headers []byte
+		if err := rows.Scan(&msg.ID, &msg.Topic, &msg.Key, &msg.Payload, &headers, &msg.Attempts, &msg.CreatedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan message: %w", err)
+		}
+		if err := json.Unmarshal(headers, &msg.Headers); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to unmarshal headers of message %d: %w", msg.ID, err)
+		}
+		messages = append(messages, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating messages: %w", err)
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	retryQuery := `
+		UPDATE outbox
+		SET attempts = attempts + 1,
+			last_error = $2,
+			next_attempt_at = CURRENT_TIMESTAMP + $3::float8 * INTERVAL '1 second'
+		WHERE id = $1
+	`
+
+	publishErr := r.publisher.Publish(ctx, messages)
+	if publishErr != nil && ctx.Err() != nil {
+		// Shutting down: leave the batch to the next relay
+		return len(messages), ctx.Err()
+	}
+
+	var sent []int64
+	for i, msg := range messages {
+		err := errorAt(publishErr, i)
+		if err == nil {
+			sent = append(sent, msg.ID)
+			continue
+		}
+
+		delay := r.cfg.backoff(msg.Attempts + 1)
+		log.Printf("Failed to publish outbox message %d to %s (attempt %d), retrying in %s: %v",
+			msg.ID, msg.Topic, msg.Attempts+1, delay, err)
+		if _, err := tx.Exec(ctx, retryQuery, msg.ID, err.Error(), delay.Seconds()); err != nil {
+			return len(messages), fmt.Errorf("failed to schedule retry of message %d: %w", msg.ID, err)
+		}
+	}
+
+	if len(sent) > 0 {
+		if _, err := tx.Exec(ctx, `UPDATE outbox SET sent_at = CURRENT_TIMESTAMP WHERE id = ANY($1)`, sent); err != nil {
+			return len(messages), fmt.Errorf("failed to mark messages sent: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return len(messages), fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(messages), nil
+}
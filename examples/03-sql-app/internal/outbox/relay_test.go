@@ -0,0 +1,90 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	cfg := Config{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}.withDefaults()
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := cfg.backoff(tt.failures); got != tt.want {
+			t.Errorf("After %d failures: expected %s, got %s", tt.failures, tt.want, got)
+		}
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg := Config{}.withDefaults()
+	if cfg.PollInterval <= 0 || cfg.BatchSize <= 0 || cfg.MinBackoff <= 0 || cfg.MaxBackoff < cfg.MinBackoff {
+		t.Errorf("Unexpected defaults %+v", cfg)
+	}
+
+	cfg = Config{MinBackoff: time.Hour}.withDefaults()
+	if cfg.MaxBackoff != time.Hour {
+		t.Errorf("Expected the maximum backoff to be raised to the minimum, got %s", cfg.MaxBackoff)
+	}
+}
+
+func TestMemoryPublisher(t *testing.T) {
+	ctx := context.Background()
+	publisher := NewMemoryPublisher()
+	errDown := errors.New("broker down")
+
+	publisher.FailWith(func(msg Message) error {
+		if msg.Key == "2" {
+			return errDown
+		}
+		return nil
+	})
+	err := publisher.Publish(ctx, []Message{{ID: 1, Key: "1"}, {ID: 2, Key: "2"}})
+	if errorAt(err, 0) != nil || !errors.Is(errorAt(err, 1), errDown) {
+		t.Fatalf("Expected only message 2 to fail with %v, got %v", errDown, err)
+	}
+
+	publisher.FailWith(nil)
+	if err := publisher.Publish(ctx, []Message{{ID: 2, Key: "2"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := publisher.Messages()
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 2 {
+		t.Errorf("Unexpected messages %+v", got)
+	}
+	if publisher.Batches() != 2 {
+		t.Errorf("Expected 2 batches, got %d", publisher.Batches())
+	}
+}
+
+func TestErrorAt(t *testing.T) {
+	errDown := errors.New("broker down")
+	if err := errorAt(errDown, 3); err != errDown {
+		t.Errorf("Expected a batch error to apply to every message, got %v", err)
+	}
+	if errorAt(nil, 0) != nil {
+		t.Error("Expected no error for a published batch")
+	}
+
+	errs := PublishErrors{nil, errDown}
+	if errorAt(errs, 0) != nil || errorAt(errs, 1) != errDown {
+		t.Errorf("Expected per-message errors, got %v and %v", errorAt(errs, 0), errorAt(errs, 1))
+	}
+	if errs.Error() != "failed to publish 1 of 2 messages" {
+		t.Errorf("Unexpected message %q", errs.Error())
+	}
+}
@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/raibid-labs/mop/examples/03-sql-app/internal/models"
 )
@@ -29,25 +31,25 @@ func (r *CustomerRepository) Create(ctx context.Context, customer *models.Custom
 	err := r.db.QueryRow(ctx, query, customer.Name, customer.Email).
 		Scan(&customer.ID, &customer.CreatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to create customer: %w", err)
+		return fmt.Errorf("failed to create customer: %w", classify(err))
 	}
 
 	return nil
 }
 
-// GetByID retrieves a customer by ID
+// GetByID retrieves a customer by ID. Deleted customers are not found.
 func (r *CustomerRepository) GetByID(ctx context.Context, id int64) (*models.Customer, error) {
 	query := `
 		SELECT id, name, email, created_at
 		FROM customers
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	var customer models.Customer
 	err := r.db.QueryRow(ctx, query, id).
 		Scan(&customer.ID, &customer.Name, &customer.Email, &customer.CreatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get customer: %w", err)
+		return nil, fmt.Errorf("failed to get customer: %w", classify(err))
 	}
 
 	return &customer, nil
@@ -58,31 +60,33 @@ func (r *CustomerRepository) GetByEmail(ctx context.Context, email string) (*mod
 	query := `
 		SELECT id, name, email, created_at
 		FROM customers
-		WHERE email = $1
+		WHERE email = $1 AND deleted_at IS NULL
 	`
 
 	var customer models.Customer
 	err := r.db.QueryRow(ctx, query, email).
 		Scan(&customer.ID, &customer.Name, &customer.Email, &customer.CreatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get customer by email: %w", err)
+		return nil, fmt.Errorf("failed to get customer by email: %w", classify(err))
 	}
 
 	return &customer, nil
 }
 
-// List retrieves all customers with pagination
+// List retrieves customers with LIMIT/OFFSET pagination. Deep pages get
+// slower as the offset grows; ListPage is the keyset alternative.
 func (r *CustomerRepository) List(ctx context.Context, limit, offset int) ([]models.Customer, error) {
 	query := `
 		SELECT id, name, email, created_at
 		FROM customers
+		WHERE deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
 	`
 
 	rows, err := r.db.Query(ctx, query, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list customers: %w", err)
+		return nil, fmt.Errorf("failed to list customers: %w", classify(err))
 	}
 	defer rows.Close()
 
@@ -90,14 +94,170 @@ func (r *CustomerRepository) List(ctx context.Context, limit, offset int) ([]mod
 	for rows.Next() {
 		var customer models.Customer
 		if err := rows.Scan(&customer.ID, &customer.Name, &customer.Email, &customer.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan customer: %w", err)
+			return nil, fmt.Errorf("failed to scan customer: %w", classify(err))
 		}
 		customers = append(customers, customer)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating customers: %w", err)
+		return nil, fmt.Errorf("error iterating customers: %w", classify(err))
 	}
 
 	return customers, nil
 }
+
+// ListPage retrieves a page of active customers, newest first, using keyset
+// pagination on (created_at, id). It returns a cursor for the next page, or
+// nil if this is the last one.
+func (r *CustomerRepository) ListPage(ctx context.Context, filter models.CustomerFilter) ([]models.Customer, *models.Cursor, error) {
+	var where conditions
+	where.add("deleted_at IS NULL")
+	if filter.NamePrefix != "" {
+		where.add("lower(name) LIKE " + where.arg(likePrefix(strings.ToLower(filter.NamePrefix))))
+	}
+	if filter.EmailPrefix != "" {
+		where.add("lower(email) LIKE " + where.arg(likePrefix(strings.ToLower(filter.EmailPrefix))))
+	}
+	if filter.After != nil {
+		where.add(fmt.Sprintf("(created_at, id) < (%s::timestamptz, %s::bigint)", where.arg(filter.After.CreatedAt), where.arg(filter.After.ID)))
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	query := `
+		SELECT id, name, email, created_at
+		FROM customers
+		` + where.where() + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + where.arg(filter.Limit+1)
+	if filter.Offset > 0 {
+		query += " OFFSET " + where.arg(filter.Offset)
+	}
+
+	rows, err := r.db.Query(ctx, query, where.args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list customers: %w", classify(err))
+	}
+	defer rows.Close()
+
+	customers := []models.Customer{}
+	for rows.Next() {
+		var customer models.Customer
+		if err := rows.Scan(&customer.ID, &customer.Name, &customer.Email, &customer.CreatedAt); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan customer: %w", classify(err))
+		}
+		customers = append(customers, customer)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating customers: %w", classify(err))
+	}
+
+	if len(customers) <= filter.Limit {
+		return customers, nil, nil
+	}
+	customers = customers[:filter.Limit]
+	last := customers[len(customers)-1]
+	return customers, &models.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
+
+// Update changes the non-nil fields of patch and returns the updated
+// customer. Deleted customers are not found.
+func (r *CustomerRepository) Update(ctx context.Context, id int64, patch *models.CustomerPatch) (*models.Customer, error) {
+	query := `
+		UPDATE customers
+		SET name = COALESCE($2, name),
+			email = COALESCE($3, email)
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, name, email, created_at
+	`
+
+	var customer models.Customer
+	err := r.db.QueryRow(ctx, query, id, patch.Name, patch.Email).
+		Scan(&customer.ID, &customer.Name, &customer.Email, &customer.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update customer: %w", classify(err))
+	}
+
+	return &customer, nil
+}
+
+// Delete soft-deletes a customer. Their orders are kept, and their email
+// becomes available to new customers.
+func (r *CustomerRepository) Delete(ctx context.Context, id int64) error {
+	query := `
+		UPDATE customers
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id
+	`
+
+	if err := r.db.QueryRow(ctx, query, id).Scan(&id); err != nil {
+		return fmt.Errorf("failed to delete customer: %w", classify(err))
+	}
+
+	return nil
+}
+
+// Erase pseudonymizes a customer's name and email and soft-deletes them, so
+// their orders can be kept for accounting without identifying them. Erasing
+// works on deleted customers, and erasing twice is harmless.
+func (r *CustomerRepository) Erase(ctx context.Context, id int64) (*models.Customer, error) {
+	query := `
+		UPDATE customers
+		SET name = 'Erased customer',
+			email = 'erased-' || id || '@erased.invalid',
+			deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP),
+			erased_at = COALESCE(erased_at, CURRENT_TIMESTAMP)
+		WHERE id = $1
+		RETURNING id, name, email, created_at, deleted_at, erased_at
+	`
+
+	var customer models.Customer
+	err := r.db.QueryRow(ctx, query, id).
+		Scan(&customer.ID, &customer.Name, &customer.Email, &customer.CreatedAt, &customer.DeletedAt, &customer.ErasedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase customer: %w", classify(err))
+	}
+
+	return &customer, nil
+}
+
+// Export reads a customer and all their orders with items from one
+// snapshot. Deleted customers can be exported too, since their data is still
+// held; erased customers export their pseudonymized details.
+func (r *CustomerRepository) Export(ctx context.Context, id int64) (*models.CustomerExport, error) {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback(ctx)
+
+	var export models.CustomerExport
+	customerQuery := `
+		SELECT id, name, email, created_at, deleted_at, erased_at, CURRENT_TIMESTAMP
+		FROM customers
+		WHERE id = $1
+	`
+
+	c := &export.Customer
+	err = tx.QueryRow(ctx, customerQuery, id).
+		Scan(&c.ID, &c.Name, &c.Email, &c.CreatedAt, &c.DeletedAt, &c.ErasedAt, &export.ExportedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer: %w", classify(err))
+	}
+
+	ordersQuery := ordersWithItemsQuery + `
+		ORDER BY o.created_at, o.id
+	`
+
+	rows, err := tx.Query(ctx, ordersQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", classify(err))
+	}
+
+	if export.Orders, err = scanOrdersWithItems(rows); err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
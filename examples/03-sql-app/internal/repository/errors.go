@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Kinds of database errors. Repository errors wrap one of them, so callers
+// can test with errors.Is regardless of the underlying driver error.
+var (
+	ErrNotFound             = errors.New("not found")
+	ErrUniqueViolation      = errors.New("unique violation")
+	ErrForeignKeyViolation  = errors.New("foreign key violation")
+	ErrCheckViolation       = errors.New("check violation")
+	ErrSerializationFailure = errors.New("serialization failure")
+	ErrTimeout              = errors.New("database timeout")
+	ErrUnavailable          = errors.New("database unavailable")
+)
+
+// Error is a database error classified by kind
+type Error struct {
+	// Kind is one of the Err* sentinels
+	Kind error
+	// Constraint names the violated constraint, if any
+	Constraint string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap exposes both the kind and the driver error to errors.Is/As
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// classify wraps err in an *Error if its kind is known, based on the
+// SQLSTATE code for errors reported by PostgreSQL
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return &Error{Kind: ErrNotFound, Err: err}
+	case errors.As(err, &pgErr):
+		if kind := kindOf(pgErr.Code); kind != nil {
+			return &Error{Kind: kind, Constraint: pgErr.ConstraintName, Err: err}
+		}
+		return err
+	case errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err):
+		return &Error{Kind: ErrTimeout, Err: err}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return &Error{Kind: ErrUnavailable, Err: err}
+	}
+	return err
+}
+
+func kindOf(code string) error {
+	switch code {
+	case "23505": // unique_violation
+		return ErrUniqueViolation
+	case "23503": // foreign_key_violation
+		return ErrForeignKeyViolation
+	case "23514", "23502", "22003": // check_violation, not_null_violation, numeric_value_out_of_range
+		return ErrCheckViolation
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		return ErrSerializationFailure
+	case "57014", "55P03": // query_canceled (statement_timeout), lock_not_available
+		return ErrTimeout
+	case "57P01", "57P03", "53300": // admin_shutdown, cannot_connect_now, too_many_connections
+		return ErrUnavailable
+	}
+	if strings.HasPrefix(code, "08") { // connection_exception
+		return ErrUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestClassify(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	plain := errors.New("boom")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "no rows", err: pgx.ErrNoRows, want: ErrNotFound},
+		{name: "wrapped no rows", err: fmt.Errorf("scan: %w", pgx.ErrNoRows), want: ErrNotFound},
+		{name: "unique", err: &pgconn.PgError{Code: "23505"}, want: ErrUniqueViolation},
+		{name: "foreign key", err: &pgconn.PgError{Code: "23503"}, want: ErrForeignKeyViolation},
+		{name: "check", err: &pgconn.PgError{Code: "23514"}, want: ErrCheckViolation},
+		{name: "not null", err: &pgconn.PgError{Code: "23502"}, want: ErrCheckViolation},
+		{name: "numeric out of range", err: &pgconn.PgError{Code: "22003"}, want: ErrCheckViolation},
+		{name: "serialization", err: &pgconn.PgError{Code: "40001"}, want: ErrSerializationFailure},
+		{name: "deadlock", err: &pgconn.PgError{Code: "40P01"}, want: ErrSerializationFailure},
+		{name: "statement timeout", err: &pgconn.PgError{Code: "57014"}, want: ErrTimeout},
+		{name: "lock timeout", err: &pgconn.PgError{Code: "55P03"}, want: ErrTimeout},
+		{name: "context deadline", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: ErrTimeout},
+		{name: "connection exception", err: &pgconn.PgError{Code: "08006"}, want: ErrUnavailable},
+		{name: "too many connections", err: &pgconn.PgError{Code: "53300"}, want: ErrUnavailable},
+		{name: "connection refused", err: refused, want: ErrUnavailable},
+		{name: "syntax error", err: &pgconn.PgError{Code: "42601"}, want: nil},
+		{name: "unknown", err: plain, want: nil},
+	}
+
+	kinds := []error{ErrNotFound, ErrUniqueViolation, ErrForeignKeyViolation, ErrCheckViolation, ErrSerializationFailure, ErrTimeout, ErrUnavailable}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classify(tt.err)
+			if !errors.Is(got, tt.err) {
+				t.Errorf("Expected the original error to be preserved, got %v", got)
+			}
+			for _, kind := range kinds {
+				if is := errors.Is(got, kind); is != (kind == tt.want) {
+					t.Errorf("errors.Is(classify(err), %v) = %v", kind, is)
+				}
+			}
+		})
+	}
+
+	if classify(nil) != nil {
+		t.Error("Expected classify(nil) to be nil")
+	}
+}
+
+func TestClassify_Constraint(t *testing.T) {
+	err := fmt.Errorf("failed to create customer: %w", classify(&pgconn.PgError{Code: "23505", ConstraintName: "customers_email_key"}))
+
+	var dbErr *Error
+	if !errors.As(err, &dbErr) || dbErr.Constraint != "customers_email_key" {
+		t.Errorf("Expected the constraint name, got %+v", dbErr)
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		t.Error("Expected the PgError to remain reachable")
+	}
+}
@@ -2,11 +2,16 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/raibid-labs/mop/examples/03-sql-app/internal/models"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/money"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/outbox"
 )
 
 // OrderRepository handles order data operations
@@ -19,18 +24,143 @@ func NewOrderRepository(db *pgxpool.Pool) *OrderRepository {
 	return &OrderRepository{db: db}
 }
 
-// Create creates a new order with items in a transaction
+// UnknownProductsError is returned when an order references products that
+// do not exist
+type UnknownProductsError struct {
+	ProductIDs []int64
+}
+
+func (e *UnknownProductsError) Error() string {
+	return fmt.Sprintf("unknown products %v", e.ProductIDs)
+}
+
+// InsufficientStockError is returned when order items exceed the available
+// stock. No stock is reserved when it is returned.
+type InsufficientStockError struct {
+	Items []models.StockShortage
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock for %d products", len(e.Items))
+}
+
+// Create creates a new order with items in a transaction. Prices are read
+// from the product catalog and stock is decremented in the same
+// transaction, so concurrent orders can never oversell a product. An
+// order.created event is written to the outbox before committing. The
+// customer must exist and not be deleted.
 func (r *OrderRepository) Create(ctx context.Context, req *models.CreateOrderRequest) (*models.OrderWithItems, error) {
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
 	}
 	defer tx.Rollback(ctx)
 
-	// Calculate total
-	var total float64
+	// Deleted customers cannot order. The share lock keeps the customer from
+	// being deleted until the order commits.
+	var active int
+	err = tx.QueryRow(ctx, `SELECT 1 FROM customers WHERE id = $1 AND deleted_at IS NULL FOR SHARE`, req.CustomerID).Scan(&active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &Error{Kind: ErrForeignKeyViolation, Err: fmt.Errorf("customer %d does not exist", req.CustomerID)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock customer: %w", classify(err))
+	}
+
+	// Sum quantities per product, since an order may list a product twice
+	quantities := make(map[int64]int)
+	var productIDs []int64
+	for _, item := range req.Items {
+		if _, ok := quantities[item.ProductID]; !ok {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+	sort.Slice(productIDs, func(i, j int) bool { return productIDs[i] < productIDs[j] })
+
+	// Lock the products in ID order, so concurrent orders for overlapping
+	// products wait for each other instead of deadlocking
+	productsQuery := `
+		SELECT id, name, price, stock
+		FROM products
+		WHERE id = ANY($1)
+		ORDER BY id
+		FOR UPDATE
+	`
+
+	rows, err := tx.Query(ctx, productsQuery, productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock products: %w", classify(err))
+	}
+	names := make(map[int64]string, len(productIDs))
+	prices := make(map[int64]money.Money, len(productIDs))
+	stock := make(map[int64]int, len(productIDs))
+	for rows.Next() {
+		var id int64
+		var name string
+		var price money.Money
+		var available int
+		if err := rows.Scan(&id, &name, &price, &available); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan product: %w", classify(err))
+		}
+		names[id] = name
+		prices[id] = price
+		stock[id] = available
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating products: %w", classify(err))
+	}
+
+	var unknown []int64
+	var shortages []models.StockShortage
+	for _, id := range productIDs {
+		available, ok := stock[id]
+		switch {
+		case !ok:
+			unknown = append(unknown, id)
+		case available < quantities[id]:
+			shortages = append(shortages, models.StockShortage{
+				ProductID: id,
+				Requested: quantities[id],
+				Available: available,
+			})
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, &UnknownProductsError{ProductIDs: unknown}
+	}
+	if len(shortages) > 0 {
+		return nil, &InsufficientStockError{Items: shortages}
+	}
+
+	// Decrement stock for all products in one statement
+	counts := make([]int, len(productIDs))
+	for i, id := range productIDs {
+		counts[i] = quantities[id]
+	}
+	stockQuery := `
+		UPDATE products AS p
+		SET stock = p.stock - d.quantity
+		FROM unnest($1::bigint[], $2::int[]) AS d(id, quantity)
+		WHERE p.id = d.id
+	`
+
+	if _, err := tx.Exec(ctx, stockQuery, productIDs, counts); err != nil {
+		return nil, fmt.Errorf("failed to decrement stock: %w", classify(err))
+	}
+
+	// Calculate total in exact decimal arithmetic
+	total := money.New(0, money.DefaultCurrency)
 	for _, item := range req.Items {
-		total += item.Price * float64(item.Quantity)
+		subtotal, err := prices[item.ProductID].Mul(int64(item.Quantity))
+		if err == nil {
+			total, err = total.Add(subtotal)
+		}
+		if err != nil {
+			return nil, &Error{Kind: ErrCheckViolation, Err: fmt.Errorf("failed to calculate order total: %w", err)}
+		}
 	}
 
 	// Create order
@@ -44,11 +174,12 @@ func (r *OrderRepository) Create(ctx context.Context, req *models.CreateOrderReq
 	err = tx.QueryRow(ctx, orderQuery, req.CustomerID, models.OrderStatusPending, total).
 		Scan(&order.ID, &order.CustomerID, &order.Status, &order.Total, &order.CreatedAt, &order.UpdatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create order: %w", err)
+		return nil, fmt.Errorf("failed to create order: %w", classify(err))
 	}
 
 	// Create order items
 	items := make([]models.OrderItem, 0, len(req.Items))
+	eventItems := make([]outbox.OrderEventItem, 0, len(req.Items))
 	itemQuery := `
 		INSERT INTO order_items (order_id, product_id, quantity, price)
 		VALUES ($1, $2, $3, $4)
@@ -57,16 +188,31 @@ func (r *OrderRepository) Create(ctx context.Context, req *models.CreateOrderReq
 
 	for _, reqItem := range req.Items {
 		var item models.OrderItem
-		err = tx.QueryRow(ctx, itemQuery, order.ID, reqItem.ProductID, reqItem.Quantity, reqItem.Price).
+		err = tx.QueryRow(ctx, itemQuery, order.ID, reqItem.ProductID, reqItem.Quantity, prices[reqItem.ProductID]).
 			Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.Price, &item.CreatedAt)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create order item: %w", err)
+			return nil, fmt.Errorf("failed to create order item: %w", classify(err))
 		}
 		items = append(items, item)
+		eventItems = append(eventItems, outbox.OrderEventItem{
+			ProductID: strconv.FormatInt(item.ProductID, 10),
+			Name:      names[item.ProductID],
+			Quantity:  item.Quantity,
+			Price:     item.Price.Float64(),
+		})
+	}
+
+	change, err := recordStatusChange(ctx, tx, order.ID, nil, order.Status, "system", "order created")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := enqueueOrderEvent(ctx, tx, &order, eventItems, change); err != nil {
+		return nil, err
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, fmt.Errorf("failed to commit transaction: %w", classify(err))
 	}
 
 	return &models.OrderWithItems{
@@ -88,7 +234,7 @@ func (r *OrderRepository) GetByID(ctx context.Context, id int64) (*models.OrderW
 	err := r.db.QueryRow(ctx, orderQuery, id).
 		Scan(&order.ID, &order.CustomerID, &order.Status, &order.Total, &order.CreatedAt, &order.UpdatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order: %w", err)
+		return nil, fmt.Errorf("failed to get order: %w", classify(err))
 	}
 
 	// Get order items
@@ -101,7 +247,7 @@ func (r *OrderRepository) GetByID(ctx context.Context, id int64) (*models.OrderW
 
 	rows, err := r.db.Query(ctx, itemsQuery, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order items: %w", err)
+		return nil, fmt.Errorf("failed to get order items: %w", classify(err))
 	}
 	defer rows.Close()
 
@@ -109,13 +255,13 @@ func (r *OrderRepository) GetByID(ctx context.Context, id int64) (*models.OrderW
 	for rows.Next() {
 		var item models.OrderItem
 		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.Price, &item.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan order item: %w", err)
+			return nil, fmt.Errorf("failed to scan order item: %w", classify(err))
 		}
 		items = append(items, item)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating order items: %w", err)
+		return nil, fmt.Errorf("error iterating order items: %w", classify(err))
 	}
 
 	return &models.OrderWithItems{
@@ -144,7 +290,7 @@ func (r *OrderRepository) GetByIDWithCustomer(ctx context.Context, id int64) (*m
 			&customer.ID, &customer.Name, &customer.Email, &customer.CreatedAt,
 		)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order with customer: %w", err)
+		return nil, fmt.Errorf("failed to get order with customer: %w", classify(err))
 	}
 
 	// Get order items
@@ -157,7 +303,7 @@ func (r *OrderRepository) GetByIDWithCustomer(ctx context.Context, id int64) (*m
 
 	rows, err := r.db.Query(ctx, itemsQuery, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order items: %w", err)
+		return nil, fmt.Errorf("failed to get order items: %w", classify(err))
 	}
 	defer rows.Close()
 
@@ -165,13 +311,13 @@ func (r *OrderRepository) GetByIDWithCustomer(ctx context.Context, id int64) (*m
 	for rows.Next() {
 		var item models.OrderItem
 		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.Price, &item.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan order item: %w", err)
+			return nil, fmt.Errorf("failed to scan order item: %w", classify(err))
 		}
 		items = append(items, item)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating order items: %w", err)
+		return nil, fmt.Errorf("error iterating order items: %w", classify(err))
 	}
 
 	return &models.OrderWithItems{
@@ -181,7 +327,9 @@ func (r *OrderRepository) GetByIDWithCustomer(ctx context.Context, id int64) (*m
 	}, nil
 }
 
-// ListByCustomer retrieves all orders for a customer
+// ListByCustomer retrieves orders for a customer with LIMIT/OFFSET
+// pagination. Deep pages get slower as the offset grows; ListByCustomerPage
+// is the keyset alternative.
 func (r *OrderRepository) ListByCustomer(ctx context.Context, customerID int64, limit, offset int) ([]models.Order, error) {
 	query := `
 		SELECT id, customer_id, status, total, created_at, updated_at
@@ -193,7 +341,7 @@ func (r *OrderRepository) ListByCustomer(ctx context.Context, customerID int64,
 
 	rows, err := r.db.Query(ctx, query, customerID, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list orders: %w", err)
+		return nil, fmt.Errorf("failed to list orders: %w", classify(err))
 	}
 	defer rows.Close()
 
@@ -201,33 +349,308 @@ func (r *OrderRepository) ListByCustomer(ctx context.Context, customerID int64,
 	for rows.Next() {
 		var order models.Order
 		if err := rows.Scan(&order.ID, &order.CustomerID, &order.Status, &order.Total, &order.CreatedAt, &order.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan order: %w", err)
+			return nil, fmt.Errorf("failed to scan order: %w", classify(err))
 		}
 		orders = append(orders, order)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating orders: %w", err)
+		return nil, fmt.Errorf("error iterating orders: %w", classify(err))
 	}
 
 	return orders, nil
 }
 
-// UpdateStatus updates the status of an order
-func (r *OrderRepository) UpdateStatus(ctx context.Context, id int64, status models.OrderStatus) error {
+// ListByCustomerPage retrieves a page of a customer's orders, newest first,
+// using keyset pagination on (created_at, id). It returns a cursor for the
+// next page, or nil if this is the last one.
+func (r *OrderRepository) ListByCustomerPage(ctx context.Context, customerID int64, filter models.OrderFilter) ([]models.Order, *models.Cursor, error) {
+	var where conditions
+	where.add("customer_id = " + where.arg(customerID))
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+		where.add("status = ANY(" + where.arg(statuses) + ")")
+	}
+	if filter.MinTotal != nil {
+		where.add("total >= " + where.arg(*filter.MinTotal))
+	}
+	if filter.MaxTotal != nil {
+		where.add("total <= " + where.arg(*filter.MaxTotal))
+	}
+	if filter.CreatedAfter != nil {
+		where.add("created_at >= " + where.arg(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		where.add("created_at < " + where.arg(*filter.CreatedBefore))
+	}
+	if filter.After != nil {
+		where.add(fmt.Sprintf("(created_at, id) < (%s::timestamptz, %s::bigint)", where.arg(filter.After.CreatedAt), where.arg(filter.After.ID)))
+	}
+
+	// Fetch one extra row to know whether there is a next page
 	query := `
+		SELECT id, customer_id, status, total, created_at, updated_at
+		FROM orders
+		` + where.where() + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + where.arg(filter.Limit+1)
+	if filter.Offset > 0 {
+		query += " OFFSET " + where.arg(filter.Offset)
+	}
+
+	rows, err := r.db.Query(ctx, query, where.args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list orders: %w", classify(err))
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		var order models.Order
+		if err := rows.Scan(&order.ID, &order.CustomerID, &order.Status, &order.Total, &order.CreatedAt, &order.UpdatedAt); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan order: %w", classify(err))
+		}
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating orders: %w", classify(err))
+	}
+
+	if len(orders) <= filter.Limit {
+		return orders, nil, nil
+	}
+	orders = orders[:filter.Limit]
+	last := orders[len(orders)-1]
+	return orders, &models.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
+
+// InvalidTransitionError is returned when an order's current status does
+// not allow the requested one
+type InvalidTransitionError struct {
+	From    models.OrderStatus
+	To      models.OrderStatus
+	Allowed []models.OrderStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("cannot change order status from %s to %s", e.From, e.To)
+}
+
+// UpdateStatus moves an order to a new status if the state machine allows
+// it and records the transition. The update is conditional on the status
+// that was checked, so a concurrent change is never overwritten. Cancelling
+// an order returns its items to stock. An order.updated or order.cancelled
+// event is written to the outbox before committing.
+func (r *OrderRepository) UpdateStatus(ctx context.Context, id int64, req *models.UpdateOrderStatusRequest) (*models.OrderStatusChange, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback(ctx)
+
+	updateQuery := `
 		UPDATE orders
 		SET status = $1
-		WHERE id = $2
+		WHERE id = $2 AND status = $3
+		RETURNING id, customer_id, status, total, created_at, updated_at
+	`
+
+	// Each statement sees the latest committed status, so a lost race is
+	// re-checked against the status that won
+	var from models.OrderStatus
+	var order models.Order
+	for updated := false; !updated; {
+		err := tx.QueryRow(ctx, `SELECT status FROM orders WHERE id = $1`, id).Scan(&from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order status: %w", classify(err))
+		}
+		if !from.CanTransitionTo(req.Status) {
+			return nil, &InvalidTransitionError{From: from, To: req.Status, Allowed: from.Next()}
+		}
+
+		err = tx.QueryRow(ctx, updateQuery, req.Status, id, from).
+			Scan(&order.ID, &order.CustomerID, &order.Status, &order.Total, &order.CreatedAt, &order.UpdatedAt)
+		switch {
+		case err == nil:
+			updated = true
+		case !errors.Is(err, pgx.ErrNoRows):
+			return nil, fmt.Errorf("failed to update order status: %w", classify(err))
+		}
+	}
+
+	if req.Status == models.OrderStatusCancelled {
+		if err := restock(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	change, err := recordStatusChange(ctx, tx, id, &from, req.Status, req.Actor, req.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := orderEventItems(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := enqueueOrderEvent(ctx, tx, &order, items, change); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", classify(err))
+	}
+
+	return change, nil
+}
+
+// GetStatusHistory retrieves an order's status transitions, oldest first
+func (r *OrderRepository) GetStatusHistory(ctx context.Context, id int64) ([]models.OrderStatusChange, error) {
+	var exists bool
+	if err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", classify(err))
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	query := `
+		SELECT id, order_id, from_status, to_status, actor, reason, created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY id
+	`
+
+	rows, err := r.db.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order status history: %w", classify(err))
+	}
+	defer rows.Close()
+
+	history := []models.OrderStatusChange{}
+	for rows.Next() {
+		var change models.OrderStatusChange
+		if err := rows.Scan(&change.ID, &change.OrderID, &change.FromStatus, &change.ToStatus, &change.Actor, &change.Reason, &change.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan order status change: %w", classify(err))
+		}
+		history = append(history, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order status history: %w", classify(err))
+	}
+
+	return history, nil
+}
+
+// recordStatusChange writes an order_status_history entry
+func recordStatusChange(ctx context.Context, tx pgx.Tx, orderID int64, from *models.OrderStatus, to models.OrderStatus, actor, reason string) (*models.OrderStatusChange, error) {
+	if actor == "" {
+		actor = "anonymous"
+	}
+
+	query := `
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, order_id, from_status, to_status, actor, reason, created_at
 	`
 
-	result, err := r.db.Exec(ctx, query, status, id)
+	var change models.OrderStatusChange
+	err := tx.QueryRow(ctx, query, orderID, from, to, actor, reason).
+		Scan(&change.ID, &change.OrderID, &change.FromStatus, &change.ToStatus, &change.Actor, &change.Reason, &change.CreatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to update order status: %w", err)
+		return nil, fmt.Errorf("failed to record order status change: %w", classify(err))
 	}
 
-	if result.RowsAffected() == 0 {
-		return pgx.ErrNoRows
+	return &change, nil
+}
+
+// orderEventItems reads an order's items with their product names for an
+// order event
+func orderEventItems(ctx context.Context, tx pgx.Tx, orderID int64) ([]outbox.OrderEventItem, error) {
+	query := `
+		SELECT i.product_id, p.name, i.quantity, i.price
+		FROM order_items i
+		INNER JOIN products p ON p.id = i.product_id
+		WHERE i.order_id = $1
+		ORDER BY i.id
+	`
+
+	rows, err := tx.Query(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order items: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var items []outbox.OrderEventItem
+	for rows.Next() {
+		var productID int64
+		var price money.Money
+		var item outbox.OrderEventItem
+		if err := rows.Scan(&productID, &item.Name, &item.Quantity, &price); err != nil {
+			return nil, fmt.Errorf("failed to scan order item: %w", classify(err))
+		}
+		item.ProductID = strconv.FormatInt(productID, 10)
+		item.Price = price.Float64()
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order items: %w", classify(err))
+	}
+
+	return items, nil
+}
+
+// enqueueOrderEvent writes an event describing a status change to the
+// outbox, so it is published if and only if the transaction commits
+func enqueueOrderEvent(ctx context.Context, tx pgx.Tx, order *models.Order, items []outbox.OrderEventItem, change *models.OrderStatusChange) error {
+	msg, err := outbox.NewOrderEvent(order, items, change).Message()
+	if err != nil {
+		return fmt.Errorf("failed to build order event: %w", err)
+	}
+
+	if err := outbox.Enqueue(ctx, tx, msg); err != nil {
+		return fmt.Errorf("failed to write order event: %w", classify(err))
+	}
+
+	return nil
+}
+
+// restock returns a cancelled order's items to stock, locking the products
+// in ID order like order creation does
+func restock(ctx context.Context, tx pgx.Tx, orderID int64) error {
+	lockQuery := `
+		SELECT id
+		FROM products
+		WHERE id IN (SELECT product_id FROM order_items WHERE order_id = $1)
+		ORDER BY id
+		FOR UPDATE
+	`
+
+	if _, err := tx.Exec(ctx, lockQuery, orderID); err != nil {
+		return fmt.Errorf("failed to lock products: %w", classify(err))
+	}
+
+	restockQuery := `
+		UPDATE products AS p
+		SET stock = p.stock + i.quantity
+		FROM (
+			SELECT product_id, SUM(quantity) AS quantity
+			FROM order_items
+			WHERE order_id = $1
+			GROUP BY product_id
+		) AS i
+		WHERE p.id = i.product_id
+	`
+
+	if _, err := tx.Exec(ctx, restockQuery, orderID); err != nil {
+		return fmt.Errorf("failed to restock products: %w", classify(err))
 	}
 
 	return nil
@@ -248,8 +671,8 @@ func (r *OrderRepository) GetOrderStats(ctx context.Context, customerID int64) (
 
 	var stats struct {
 		TotalOrders       int64
-		TotalSpent        float64
-		AverageOrderValue float64
+		TotalSpent        money.Money
+		AverageOrderValue money.Money
 		DeliveredOrders   int64
 		CancelledOrders   int64
 	}
@@ -257,7 +680,7 @@ func (r *OrderRepository) GetOrderStats(ctx context.Context, customerID int64) (
 	err := r.db.QueryRow(ctx, query, customerID).
 		Scan(&stats.TotalOrders, &stats.TotalSpent, &stats.AverageOrderValue, &stats.DeliveredOrders, &stats.CancelledOrders)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order stats: %w", err)
+		return nil, fmt.Errorf("failed to get order stats: %w", classify(err))
 	}
 
 	return map[string]interface{}{
@@ -291,3 +714,64 @@ func (r *OrderRepository) SimulateSlowQuery(ctx context.Context, customerID int6
 
 	return result, nil
 }
+
+// ordersWithItemsQuery selects a customer's orders with the items of each
+// aggregated into a JSON array. Callers append the ORDER BY and any LIMIT,
+// and read the rows with scanOrdersWithItems.
+const ordersWithItemsQuery = `
+		SELECT
+			o.id, o.customer_id, o.status, o.total, o.created_at, o.updated_at,
+			COALESCE(
+				json_agg(
+					json_build_object(
+						'id', i.id,
+						'order_id', i.order_id,
+						'product_id', i.product_id,
+						'quantity', i.quantity,
+						'price', i.price,
+						'created_at', i.created_at
+					) ORDER BY i.id
+				) FILTER (WHERE i.id IS NOT NULL),
+				'[]'
+			)
+		FROM orders o
+		LEFT JOIN order_items i ON i.order_id = o.id
+		WHERE o.customer_id = $1
+		GROUP BY o.id`
+
+// scanOrdersWithItems reads and closes the rows of an ordersWithItemsQuery
+func scanOrdersWithItems(rows pgx.Rows) ([]models.OrderWithItems, error) {
+	defer rows.Close()
+
+	result := []models.OrderWithItems{}
+	for rows.Next() {
+		var order models.OrderWithItems
+		if err := rows.Scan(&order.ID, &order.CustomerID, &order.Status, &order.Total, &order.CreatedAt, &order.UpdatedAt, &order.Items); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", classify(err))
+		}
+		result = append(result, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %w", classify(err))
+	}
+
+	return result, nil
+}
+
+// ListWithItems retrieves a customer's orders with their items in a single
+// query, aggregating the items of each order into a JSON array. It returns
+// the same result as SimulateSlowQuery without the N+1 queries.
+func (r *OrderRepository) ListWithItems(ctx context.Context, customerID int64, limit, offset int) ([]models.OrderWithItems, error) {
+	query := ordersWithItemsQuery + `
+		ORDER BY o.created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Query(ctx, query, customerID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders with items: %w", classify(err))
+	}
+
+	return scanOrdersWithItems(rows)
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/models"
+)
+
+// ErrProductInUse is returned when deleting a product that has been ordered
+var ErrProductInUse = errors.New("product is referenced by orders")
+
+// ProductRepository handles product catalog operations
+type ProductRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewProductRepository creates a new product repository
+func NewProductRepository(db *pgxpool.Pool) *ProductRepository {
+	return &ProductRepository{db: db}
+}
+
+// Create creates a new product
+func (r *ProductRepository) Create(ctx context.Context, req *models.ProductRequest) (*models.Product, error) {
+	query := `
+		INSERT INTO products (name, description, price, stock)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, name, description, price, stock, created_at, updated_at
+	`
+
+	var product models.Product
+	err := r.db.QueryRow(ctx, query, req.Name, req.Description, req.Price, req.Stock).
+		Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.Stock, &product.CreatedAt, &product.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create product: %w", classify(err))
+	}
+
+	return &product, nil
+}
+
+// GetByID retrieves a product by ID
+func (r *ProductRepository) GetByID(ctx context.Context, id int64) (*models.Product, error) {
+	query := `
+		SELECT id, name, description, price, stock, created_at, updated_at
+		FROM products
+		WHERE id = $1
+	`
+
+	var product models.Product
+	err := r.db.QueryRow(ctx, query, id).
+		Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.Stock, &product.CreatedAt, &product.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", classify(err))
+	}
+
+	return &product, nil
+}
+
+// List retrieves products ordered by ID with pagination
+func (r *ProductRepository) List(ctx context.Context, limit, offset int) ([]models.Product, error) {
+	query := `
+		SELECT id, name, description, price, stock, created_at, updated_at
+		FROM products
+		ORDER BY id
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var products []models.Product
+	for rows.Next() {
+		var product models.Product
+		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.Stock, &product.CreatedAt, &product.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", classify(err))
+		}
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating products: %w", classify(err))
+	}
+
+	return products, nil
+}
+
+// Update replaces a product's details and stock level
+func (r *ProductRepository) Update(ctx context.Context, id int64, req *models.ProductRequest) (*models.Product, error) {
+	query := `
+		UPDATE products
+		SET name = $2, description = $3, price = $4, stock = $5
+		WHERE id = $1
+		RETURNING id, name, description, price, stock, created_at, updated_at
+	`
+
+	var product models.Product
+	err := r.db.QueryRow(ctx, query, id, req.Name, req.Description, req.Price, req.Stock).
+		Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.Stock, &product.CreatedAt, &product.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update product: %w", classify(err))
+	}
+
+	return &product, nil
+}
+
+// Delete deletes a product that has never been ordered
+func (r *ProductRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.Exec(ctx, `DELETE FROM products WHERE id = $1`, id)
+	if err != nil {
+		err = classify(err)
+		if errors.Is(err, ErrForeignKeyViolation) {
+			return ErrProductInUse
+		}
+		return fmt.Errorf("failed to delete product: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+)
+
+// conditions builds the WHERE clause of a query with optional filters
+type conditions struct {
+	clauses []string
+	args    []any
+}
+
+// arg adds a query argument and returns its placeholder
+func (c *conditions) arg(v any) string {
+	c.args = append(c.args, v)
+	return "$" + strconv.Itoa(len(c.args))
+}
+
+// add adds a clause that must hold
+func (c *conditions) add(clause string) {
+	c.clauses = append(c.clauses, clause)
+}
+
+// where returns the WHERE clause, or nothing if there are no clauses
+func (c *conditions) where() string {
+	if len(c.clauses) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(c.clauses, " AND ")
+}
+
+// likePrefix returns a LIKE pattern matching strings that start with prefix
+func likePrefix(prefix string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return escaper.Replace(prefix) + "%"
+}
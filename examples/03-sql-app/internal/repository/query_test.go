@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConditions(t *testing.T) {
+	var where conditions
+	if got := where.where(); got != "" {
+		t.Errorf("Expected no WHERE clause, got %q", got)
+	}
+
+	where.add("customer_id = " + where.arg(int64(7)))
+	where.add("total >= " + where.arg(10.5))
+	limit := where.arg(21)
+
+	if got, want := where.where(), "WHERE customer_id = $1 AND total >= $2"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if limit != "$3" {
+		t.Errorf("Expected the limit placeholder to be $3, got %s", limit)
+	}
+	if want := []any{int64(7), 10.5, 21}; !reflect.DeepEqual(where.args, want) {
+		t.Errorf("Expected args %v, got %v", want, where.args)
+	}
+}
+
+func TestLikePrefix(t *testing.T) {
+	tests := map[string]string{
+		"ali":      "ali%",
+		"100%":     `100\%%`,
+		"a_b":      `a\_b%`,
+		`back\sla`: `back\\sla%`,
+	}
+
+	for prefix, want := range tests {
+		if got := likePrefix(prefix); got != want {
+			t.Errorf("likePrefix(%q): expected %q, got %q", prefix, want, got)
+		}
+	}
+}
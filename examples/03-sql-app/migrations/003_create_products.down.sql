@@ -0,0 +1,5 @@
+-- Drop products table
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS fk_order_items_product;
+DROP TRIGGER IF EXISTS update_products_updated_at ON products;
+DROP INDEX IF EXISTS idx_products_name;
+DROP TABLE IF EXISTS products;
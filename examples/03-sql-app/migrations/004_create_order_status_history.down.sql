@@ -0,0 +1,4 @@
+-- Drop order_status_history table
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS chk_orders_status;
+DROP INDEX IF EXISTS idx_order_status_history_order_id;
+DROP TABLE IF EXISTS order_status_history;
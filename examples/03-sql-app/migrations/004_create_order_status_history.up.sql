@@ -0,0 +1,20 @@
+-- Create order_status_history table
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_order_status_history_order FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+);
+
+-- Create index for reading an order's history in order
+CREATE INDEX idx_order_status_history_order_id ON order_status_history(order_id, id);
+
+-- Reject unknown statuses. NOT VALID leaves rows written before the state
+-- machine existed alone.
+ALTER TABLE orders
+    ADD CONSTRAINT chk_orders_status
+    CHECK (status IN ('pending', 'processing', 'shipped', 'delivered', 'cancelled')) NOT VALID;
@@ -0,0 +1,3 @@
+-- Drop outbox table
+DROP INDEX IF EXISTS idx_outbox_unsent;
+DROP TABLE IF EXISTS outbox;
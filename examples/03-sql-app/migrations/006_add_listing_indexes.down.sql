@@ -0,0 +1,8 @@
+-- Drop listing indexes
+DROP INDEX IF EXISTS idx_customers_email_prefix;
+DROP INDEX IF EXISTS idx_customers_name_prefix;
+DROP INDEX IF EXISTS idx_orders_customer_created_at_id;
+DROP INDEX IF EXISTS idx_customers_created_at_id;
+
+ALTER TABLE orders ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE customers ALTER COLUMN created_at DROP NOT NULL;
@@ -0,0 +1,11 @@
+-- Keyset pagination orders by (created_at, id), so created_at must be set
+ALTER TABLE customers ALTER COLUMN created_at SET NOT NULL;
+ALTER TABLE orders ALTER COLUMN created_at SET NOT NULL;
+
+-- Create indexes for paging through customers and their orders newest first
+CREATE INDEX idx_customers_created_at_id ON customers(created_at DESC, id DESC);
+CREATE INDEX idx_orders_customer_created_at_id ON orders(customer_id, created_at DESC, id DESC);
+
+-- Create indexes for case-insensitive prefix searches
+CREATE INDEX idx_customers_name_prefix ON customers(lower(name) text_pattern_ops);
+CREATE INDEX idx_customers_email_prefix ON customers(lower(email) text_pattern_ops);
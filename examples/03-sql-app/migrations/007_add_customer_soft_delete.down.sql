@@ -0,0 +1,13 @@
+-- Restore cascading deletes and unique emails. Fails if deleted customers
+-- share an email with another customer.
+ALTER TABLE orders DROP CONSTRAINT fk_orders_customer;
+ALTER TABLE orders
+    ADD CONSTRAINT fk_orders_customer
+    FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS idx_customers_email_active;
+CREATE INDEX idx_customers_email ON customers(email);
+ALTER TABLE customers ADD CONSTRAINT customers_email_key UNIQUE (email);
+
+ALTER TABLE customers DROP COLUMN IF EXISTS erased_at;
+ALTER TABLE customers DROP COLUMN IF EXISTS deleted_at;
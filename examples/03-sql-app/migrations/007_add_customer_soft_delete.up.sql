@@ -0,0 +1,17 @@
+-- Soft-deleted customers keep their row so their orders stay intact;
+-- erased customers additionally have their personal data pseudonymized
+ALTER TABLE customers ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE customers ADD COLUMN erased_at TIMESTAMP WITH TIME ZONE;
+
+-- Only active customers need unique emails, so a deleted customer's email
+-- can be used to sign up again
+ALTER TABLE customers DROP CONSTRAINT customers_email_key;
+DROP INDEX IF EXISTS idx_customers_email;
+CREATE UNIQUE INDEX idx_customers_email_active ON customers(email) WHERE deleted_at IS NULL;
+
+-- Orders are kept for accounting, so refuse to delete a customer with orders
+-- instead of cascading
+ALTER TABLE orders DROP CONSTRAINT fk_orders_customer;
+ALTER TABLE orders
+    ADD CONSTRAINT fk_orders_customer
+    FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE RESTRICT;
@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL schema migrations so the server and
+// cmd/migrate can apply them without the files on disk
+package migrations
+
+import "embed"
+
+// FS holds the NNN_name.up.sql and NNN_name.down.sql files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -4,18 +4,27 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/raibid-labs/mop/examples/03-sql-app/internal/db"
 	"github.com/raibid-labs/mop/examples/03-sql-app/internal/handlers"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/migrate"
 	"github.com/raibid-labs/mop/examples/03-sql-app/internal/models"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/money"
+	"github.com/raibid-labs/mop/examples/03-sql-app/internal/outbox"
 	"github.com/raibid-labs/mop/examples/03-sql-app/internal/repository"
+	"github.com/raibid-labs/mop/examples/03-sql-app/migrations"
 )
 
 var (
@@ -56,10 +65,14 @@ func cleanupDB(t *testing.T, pool *pgxpool.Pool) {
 	ctx := context.Background()
 
 	queries := []string{
+		"DROP TABLE IF EXISTS outbox CASCADE",
+		"DROP TABLE IF EXISTS order_status_history CASCADE",
 		"DROP TABLE IF EXISTS order_items CASCADE",
 		"DROP TABLE IF EXISTS orders CASCADE",
+		"DROP TABLE IF EXISTS products CASCADE",
 		"DROP TABLE IF EXISTS customers CASCADE",
 		"DROP FUNCTION IF EXISTS update_updated_at_column() CASCADE",
+		"DROP TABLE IF EXISTS schema_migrations",
 	}
 
 	for _, query := range queries {
@@ -70,95 +83,54 @@ func cleanupDB(t *testing.T, pool *pgxpool.Pool) {
 }
 
 func runMigrations(t *testing.T, pool *pgxpool.Pool) {
-	ctx := context.Background()
-
-	// Create customers table
-	customersSQL := `
-		CREATE TABLE IF NOT EXISTS customers (
-			id BIGSERIAL PRIMARY KEY,
-			name VARCHAR(255) NOT NULL,
-			email VARCHAR(255) NOT NULL UNIQUE,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		);
-		CREATE INDEX IF NOT EXISTS idx_customers_email ON customers(email);
-	`
-
-	if _, err := pool.Exec(ctx, customersSQL); err != nil {
-		t.Fatalf("Failed to create customers table: %v", err)
-	}
-
-	// Create orders and order_items tables
-	ordersSQL := `
-		CREATE TABLE IF NOT EXISTS orders (
-			id BIGSERIAL PRIMARY KEY,
-			customer_id BIGINT NOT NULL,
-			status VARCHAR(50) NOT NULL DEFAULT 'pending',
-			total DECIMAL(10, 2) NOT NULL DEFAULT 0.00,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			CONSTRAINT fk_orders_customer FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders(customer_id);
-		CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
-		CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders(created_at DESC);
-
-		CREATE TABLE IF NOT EXISTS order_items (
-			id BIGSERIAL PRIMARY KEY,
-			order_id BIGINT NOT NULL,
-			product_id BIGINT NOT NULL,
-			quantity INT NOT NULL CHECK (quantity > 0),
-			price DECIMAL(10, 2) NOT NULL CHECK (price >= 0),
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			CONSTRAINT fk_order_items_order FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
-		CREATE INDEX IF NOT EXISTS idx_order_items_product_id ON order_items(product_id);
-
-		CREATE OR REPLACE FUNCTION update_updated_at_column()
-		RETURNS TRIGGER AS $$
-		BEGIN
-			NEW.updated_at = CURRENT_TIMESTAMP;
-			RETURN NEW;
-		END;
-		$$ language 'plpgsql';
-
-		DROP TRIGGER IF EXISTS update_orders_updated_at ON orders;
-		CREATE TRIGGER update_orders_updated_at
-			BEFORE UPDATE ON orders
-			FOR EACH ROW
-			EXECUTE FUNCTION update_updated_at_column();
-	`
-
-	if _, err := pool.Exec(ctx, ordersSQL); err != nil {
-		t.Fatalf("Failed to create orders tables: %v", err)
+	migrator, err := migrate.New(pool, migrations.FS)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
 	}
 }
 
 func setupRouter(pool *pgxpool.Pool) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
+	router.Use(handlers.NewQueryStatsMiddleware(10, prometheus.NewRegistry()).Handle)
 
 	// Initialize repositories
 	customerRepo := repository.NewCustomerRepository(pool)
 	orderRepo := repository.NewOrderRepository(pool)
+	productRepo := repository.NewProductRepository(pool)
 
 	// Initialize handlers
 	healthHandler := handlers.NewHealthHandler(pool)
 	customerHandler := handlers.NewCustomerHandler(customerRepo)
 	orderHandler := handlers.NewOrderHandler(orderRepo)
+	productHandler := handlers.NewProductHandler(productRepo)
 
 	// Routes
 	router.GET("/health", healthHandler.Check)
 	router.POST("/customers", customerHandler.Create)
 	router.GET("/customers/:id", customerHandler.GetByID)
 	router.GET("/customers", customerHandler.List)
+	router.PUT("/customers/:id", customerHandler.Replace)
+	router.PATCH("/customers/:id", customerHandler.Patch)
+	router.DELETE("/customers/:id", customerHandler.Delete)
+	router.POST("/customers/:id/erase", customerHandler.Erase)
+	router.GET("/customers/:id/export", customerHandler.Export)
+	router.POST("/products", productHandler.Create)
+	router.GET("/products/:id", productHandler.GetByID)
+	router.GET("/products", productHandler.List)
+	router.PUT("/products/:id", productHandler.Update)
+	router.DELETE("/products/:id", productHandler.Delete)
 	router.POST("/orders", orderHandler.Create)
 	router.GET("/orders/:id", orderHandler.GetByID)
 	router.PUT("/orders/:id/status", orderHandler.UpdateStatus)
-	router.GET("/customers/:customer_id/orders", orderHandler.ListByCustomer)
-	router.GET("/customers/:customer_id/orders/stats", orderHandler.GetStats)
+	router.GET("/orders/:id/history", orderHandler.GetHistory)
+	router.GET("/customers/:id/orders", orderHandler.ListByCustomer)
+	router.GET("/customers/:id/orders/stats", orderHandler.GetStats)
+	router.GET("/customers/:id/orders/slow", orderHandler.SimulateSlowQuery)
+	router.GET("/customers/:id/orders/optimized", orderHandler.ListWithItems)
 
 	return router
 }
@@ -216,6 +188,162 @@ func TestCreateCustomer(t *testing.T) {
 	if response.ID == 0 {
 		t.Error("Expected non-zero customer ID")
 	}
+
+	// Create validates the request like Replace does
+	for _, invalid := range []map[string]string{
+		{"email": "nameless@example.com"},
+		{"name": "Jane Doe", "email": "not an email"},
+	} {
+		body, _ := json.Marshal(invalid)
+		req, _ := http.NewRequest("POST", "/customers", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d", invalid, w.Code)
+		}
+	}
+}
+
+func TestCustomerLifecycle(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+	ctx := context.Background()
+
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	customerID := createTestCustomer(t, router, "Jane Doe", "jane@example.com")
+	path := fmt.Sprintf("/customers/%d", customerID)
+	productID := createTestProduct(t, router, "Widget", usd("12.50"), 10)
+	orderID := createTestOrderFor(t, router, customerID, productID, 2)
+
+	t.Run("update", func(t *testing.T) {
+		w := do("PUT", path, models.CustomerRequest{Name: "Jane Smith", Email: "jane.smith@example.com"})
+		var customer models.Customer
+		json.Unmarshal(w.Body.Bytes(), &customer)
+		if w.Code != http.StatusOK || customer.Name != "Jane Smith" || customer.Email != "jane.smith@example.com" {
+			t.Errorf("Unexpected PUT response %d: %s", w.Code, w.Body.String())
+		}
+
+		w = do("PATCH", path, map[string]string{"name": "Jane Q. Smith"})
+		json.Unmarshal(w.Body.Bytes(), &customer)
+		if w.Code != http.StatusOK || customer.Name != "Jane Q. Smith" || customer.Email != "jane.smith@example.com" {
+			t.Errorf("Expected PATCH to change only the name, got %d: %s", w.Code, w.Body.String())
+		}
+
+		if w := do("PATCH", path, map[string]string{"email": "not an email"}); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for an invalid email, got %d", w.Code)
+		}
+		if w := do("PUT", path, map[string]string{"name": "No Email"}); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for a PUT without email, got %d", w.Code)
+		}
+
+		createTestCustomer(t, router, "Taken", "taken@example.com")
+		if w := do("PATCH", path, map[string]string{"email": "taken@example.com"}); w.Code != http.StatusConflict {
+			t.Errorf("Expected status 409 for a duplicate email, got %d", w.Code)
+		}
+	})
+
+	t.Run("export", func(t *testing.T) {
+		w := do("GET", path+"/export", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Disposition"); got != fmt.Sprintf(`attachment; filename="customer-%d.json"`, customerID) {
+			t.Errorf("Unexpected Content-Disposition %q", got)
+		}
+
+		var export models.CustomerExport
+		json.Unmarshal(w.Body.Bytes(), &export)
+		if export.Customer.ID != customerID || export.Customer.Email != "jane.smith@example.com" || export.ExportedAt.IsZero() {
+			t.Errorf("Unexpected customer in export %+v", export)
+		}
+		if len(export.Orders) != 1 || export.Orders[0].ID != orderID || export.Orders[0].Total != usd("25.00") ||
+			len(export.Orders[0].Items) != 1 || export.Orders[0].Items[0].Quantity != 2 {
+			t.Errorf("Unexpected orders in export %+v", export.Orders)
+		}
+	})
+
+	t.Run("soft delete", func(t *testing.T) {
+		if w := do("DELETE", path, nil); w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+		}
+		if w := do("DELETE", path, nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 deleting twice, got %d", w.Code)
+		}
+		for _, method := range []string{"GET", "PATCH"} {
+			if w := do(method, path, map[string]string{}); w.Code != http.StatusNotFound {
+				t.Errorf("%s of a deleted customer: expected status 404, got %d", method, w.Code)
+			}
+		}
+
+		w := do("GET", "/customers?email_prefix=jane", nil)
+		if bytes.Contains(w.Body.Bytes(), []byte("jane.smith@example.com")) {
+			t.Errorf("Expected the list to exclude the deleted customer, got %s", w.Body.String())
+		}
+
+		// The order is kept, but the customer cannot order again
+		if w := do("GET", fmt.Sprintf("/orders/%d", orderID), nil); w.Code != http.StatusOK {
+			t.Errorf("Expected the deleted customer's order to remain, got %d", w.Code)
+		}
+		w = do("POST", "/orders", models.CreateOrderRequest{
+			CustomerID: customerID,
+			Items:      []models.CreateOrderItem{{ProductID: productID, Quantity: 1}},
+		})
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 ordering for a deleted customer, got %d: %s", w.Code, w.Body.String())
+		}
+
+		// Deleted customers do not reserve their email
+		createTestCustomer(t, router, "New Jane", "jane.smith@example.com")
+	})
+
+	t.Run("erase", func(t *testing.T) {
+		w := do("POST", path+"/erase", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var customer models.Customer
+		json.Unmarshal(w.Body.Bytes(), &customer)
+		if customer.Name != "Erased customer" || customer.Email != fmt.Sprintf("erased-%d@erased.invalid", customerID) ||
+			customer.DeletedAt == nil || customer.ErasedAt == nil {
+			t.Errorf("Unexpected erased customer %+v", customer)
+		}
+
+		w = do("GET", fmt.Sprintf("/orders/%d?include_customer=true", orderID), nil)
+		if w.Code != http.StatusOK || bytes.Contains(w.Body.Bytes(), []byte("Jane")) {
+			t.Errorf("Expected the order without personal data, got %d: %s", w.Code, w.Body.String())
+		}
+
+		w = do("GET", path+"/export", nil)
+		if w.Code != http.StatusOK || bytes.Contains(w.Body.Bytes(), []byte("jane")) || bytes.Contains(w.Body.Bytes(), []byte("Jane")) {
+			t.Errorf("Expected an export without personal data, got %d: %s", w.Code, w.Body.String())
+		}
+
+		if w := do("POST", "/customers/999999/erase", nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 erasing an unknown customer, got %d", w.Code)
+		}
+	})
+
+	t.Run("hard delete is restricted", func(t *testing.T) {
+		_, err := pool.Exec(ctx, "DELETE FROM customers WHERE id = $1", customerID)
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != "23503" {
+			t.Errorf("Expected a foreign key violation deleting a customer with orders, got %v", err)
+		}
+	})
 }
 
 func TestCreateOrder(t *testing.T) {
@@ -239,12 +367,16 @@ func TestCreateOrder(t *testing.T) {
 	var customerResponse models.Customer
 	json.Unmarshal(w.Body.Bytes(), &customerResponse)
 
+	// Create the products; their catalog prices determine the total
+	widgetID := createTestProduct(t, router, "Widget", usd("29.99"), 10)
+	gadgetID := createTestProduct(t, router, "Gadget", usd("49.99"), 10)
+
 	// Now create an order
 	order := models.CreateOrderRequest{
 		CustomerID: customerResponse.ID,
 		Items: []models.CreateOrderItem{
-			{ProductID: 1, Quantity: 2, Price: 29.99},
-			{ProductID: 2, Quantity: 1, Price: 49.99},
+			{ProductID: widgetID, Quantity: 2},
+			{ProductID: gadgetID, Quantity: 1},
 		},
 	}
 
@@ -261,133 +393,208 @@ func TestCreateOrder(t *testing.T) {
 	var orderResponse models.OrderWithItems
 	json.Unmarshal(w.Body.Bytes(), &orderResponse)
 
-	expectedTotal := (29.99 * 2) + (49.99 * 1)
-	if orderResponse.Total != expectedTotal {
-		t.Errorf("Expected total %.2f, got %.2f", expectedTotal, orderResponse.Total)
+	if expectedTotal := usd("109.97"); orderResponse.Total != expectedTotal {
+		t.Errorf("Expected total %s, got %s", expectedTotal, orderResponse.Total)
 	}
 
 	if len(orderResponse.Items) != 2 {
 		t.Errorf("Expected 2 items, got %d", len(orderResponse.Items))
 	}
+
+	if stock := getTestProduct(t, router, widgetID).Stock; stock != 8 {
+		t.Errorf("Expected widget stock 8, got %d", stock)
+	}
 }
 
-func TestGetOrder(t *testing.T) {
+func TestCreateOrderIgnoresClientPrice(t *testing.T) {
 	pool := setupTestDB(t)
 	defer pool.Close()
 
 	router := setupRouter(pool)
 
-	// Create customer and order
-	customerID := createTestCustomer(t, router, "Test User", "test@example.com")
-	orderID := createTestOrder(t, router, customerID)
+	customerID := createTestCustomer(t, router, "Bargain Hunter", "bargain@example.com")
+	productID := createTestProduct(t, router, "Laptop", usd("999.00"), 5)
 
-	// Get the order
-	req, _ := http.NewRequest("GET", fmt.Sprintf("/orders/%d", orderID), nil)
+	body := fmt.Sprintf(`{"customer_id": %d, "items": [{"product_id": %d, "quantity": 1, "price": 0.01}]}`, customerID, productID)
+	req, _ := http.NewRequest("POST", "/orders", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
 	}
 
 	var response models.OrderWithItems
 	json.Unmarshal(w.Body.Bytes(), &response)
 
-	if response.ID != orderID {
-		t.Errorf("Expected order ID %d, got %d", orderID, response.ID)
+	if response.Total != usd("999.00") || response.Items[0].Price != usd("999.00") {
+		t.Errorf("Expected the catalog price 999.00, got total %s and item price %s", response.Total, response.Items[0].Price)
 	}
 }
 
-func TestUpdateOrderStatus(t *testing.T) {
+func TestOrderTotalsAreExact(t *testing.T) {
 	pool := setupTestDB(t)
 	defer pool.Close()
 
 	router := setupRouter(pool)
 
-	// Create customer and order
-	customerID := createTestCustomer(t, router, "Test User", "test@example.com")
-	orderID := createTestOrder(t, router, customerID)
-
-	// Update status
-	statusUpdate := models.UpdateOrderStatusRequest{
-		Status: models.OrderStatusShipped,
-	}
+	customerID := createTestCustomer(t, router, "Penny Pincher", "penny@example.com")
+	dimeID := createTestProduct(t, router, "Dime", usd("0.10"), 100)
+	twentyID := createTestProduct(t, router, "Twenty", usd("0.20"), 100)
 
-	body, _ := json.Marshal(statusUpdate)
-	req, _ := http.NewRequest("PUT", fmt.Sprintf("/orders/%d/status", orderID), bytes.NewBuffer(body))
+	// 0.1 + 0.2 is 0.30000000000000004 in floating point
+	body := fmt.Sprintf(`{"customer_id": %d, "items": [{"product_id": %d, "quantity": 1}, {"product_id": %d, "quantity": 1}]}`,
+		customerID, dimeID, twentyID)
+	req, _ := http.NewRequest("POST", "/orders", bytes.NewBufferString(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"total":{"amount":"0.30","currency":"USD"}`)) {
+		t.Errorf("Expected an exact total of 0.30 USD, got %s", w.Body.String())
 	}
 
-	// Verify the status was updated
-	req, _ = http.NewRequest("GET", fmt.Sprintf("/orders/%d", orderID), nil)
+	// Totals 0.30, 0.10 and 0.10 average 0.1666..., which rounds to 0.17
+	createTestOrderFor(t, router, customerID, dimeID, 1)
+	createTestOrderFor(t, router, customerID, dimeID, 1)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/customers/%d/orders/stats", customerID), nil)
 	w = httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	var response models.OrderWithItems
-	json.Unmarshal(w.Body.Bytes(), &response)
+	var stats struct {
+		TotalSpent        money.Money `json:"total_spent"`
+		AverageOrderValue money.Money `json:"average_order_value"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if stats.TotalSpent != usd("0.50") || stats.AverageOrderValue != usd("0.17") {
+		t.Errorf("Expected total 0.50 and average 0.17, got %s and %s", stats.TotalSpent, stats.AverageOrderValue)
+	}
 
-	if response.Status != models.OrderStatusShipped {
-		t.Errorf("Expected status 'shipped', got %s", response.Status)
+	// Amounts with more than two decimal places are rejected, not rounded
+	req, _ = http.NewRequest("POST", "/products", bytes.NewBufferString(`{"name": "Fraction", "price": "1.005", "stock": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a price with three decimal places, got %d", w.Code)
 	}
 }
 
-func TestOrderStats(t *testing.T) {
+func TestProductCRUD(t *testing.T) {
 	pool := setupTestDB(t)
 	defer pool.Close()
 
 	router := setupRouter(pool)
 
-	// Create customer and multiple orders
-	customerID := createTestCustomer(t, router, "Stats User", "stats@example.com")
-	createTestOrder(t, router, customerID)
-	createTestOrder(t, router, customerID)
+	productID := createTestProduct(t, router, "Widget", usd("9.99"), 3)
 
-	// Get stats
-	req, _ := http.NewRequest("GET", fmt.Sprintf("/customers/%d/orders/stats", customerID), nil)
+	// Replace the product
+	body, _ := json.Marshal(models.ProductRequest{Name: "Widget v2", Price: usd("12.50"), Stock: 7})
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/products/%d", productID), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
 	}
 
-	var stats map[string]interface{}
-	json.Unmarshal(w.Body.Bytes(), &stats)
+	product := getTestProduct(t, router, productID)
+	if product.Name != "Widget v2" || product.Price != usd("12.50") || product.Stock != 7 {
+		t.Errorf("Unexpected product after update: %+v", product)
+	}
 
-	totalOrders := int64(stats["total_orders"].(float64))
-	if totalOrders != 2 {
-		t.Errorf("Expected 2 total orders, got %d", totalOrders)
+	// List
+	req, _ = http.NewRequest("GET", "/products", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var list struct {
+		Products []models.Product `json:"products"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Products) != 1 {
+		t.Errorf("Expected 1 product, got %d", len(list.Products))
 	}
-}
 
-// Helper functions
-func createTestCustomer(t *testing.T, router *gin.Engine, name, email string) int64 {
-	customer := map[string]string{
-		"name":  name,
-		"email": email,
+	// Negative stock is rejected
+	body, _ = json.Marshal(models.ProductRequest{Name: "Widget", Price: usd("1.00"), Stock: -1})
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/products/%d", productID), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for negative stock, got %d", w.Code)
 	}
 
-	body, _ := json.Marshal(customer)
-	req, _ := http.NewRequest("POST", "/customers", bytes.NewBuffer(body))
+	// So is a negative price
+	body, _ = json.Marshal(models.ProductRequest{Name: "Widget", Price: usd("-1.00"), Stock: 1})
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/products/%d", productID), bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
+	w = httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	var response models.Customer
-	json.Unmarshal(w.Body.Bytes(), &response)
-	return response.ID
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for negative price, got %d", w.Code)
+	}
+
+	// An ordered product cannot be deleted
+	customerID := createTestCustomer(t, router, "Product User", "product@example.com")
+	orderedID := createTestProduct(t, router, "Ordered", usd("5.00"), 5)
+	createTestOrderFor(t, router, customerID, orderedID, 1)
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/products/%d", orderedID), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 deleting an ordered product, got %d", w.Code)
+	}
+
+	// Delete
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/products/%d", productID), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/products/%d", productID), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after delete, got %d", w.Code)
+	}
 }
 
-func createTestOrder(t *testing.T, router *gin.Engine, customerID int64) int64 {
+func TestCreateOrderInsufficientStock(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+
+	customerID := createTestCustomer(t, router, "Stock User", "stock@example.com")
+	plentyID := createTestProduct(t, router, "Plenty", usd("1.00"), 100)
+	scarceID := createTestProduct(t, router, "Scarce", usd("1.00"), 2)
+	emptyID := createTestProduct(t, router, "Empty", usd("1.00"), 0)
+
 	order := models.CreateOrderRequest{
 		CustomerID: customerID,
 		Items: []models.CreateOrderItem{
-			{ProductID: 1, Quantity: 1, Price: 99.99},
+			{ProductID: plentyID, Quantity: 5},
+			{ProductID: scarceID, Quantity: 2},
+			{ProductID: emptyID, Quantity: 1},
+			// Quantities of repeated products add up
+			{ProductID: scarceID, Quantity: 1},
 		},
 	}
 
@@ -397,37 +604,1238 @@ func createTestOrder(t *testing.T, router *gin.Engine, customerID int64) int64 {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	var response models.OrderWithItems
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Items []models.StockShortage `json:"items"`
+	}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	return response.ID
+
+	expected := []models.StockShortage{
+		{ProductID: scarceID, Requested: 3, Available: 2},
+		{ProductID: emptyID, Requested: 1, Available: 0},
+	}
+	if fmt.Sprint(response.Items) != fmt.Sprint(expected) {
+		t.Errorf("Expected shortages %v, got %v", expected, response.Items)
+	}
+
+	// Nothing was reserved
+	if stock := getTestProduct(t, router, plentyID).Stock; stock != 100 {
+		t.Errorf("Expected stock 100 after a rejected order, got %d", stock)
+	}
+
+	// Unknown products are rejected
+	order.Items = []models.CreateOrderItem{{ProductID: 999999, Quantity: 1}}
+	body, _ = json.Marshal(order)
+	req, _ = http.NewRequest("POST", "/orders", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown product, got %d", w.Code)
+	}
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	// In a real implementation, this would check os.Getenv
-	return defaultValue
+func TestCreateOrderConcurrentNoOverselling(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+
+	customerID := createTestCustomer(t, router, "Rush User", "rush@example.com")
+	firstID := createTestProduct(t, router, "First", usd("1.00"), 10)
+	secondID := createTestProduct(t, router, "Second", usd("1.00"), 10)
+
+	// 40 concurrent orders each want one of both products, listed in
+	// alternating order to provoke deadlocks if locks were taken in item order
+	const attempts = 40
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		items := []models.CreateOrderItem{
+			{ProductID: firstID, Quantity: 1},
+			{ProductID: secondID, Quantity: 1},
+		}
+		if i%2 == 1 {
+			items[0], items[1] = items[1], items[0]
+		}
+		body, _ := json.Marshal(models.CreateOrderRequest{CustomerID: customerID, Items: items})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", "/orders", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	created, conflicts := 0, 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			conflicts++
+		default:
+			t.Errorf("Unexpected status %d", code)
+		}
+	}
+	if created != 10 || conflicts != attempts-10 {
+		t.Errorf("Expected 10 orders and %d conflicts, got %d and %d", attempts-10, created, conflicts)
+	}
+
+	for _, id := range []int64{firstID, secondID} {
+		if stock := getTestProduct(t, router, id).Stock; stock != 0 {
+			t.Errorf("Expected product %d to be sold out, got stock %d", id, stock)
+		}
+	}
+
+	var sold int
+	if err := pool.QueryRow(context.Background(), "SELECT COALESCE(SUM(quantity), 0) FROM order_items WHERE product_id = $1", firstID).Scan(&sold); err != nil {
+		t.Fatalf("Failed to count sold items: %v", err)
+	}
+	if sold != 10 {
+		t.Errorf("Expected 10 items sold, got %d", sold)
+	}
 }
 
-// Benchmark tests to generate load for OBI testing
-func BenchmarkCreateOrder(b *testing.B) {
-	pool := setupTestDB(&testing.T{})
+func TestGetOrder(t *testing.T) {
+	pool := setupTestDB(t)
 	defer pool.Close()
 
 	router := setupRouter(pool)
-	customerID := createTestCustomer(&testing.T{}, router, "Bench User", fmt.Sprintf("bench%d@example.com", time.Now().Unix()))
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		order := models.CreateOrderRequest{
-			CustomerID: customerID,
-			Items: []models.CreateOrderItem{
-				{ProductID: int64(i % 100), Quantity: i%10 + 1, Price: float64(i%100) + 9.99},
-			},
+	// Create customer and order
+	customerID := createTestCustomer(t, router, "Test User", "test@example.com")
+	orderID := createTestOrder(t, router, customerID)
+
+	// Get the order
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/orders/%d", orderID), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var response models.OrderWithItems
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	if response.ID != orderID {
+		t.Errorf("Expected order ID %d, got %d", orderID, response.ID)
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+
+	// Create customer and order
+	customerID := createTestCustomer(t, router, "Test User", "test@example.com")
+	orderID := createTestOrder(t, router, customerID)
+
+	// Ship the order
+	for _, status := range []models.OrderStatus{models.OrderStatusProcessing, models.OrderStatusShipped} {
+		if w := updateTestOrderStatus(t, router, orderID, status); w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 moving to %s, got %d", status, w.Code)
 		}
+	}
 
-		body, _ := json.Marshal(order)
-		req, _ := http.NewRequest("POST", "/orders", bytes.NewBuffer(body))
-		req.Header.Set("Content-Type", "application/json")
-		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+	// Verify the status was updated
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/orders/%d", orderID), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response models.OrderWithItems
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	if response.Status != models.OrderStatusShipped {
+		t.Errorf("Expected status 'shipped', got %s", response.Status)
+	}
+}
+
+func TestOrderStatusTransitions(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+
+	customerID := createTestCustomer(t, router, "Transition User", "transition@example.com")
+	productID := createTestProduct(t, router, "Widget", usd("5.00"), 10)
+	orderID := createTestOrderFor(t, router, customerID, productID, 3)
+
+	// Skipping processing is not allowed
+	w := updateTestOrderStatus(t, router, orderID, models.OrderStatusShipped)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var conflict struct {
+		CurrentStatus models.OrderStatus   `json:"current_status"`
+		Allowed       []models.OrderStatus `json:"allowed"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &conflict)
+	if conflict.CurrentStatus != models.OrderStatusPending || fmt.Sprint(conflict.Allowed) != "[processing cancelled]" {
+		t.Errorf("Unexpected conflict response: %s", w.Body.String())
+	}
+
+	// Unknown statuses are rejected before reaching the database
+	if w := updateTestOrderStatus(t, router, orderID, models.OrderStatus("lost")); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown status, got %d", w.Code)
+	}
+
+	// Missing orders
+	if w := updateTestOrderStatus(t, router, 999999, models.OrderStatusProcessing); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing order, got %d", w.Code)
+	}
+
+	// Cancelling returns the items to stock and is final
+	body, _ := json.Marshal(models.UpdateOrderStatusRequest{
+		Status: models.OrderStatusCancelled,
+		Actor:  "support:alice",
+		Reason: "customer request",
+	})
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/orders/%d/status", orderID), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if stock := getTestProduct(t, router, productID).Stock; stock != 10 {
+		t.Errorf("Expected stock 10 after cancelling, got %d", stock)
+	}
+	if w := updateTestOrderStatus(t, router, orderID, models.OrderStatusPending); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 reopening a cancelled order, got %d", w.Code)
+	}
+
+	// History
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/orders/%d/history", orderID), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var history struct {
+		History []models.OrderStatusChange `json:"history"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &history)
+
+	if len(history.History) != 2 {
+		t.Fatalf("Expected 2 history entries, got %s", w.Body.String())
+	}
+	created, cancelled := history.History[0], history.History[1]
+	if created.FromStatus != nil || created.ToStatus != models.OrderStatusPending {
+		t.Errorf("Unexpected creation entry: %+v", created)
+	}
+	if *cancelled.FromStatus != models.OrderStatusPending || cancelled.ToStatus != models.OrderStatusCancelled ||
+		cancelled.Actor != "support:alice" || cancelled.Reason != "customer request" {
+		t.Errorf("Unexpected cancellation entry: %+v", cancelled)
+	}
+
+	req, _ = http.NewRequest("GET", "/orders/999999/history", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing order, got %d", w.Code)
+	}
+}
+
+func TestConcurrentStatusTransitions(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+
+	customerID := createTestCustomer(t, router, "Race User", "race@example.com")
+	productID := createTestProduct(t, router, "Widget", usd("5.00"), 10)
+	orderID := createTestOrderFor(t, router, customerID, productID, 1)
+
+	// Processing and cancelling race; exactly one wins
+	codes := make(chan int, 2)
+	for _, status := range []models.OrderStatus{models.OrderStatusProcessing, models.OrderStatusCancelled} {
+		go func(status models.OrderStatus) {
+			codes <- updateTestOrderStatus(t, router, orderID, status).Code
+		}(status)
+	}
+
+	// processing -> cancelled is also legal, so both succeed if processing
+	// wins; if cancelling wins, processing is refused
+	succeeded := 0
+	for i := 0; i < 2; i++ {
+		switch code := <-codes; code {
+		case http.StatusOK:
+			succeeded++
+		case http.StatusConflict:
+		default:
+			t.Errorf("Unexpected status %d", code)
+		}
+	}
+	if succeeded == 0 {
+		t.Fatal("Expected at least one transition to succeed")
+	}
+
+	// One entry for the creation plus one per successful transition
+	var entries int
+	if err := pool.QueryRow(context.Background(), "SELECT COUNT(*) FROM order_status_history WHERE order_id = $1", orderID).Scan(&entries); err != nil {
+		t.Fatalf("Failed to count history: %v", err)
+	}
+	if entries != 1+succeeded {
+		t.Errorf("Expected %d history entries, got %d", 1+succeeded, entries)
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+	ctx := context.Background()
+
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		for _, path := range []string{"/customers/999999", "/orders/999999", "/orders/999999?include_customer=true", "/products/999999"} {
+			if w := do("GET", path, nil); w.Code != http.StatusNotFound {
+				t.Errorf("GET %s: expected status 404, got %d", path, w.Code)
+			}
+		}
+	})
+
+	t.Run("unique violation", func(t *testing.T) {
+		createTestCustomer(t, router, "First", "dup@example.com")
+		w := do("POST", "/customers", map[string]string{"name": "Second", "email": "dup@example.com"})
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status 409 for a duplicate email, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("foreign key violation", func(t *testing.T) {
+		productID := createTestProduct(t, router, "Orphan Widget", usd("1.00"), 10)
+		w := do("POST", "/orders", models.CreateOrderRequest{
+			CustomerID: 999999,
+			Items:      []models.CreateOrderItem{{ProductID: productID, Quantity: 1}},
+		})
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for an unknown customer, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("check violation", func(t *testing.T) {
+		// The HTTP layer rejects negative stock, so go through the repository
+		productID := createTestProduct(t, router, "Checked Widget", usd("1.00"), 10)
+		repo := repository.NewProductRepository(pool)
+		_, err := repo.Update(ctx, productID, &models.ProductRequest{Name: "Checked Widget", Price: usd("1.00"), Stock: -1})
+		if !errors.Is(err, repository.ErrCheckViolation) {
+			t.Errorf("Expected ErrCheckViolation, got %v", err)
+		}
+	})
+
+	t.Run("lock timeout", func(t *testing.T) {
+		customerID := createTestCustomer(t, router, "Locked", "locked@example.com")
+		orderID := createTestOrder(t, router, customerID)
+
+		impatient := newTestPool(t, "lock_timeout=100ms")
+		defer impatient.Close()
+
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		defer tx.Rollback(ctx)
+		if _, err := tx.Exec(ctx, "SELECT 1 FROM orders WHERE id = $1 FOR UPDATE", orderID); err != nil {
+			t.Fatalf("Failed to lock order: %v", err)
+		}
+
+		w := updateTestOrderStatus(t, setupRouter(impatient), orderID, models.OrderStatusProcessing)
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected status 503 with Retry-After, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("serialization failure", func(t *testing.T) {
+		customerID := createTestCustomer(t, router, "Serial", "serial@example.com")
+		orderID := createTestOrder(t, router, customerID)
+
+		serializable := newTestPool(t, "default_transaction_isolation=serializable")
+		defer serializable.Close()
+
+		// Hold a concurrent, uncommitted update of the order
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		defer tx.Rollback(ctx)
+		if _, err := tx.Exec(ctx, "UPDATE orders SET updated_at = CURRENT_TIMESTAMP WHERE id = $1", orderID); err != nil {
+			t.Fatalf("Failed to update order: %v", err)
+		}
+
+		// The request's snapshot predates the commit below, so its update
+		// cannot be serialized once the lock is released
+		result := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			result <- updateTestOrderStatus(t, setupRouter(serializable), orderID, models.OrderStatusProcessing)
+		}()
+		waitForLockWait(t, pool)
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+
+		if w := <-result; w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected status 503 with Retry-After, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("database unavailable", func(t *testing.T) {
+		// Nothing listens on port 1; connections are only attempted per request
+		down, err := pgxpool.New(ctx, "host=localhost port=1 user=postgres password=postgres dbname=orders_test sslmode=disable connect_timeout=1")
+		if err != nil {
+			t.Fatalf("Failed to create pool: %v", err)
+		}
+		defer down.Close()
+
+		req, _ := http.NewRequest("GET", "/customers/1", nil)
+		w := httptest.NewRecorder()
+		setupRouter(down).ServeHTTP(w, req)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503 when the database is down, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestOutbox(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+	ctx := context.Background()
+
+	customerID := createTestCustomer(t, router, "Outbox User", "outbox@example.com")
+	productID := createTestProduct(t, router, "Widget", usd("10.00"), 5)
+
+	publisher := outbox.NewMemoryPublisher()
+	relay := outbox.NewRelay(pool, publisher, outbox.Config{MinBackoff: time.Hour})
+
+	// drain publishes until nothing is due and returns the new messages
+	drain := func() []outbox.Message {
+		before := len(publisher.Messages())
+		for {
+			n, err := relay.ProcessBatch(ctx)
+			if err != nil {
+				t.Fatalf("ProcessBatch failed: %v", err)
+			}
+			if n == 0 {
+				return publisher.Messages()[before:]
+			}
+		}
+	}
+
+	t.Run("events follow the order", func(t *testing.T) {
+		orderID := createTestOrderFor(t, router, customerID, productID, 2)
+		if w := updateTestOrderStatus(t, router, orderID, models.OrderStatusCancelled); w.Code != http.StatusOK {
+			t.Fatalf("Failed to cancel order: %d %s", w.Code, w.Body.String())
+		}
+
+		messages := drain()
+		if len(messages) != 2 {
+			t.Fatalf("Expected 2 messages, got %d", len(messages))
+		}
+
+		var created, cancelled outbox.OrderEvent
+		json.Unmarshal(messages[0].Payload, &created)
+		json.Unmarshal(messages[1].Payload, &cancelled)
+		if messages[0].Topic != "orders.created" || created.Type != outbox.OrderCreated || created.Status != "pending" {
+			t.Errorf("Unexpected first message %s: %+v", messages[0].Topic, created)
+		}
+		if messages[1].Topic != "orders.cancelled" || cancelled.Type != outbox.OrderCancelled || cancelled.Status != "cancelled" {
+			t.Errorf("Unexpected second message %s: %+v", messages[1].Topic, cancelled)
+		}
+		if created.OrderID != fmt.Sprint(orderID) || messages[0].Key != created.OrderID || created.CustomerID != fmt.Sprint(customerID) {
+			t.Errorf("Unexpected IDs in %+v", created)
+		}
+		if created.Total != 20.00 || len(created.Items) != 1 || created.Items[0].Name != "Widget" {
+			t.Errorf("Unexpected order details in %+v", created)
+		}
+		if len(cancelled.Items) != 1 || cancelled.Items[0].Quantity != 2 {
+			t.Errorf("Unexpected items in %+v", cancelled)
+		}
+
+		var unsent int
+		if err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM outbox WHERE sent_at IS NULL").Scan(&unsent); err != nil {
+			t.Fatalf("Failed to count unsent messages: %v", err)
+		}
+		if unsent != 0 {
+			t.Errorf("Expected every message to be marked sent, %d are not", unsent)
+		}
+	})
+
+	t.Run("rolled back changes are not published", func(t *testing.T) {
+		order := models.CreateOrderRequest{
+			CustomerID: customerID,
+			Items:      []models.CreateOrderItem{{ProductID: productID, Quantity: 100}},
+		}
+		body, _ := json.Marshal(order)
+		req, _ := http.NewRequest("POST", "/orders", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("Expected status 409, got %d", w.Code)
+		}
+
+		if messages := drain(); len(messages) != 0 {
+			t.Errorf("Expected no messages, got %d", len(messages))
+		}
+	})
+
+	t.Run("a claimed batch is published in one call", func(t *testing.T) {
+		createTestOrderFor(t, router, customerID, productID, 1)
+		createTestOrderFor(t, router, customerID, productID, 1)
+
+		before := publisher.Batches()
+		if messages := drain(); len(messages) != 2 {
+			t.Fatalf("Expected 2 messages, got %d", len(messages))
+		}
+		if calls := publisher.Batches() - before; calls != 1 {
+			t.Errorf("Expected the batch to be published with 1 call, got %d", calls)
+		}
+	})
+
+	t.Run("failed messages are retried with backoff", func(t *testing.T) {
+		orderID := createTestOrderFor(t, router, customerID, productID, 1)
+		if w := updateTestOrderStatus(t, router, orderID, models.OrderStatusProcessing); w.Code != http.StatusOK {
+			t.Fatalf("Failed to update order: %d %s", w.Code, w.Body.String())
+		}
+
+		publisher.FailWith(func(outbox.Message) error { return errors.New("broker down") })
+		if messages := drain(); len(messages) != 0 {
+			t.Fatalf("Expected no messages while the broker is down, got %d", len(messages))
+		}
+
+		// Only the created event was attempted; the update waits behind it
+		var attempts int
+		var lastError string
+		var backingOff bool
+		err := pool.QueryRow(ctx, `
+			SELECT attempts, last_error, next_attempt_at > CURRENT_TIMESTAMP
+			FROM outbox WHERE key = $1 ORDER BY id LIMIT 1`, fmt.Sprint(orderID)).Scan(&attempts, &lastError, &backingOff)
+		if err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		if attempts != 1 || lastError != "broker down" || !backingOff {
+			t.Errorf("Expected one failed attempt backing off, got attempts=%d last_error=%q backing off=%v", attempts, lastError, backingOff)
+		}
+
+		// Still backing off once the broker recovers
+		publisher.FailWith(nil)
+		if messages := drain(); len(messages) != 0 {
+			t.Fatalf("Expected no messages during backoff, got %d", len(messages))
+		}
+
+		if _, err := pool.Exec(ctx, "UPDATE outbox SET next_attempt_at = CURRENT_TIMESTAMP WHERE key = $1", fmt.Sprint(orderID)); err != nil {
+			t.Fatalf("Failed to end backoff: %v", err)
+		}
+		messages := drain()
+		if len(messages) != 2 || messages[0].Topic != "orders.created" || messages[1].Topic != "orders.updated" {
+			t.Fatalf("Expected the created and updated events in order, got %+v", messages)
+		}
+		if messages[0].Attempts != 1 {
+			t.Errorf("Expected the created event to be on its second attempt, got %d previous attempts", messages[0].Attempts)
+		}
+	})
+}
+
+func TestOutboxConcurrentRelays(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+	ctx := context.Background()
+
+	customerID := createTestCustomer(t, router, "Relay User", "relay@example.com")
+	productID := createTestProduct(t, router, "Widget", usd("1.00"), 1000)
+
+	const orders = 20
+	for i := 0; i < orders; i++ {
+		orderID := createTestOrderFor(t, router, customerID, productID, 1)
+		updateTestOrderStatus(t, router, orderID, models.OrderStatusProcessing)
+		updateTestOrderStatus(t, router, orderID, models.OrderStatusShipped)
+	}
+
+	// Relays sharing the table never publish a message twice or a key out
+	// of order
+	publisher := outbox.NewMemoryPublisher()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			relay := outbox.NewRelay(pool, publisher, outbox.Config{BatchSize: 5})
+			for idle := 0; idle < 3; {
+				n, err := relay.ProcessBatch(ctx)
+				if err != nil {
+					t.Errorf("ProcessBatch failed: %v", err)
+					return
+				}
+				if n == 0 {
+					idle++
+					time.Sleep(20 * time.Millisecond)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	messages := publisher.Messages()
+	if len(messages) != orders*3 {
+		t.Errorf("Expected %d messages, got %d", orders*3, len(messages))
+	}
+	seen := make(map[int64]bool)
+	last := make(map[string]int64)
+	for _, msg := range messages {
+		if seen[msg.ID] {
+			t.Errorf("Message %d was published twice", msg.ID)
+		}
+		seen[msg.ID] = true
+		if msg.ID < last[msg.Key] {
+			t.Errorf("Message %d for key %s was published after message %d", msg.ID, msg.Key, last[msg.Key])
+		}
+		last[msg.Key] = msg.ID
+	}
+}
+
+func TestNPlusOneDetection(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+
+	customerID := createTestCustomer(t, router, "N+1 User", "nplusone@example.com")
+	productID := createTestProduct(t, router, "Widget", usd("2.50"), 100)
+	const orders = 12
+	for i := 0; i < orders; i++ {
+		createTestOrderFor(t, router, customerID, productID, i+1)
+	}
+
+	get := func(path string) (*httptest.ResponseRecorder, []models.OrderWithItems) {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected status 200, got %d", path, w.Code)
+		}
+		var response struct {
+			Orders []models.OrderWithItems `json:"orders"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response.Orders
+	}
+
+	slow, slowOrders := get(fmt.Sprintf("/customers/%d/orders/slow", customerID))
+	if got := slow.Header().Get(handlers.HeaderNPlusOneQuery); got != "true" {
+		t.Errorf("Expected the slow endpoint to be flagged, got %q", got)
+	}
+	// One query for the orders, then two per order
+	if got, want := slow.Header().Get(handlers.HeaderQueryCount), fmt.Sprint(1+2*orders); got != want {
+		t.Errorf("Expected %s queries for the slow endpoint, got %s", want, got)
+	}
+
+	fast, fastOrders := get(fmt.Sprintf("/customers/%d/orders/optimized", customerID))
+	if got := fast.Header().Get(handlers.HeaderNPlusOneQuery); got != "" {
+		t.Errorf("Expected the optimized endpoint not to be flagged, got %q", got)
+	}
+	if got := fast.Header().Get(handlers.HeaderQueryCount); got != "1" {
+		t.Errorf("Expected 1 query for the optimized endpoint, got %s", got)
+	}
+
+	if len(fastOrders) != orders || len(slowOrders) != orders {
+		t.Fatalf("Expected %d orders from both endpoints, got %d and %d", orders, len(slowOrders), len(fastOrders))
+	}
+	for i := range slowOrders {
+		s, f := slowOrders[i], fastOrders[i]
+		if s.ID != f.ID || s.Total != f.Total || len(s.Items) != len(f.Items) {
+			t.Fatalf("Order %d differs: %+v vs %+v", i, s, f)
+		}
+		for j := range s.Items {
+			si, fi := s.Items[j], f.Items[j]
+			if si.ID != fi.ID || si.ProductID != fi.ProductID || si.Quantity != fi.Quantity || si.Price != fi.Price || !si.CreatedAt.Equal(fi.CreatedAt) {
+				t.Errorf("Item %d of order %d differs: %+v vs %+v", j, s.ID, si, fi)
+			}
+		}
+	}
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	setupTestDB(t).Close()
+
+	// Every query is slow, and explained whenever no EXPLAIN is running
+	slowQueries := db.NewSlowQueryLog(db.SlowQueryConfig{Threshold: time.Nanosecond, ExplainSampleRate: 1})
+	pool, err := db.NewPool(context.Background(), db.Config{
+		Host:        getEnvOrDefault("TEST_DB_HOST", "localhost"),
+		Port:        5432,
+		User:        "postgres",
+		Password:    "postgres",
+		Database:    "orders_test",
+		SSLMode:     "disable",
+		SlowQueries: slowQueries,
+	})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer pool.Close()
+
+	router := setupRouter(pool)
+	debugHandler := handlers.NewDebugHandler(slowQueries)
+	router.GET("/debug/queries", debugHandler.Queries)
+
+	customerID := createTestCustomer(t, router, "Slow User", "slow@example.com")
+	createTestOrder(t, router, customerID)
+
+	find := func(caller string) *db.SlowQuery {
+		for _, q := range slowQueries.Top() {
+			if q.Caller == caller {
+				return &q
+			}
+		}
+		return nil
+	}
+
+	// An EXPLAIN that is still running makes others be skipped, so retry
+	const listCaller = "repository.(*OrderRepository).ListByCustomerPage"
+	var list *db.SlowQuery
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/customers/%d/orders", customerID), nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		if list = find(listCaller); list != nil && list.Plan != nil {
+			break
+		}
+	}
+	if list == nil || list.Plan == nil {
+		t.Fatalf("Expected a plan for %s, got %+v", listCaller, list)
+	}
+
+	var plan []map[string]any
+	if err := json.Unmarshal(list.Plan, &plan); err != nil || len(plan) != 1 || plan[0]["Plan"] == nil {
+		t.Errorf("Expected an EXPLAIN JSON plan, got %s (%v)", list.Plan, err)
+	}
+	if list.Count == 0 || list.LastRows != 1 {
+		t.Errorf("Unexpected stats %+v", list)
+	}
+	// The plan was made with the customer ID but does not keep it
+	if p := string(list.Plan); strings.Contains(p, "customer_id = '") || strings.Contains(p, fmt.Sprintf("customer_id = %d", customerID)) {
+		t.Errorf("Expected the customer ID to be redacted from the plan, got %s", p)
+	}
+
+	// Writes are recorded but never run again
+	insert := find("repository.(*CustomerRepository).Create")
+	if insert == nil {
+		t.Fatal("Expected the customer insert to be recorded")
+	}
+	if insert.Plan != nil {
+		t.Error("Expected no plan for an INSERT")
+	}
+	var customers int
+	if err := pool.QueryRow(context.Background(), "SELECT COUNT(*) FROM customers").Scan(&customers); err != nil || customers != 1 {
+		t.Errorf("Expected 1 customer, got %d (%v)", customers, err)
+	}
+
+	req, _ := http.NewRequest("GET", "/debug/queries", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var response struct {
+		Queries []db.SlowQuery `json:"queries"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK || len(response.Queries) == 0 {
+		t.Errorf("Unexpected /debug/queries response %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestKeysetPagination(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+	ctx := context.Background()
+
+	get := func(path string, response any) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if response != nil && w.Code == http.StatusOK {
+			json.Unmarshal(w.Body.Bytes(), response)
+		}
+		return w
+	}
+
+	// Customers sharing a timestamp are still paged in a stable order
+	_, err := pool.Exec(ctx, `
+		INSERT INTO customers (name, email, created_at)
+		SELECT 'Page User ' || i, 'page' || i || '@example.com', '2024-01-01T00:00:00Z'
+		FROM generate_series(1, 7) AS i`)
+	if err != nil {
+		t.Fatalf("Failed to insert customers: %v", err)
+	}
+	createTestCustomer(t, router, "Alice_Smith", "alice@example.com")
+	createTestCustomer(t, router, "Alicex", "ALICE.X@example.com")
+
+	t.Run("customers", func(t *testing.T) {
+		seen := make(map[int64]bool)
+		path := "/customers?limit=2"
+		pages := 0
+		for {
+			var page struct {
+				Customers  []models.Customer `json:"customers"`
+				NextCursor *string           `json:"next_cursor"`
+			}
+			if w := get(path, &page); w.Code != http.StatusOK {
+				t.Fatalf("GET %s: expected status 200, got %d", path, w.Code)
+			}
+			pages++
+			for _, customer := range page.Customers {
+				if seen[customer.ID] {
+					t.Errorf("Customer %d was listed twice", customer.ID)
+				}
+				seen[customer.ID] = true
+			}
+			if page.NextCursor == nil {
+				break
+			}
+			path = "/customers?limit=2&cursor=" + *page.NextCursor
+		}
+		if len(seen) != 9 || pages != 5 {
+			t.Errorf("Expected 9 customers on 5 pages, got %d on %d", len(seen), pages)
+		}
+	})
+
+	t.Run("deprecated offset", func(t *testing.T) {
+		var first, skipped struct {
+			Customers []models.Customer `json:"customers"`
+		}
+		get("/customers?limit=3", &first)
+		w := get("/customers?limit=2&offset=1", &skipped)
+		if w.Code != http.StatusOK || w.Header().Get("Deprecation") == "" {
+			t.Fatalf("Expected status 200 with a Deprecation header, got %d %v", w.Code, w.Header())
+		}
+		if len(first.Customers) != 3 || len(skipped.Customers) != 2 || skipped.Customers[0].ID != first.Customers[1].ID || skipped.Customers[1].ID != first.Customers[2].ID {
+			t.Errorf("Expected offset 1 to skip the first customer, got %+v", skipped.Customers)
+		}
+	})
+
+	t.Run("customer filters", func(t *testing.T) {
+		var page struct {
+			Customers []models.Customer `json:"customers"`
+		}
+		get("/customers?name_prefix=alice_", &page)
+		if len(page.Customers) != 1 || page.Customers[0].Name != "Alice_Smith" {
+			t.Errorf("Expected the underscore to match literally, got %+v", page.Customers)
+		}
+		get("/customers?email_prefix=alice.", &page)
+		if len(page.Customers) != 1 || page.Customers[0].Name != "Alicex" {
+			t.Errorf("Expected a case-insensitive email match, got %+v", page.Customers)
+		}
+	})
+
+	t.Run("order filters", func(t *testing.T) {
+		customerID := createTestCustomer(t, router, "Filter User", "filter@example.com")
+		productID := createTestProduct(t, router, "Widget", usd("10.00"), 100)
+		var orderIDs []int64
+		for i := 1; i <= 5; i++ {
+			orderIDs = append(orderIDs, createTestOrderFor(t, router, customerID, productID, i))
+		}
+		updateTestOrderStatus(t, router, orderIDs[0], models.OrderStatusCancelled)
+		updateTestOrderStatus(t, router, orderIDs[1], models.OrderStatusProcessing)
+		if _, err := pool.Exec(ctx, "UPDATE orders SET created_at = '2023-06-01T00:00:00Z' WHERE id = $1", orderIDs[4]); err != nil {
+			t.Fatalf("Failed to backdate order: %v", err)
+		}
+
+		ids := func(query string) []int64 {
+			var page struct {
+				Orders []models.Order `json:"orders"`
+			}
+			path := fmt.Sprintf("/customers/%d/orders?%s", customerID, query)
+			if w := get(path, &page); w.Code != http.StatusOK {
+				t.Fatalf("GET %s: expected status 200, got %d", path, w.Code)
+			}
+			var ids []int64
+			for _, order := range page.Orders {
+				ids = append(ids, order.ID)
+			}
+			return ids
+		}
+
+		tests := []struct {
+			query string
+			want  []int64
+		}{
+			{"status=cancelled,processing", []int64{orderIDs[1], orderIDs[0]}},
+			{"min_total=20&max_total=40", []int64{orderIDs[3], orderIDs[2], orderIDs[1]}},
+			{"created_before=2024-01-01T00:00:00Z", []int64{orderIDs[4]}},
+			{"created_after=2024-01-01T00:00:00Z&status=pending", []int64{orderIDs[3], orderIDs[2]}},
+		}
+		for _, tt := range tests {
+			if got := ids(tt.query); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("%s: expected orders %v, got %v", tt.query, tt.want, got)
+			}
+		}
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, path := range []string{"/customers?limit=1000", "/customers?offset=-1", "/customers?cursor=garbage", "/customers/1/orders?status=lost"} {
+			if w := get(path, nil); w.Code != http.StatusBadRequest {
+				t.Errorf("GET %s: expected status 400, got %d", path, w.Code)
+			}
+		}
+	})
+}
+
+func TestOrderStats(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+
+	router := setupRouter(pool)
+
+	// Create customer and multiple orders
+	customerID := createTestCustomer(t, router, "Stats User", "stats@example.com")
+	createTestOrder(t, router, customerID)
+	createTestOrder(t, router, customerID)
+
+	// Get stats
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/customers/%d/orders/stats", customerID), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var stats map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+
+	totalOrders := int64(stats["total_orders"].(float64))
+	if totalOrders != 2 {
+		t.Errorf("Expected 2 total orders, got %d", totalOrders)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	pool := setupTestDB(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	migrator, err := migrate.New(pool, migrations.FS)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	tableExists := func(name string) bool {
+		var exists bool
+		if err := pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists); err != nil {
+			t.Fatalf("Failed to check table %s: %v", name, err)
+		}
+		return exists
+	}
+
+	// setupTestDB applied everything; a second Up is a no-op
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Expected repeated Up to succeed, got %v", err)
+	}
+
+	if err := migrator.Down(ctx, 1); err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	last := len(statuses) - 1
+	if statuses[last].Applied || !statuses[last-1].Applied {
+		t.Errorf("Expected Down to roll back only the latest migration, got %+v", statuses)
+	}
+
+	if err := migrator.To(ctx, 1); err != nil {
+		t.Fatalf("To(1) failed: %v", err)
+	}
+	if tableExists("orders") || !tableExists("customers") {
+		t.Error("Expected To(1) to drop orders and keep customers")
+	}
+
+	if err := migrator.To(ctx, 0); err != nil {
+		t.Fatalf("To(0) failed: %v", err)
+	}
+	if tableExists("customers") {
+		t.Error("Expected To(0) to drop customers")
+	}
+
+	// Concurrent replicas apply each migration once
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() { errs <- migrator.Up(ctx) }()
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Concurrent Up failed: %v", err)
+		}
+	}
+	if !tableExists("orders") {
+		t.Error("Expected Up to create orders")
+	}
+
+	// An edited migration is refused until forced
+	if _, err := pool.Exec(ctx, "UPDATE schema_migrations SET checksum = repeat('0', 64) WHERE version = 1"); err != nil {
+		t.Fatalf("Failed to tamper with checksum: %v", err)
+	}
+	if err := migrator.Verify(ctx); !errors.Is(err, migrate.ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	if err := migrator.Up(ctx); !errors.Is(err, migrate.ErrChecksumMismatch) {
+		t.Errorf("Expected Up to refuse a modified migration, got %v", err)
+	}
+	if err := migrator.Force(ctx, migrator.Latest()); err != nil {
+		t.Fatalf("Force failed: %v", err)
+	}
+	if err := migrator.Verify(ctx); err != nil {
+		t.Errorf("Expected Force to accept the current checksums, got %v", err)
+	}
+}
+
+// Helper functions
+func createTestCustomer(t *testing.T, router *gin.Engine, name, email string) int64 {
+	customer := map[string]string{
+		"name":  name,
+		"email": email,
+	}
+
+	body, _ := json.Marshal(customer)
+	req, _ := http.NewRequest("POST", "/customers", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response models.Customer
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response.ID
+}
+
+// usd parses a test amount in the default currency
+func usd(s string) money.Money {
+	m, err := money.Parse(s, money.DefaultCurrency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func createTestProduct(t *testing.T, router *gin.Engine, name string, price money.Money, stock int) int64 {
+	product := models.ProductRequest{
+		Name:  name,
+		Price: price,
+		Stock: stock,
+	}
+
+	body, _ := json.Marshal(product)
+	req, _ := http.NewRequest("POST", "/products", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to create product: %d %s", w.Code, w.Body.String())
+	}
+
+	var response models.Product
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response.ID
+}
+
+func getTestProduct(t *testing.T, router *gin.Engine, id int64) models.Product {
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/products/%d", id), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to get product %d: %d %s", id, w.Code, w.Body.String())
+	}
+
+	var response models.Product
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+func createTestOrder(t *testing.T, router *gin.Engine, customerID int64) int64 {
+	productID := createTestProduct(t, router, "Test Product", usd("99.99"), 100)
+	return createTestOrderFor(t, router, customerID, productID, 1)
+}
+
+func createTestOrderFor(t *testing.T, router *gin.Engine, customerID, productID int64, quantity int) int64 {
+	order := models.CreateOrderRequest{
+		CustomerID: customerID,
+		Items: []models.CreateOrderItem{
+			{ProductID: productID, Quantity: quantity},
+		},
+	}
+
+	body, _ := json.Marshal(order)
+	req, _ := http.NewRequest("POST", "/orders", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response models.OrderWithItems
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response.ID
+}
+
+func updateTestOrderStatus(t *testing.T, router *gin.Engine, orderID int64, status models.OrderStatus) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.UpdateOrderStatusRequest{Status: status})
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/orders/%d/status", orderID), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// newTestPool connects to the test database with extra session settings,
+// e.g. "lock_timeout=100ms"
+func newTestPool(t *testing.T, settings string) *pgxpool.Pool {
+	dsn := fmt.Sprintf("host=%s port=5432 user=postgres password=postgres dbname=orders_test sslmode=disable %s",
+		getEnvOrDefault("TEST_DB_HOST", "localhost"), settings)
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	return pool
+}
+
+// waitForLockWait waits until some session is blocked on a lock
+func waitForLockWait(t *testing.T, pool *pgxpool.Pool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var waiting int
+		err := pool.QueryRow(context.Background(),
+			"SELECT COUNT(*) FROM pg_stat_activity WHERE datname = current_database() AND wait_event_type = 'Lock'").Scan(&waiting)
+		if err != nil {
+			t.Fatalf("Failed to query pg_stat_activity: %v", err)
+		}
+		if waiting > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for a blocked session")
+}
+
+func getEnvOrDefault(key, defaultValue string) string {
+	// In a real implementation, this would check os.Getenv
+	return defaultValue
+}
+
+// Benchmark tests to generate load for OBI testing
+func BenchmarkCreateOrder(b *testing.B) {
+	pool := setupTestDB(&testing.T{})
+	defer pool.Close()
+
+	router := setupRouter(pool)
+	customerID := createTestCustomer(&testing.T{}, router, "Bench User", fmt.Sprintf("bench%d@example.com", time.Now().Unix()))
+	productIDs := make([]int64, 100)
+	for i := range productIDs {
+		productIDs[i] = createTestProduct(&testing.T{}, router, fmt.Sprintf("Bench Product %d", i), money.New(int64(i)*100+999, money.DefaultCurrency), 1000000)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		order := models.CreateOrderRequest{
+			CustomerID: customerID,
+			Items: []models.CreateOrderItem{
+				{ProductID: productIDs[i%100], Quantity: i%10 + 1},
+			},
+		}
+
+		body, _ := json.Marshal(order)
+		req, _ := http.NewRequest("POST", "/orders", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+	}
+}
+
+// BenchmarkDeepPage compares fetching a page deep into a customer's orders
+// with OFFSET and with a keyset cursor
+func BenchmarkDeepPage(b *testing.B) {
+	pool := setupTestDB(&testing.T{})
+	defer pool.Close()
+
+	ctx := context.Background()
+	repo := repository.NewOrderRepository(pool)
+
+	var customerID int64
+	err := pool.QueryRow(ctx, "INSERT INTO customers (name, email) VALUES ('Deep User', 'deep@example.com') RETURNING id").Scan(&customerID)
+	if err != nil {
+		b.Fatalf("Failed to create customer: %v", err)
+	}
+	_, err = pool.Exec(ctx, `
+		INSERT INTO orders (customer_id, total, created_at)
+		SELECT $1, i % 100, TIMESTAMPTZ '2024-01-01' + i * INTERVAL '1 second'
+		FROM generate_series(1, 50000) AS i`, customerID)
+	if err != nil {
+		b.Fatalf("Failed to create orders: %v", err)
+	}
+	if _, err := pool.Exec(ctx, "ANALYZE orders"); err != nil {
+		b.Fatalf("Failed to analyze orders: %v", err)
+	}
+
+	const limit = 20
+	for _, depth := range []int{0, 1000, 10000, 49000} {
+		// The cursor for the page at depth is the row just before it
+		var cursor *models.Cursor
+		if depth > 0 {
+			cursor = &models.Cursor{}
+			err := pool.QueryRow(ctx, `
+				SELECT created_at, id FROM orders WHERE customer_id = $1
+				ORDER BY created_at DESC, id DESC OFFSET $2 LIMIT 1`, customerID, depth-1).Scan(&cursor.CreatedAt, &cursor.ID)
+			if err != nil {
+				b.Fatalf("Failed to find cursor: %v", err)
+			}
+		}
+
+		b.Run(fmt.Sprintf("offset/%d", depth), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.ListByCustomer(ctx, customerID, limit, depth); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("keyset/%d", depth), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := repo.ListByCustomerPage(ctx, customerID, models.OrderFilter{After: cursor, Limit: limit}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
 	}
 }
@@ -2,13 +2,12 @@ module github.com/raibid-labs/mop/load-generators/01-http
 
 go 1.21
 
-require (
-	github.com/prometheus/client_golang v1.18.0
-)
+require github.com/prometheus/client_golang v1.18.0
 
 require (
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/matttproud/golang_protobuf_extensions/v2 v2.0.0 // indirect
 	github.com/prometheus/client_model v0.5.0 // indirect
 	github.com/prometheus/common v0.45.0 // indirect
 	github.com/prometheus/procfs v0.12.0 // indirect
@@ -10,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/raibid-labs/mop/examples/02-grpc-service/pkg/telemetry"
 	"github.com/raibid-labs/mop/load-generators/02-grpc/internal/generator"
 	"github.com/raibid-labs/mop/load-generators/02-grpc/internal/patterns"
 )
@@ -27,6 +28,8 @@ var (
 	metricsPort  = flag.Int("metrics-port", getIntEnv("METRICS_PORT", 9091), "Prometheus metrics port")
 	reportFormat = flag.String("report", getEnv("REPORT_FORMAT", "text"), "Report format: text, json")
 	insecure     = flag.Bool("insecure", getBoolEnv("INSECURE", true), "Use insecure connection")
+	otlpEndpoint = flag.String("otlp-endpoint", getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""), "OTLP/gRPC collector for traces and metrics (disabled if empty)")
+	otlpInsecure = flag.Bool("otlp-insecure", getBoolEnv("OTEL_EXPORTER_OTLP_INSECURE", false), "Connect to the OTLP collector without TLS")
 )
 
 func main() {
@@ -58,6 +61,16 @@ func main() {
 		log.Fatalf("Unknown load pattern: %s", *pattern)
 	}
 
+	// Setup OpenTelemetry export
+	shutdownTelemetry, err := telemetry.Setup(ctx, telemetry.Config{
+		ServiceName: "grpc-load-generator",
+		Endpoint:    *otlpEndpoint,
+		Insecure:    *otlpInsecure,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up telemetry: %v", err)
+	}
+
 	// Create and configure generator
 	gen, err := generator.New(generator.Config{
 		Target:      *target,
@@ -74,7 +87,11 @@ func main() {
 	defer gen.Close()
 
 	// Start metrics server
-	go gen.StartMetricsServer()
+	go func() {
+		if err := gen.StartMetricsServer(); err != nil {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
 
 	log.Printf("Starting gRPC load test against %s", *target)
 	log.Printf("Method: %s, Pattern: %s, Duration: %s", *method, *pattern, *duration)
@@ -92,6 +109,13 @@ func main() {
 		fmt.Println(results.ToString())
 	}
 
+	// Flush spans and metrics before exiting
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTelemetry(flushCtx); err != nil {
+		log.Printf("Failed to flush telemetry: %v", err)
+	}
+	flushCancel()
+
 	// Exit with error code if too many failures
 	if results.FailureRate() > 0.05 { // More than 5% failures
 		os.Exit(1)
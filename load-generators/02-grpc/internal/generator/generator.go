@@ -12,6 +12,7 @@ import (
 	"github.com/raibid-labs/mop/load-generators/02-grpc/internal/patterns"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
@@ -57,8 +58,9 @@ type Metrics struct {
 }
 
 func New(config Config) (*Generator, error) {
-	// Setup gRPC connection
-	var opts []grpc.DialOption
+	// Setup gRPC connection. The OpenTelemetry stats handler traces each
+	// request and propagates its trace context to the server.
+	opts := []grpc.DialOption{grpc.WithStatsHandler(otelgrpc.NewClientHandler())}
 	if config.Insecure {
 		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	}
@@ -270,10 +272,12 @@ func (g *Generator) calculateStatistics(results *Results) {
 	results.P99Latency = latencies[len(latencies)*99/100]
 }
 
-func (g *Generator) StartMetricsServer() {
+// StartMetricsServer serves /metrics until it fails, e.g. because the port
+// is already in use
+func (g *Generator) StartMetricsServer() error {
 	http.Handle("/metrics", promhttp.Handler())
 	addr := fmt.Sprintf(":%d", g.config.MetricsPort)
-	http.ListenAndServe(addr, nil)
+	return http.ListenAndServe(addr, nil)
 }
 
 func (r *Results) FailureRate() float64 {